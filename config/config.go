@@ -0,0 +1,659 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Environments lists the names accepted for APP_ENV / -env. Each one may have
+// a <name>.yml file in the config directory.
+var Environments = []string{"development", "test", "production"}
+
+// MfaKeySize is the length of the decoded MFA encryption key (AES-256).
+const MfaKeySize = 32
+
+// SigningKeyCipherSize is the length of the decoded key that encrypts the
+// stored token signing keys (AES-256).
+const SigningKeyCipherSize = 32
+
+// Config is the complete server configuration. Values are layered, each
+// overriding the last:
+//
+//  1. defaults (see setDefaults)
+//  2. config/<env>.yml, with ${VAR} placeholders expanded from the environment
+//  3. environment variables (see envBindings)
+//  4. secrets read from the files named by <VAR>_FILE
+//  5. command line flags
+//
+// Fields tagged secret are redacted by Print.
+type Config struct {
+	Env       string          `mapstructure:"env"`
+	Server    ServerConfig    `mapstructure:"server"`
+	GRPC      GRPCConfig      `mapstructure:"grpc"`
+	GraphQL   GraphQLConfig   `mapstructure:"graphql"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	Sessions  SessionsConfig  `mapstructure:"sessions"`
+	Mailer    MailerConfig    `mapstructure:"mailer"`
+	CORS      CORSPolicy      `mapstructure:"cors"`
+	Health    HealthConfig    `mapstructure:"health"`
+	Tracing   TracingConfig   `mapstructure:"tracing"`
+	Crash     CrashConfig     `mapstructure:"crash"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	OpenAPI   OpenAPIConfig   `mapstructure:"openapi"`
+}
+
+type ServerConfig struct {
+	Port int `mapstructure:"port"`
+	// PublicBaseURL is used to build links in emails. Defaults to
+	// http://localhost:<port>.
+	PublicBaseURL string `mapstructure:"public_base_url"`
+
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+	// ShutdownTimeout bounds how long in-flight requests, and then the
+	// lifecycle stop hooks, get after SIGTERM.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// DrainDelay keeps the listener open after SIGTERM with /readyz failing,
+	// so load balancers stop sending traffic before connections are refused.
+	DrainDelay time.Duration `mapstructure:"drain_delay"`
+}
+
+// GRPCConfig is for the gRPC server, which runs alongside the HTTP server
+// in the same process.
+type GRPCConfig struct {
+	Port int `mapstructure:"port"`
+	// Reflection lets tools like grpcurl list the services without their
+	// .proto files.
+	Reflection bool `mapstructure:"reflection"`
+}
+
+// GraphQLConfig limits what a single /graphql operation may ask for.
+type GraphQLConfig struct {
+	// MaxDepth is how deeply selections may nest.
+	MaxDepth int `mapstructure:"max_depth"`
+	// MaxComplexity caps the cost of an operation: one per field, times
+	// the page size of the connections it is selected through.
+	MaxComplexity int `mapstructure:"max_complexity"`
+	// Introspection lets clients query the schema itself.
+	Introspection bool `mapstructure:"introspection"`
+}
+
+type HealthConfig struct {
+	// CacheTTL is how long a /readyz result is reused.
+	CacheTTL     time.Duration `mapstructure:"cache_ttl"`
+	CheckTimeout time.Duration `mapstructure:"check_timeout"`
+}
+
+type TracingConfig struct {
+	// Exporter is "none", "stdout", "file" (spans appended to File) or
+	// "otlp" (OTLP over HTTP to OTLPEndpoint, e.g. a local collector).
+	Exporter     string `mapstructure:"exporter"`
+	ServiceName  string `mapstructure:"service_name"`
+	File         string `mapstructure:"file"`
+	OTLPEndpoint string `mapstructure:"otlp_endpoint"`
+	// SampleRatio is the fraction of new traces kept, from 0 to 1.
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+type CrashConfig struct {
+	// Reporter is "none", leaving recovered panics in the logs only, or
+	// "file" to also write a JSON report per panic to Dir.
+	Reporter string `mapstructure:"reporter"`
+	Dir      string `mapstructure:"dir"`
+}
+
+type RateLimitConfig struct {
+	// Store is "memory", limiting each instance separately, or "postgres"
+	// to share the limits between instances.
+	Store string `mapstructure:"store"`
+	// TrustForwardedFor takes client addresses from X-Forwarded-For. Only
+	// enable it behind a proxy that appends to the header.
+	TrustForwardedFor bool `mapstructure:"trust_forwarded_for"`
+	// PruneInterval is how often full buckets are deleted from postgres.
+	PruneInterval time.Duration `mapstructure:"prune_interval"`
+	// Default covers every limited route without a policy in Routes.
+	Default RateLimitPolicy   `mapstructure:"default"`
+	Routes  []RateLimitPolicy `mapstructure:"routes"`
+}
+
+// RateLimitPolicy allows Requests per Per, in bursts of up to Burst
+// (default Requests), counted by Key: "ip", "api_key" or "user". Zero
+// Requests turns the limit off.
+type RateLimitPolicy struct {
+	// Route is the route name, e.g. users.create. Unused for the default.
+	// gRPC methods share the limit of the route they mirror.
+	Route    string        `mapstructure:"route"`
+	Key      string        `mapstructure:"key"`
+	Requests int           `mapstructure:"requests"`
+	Per      time.Duration `mapstructure:"per"`
+	Burst    int           `mapstructure:"burst"`
+}
+
+type DatabaseConfig struct {
+	ConnectionString string `mapstructure:"connection_string" secret:"true"`
+}
+
+type AuthConfig struct {
+	Issuer              string        `mapstructure:"issuer"`
+	KeyRotationInterval time.Duration `mapstructure:"key_rotation_interval"`
+	// AdminAPIKey is only needed to create the first admin key.
+	AdminAPIKey      string `mapstructure:"admin_api_key" secret:"true"`
+	EmailTokenSecret string `mapstructure:"email_token_secret" secret:"true"`
+	// MfaEncryptionKey is MfaKeySize base64 encoded bytes. Losing it
+	// disables every enrolled authenticator.
+	MfaEncryptionKey string `mapstructure:"mfa_encryption_key" secret:"true"`
+	// SigningKeyEncryptionKey is SigningKeyCipherSize base64 encoded bytes
+	// encrypting the signing keys every instance loads from the database.
+	// Every instance needs the same one.
+	SigningKeyEncryptionKey string `mapstructure:"signing_key_encryption_key" secret:"true"`
+}
+
+type SessionsConfig struct {
+	// Store is "postgres" or "memory".
+	Store        string `mapstructure:"store"`
+	CookieSecure bool   `mapstructure:"cookie_secure"`
+}
+
+// OpenAPIConfig controls validation against the OpenAPI document.
+type OpenAPIConfig struct {
+	ValidateRequests bool `mapstructure:"validate_requests"`
+	// ValidateResponses buffers every response and answers 500 for those
+	// the document doesn't describe. It is for tests, not production.
+	ValidateResponses bool `mapstructure:"validate_responses"`
+	// MaxBodyBytes caps the request bodies validation reads; larger ones
+	// are answered 413.
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+}
+
+type MailerConfig struct {
+	// Transport is "smtp" for real delivery, "file" to write .eml files to
+	// Dir, or "memory" for local runs without a mail server.
+	Transport string     `mapstructure:"transport"`
+	From      string     `mapstructure:"from"`
+	Dir       string     `mapstructure:"dir"`
+	SMTP      SMTPConfig `mapstructure:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password" secret:"true"`
+}
+
+type envBinding struct {
+	key string
+	// names are tried in order, then those of later bindings for the same
+	// key; older names are kept so existing deployments keep working.
+	names []string
+	// secret bindings may instead be read from the file named by
+	// <name>_FILE, as with Docker and Kubernetes secrets.
+	secret bool
+	// env, when set, limits the binding to that environment.
+	env string
+}
+
+var envBindings = []envBinding{
+	{key: "server.port", names: []string{"PORT"}},
+	{key: "server.public_base_url", names: []string{"PUBLIC_BASE_URL"}},
+	{key: "server.shutdown_timeout", names: []string{"SHUTDOWN_TIMEOUT"}},
+	{key: "server.drain_delay", names: []string{"DRAIN_DELAY"}},
+	{key: "grpc.port", names: []string{"GRPC_PORT"}},
+	{key: "grpc.reflection", names: []string{"GRPC_REFLECTION"}},
+	{key: "graphql.max_depth", names: []string{"GRAPHQL_MAX_DEPTH"}},
+	{key: "graphql.max_complexity", names: []string{"GRAPHQL_MAX_COMPLEXITY"}},
+	{key: "graphql.introspection", names: []string{"GRAPHQL_INTROSPECTION"}},
+	{key: "database.connection_string", names: []string{"DATABASE_URL"}, secret: true},
+	// DEV_CONN_STR predates DATABASE_URL. It is development only so a .env
+	// holding it can't point the test suite at the development database.
+	{key: "database.connection_string", names: []string{"DEV_CONN_STR"}, secret: true, env: "development"},
+	{key: "auth.issuer", names: []string{"JWT_ISSUER"}},
+	{key: "auth.key_rotation_interval", names: []string{"JWT_KEY_ROTATION_INTERVAL"}},
+	{key: "auth.admin_api_key", names: []string{"ADMIN_API_KEY"}, secret: true},
+	{key: "auth.email_token_secret", names: []string{"EMAIL_TOKEN_SECRET"}, secret: true},
+	{key: "auth.mfa_encryption_key", names: []string{"MFA_ENCRYPTION_KEY"}, secret: true},
+	{key: "auth.signing_key_encryption_key", names: []string{"SIGNING_KEY_ENCRYPTION_KEY"}, secret: true},
+	{key: "sessions.store", names: []string{"SESSION_STORE"}},
+	{key: "sessions.cookie_secure", names: []string{"SESSION_COOKIE_SECURE"}},
+	{key: "mailer.transport", names: []string{"MAILER"}},
+	{key: "mailer.from", names: []string{"MAIL_FROM"}},
+	{key: "mailer.dir", names: []string{"MAIL_DIR"}},
+	{key: "mailer.smtp.host", names: []string{"SMTP_HOST"}},
+	{key: "mailer.smtp.port", names: []string{"SMTP_PORT"}},
+	{key: "mailer.smtp.username", names: []string{"SMTP_USERNAME"}},
+	{key: "mailer.smtp.password", names: []string{"SMTP_PASSWORD"}, secret: true},
+	{key: "cors.allowed_origins", names: []string{"CORS_ALLOWED_ORIGINS"}},
+	{key: "tracing.exporter", names: []string{"TRACING_EXPORTER"}},
+	{key: "tracing.service_name", names: []string{"OTEL_SERVICE_NAME"}},
+	{key: "tracing.file", names: []string{"TRACING_FILE"}},
+	{key: "tracing.otlp_endpoint", names: []string{"OTEL_EXPORTER_OTLP_ENDPOINT"}},
+	{key: "tracing.sample_ratio", names: []string{"TRACING_SAMPLE_RATIO"}},
+	{key: "crash.reporter", names: []string{"CRASH_REPORTER"}},
+	{key: "crash.dir", names: []string{"CRASH_DIR"}},
+	{key: "rate_limit.store", names: []string{"RATE_LIMIT_STORE"}},
+	{key: "rate_limit.trust_forwarded_for", names: []string{"RATE_LIMIT_TRUST_FORWARDED_FOR"}},
+	{key: "openapi.validate_requests", names: []string{"OPENAPI_VALIDATE_REQUESTS"}},
+	{key: "openapi.validate_responses", names: []string{"OPENAPI_VALIDATE_RESPONSES"}},
+	{key: "openapi.max_body_bytes", names: []string{"OPENAPI_MAX_BODY_BYTES"}},
+}
+
+// flagKeys maps command line flags to the config keys they set.
+var flagKeys = map[string]string{
+	"port":            "server.port",
+	"public-base-url": "server.public_base_url",
+	"grpc-port":       "grpc.port",
+	"database-url":    "database.connection_string",
+	"mailer":          "mailer.transport",
+	"session-store":   "sessions.store",
+	"trace-exporter":  "tracing.exporter",
+}
+
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("server.port", 8000)
+	v.SetDefault("server.read_timeout", 15*time.Second)
+	v.SetDefault("server.read_header_timeout", 5*time.Second)
+	v.SetDefault("server.write_timeout", 30*time.Second)
+	v.SetDefault("server.idle_timeout", 2*time.Minute)
+	v.SetDefault("server.shutdown_timeout", 30*time.Second)
+	v.SetDefault("server.drain_delay", 0)
+	v.SetDefault("grpc.port", 9090)
+	v.SetDefault("grpc.reflection", false)
+	v.SetDefault("graphql.max_depth", 10)
+	v.SetDefault("graphql.max_complexity", 1000)
+	v.SetDefault("graphql.introspection", false)
+	v.SetDefault("health.cache_ttl", time.Second)
+	v.SetDefault("health.check_timeout", 2*time.Second)
+	v.SetDefault("auth.issuer", "db_practice")
+	v.SetDefault("auth.key_rotation_interval", 24*time.Hour)
+	v.SetDefault("sessions.store", "postgres")
+	v.SetDefault("sessions.cookie_secure", true)
+	v.SetDefault("mailer.transport", "memory")
+	v.SetDefault("mailer.from", "noreply@localhost")
+	v.SetDefault("mailer.dir", "mail")
+	v.SetDefault("mailer.smtp.port", 587)
+	v.SetDefault("cors.allowed_origins", []string{})
+	v.SetDefault("cors.allowed_headers", []string{"Content-Type", "Authorization", "X-API-Key"})
+	v.SetDefault("cors.exposed_headers", []string{})
+	v.SetDefault("cors.allow_credentials", false)
+	v.SetDefault("cors.max_age", 600)
+	v.SetDefault("tracing.exporter", "none")
+	v.SetDefault("tracing.service_name", "db_practice")
+	v.SetDefault("tracing.file", "traces.jsonl")
+	v.SetDefault("tracing.otlp_endpoint", "http://localhost:4318")
+	v.SetDefault("tracing.sample_ratio", 1.0)
+	v.SetDefault("crash.reporter", "none")
+	v.SetDefault("crash.dir", "crashes")
+	v.SetDefault("openapi.validate_requests", true)
+	v.SetDefault("openapi.validate_responses", false)
+	v.SetDefault("openapi.max_body_bytes", 1<<20)
+	v.SetDefault("rate_limit.store", "memory")
+	v.SetDefault("rate_limit.trust_forwarded_for", false)
+	v.SetDefault("rate_limit.prune_interval", 5*time.Minute)
+	v.SetDefault("rate_limit.default", map[string]interface{}{
+		"key": "ip", "requests": 300, "per": time.Minute,
+	})
+	// Signups and password resets are limited per address and lookups per
+	// user, which also slows down probing for registered emails. Legacy
+	// routes get the same limits as the routes replacing them.
+	v.SetDefault("rate_limit.routes", []map[string]interface{}{
+		{"route": "auth.password_reset", "key": "ip", "requests": 10, "per": time.Hour},
+		{"route": "users.create", "key": "ip", "requests": 20, "per": time.Hour, "burst": 5},
+		{"route": "users.create_legacy", "key": "ip", "requests": 20, "per": time.Hour, "burst": 5},
+		{"route": "users.get", "key": "user", "requests": 30, "per": time.Minute, "burst": 10},
+		{"route": "users.search", "key": "user", "requests": 30, "per": time.Minute, "burst": 10},
+	})
+}
+
+// Load builds the configuration from every layer. args are the command line
+// arguments after the program (and subcommand) name; besides the value flags
+// in flagKeys they accept -env (or APP_ENV, default "development") and
+// -config-dir (or CONFIG_DIR, default "config").
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("db_practice", flag.ContinueOnError)
+	env := flags.String("env", os.Getenv("APP_ENV"), "environment: "+strings.Join(Environments, ", "))
+	dir := flags.String("config-dir", os.Getenv("CONFIG_DIR"), "directory holding <env>.yml")
+	flags.Int("port", 0, "port to listen on")
+	flags.Int("grpc-port", 0, "port the gRPC server listens on")
+	flags.String("public-base-url", "", "base URL used in emailed links")
+	flags.String("database-url", "", "Postgres connection string")
+	flags.String("mailer", "", "mail transport: smtp, file or memory")
+	flags.String("session-store", "", "session store: postgres or memory")
+	flags.String("trace-exporter", "", "trace exporter: none, stdout, file or otlp")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *env == "" {
+		*env = "development"
+	}
+	if *dir == "" {
+		*dir = "config"
+	}
+	if !contains(Environments, *env) {
+		return nil, fmt.Errorf("unknown environment %q: want one of %s", *env, strings.Join(Environments, ", "))
+	}
+
+	v := viper.New()
+	setDefaults(v)
+
+	if err := mergeFile(v, filepath.Join(*dir, *env+".yml")); err != nil {
+		return nil, err
+	}
+
+	bindings := []envBinding{}
+	bound := map[string]int{}
+	for _, b := range envBindings {
+		if b.env != "" && b.env != *env {
+			continue
+		}
+		if i, ok := bound[b.key]; ok {
+			bindings[i].names = append(bindings[i].names, b.names...)
+			continue
+		}
+		bound[b.key] = len(bindings)
+		bindings = append(bindings, envBinding{key: b.key, names: append([]string{}, b.names...), secret: b.secret})
+	}
+
+	for _, b := range bindings {
+		if err := v.BindEnv(append([]string{b.key}, b.names...)...); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range bindings {
+		if !b.secret {
+			continue
+		}
+		for _, name := range b.names {
+			path := os.Getenv(name + "_FILE")
+			if path == "" {
+				continue
+			}
+			secret, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s_FILE: %w", name, err)
+			}
+			v.Set(b.key, strings.TrimRight(string(secret), "\r\n"))
+			break
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if key, ok := flagKeys[f.Name]; ok {
+			v.Set(key, f.Value.String())
+		}
+	})
+
+	var c Config
+	if err := v.Unmarshal(&c); err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+	c.Env = *env
+
+	if c.Server.PublicBaseURL == "" {
+		c.Server.PublicBaseURL = fmt.Sprintf("http://localhost:%d", c.Server.Port)
+	}
+	// Origins from CORS_ALLOWED_ORIGINS arrive as one comma separated
+	// string split without trimming.
+	c.CORS.AllowedOrigins = ParseOrigins(strings.Join(c.CORS.AllowedOrigins, ","))
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+var placeholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// mergeFile layers a YAML file over the defaults. A missing file is not an
+// error: containers may configure everything through the environment.
+func mergeFile(v *viper.Viper, path string) error {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	expanded := placeholder.ReplaceAllStringFunc(string(raw), func(m string) string {
+		return os.Getenv(placeholder.FindStringSubmatch(m)[1])
+	})
+
+	v.SetConfigType("yaml")
+	if err := v.MergeConfig(strings.NewReader(expanded)); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// ValidationError lists every problem found, so a misconfigured deployment
+// can be fixed in one pass.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration as a whole.
+func (c *Config) Validate() error {
+	var problems []string
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		fail("server.port %d is out of range", c.Server.Port)
+	}
+	if u, err := url.Parse(c.Server.PublicBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("server.public_base_url %q must be an http(s) URL", c.Server.PublicBaseURL)
+	}
+	timeouts := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_timeout", c.Server.ReadTimeout},
+		{"read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"write_timeout", c.Server.WriteTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+		{"shutdown_timeout", c.Server.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.value <= 0 {
+			fail("server.%s must be positive", t.name)
+		}
+	}
+	if c.Server.DrainDelay < 0 {
+		fail("server.drain_delay must not be negative")
+	}
+
+	if c.GRPC.Port < 1 || c.GRPC.Port > 65535 {
+		fail("grpc.port %d is out of range", c.GRPC.Port)
+	} else if c.GRPC.Port == c.Server.Port {
+		fail("grpc.port %d is already server.port", c.GRPC.Port)
+	}
+
+	if c.GraphQL.MaxDepth < 1 {
+		fail("graphql.max_depth must be positive")
+	}
+	if c.GraphQL.MaxComplexity < 1 {
+		fail("graphql.max_complexity must be positive")
+	}
+
+	if c.Health.CacheTTL < 0 {
+		fail("health.cache_ttl must not be negative")
+	}
+	if c.Health.CheckTimeout <= 0 {
+		fail("health.check_timeout must be positive")
+	}
+
+	if c.Database.ConnectionString == "" {
+		fail("database.connection_string is required (DATABASE_URL)")
+	}
+
+	if c.Auth.Issuer == "" {
+		fail("auth.issuer must not be empty")
+	}
+	if c.Auth.KeyRotationInterval <= 0 {
+		fail("auth.key_rotation_interval must be positive")
+	}
+	if c.Auth.EmailTokenSecret == "" {
+		fail("auth.email_token_secret is required (EMAIL_TOKEN_SECRET)")
+	}
+	if key, err := base64.StdEncoding.DecodeString(c.Auth.MfaEncryptionKey); err != nil || len(key) != MfaKeySize {
+		fail("auth.mfa_encryption_key must be %d base64 encoded bytes (MFA_ENCRYPTION_KEY)", MfaKeySize)
+	}
+	if key, err := base64.StdEncoding.DecodeString(c.Auth.SigningKeyEncryptionKey); err != nil || len(key) != SigningKeyCipherSize {
+		fail("auth.signing_key_encryption_key must be %d base64 encoded bytes (SIGNING_KEY_ENCRYPTION_KEY)", SigningKeyCipherSize)
+	}
+
+	switch c.Sessions.Store {
+	case "postgres", "memory":
+	default:
+		fail("sessions.store %q must be postgres or memory", c.Sessions.Store)
+	}
+	if c.Env == "production" && !c.Sessions.CookieSecure {
+		fail("sessions.cookie_secure must be true in production")
+	}
+
+	if c.Env == "production" && c.OpenAPI.ValidateResponses {
+		fail("openapi.validate_responses must be false in production")
+	}
+	if c.OpenAPI.MaxBodyBytes <= 0 {
+		fail("openapi.max_body_bytes must be positive")
+	}
+
+	switch c.Mailer.Transport {
+	case "memory":
+	case "file":
+		if c.Mailer.Dir == "" {
+			fail("mailer.dir is required for the file transport")
+		}
+	case "smtp":
+		if c.Mailer.SMTP.Host == "" {
+			fail("mailer.smtp.host is required for the smtp transport")
+		}
+		if c.Mailer.SMTP.Port < 1 || c.Mailer.SMTP.Port > 65535 {
+			fail("mailer.smtp.port %d is out of range", c.Mailer.SMTP.Port)
+		}
+	default:
+		fail("mailer.transport %q must be smtp, file or memory", c.Mailer.Transport)
+	}
+	if c.Mailer.From == "" {
+		fail("mailer.from must not be empty")
+	}
+
+	if err := c.CORS.Validate(); err != nil {
+		fail("%v", err)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "file":
+		if c.Tracing.File == "" {
+			fail("tracing.file is required for the file exporter")
+		}
+	case "otlp":
+		if u, err := url.Parse(c.Tracing.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("tracing.otlp_endpoint %q must be an http(s) URL", c.Tracing.OTLPEndpoint)
+		}
+	default:
+		fail("tracing.exporter %q must be none, stdout, file or otlp", c.Tracing.Exporter)
+	}
+	if c.Tracing.ServiceName == "" {
+		fail("tracing.service_name must not be empty")
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio %g must be between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	switch c.Crash.Reporter {
+	case "none":
+	case "file":
+		if c.Crash.Dir == "" {
+			fail("crash.dir is required for the file reporter")
+		}
+	default:
+		fail("crash.reporter %q must be none or file", c.Crash.Reporter)
+	}
+
+	switch c.RateLimit.Store {
+	case "memory":
+	case "postgres":
+		if c.RateLimit.PruneInterval <= 0 {
+			fail("rate_limit.prune_interval must be positive")
+		}
+	default:
+		fail("rate_limit.store %q must be memory or postgres", c.RateLimit.Store)
+	}
+	c.RateLimit.Default.validate("rate_limit.default", fail)
+	routes := map[string]bool{}
+	for i, p := range c.RateLimit.Routes {
+		name := fmt.Sprintf("rate_limit.routes[%d]", i)
+		if p.Route == "" {
+			fail("%s.route must not be empty", name)
+		} else if routes[p.Route] {
+			fail("%s.route %q is listed more than once", name, p.Route)
+		}
+		routes[p.Route] = true
+		p.validate(name, fail)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (p RateLimitPolicy) validate(name string, fail func(string, ...interface{})) {
+	switch p.Key {
+	case "ip", "api_key", "user":
+	default:
+		fail("%s.key %q must be ip, api_key or user", name, p.Key)
+	}
+	if p.Requests < 0 || p.Burst < 0 {
+		fail("%s.requests and burst must not be negative", name)
+	}
+	if p.Requests > 0 && p.Per <= 0 {
+		fail("%s.per must be positive", name)
+	}
+}
+
+// MfaKey returns the decoded MFA encryption key. Only call it on a
+// validated Config.
+func (a AuthConfig) MfaKey() []byte {
+	key, _ := base64.StdEncoding.DecodeString(a.MfaEncryptionKey)
+	return key
+}
+
+// SigningKeyCipher returns the decoded signing key encryption key. Only call
+// it on a validated Config.
+func (a AuthConfig) SigningKeyCipher() []byte {
+	key, _ := base64.StdEncoding.DecodeString(a.SigningKeyEncryptionKey)
+	return key
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,26 +1,196 @@
 package config
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/gorilla/mux"
 )
 
-func SetCORS(next http.Handler) http.Handler {
+// CORSPolicy controls which browser origins may call the API; it is the cors
+// section of Config. Origins are either exact ("https://app.example.com") or
+// match any subdomain ("https://*.example.com", which does not match
+// example.com itself).
+type CORSPolicy struct {
+	AllowedOrigins   []string `mapstructure:"allowed_origins"`
+	AllowedHeaders   []string `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string `mapstructure:"exposed_headers"`
+	AllowCredentials bool     `mapstructure:"allow_credentials"`
+	// MaxAge is how long, in seconds, browsers may cache a preflight.
+	MaxAge int `mapstructure:"max_age"`
+}
+
+// preflightMethods are the methods checked against the router when working
+// out what a path supports.
+var preflightMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// Validate rejects origin patterns that are malformed or unsafe.
+func (p *CORSPolicy) Validate() error {
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			if p.AllowCredentials {
+				return fmt.Errorf("CORS origin \"*\" cannot be combined with allow_credentials")
+			}
+			continue
+		}
+
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("invalid CORS origin %q: want scheme://host[:port]", o)
+		}
+		if strings.Contains(u.Host, "*") && (!strings.HasPrefix(u.Host, "*.") || strings.Count(u.Host, "*") > 1) {
+			return fmt.Errorf("invalid CORS origin %q: wildcard must be a leading \"*.\"", o)
+		}
+	}
+	if p.MaxAge < 0 {
+		return fmt.Errorf("CORS max_age must not be negative")
+	}
+	return nil
+}
+
+// AllowsOrigin reports whether origin matches the allowlist.
+func (p *CORSPolicy) AllowsOrigin(origin string) bool {
+	o, err := url.Parse(strings.ToLower(origin))
+	if err != nil || o.Scheme == "" || o.Host == "" {
+		return false
+	}
+
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+
+		a, err := url.Parse(strings.ToLower(strings.TrimRight(allowed, "/")))
+		if err != nil || a.Scheme != o.Scheme {
+			continue
+		}
+
+		if suffix, ok := strings.CutPrefix(a.Host, "*."); ok {
+			if o.Port() != portOf(suffix) {
+				continue
+			}
+			host := o.Hostname()
+			base := strings.Split(suffix, ":")[0]
+			if strings.HasSuffix(host, "."+base) && len(host) > len(base)+1 {
+				return true
+			}
+			continue
+		}
+
+		if a.Host == o.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// Router serves requests and reports the routes it has for them, as
+// mux.Router does.
+type Router interface {
+	http.Handler
+	Match(r *http.Request, match *mux.RouteMatch) bool
+}
+
+// NewCORSHandler wraps router with the policy. Preflight (OPTIONS) requests
+// are answered here with 204 and the methods the router has for the path;
+// other requests get the CORS response headers and are passed on.
+func NewCORSHandler(policy *CORSPolicy, router Router) http.Handler {
+	allowedHeaders := strings.Join(policy.AllowedHeaders, ", ")
+	exposedHeaders := strings.Join(policy.ExposedHeaders, ", ")
+
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		headers := w.Header()
 		origin := r.Header.Get("Origin")
-		allowed := []string{"GET", "POST"}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// Responses differ per origin, so caches must key on it.
+		headers.Add("Vary", "Origin")
+		if preflight {
+			headers.Add("Vary", "Access-Control-Request-Method")
+			headers.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" {
+			router.ServeHTTP(w, r)
+			return
+		}
+
+		if !policy.AllowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			router.ServeHTTP(w, r)
+			return
+		}
+
+		headers.Set("Access-Control-Allow-Origin", origin)
+		if policy.AllowCredentials {
+			headers.Set("Access-Control-Allow-Credentials", "true")
+		}
 
-		if origin != "" {
-			headers.Set("Access-Control-Allow-Origin", "*")
-			if strings.HasPrefix(origin, "http") || strings.HasPrefix(origin, "https") {
-				headers.Set("Access-Control-Allow-Origin", origin)
+		if !preflight {
+			if exposedHeaders != "" {
+				headers.Set("Access-Control-Expose-Headers", exposedHeaders)
 			}
-			headers.Set("Access-Control-Allow-Headers", "*")
-			headers.Set("Access-Control-Allow-Methods", strings.Join(allowed, ", "))
+			router.ServeHTTP(w, r)
+			return
 		}
 
-		next.ServeHTTP(w, r)
+		methods := routeMethods(router, r)
+		if len(methods) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		headers.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if allowedHeaders != "" {
+			headers.Set("Access-Control-Allow-Headers", allowedHeaders)
+		}
+		if policy.MaxAge > 0 {
+			headers.Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
 	}
 	return http.HandlerFunc(fn)
 }
+
+// routeMethods lists the methods the router would accept for the request's
+// path.
+func routeMethods(router Router, r *http.Request) []string {
+	methods := []string{}
+	for _, m := range preflightMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = m
+
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, m)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// ParseOrigins splits a comma separated origin list, as found in
+// CORS_ALLOWED_ORIGINS.
+func ParseOrigins(list string) []string {
+	origins := []string{}
+	for _, o := range strings.Split(list, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+func portOf(host string) string {
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		return host[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPolicy = &CORSPolicy{
+	AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org", "http://localhost:3000/"},
+	AllowedHeaders:   []string{"Content-Type", "Authorization"},
+	ExposedHeaders:   []string{"WWW-Authenticate"},
+	AllowCredentials: true,
+	MaxAge:           600,
+}
+
+func testRouter() *mux.Router {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	router := mux.NewRouter()
+	router.HandleFunc("/auth/login", noop).Methods("POST")
+
+	protected := router.NewRoute().Subrouter()
+	protected.HandleFunc("/users/{email}", noop).Methods("GET")
+	protected.HandleFunc("/users/{id}", noop).Methods("PUT")
+	protected.HandleFunc("/users/{id}", noop).Methods("DELETE")
+	return router
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	testCases := []struct {
+		description string
+		origin      string
+		expected    bool
+	}{
+		{description: "Success: Exact match", origin: "https://app.example.com", expected: true},
+		{description: "Success: Case insensitive", origin: "https://APP.example.com", expected: true},
+		{description: "Success: Wildcard subdomain", origin: "https://admin.example.org", expected: true},
+		{description: "Success: Nested wildcard subdomain", origin: "https://a.b.example.org", expected: true},
+		{description: "Success: Config trailing slash ignored", origin: "http://localhost:3000", expected: true},
+		{description: "Failure: Wildcard excludes apex", origin: "https://example.org"},
+		{description: "Failure: Suffix is not a subdomain", origin: "https://evilexample.org"},
+		{description: "Failure: Scheme must match", origin: "http://app.example.com"},
+		{description: "Failure: Port must match", origin: "http://localhost:3001"},
+		{description: "Failure: Unlisted origin", origin: "https://evil.example.com"},
+		{description: "Failure: Opaque origin", origin: "null"},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			assert.Equal(t, tc.expected, testPolicy.AllowsOrigin(tc.origin))
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	testCases := []struct {
+		description     string
+		origin          string
+		path            string
+		expectedCode    int
+		expectedMethods string
+		expectedOrigin  string
+	}{
+		{
+			description:     "Success: Methods derived from routes",
+			origin:          "https://app.example.com",
+			path:            "/users/12infioed",
+			expectedCode:    204,
+			expectedMethods: "DELETE, GET, PUT",
+			expectedOrigin:  "https://app.example.com",
+		},
+		{
+			description:     "Success: Single method route",
+			origin:          "https://admin.example.org",
+			path:            "/auth/login",
+			expectedCode:    204,
+			expectedMethods: "POST",
+			expectedOrigin:  "https://admin.example.org",
+		},
+		{
+			description:  "Failure: Origin not allowed",
+			origin:       "https://evil.example.com",
+			path:         "/users/12infioed",
+			expectedCode: 403,
+		},
+		{
+			description:    "Failure: No such route",
+			origin:         "https://app.example.com",
+			path:           "/nowhere/at/all",
+			expectedCode:   404,
+			expectedOrigin: "https://app.example.com",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := httptest.NewRequest("OPTIONS", tc.path, nil)
+			r.Header.Set("Origin", tc.origin)
+			r.Header.Set("Access-Control-Request-Method", "PUT")
+			r.Header.Set("Access-Control-Request-Headers", "content-type")
+
+			w := httptest.NewRecorder()
+			NewCORSHandler(testPolicy, testRouter()).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedMethods, w.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, tc.expectedOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			if tc.expectedCode == 204 {
+				assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+				assert.Equal(t, "Content-Type, Authorization", w.Header().Get("Access-Control-Allow-Headers"))
+				assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	testCases := []struct {
+		description    string
+		origin         string
+		expectedOrigin string
+		expectedExpose string
+	}{
+		{
+			description:    "Success: Allowed origin",
+			origin:         "https://app.example.com",
+			expectedOrigin: "https://app.example.com",
+			expectedExpose: "WWW-Authenticate",
+		},
+		{
+			description: "Failure: Other origin gets no CORS headers",
+			origin:      "https://evil.example.com",
+		},
+		{
+			description: "Success: Same-origin request untouched",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := httptest.NewRequest("GET", "/users/testemail@mail.com", nil)
+			if tc.origin != "" {
+				r.Header.Set("Origin", tc.origin)
+			}
+
+			w := httptest.NewRecorder()
+			NewCORSHandler(testPolicy, testRouter()).ServeHTTP(w, r)
+
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, tc.expectedOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tc.expectedExpose, w.Header().Get("Access-Control-Expose-Headers"))
+			assert.Equal(t, "Origin", w.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		description string
+		policy      CORSPolicy
+		expectErr   bool
+	}{
+		{description: "Success: Exact and wildcard", policy: CORSPolicy{AllowedOrigins: []string{"https://a.com", "https://*.a.com:8443"}}},
+		{description: "Success: Any origin without credentials", policy: CORSPolicy{AllowedOrigins: []string{"*"}}},
+		{description: "Failure: Any origin with credentials", policy: CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}, expectErr: true},
+		{description: "Failure: Wildcard in the middle", policy: CORSPolicy{AllowedOrigins: []string{"https://a.*.com"}}, expectErr: true},
+		{description: "Failure: Missing scheme", policy: CORSPolicy{AllowedOrigins: []string{"a.com"}}, expectErr: true},
+		{description: "Failure: Path", policy: CORSPolicy{AllowedOrigins: []string{"https://a.com/app"}}, expectErr: true},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			err := tc.policy.Validate()
+			assert.Equal(t, tc.expectErr, err != nil, "%v", err)
+		})
+	}
+}
+
+func TestParseOrigins(t *testing.T) {
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, ParseOrigins(" https://a.example.com, ,https://b.example.com "))
+	assert.Equal(t, []string{}, ParseOrigins(""))
+}
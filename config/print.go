@@ -0,0 +1,75 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces set secret values in Print output.
+const Redacted = "[REDACTED]"
+
+// Print writes the effective configuration as YAML, in the same layout as the
+// <env>.yml files, with secret fields redacted.
+func Print(w io.Writer, c *Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(toNode(reflect.ValueOf(*c), false)); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func toNode(v reflect.Value, secret bool) *yaml.Node {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return scalar(d.String(), "!!str")
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			node.Content = append(node.Content,
+				scalar(field.Tag.Get("mapstructure"), "!!str"),
+				toNode(v.Field(i), field.Tag.Get("secret") == "true"))
+		}
+		return node
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		// Lists of scalars fit on one line; lists of structs do not.
+		if v.Type().Elem().Kind() != reflect.Struct {
+			node.Style = yaml.FlowStyle
+		}
+		for i := 0; i < v.Len(); i++ {
+			node.Content = append(node.Content, toNode(v.Index(i), secret))
+		}
+		return node
+	case reflect.String:
+		if secret && v.String() != "" {
+			return scalar(Redacted, "!!str")
+		}
+		return scalar(v.String(), "!!str")
+	case reflect.Bool:
+		return scalar(strconv.FormatBool(v.Bool()), "!!bool")
+	case reflect.Int, reflect.Int64:
+		return scalar(strconv.FormatInt(v.Int(), 10), "!!int")
+	case reflect.Float64:
+		f := strconv.FormatFloat(v.Float(), 'f', -1, 64)
+		// Keep a decimal point so whole numbers still read as floats.
+		if !strings.Contains(f, ".") {
+			f += ".0"
+		}
+		return scalar(f, "!!float")
+	default:
+		panic("config: cannot print " + v.Kind().String())
+	}
+}
+
+func scalar(value, tag string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
@@ -0,0 +1,135 @@
+package graphqlapi
+
+import (
+	"context"
+	"db_practice/internal/logging"
+	"db_practice/internal/rbac"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// authorizer batches the permission checks of one operation, as the loader
+// batches its lookups: checks queued while a level resolves are decided in
+// one CanAll call when the first of their thunks runs. Decisions, and
+// whether the caller reads any user, are reused for the rest of the
+// operation, which has a single caller.
+type authorizer struct {
+	rbac rbac.Client
+
+	mu       sync.Mutex
+	pending  map[rbac.Action]*checks
+	decided  map[string]bool
+	readsAny *decision
+}
+
+// checks is the resources waiting to be decided together, and how that
+// went.
+type checks struct {
+	resources []rbac.Resource
+	done      bool
+	err       error
+}
+
+type decision struct {
+	allowed bool
+	err     error
+}
+
+func newAuthorizer(c rbac.Client) *authorizer {
+	return &authorizer{
+		rbac:    c,
+		pending: map[rbac.Action]*checks{},
+		decided: map[string]bool{},
+	}
+}
+
+type authorizerKey struct{}
+
+func withAuthorizer(ctx context.Context, a *authorizer) context.Context {
+	return context.WithValue(ctx, authorizerKey{}, a)
+}
+
+// authorizerFromContext returns the operation's authorizer. Outside
+// Execute, which sets it, every call gets one of its own.
+func authorizerFromContext(ctx context.Context, c rbac.Client) *authorizer {
+	if a, ok := ctx.Value(authorizerKey{}).(*authorizer); ok {
+		return a
+	}
+	return newAuthorizer(c)
+}
+
+// can queues the check of the action on the resource, unless it was already
+// decided, and returns a thunk deciding the pending checks of the action on
+// first call. Errors are logged once for the batch.
+func (a *authorizer) can(ctx context.Context, subject string, action rbac.Action, resource rbac.Resource) func() (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := decisionKey(action, resource)
+	if allowed, ok := a.decided[key]; ok {
+		return func() (bool, error) { return allowed, nil }
+	}
+	if a.pending[action] == nil {
+		a.pending[action] = &checks{}
+	}
+	b := a.pending[action]
+	if !b.queued(action, resource) {
+		b.resources = append(b.resources, resource)
+	}
+
+	return func() (bool, error) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		if !b.done {
+			// Checks queued from now on start a new batch.
+			if a.pending[action] == b {
+				delete(a.pending, action)
+			}
+			allowed, err := a.rbac.CanAll(ctx, subject, action, b.resources)
+			b.done, b.err = true, err
+			if err != nil {
+				logging.FromContext(ctx).WithFields(log.Fields{"Subject": subject, "Action": action}).Errorf("%+v", err)
+			}
+			for i := range allowed {
+				a.decided[decisionKey(action, b.resources[i])] = allowed[i]
+			}
+		}
+		if b.err != nil {
+			return false, b.err
+		}
+		return a.decided[key], nil
+	}
+}
+
+func (b *checks) queued(action rbac.Action, resource rbac.Resource) bool {
+	for _, r := range b.resources {
+		if decisionKey(action, r) == decisionKey(action, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// readsAnyUser reports whether the subject may read every user, asking
+// once per operation.
+func (a *authorizer) readsAnyUser(ctx context.Context, subject string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.readsAny == nil {
+		allowed, err := a.rbac.CanAny(ctx, subject, rbac.ActionReadUser)
+		if err != nil {
+			logging.FromContext(ctx).WithFields(log.Fields{"Subject": subject, "Action": rbac.ActionReadUser}).Errorf("%+v", err)
+		}
+		a.readsAny = &decision{allowed: allowed, err: err}
+	}
+	return a.readsAny.allowed, a.readsAny.err
+}
+
+// decisionKey tells decisions apart by the owner too, which Evaluate
+// decides on but String leaves out.
+func decisionKey(action rbac.Action, resource rbac.Resource) string {
+	return string(action) + " " + resource.String() + " " + resource.OwnerId
+}
@@ -0,0 +1,129 @@
+package graphqlapi
+
+import (
+	"context"
+	"db_practice/internal/auth"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRbac answers as rbac.TestClient does, recording the resources of
+// each CanAll call and counting CanAny calls.
+type countingRbac struct {
+	rbac.TestClient
+
+	mu      sync.Mutex
+	anys    int
+	batches [][]string
+}
+
+func (c *countingRbac) CanAny(ctx context.Context, subject string, action rbac.Action) (bool, error) {
+	c.mu.Lock()
+	c.anys++
+	c.mu.Unlock()
+	return c.TestClient.CanAny(ctx, subject, action)
+}
+
+func (c *countingRbac) CanAll(ctx context.Context, subject string, action rbac.Action, resources []rbac.Resource) ([]bool, error) {
+	c.mu.Lock()
+	ids := make([]string, len(resources))
+	for i, r := range resources {
+		ids[i] = r.Id
+	}
+	c.batches = append(c.batches, ids)
+	c.mu.Unlock()
+	return c.TestClient.CanAll(ctx, subject, action, resources)
+}
+
+func TestAuthorizer(t *testing.T) {
+	testCases := []struct {
+		description     string
+		client          rbac.TestClient
+		owners          []string
+		expectedAllowed []bool
+		expectedBatches [][]string
+		expectedErr     error
+	}{
+		{
+			description:     "Success: Resources decided in one batch, repeats once",
+			client:          rbac.TestClient{CanData: true, OwnOnly: true},
+			owners:          []string{"1", "2", "1"},
+			expectedAllowed: []bool{true, false, true},
+			expectedBatches: [][]string{{"1", "2"}},
+		},
+		{
+			description:     "Failure: Lookup error fails the whole batch",
+			client:          rbac.TestClient{CanErr: errors.New("connection refused")},
+			owners:          []string{"1", "2"},
+			expectedBatches: [][]string{{"1", "2"}},
+			expectedErr:     errors.New("connection refused"),
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			client := &countingRbac{TestClient: tc.client}
+			a := newAuthorizer(client)
+
+			var thunks []func() (bool, error)
+			for _, owner := range tc.owners {
+				thunks = append(thunks, a.can(context.Background(), "1", rbac.ActionReadUser, rbac.UserResource(owner)))
+			}
+
+			var allowed []bool
+			var lastErr error
+			for _, thunk := range thunks {
+				ok, err := thunk()
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				allowed = append(allowed, ok)
+			}
+
+			assert.Equal(t, tc.expectedAllowed, allowed)
+			assert.Equal(t, tc.expectedBatches, client.batches)
+			assert.Equal(t, tc.expectedErr, lastErr)
+		})
+	}
+}
+
+func TestExecuteAuthorizesOnce(t *testing.T) {
+	client := &batchingClient{stored: []*users.User{{Id: "1", Email: "jane@example.com"}, {Id: "2", Email: "john@example.com"}}}
+	authz := &countingRbac{TestClient: rbac.TestClient{CanData: true, OwnOnly: true}}
+	schema, err := NewSchema(client, authz, verification.TestClient{}, nil, testLimits)
+	require.NoError(t, err)
+
+	ctx := auth.WithUserId(context.Background(), "1")
+	op, result := schema.Prepare(ctx, Params{
+		Query: `{
+			a: user(id: "1") { id } b: user(id: "2") { id } c: user(id: "1") { id }
+			d: userByEmail(email: "jane@example.com") { id } e: userByEmail(email: "john@example.com") { id }
+		}`,
+	})
+	require.Nil(t, result)
+	result = schema.Execute(ctx, op)
+
+	data, err := json.Marshal(result.Data)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":{"id":"1"},"b":null,"c":{"id":"1"},"d":{"id":"1"},"e":null}`, string(data))
+	codes, _ := errorCodes(t, result)
+	assert.ElementsMatch(t, []string{"forbidden", "not_found"}, codes)
+
+	// Whether the caller reads any user is asked once, and every field's
+	// check is decided in one batch.
+	assert.Equal(t, 1, authz.anys)
+	require.Len(t, authz.batches, 1)
+	assert.ElementsMatch(t, []string{"1", "2"}, authz.batches[0])
+}
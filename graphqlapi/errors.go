@@ -0,0 +1,138 @@
+package graphqlapi
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"db_practice/internal/openapi"
+	"db_practice/internal/users"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/pkg/errors"
+)
+
+// Error is a GraphQL error for an error catalog code. Its extensions carry
+// what REST error bodies do: the code, the request id and, for invalid
+// input, an error per field.
+type Error struct {
+	message   string
+	code      errcatalog.Code
+	requestID string
+	fields    []FieldError
+}
+
+// FieldError is one invalid argument. Field is the argument's path, e.g.
+// "input.email".
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Extensions implements gqlerrors.ExtendedError.
+func (e *Error) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": string(e.code)}
+	if e.requestID != "" {
+		extensions["requestId"] = e.requestID
+	}
+	if len(e.fields) > 0 {
+		extensions["fields"] = e.fields
+	}
+	return extensions
+}
+
+type languageKey struct{}
+
+// withLanguage stores the Accept-Language errors are localized by.
+func withLanguage(ctx context.Context, acceptLanguage string) context.Context {
+	return context.WithValue(ctx, languageKey{}, acceptLanguage)
+}
+
+// catalogError is the error for a catalog code, in the language the request
+// asked for. Violations name their fields as the caller sent them.
+func catalogError(ctx context.Context, code errcatalog.Code, violations ...openapi.Violation) *Error {
+	acceptLanguage, _ := ctx.Value(languageKey{}).(string)
+	tag := errcatalog.Default.Match(acceptLanguage)
+	entry, _ := errcatalog.Default.Lookup(tag, code)
+
+	e := &Error{message: entry.Message, code: code, requestID: logging.RequestID(ctx)}
+	for _, v := range violations {
+		params := map[string]string{"field": v.Field}
+		for k, p := range v.Params {
+			params[k] = p
+		}
+		fieldEntry, _ := errcatalog.Default.Lookup(tag, errcatalog.Code(v.Code))
+		e.fields = append(e.fields, FieldError{
+			Field:   v.Field,
+			Code:    v.Code,
+			Message: errcatalog.Render(fieldEntry.FieldMessage, params),
+		})
+	}
+	return e
+}
+
+// usersError is the error for one from the users client: not_found for a
+// missing user, conflict_error for a taken email and internal_error, logged,
+// for anything else.
+func usersError(ctx context.Context, err error) *Error {
+	switch errors.Cause(err) {
+	case sql.ErrNoRows:
+		return catalogError(ctx, errcatalog.NotFound)
+	case users.ErrEmailExists:
+		return catalogError(ctx, errcatalog.Conflict,
+			openapi.Violation{Field: "input.email", Code: string(errcatalog.Conflict)})
+	default:
+		logging.FromContext(ctx).Errorf("%+v", err)
+		return catalogError(ctx, errcatalog.Internal)
+	}
+}
+
+// extended finds the *Error behind a formatted one. Errors returned from
+// thunks are formatted before they are located, so the extensions
+// graphql-go copies from the original error are lost on the way.
+func extended(err error) (*Error, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *Error:
+			return e, true
+		case gqlerrors.FormattedError:
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			err = e.OriginalError
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// formatErrors gives every error in errs an error catalog code. Errors
+// without a path were found before execution, so the request is at fault;
+// any other error not raised by a resolver is a bug, and its message is
+// logged rather than shown.
+func formatErrors(ctx context.Context, errs []gqlerrors.FormattedError) []gqlerrors.FormattedError {
+	for i, err := range errs {
+		if e, ok := extended(err); ok {
+			err.Message = e.message
+			err.Extensions = e.Extensions()
+		} else if len(err.Path) == 0 {
+			err.Extensions = catalogError(ctx, errcatalog.Invalid).Extensions()
+		} else {
+			logging.FromContext(ctx).Errorf("GraphQL field %v failed: %s", err.Path, err.Message)
+			internal := catalogError(ctx, errcatalog.Internal)
+			err.Message = internal.message
+			err.Extensions = internal.Extensions()
+		}
+		if err.Locations == nil {
+			err.Locations = []location.SourceLocation{}
+		}
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,131 @@
+package graphqlapi
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound what one operation may ask for, so a single request can't
+// fan out into an unbounded number of queries.
+type Limits struct {
+	// MaxDepth is how deeply selections may nest; top-level fields are at
+	// depth 1.
+	MaxDepth int
+	// MaxComplexity caps the operation's cost: one per field, with the
+	// fields selected on each item of a page counted once per item.
+	MaxComplexity int
+	// Introspection lets clients query the schema with __schema and __type.
+	Introspection bool
+}
+
+// pagedFields return a connection of up to "first" items, defaultPageSize
+// when it isn't given.
+var pagedFields = map[string]bool{"users": true}
+
+// measure returns the depth and complexity of the selection set of an
+// operation in doc. Introspection fields are free. It expects a validated
+// document, without fragment cycles.
+func measure(doc *ast.Document, selections *ast.SelectionSet, variables map[string]interface{}) (depth, complexity int) {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[f.Name.Value] = f
+		}
+	}
+
+	var walk func(set *ast.SelectionSet, level int) (int, int)
+	walk = func(set *ast.SelectionSet, level int) (depth, complexity int) {
+		if set == nil {
+			return level - 1, 0
+		}
+		depth = level - 1
+		for _, selection := range set.Selections {
+			var d, c int
+			switch s := selection.(type) {
+			case *ast.Field:
+				if strings.HasPrefix(s.Name.Value, "__") {
+					continue
+				}
+				d, c = walk(s.SelectionSet, level+1)
+				if pagedFields[s.Name.Value] {
+					c *= pageSize(s, variables)
+				}
+				c++
+			case *ast.InlineFragment:
+				d, c = walk(s.SelectionSet, level)
+			case *ast.FragmentSpread:
+				if f, ok := fragments[s.Name.Value]; ok {
+					d, c = walk(f.SelectionSet, level)
+				}
+			}
+			if d > depth {
+				depth = d
+			}
+			complexity += c
+		}
+		return depth, complexity
+	}
+	return walk(selections, 1)
+}
+
+// introspects reports whether the selection set asks for the schema with
+// __schema or __type. __typename is allowed either way.
+func introspects(doc *ast.Document, selections *ast.SelectionSet) bool {
+	for _, selection := range selections.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if s.Name.Value == "__schema" || s.Name.Value == "__type" {
+				return true
+			}
+		case *ast.InlineFragment:
+			if introspects(doc, s.SelectionSet) {
+				return true
+			}
+		case *ast.FragmentSpread:
+			for _, def := range doc.Definitions {
+				if f, ok := def.(*ast.FragmentDefinition); ok && f.Name.Value == s.Name.Value && introspects(doc, f.SelectionSet) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// pageSize is the field's "first" argument, given inline or as a variable.
+func pageSize(field *ast.Field, variables map[string]interface{}) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil && n > 0 {
+				return n
+			}
+		case *ast.Variable:
+			if n, ok := intValue(variables[v.Name.Value]); ok && n > 0 {
+				return n
+			}
+		}
+	}
+	return defaultPageSize
+}
+
+// intValue converts a variable decoded from JSON to an int.
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), true
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,76 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasure(t *testing.T) {
+	testCases := []struct {
+		description        string
+		query              string
+		variables          map[string]interface{}
+		expectedDepth      int
+		expectedComplexity int
+		expectedIntrospect bool
+	}{
+		{
+			description:        "Success: One field",
+			query:              `{ user(id: "1") { id email } }`,
+			expectedDepth:      2,
+			expectedComplexity: 3,
+		},
+		{
+			description:        "Success: Page counted per item",
+			query:              `{ users(first: 5) { edges { node { id } } } }`,
+			expectedDepth:      4,
+			expectedComplexity: 16,
+		},
+		{
+			description:        "Success: Page size from a variable",
+			query:              `query($n: Int) { users(first: $n) { edges { cursor } } }`,
+			variables:          map[string]interface{}{"n": float64(10)},
+			expectedDepth:      3,
+			expectedComplexity: 21,
+		},
+		{
+			description:        "Success: Default page size",
+			query:              `{ users { pageInfo { hasNextPage } } }`,
+			expectedDepth:      3,
+			expectedComplexity: 2*defaultPageSize + 1,
+		},
+		{
+			description:        "Success: Fragments count where they are spread",
+			query:              `{ user(id: "1") { ...f ... on User { id } } } fragment f on User { email }`,
+			expectedDepth:      2,
+			expectedComplexity: 3,
+		},
+		{
+			description:        "Success: Introspection is free but detected",
+			query:              `{ __schema { types { name } } __typename }`,
+			expectedDepth:      0,
+			expectedComplexity: 0,
+			expectedIntrospect: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			doc, err := parser.Parse(parser.ParseParams{Source: tc.query})
+			require.NoError(t, err)
+			op := doc.Definitions[0].(*ast.OperationDefinition)
+
+			depth, complexity := measure(doc, op.SelectionSet, tc.variables)
+			assert.Equal(t, tc.expectedDepth, depth)
+			assert.Equal(t, tc.expectedComplexity, complexity)
+			assert.Equal(t, tc.expectedIntrospect, introspects(doc, op.SelectionSet))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package graphqlapi
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/users"
+	"sync"
+)
+
+// loader batches the user lookups of one operation. Resolvers ask for a
+// user and get a thunk; graphql-go runs every resolver of a level before
+// calling the level's thunks, so by the first call every key of the level
+// is pending and they are all fetched in one query. Users fetched once are
+// reused for the rest of the operation.
+type loader struct {
+	byIds    func(ctx context.Context, ids []string) ([]*users.User, error)
+	byEmails func(ctx context.Context, emails []string) ([]*users.User, error)
+
+	mu      sync.Mutex
+	ids     *batch
+	emails  *batch
+	fetched map[string]*users.User
+}
+
+// batch is the keys waiting to be fetched together, and how that went.
+type batch struct {
+	keys []string
+	done bool
+	err  error
+}
+
+func newLoader(u users.Client) *loader {
+	return &loader{
+		byIds:    u.GetUsersByIds,
+		byEmails: u.GetUsersByEmails,
+		fetched:  map[string]*users.User{},
+	}
+}
+
+type loaderKey struct{}
+
+func withLoader(ctx context.Context, l *loader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+// loaderFromContext returns the operation's loader. Outside Execute, which
+// sets it, every call gets a loader of its own and nothing is batched.
+func loaderFromContext(ctx context.Context, u users.Client) *loader {
+	if l, ok := ctx.Value(loaderKey{}).(*loader); ok {
+		return l
+	}
+	return newLoader(u)
+}
+
+// userById returns a thunk for the user with the given id.
+func (l *loader) userById(ctx context.Context, id string) func() (*users.User, error) {
+	return l.load(ctx, &l.ids, l.byIds, "id:"+id, id)
+}
+
+// userByEmail returns a thunk for the user with the given email.
+func (l *loader) userByEmail(ctx context.Context, email string) func() (*users.User, error) {
+	return l.load(ctx, &l.emails, l.byEmails, "email:"+email, email)
+}
+
+// load queues key in the pending batch, unless its user was already
+// fetched, and returns a thunk fetching the batch on first call. Fetched
+// users are cached by both id and email.
+func (l *loader) load(ctx context.Context, pending **batch, fetch func(context.Context, []string) ([]*users.User, error),
+	cacheKey, key string) func() (*users.User, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if u, ok := l.fetched[cacheKey]; ok {
+		return func() (*users.User, error) { return u, nil }
+	}
+	if *pending == nil {
+		*pending = &batch{}
+	}
+	b := *pending
+	b.keys = append(b.keys, key)
+
+	return func() (*users.User, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if !b.done {
+			// Keys asked for from now on start a new batch.
+			if *pending == b {
+				*pending = nil
+			}
+			found, err := fetch(ctx, unique(b.keys))
+			b.done, b.err = true, err
+			for _, u := range found {
+				l.fetched["id:"+u.Id] = u
+				l.fetched["email:"+u.Email] = u
+			}
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+		u, ok := l.fetched[cacheKey]
+		if !ok {
+			return nil, sql.ErrNoRows
+		}
+		return u, nil
+	}
+}
+
+// unique drops repeated keys, keeping the first of each.
+func unique(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package graphqlapi
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/users"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchingClient serves batch lookups from stored users, recording the keys
+// of each one.
+type batchingClient struct {
+	users.TestClient
+	stored []*users.User
+	err    error
+
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (c *batchingClient) GetUsersByIds(ctx context.Context, ids []string) ([]*users.User, error) {
+	return c.lookup(ids, func(u *users.User) string { return u.Id })
+}
+
+func (c *batchingClient) GetUsersByEmails(ctx context.Context, emails []string) ([]*users.User, error) {
+	return c.lookup(emails, func(u *users.User) string { return u.Email })
+}
+
+func (c *batchingClient) lookup(keys []string, key func(*users.User) string) ([]*users.User, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.batches = append(c.batches, keys)
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	var found []*users.User
+	for _, k := range keys {
+		for _, u := range c.stored {
+			if key(u) == k {
+				found = append(found, u)
+			}
+		}
+	}
+	return found, nil
+}
+
+func TestLoader(t *testing.T) {
+	stored := []*users.User{{Id: "1", Email: "jane@example.com"}, {Id: "2", Email: "john@example.com"}}
+
+	testCases := []struct {
+		description     string
+		err             error
+		ids             []string
+		emails          []string
+		expectedFound   []string
+		expectedBatches [][]string
+		expectedErr     error
+	}{
+		{
+			description:     "Success: Ids fetched in one batch, repeats once",
+			ids:             []string{"2", "1", "2"},
+			expectedFound:   []string{"2", "1", "2"},
+			expectedBatches: [][]string{{"2", "1"}},
+		},
+		{
+			description:     "Success: Ids and emails batched separately",
+			ids:             []string{"1"},
+			emails:          []string{"john@example.com"},
+			expectedFound:   []string{"1", "2"},
+			expectedBatches: [][]string{{"1"}, {"john@example.com"}},
+		},
+		{
+			description:     "Failure: Missing user",
+			ids:             []string{"1", "3"},
+			expectedFound:   []string{"1"},
+			expectedBatches: [][]string{{"1", "3"}},
+			expectedErr:     sql.ErrNoRows,
+		},
+		{
+			description:     "Failure: Database error fails the whole batch",
+			err:             errors.New("connection refused"),
+			ids:             []string{"1", "2"},
+			expectedBatches: [][]string{{"1", "2"}},
+			expectedErr:     errors.New("connection refused"),
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			client := &batchingClient{stored: stored, err: tc.err}
+			l := newLoader(client)
+
+			var thunks []func() (*users.User, error)
+			for _, id := range tc.ids {
+				thunks = append(thunks, l.userById(context.Background(), id))
+			}
+			for _, email := range tc.emails {
+				thunks = append(thunks, l.userByEmail(context.Background(), email))
+			}
+
+			var found []string
+			var lastErr error
+			for _, thunk := range thunks {
+				u, err := thunk()
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				found = append(found, u.Id)
+			}
+
+			assert.Equal(t, tc.expectedFound, found)
+			assert.Equal(t, tc.expectedBatches, client.batches)
+			assert.Equal(t, tc.expectedErr, lastErr)
+		})
+	}
+}
+
+func TestLoaderCache(t *testing.T) {
+	client := &batchingClient{stored: []*users.User{{Id: "1", Email: "jane@example.com"}}}
+	l := newLoader(client)
+
+	_, err := l.userById(context.Background(), "1")()
+	require.NoError(t, err)
+
+	// Users fetched by id are known by email too, and later keys start a
+	// new batch.
+	u, err := l.userByEmail(context.Background(), "jane@example.com")()
+	require.NoError(t, err)
+	assert.Equal(t, "1", u.Id)
+	_, err = l.userById(context.Background(), "2")()
+	assert.Equal(t, sql.ErrNoRows, err)
+
+	assert.Equal(t, [][]string{{"1"}, {"2"}}, client.batches)
+}
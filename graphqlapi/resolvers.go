@@ -0,0 +1,548 @@
+package graphqlapi
+
+import (
+	"context"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"db_practice/internal/openapi"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql"
+	log "github.com/sirupsen/logrus"
+)
+
+const minPasswordLength = 8
+
+// inputFields maps the JSON names of the REST request bodies, which
+// validation reports, to the names of the GraphQL input fields.
+var inputFields = map[string]string{
+	"first_name": "firstName",
+	"last_name":  "lastName",
+	"email":      "email",
+	"address":    "address",
+	"city":       "city",
+	"state":      "state",
+	"zip":        "zip",
+	"dob":        "dob",
+	"password":   "password",
+}
+
+// UserConnection is a page of users, as the users query returns them.
+type UserConnection struct {
+	Edges    []UserEdge `json:"edges"`
+	PageInfo PageInfo   `json:"pageInfo"`
+}
+
+type UserEdge struct {
+	Cursor string      `json:"cursor"`
+	Node   *users.User `json:"node"`
+}
+
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor"`
+}
+
+func (s *Schema) config() graphql.SchemaConfig {
+	user := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":              &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"firstName":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"lastName":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"email":           &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"address":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"city":            &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"state":           &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"zip":             &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"dob":             &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"status":          &graphql.Field{Type: graphql.String},
+			"emailVerifiedAt": &graphql.Field{Type: graphql.DateTime},
+		},
+	})
+
+	edge := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graphql.NewNonNull(user)},
+		},
+	})
+	pageInfo := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"endCursor":   &graphql.Field{Type: graphql.String},
+		},
+	})
+	connection := graphql.NewObject(graphql.ObjectConfig{
+		Name: "UserConnection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edge)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfo)},
+		},
+	})
+
+	input := func(name string, password bool) *graphql.InputObject {
+		fields := graphql.InputObjectConfigFieldMap{}
+		for _, field := range inputFields {
+			if field != "password" {
+				fields[field] = &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)}
+			}
+		}
+		if password {
+			fields["password"] = &graphql.InputObjectFieldConfig{Type: graphql.String}
+		}
+		return graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Fields: fields})
+	}
+
+	eventType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "UserEventType",
+		Values: graphql.EnumValueConfigMap{
+			"CREATED": &graphql.EnumValueConfig{Value: users.EventCreated},
+			"UPDATED": &graphql.EnumValueConfig{Value: users.EventUpdated},
+			"DELETED": &graphql.EnumValueConfig{Value: users.EventDeleted},
+		},
+	})
+	event := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "UserEvent",
+		Description: "A change to a user. A deleted user only has its id.",
+		Fields: graphql.Fields{
+			"type": &graphql.Field{Type: graphql.NewNonNull(eventType)},
+			"user": &graphql.Field{Type: graphql.NewNonNull(user)},
+			"at":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+		},
+	})
+
+	return graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"user": &graphql.Field{
+					Type:    user,
+					Args:    graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+					Resolve: s.resolveUser,
+				},
+				"userByEmail": &graphql.Field{
+					Type:    user,
+					Args:    graphql.FieldConfigArgument{"email": {Type: graphql.NewNonNull(graphql.String)}},
+					Resolve: s.resolveUserByEmail,
+				},
+				"users": &graphql.Field{
+					Type: graphql.NewNonNull(connection),
+					Args: graphql.FieldConfigArgument{
+						"first": {Type: graphql.Int, DefaultValue: defaultPageSize},
+						"after": {Type: graphql.String},
+					},
+					Resolve: s.resolveUsers,
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Mutation",
+			Fields: graphql.Fields{
+				"createUser": &graphql.Field{
+					Type:    graphql.NewNonNull(user),
+					Args:    graphql.FieldConfigArgument{"input": {Type: graphql.NewNonNull(input("CreateUserInput", true))}},
+					Resolve: s.resolveCreateUser,
+				},
+				"updateUser": &graphql.Field{
+					Type: graphql.NewNonNull(user),
+					Args: graphql.FieldConfigArgument{
+						"id":    {Type: graphql.NewNonNull(graphql.ID)},
+						"input": {Type: graphql.NewNonNull(input("UpdateUserInput", false))},
+					},
+					Resolve: s.resolveUpdateUser,
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Subscription",
+			Fields: graphql.Fields{
+				"userEvents": &graphql.Field{
+					Type:        graphql.NewNonNull(event),
+					Description: "Changes to the user with the given id, or to every user.",
+					Args:        graphql.FieldConfigArgument{"id": {Type: graphql.ID}},
+					Subscribe:   s.subscribeUserEvents,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+				},
+			},
+		}),
+	}
+}
+
+func (s *Schema) resolveUser(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	id, _ := p.Args["id"].(string)
+	if err := required(ctx, map[string]string{"id": id}); err != nil {
+		return nil, err
+	}
+
+	check, err := s.queueAuthorization(ctx, apikeys.ScopeUsersRead, rbac.ActionReadUser, rbac.UserResource(id))
+	if err != nil {
+		return nil, err
+	}
+
+	load := loaderFromContext(ctx, s.usersClient).userById(ctx, id)
+	return func() (interface{}, error) {
+		if err := check(); err != nil {
+			return nil, err
+		}
+		user, err := load()
+		if err != nil {
+			return nil, usersError(ctx, err)
+		}
+		return user, nil
+	}, nil
+}
+
+func (s *Schema) resolveUserByEmail(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	email, _ := p.Args["email"].(string)
+	email = strings.ToLower(email)
+	if err := s.validate(ctx, "POST", "/v1/users/search", "", map[string]string{"email": email}); err != nil {
+		return nil, err
+	}
+	if err := required(ctx, map[string]string{"email": email}); err != nil {
+		return nil, err
+	}
+
+	readsAny, err := s.readsAnyUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Callers who can't read every user only get their own record, so that
+	// is the one to check.
+	subject, _ := auth.UserIdFromContext(ctx)
+	check := func() error { return nil }
+	if !readsAny {
+		if check, err = s.queueAuthorization(ctx, apikeys.ScopeUsersRead, rbac.ActionReadUser, rbac.UserResource(subject)); err != nil {
+			return nil, err
+		}
+	}
+
+	load := loaderFromContext(ctx, s.usersClient).userByEmail(ctx, email)
+	return func() (interface{}, error) {
+		user, err := load()
+		if err != nil {
+			return nil, usersError(ctx, err)
+		}
+		// Someone else's email is answered as unknown, so callers who can't
+		// read every user aren't told which emails are registered.
+		if !readsAny {
+			if user.Id != subject {
+				return nil, catalogError(ctx, errcatalog.NotFound)
+			}
+			if err := check(); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}, nil
+}
+
+// resolveUsers returns a page of users after the cursor, which is the last
+// id of the previous page.
+func (s *Schema) resolveUsers(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	first, _ := p.Args["first"].(int)
+	if first < 1 || first > maxPageSize {
+		return nil, invalid(ctx, []openapi.Violation{{Field: "first", Code: string(errcatalog.Invalid)}})
+	}
+	var after string
+	if cursor, _ := p.Args["after"].(string); cursor != "" {
+		id, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, invalid(ctx, []openapi.Violation{{Field: "after", Code: string(errcatalog.Invalid)}})
+		}
+		after = string(id)
+	}
+
+	// No user owns the whole list, so only permissions on any user allow it.
+	if err := s.authorize(ctx, apikeys.ScopeUsersAdmin, rbac.ActionReadUser, rbac.Resource{Type: "users"}); err != nil {
+		return nil, err
+	}
+
+	// One more than the page tells whether there is a next one.
+	page, err := s.usersClient.ListUsers(ctx, after, first+1)
+	if err != nil {
+		return nil, usersError(ctx, err)
+	}
+
+	connection := UserConnection{Edges: []UserEdge{}}
+	if len(page) > first {
+		page, connection.PageInfo.HasNextPage = page[:first], true
+	}
+	for _, user := range page {
+		connection.Edges = append(connection.Edges, UserEdge{Cursor: cursor(user.Id), Node: user})
+	}
+	if len(page) > 0 {
+		end := cursor(page[len(page)-1].Id)
+		connection.PageInfo.EndCursor = &end
+	}
+	return connection, nil
+}
+
+func (s *Schema) resolveCreateUser(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	// Signing up needs no credentials, but an API key must be allowed to
+	// write.
+	if key, ok := apikeys.ApiKeyFromContext(ctx); ok && !key.HasScope(apikeys.ScopeUsersWrite) {
+		return nil, scopeError(ctx, key, apikeys.ScopeUsersWrite)
+	}
+
+	body := inputValues(p.Args["input"])
+	if err := s.validate(ctx, "POST", "/v1/users", "input.", body); err != nil {
+		return nil, err
+	}
+	password := body["password"]
+	delete(body, "password")
+	if err := requiredInput(ctx, body); err != nil {
+		return nil, err
+	}
+	if password != "" && len(password) < minPasswordLength {
+		return nil, invalid(ctx, []openapi.Violation{{
+			Field:  "input.password",
+			Code:   openapi.ViolationTooShort,
+			Params: map[string]string{"min": strconv.Itoa(minPasswordLength)},
+		}})
+	}
+
+	user, err := s.usersClient.CreateUser(ctx, body["first_name"], body["last_name"], body["email"], body["address"], body["city"], body["state"], body["zip"], body["dob"])
+	if err != nil {
+		return nil, usersError(ctx, err)
+	}
+
+	if password != "" {
+		if err := s.usersClient.SetPassword(ctx, user.Id, password); err != nil {
+			return nil, usersError(ctx, err)
+		}
+	}
+
+	// The account exists either way; a failed send can be retried through
+	// the resend endpoint.
+	if err := s.verificationClient.SendVerification(ctx, user.Id); err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"Id": user.Id}).Errorf("%+v", err)
+	}
+
+	return user, nil
+}
+
+func (s *Schema) resolveUpdateUser(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	id, _ := p.Args["id"].(string)
+	if err := required(ctx, map[string]string{"id": id}); err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, apikeys.ScopeUsersWrite, rbac.ActionUpdateUser, rbac.UserResource(id)); err != nil {
+		return nil, err
+	}
+
+	body := inputValues(p.Args["input"])
+	if err := s.validate(ctx, "PUT", "/v1/users/{id}", "input.", body); err != nil {
+		return nil, err
+	}
+	if err := requiredInput(ctx, body); err != nil {
+		return nil, err
+	}
+
+	user, err := s.usersClient.UpdateUser(ctx, id, body["first_name"], body["last_name"], body["email"], body["address"], body["city"], body["state"], body["zip"], body["dob"])
+	if err != nil {
+		return nil, usersError(ctx, err)
+	}
+	return user, nil
+}
+
+// subscribeUserEvents forwards events for the user with the given id, or
+// for every user. The caller is authorized once, when subscribing.
+func (s *Schema) subscribeUserEvents(p graphql.ResolveParams) (interface{}, error) {
+	ctx := p.Context
+	id, _ := p.Args["id"].(string)
+
+	scope, resource := apikeys.ScopeUsersAdmin, rbac.Resource{Type: "users"}
+	if id != "" {
+		scope, resource = apikeys.ScopeUsersRead, rbac.UserResource(id)
+	}
+	if err := s.authorize(ctx, scope, rbac.ActionReadUser, resource); err != nil {
+		return nil, err
+	}
+
+	events := s.events.Subscribe(ctx)
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for e := range events {
+			if id != "" && e.User.Id != id {
+				continue
+			}
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// inputValues reads an input object into the JSON names of the matching
+// REST request, lowercasing the email as the REST handlers do. Empty
+// values are left out, so validation reports them as missing.
+func inputValues(arg interface{}) map[string]string {
+	input, _ := arg.(map[string]interface{})
+	values := map[string]string{}
+	for name, field := range inputFields {
+		if v, _ := input[field].(string); v != "" {
+			values[name] = v
+		}
+	}
+	if email, ok := values["email"]; ok {
+		values["email"] = strings.ToLower(email)
+	}
+	return values
+}
+
+// validate checks body against the request schema of the REST route for
+// method and template. Violations are renamed to the GraphQL fields, under
+// prefix.
+func (s *Schema) validate(ctx context.Context, method, template, prefix string, body map[string]string) error {
+	if s.validator == nil {
+		return nil
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("%+v", err)
+		return catalogError(ctx, errcatalog.Internal)
+	}
+	// Request only fails for bodies that aren't JSON.
+	violations, _ := s.validator.Request(method, template, nil, b)
+	for i, v := range violations {
+		if field, ok := inputFields[v.Field]; ok {
+			violations[i].Field = prefix + field
+		}
+	}
+	return invalid(ctx, violations)
+}
+
+// requiredInput checks every field of an input object but the password is
+// set. It holds with schema validation off too.
+func requiredInput(ctx context.Context, body map[string]string) error {
+	values := map[string]string{}
+	for name, field := range inputFields {
+		if name != "password" {
+			values["input."+field] = body[name]
+		}
+	}
+	return required(ctx, values)
+}
+
+// required checks none of the values, by field, are empty.
+func required(ctx context.Context, values map[string]string) error {
+	var violations []openapi.Violation
+	for field, value := range values {
+		if value == "" {
+			violations = append(violations, openapi.Violation{Field: field, Code: openapi.ViolationRequired})
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Field < violations[j].Field
+	})
+	return invalid(ctx, violations)
+}
+
+// invalid is the invalid error for violations, if there are any.
+func invalid(ctx context.Context, violations []openapi.Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fields := make([]string, len(violations))
+	for i, v := range violations {
+		fields[i] = v.String()
+	}
+	logging.FromContext(ctx).WithFields(log.Fields{"Violations": strings.Join(fields, "; ")}).Warn("Request failed validation")
+	return catalogError(ctx, errcatalog.Invalid, violations...)
+}
+
+// authorize checks the caller may perform the action on the resource. API
+// keys were checked for the read scope when the request came in; scope is
+// what this field needs of them.
+func (s *Schema) authorize(ctx context.Context, scope apikeys.Scope, action rbac.Action, resource rbac.Resource) error {
+	check, err := s.queueAuthorization(ctx, scope, action, resource)
+	if err != nil {
+		return err
+	}
+	return check()
+}
+
+// queueAuthorization is authorize for fields resolved by thunk: API keys
+// and missing credentials fail at once, and the caller's permission is
+// queued with the operation's other checks, to be decided by the thunk.
+func (s *Schema) queueAuthorization(ctx context.Context, scope apikeys.Scope, action rbac.Action, resource rbac.Resource) (func() error, error) {
+	if key, ok := apikeys.ApiKeyFromContext(ctx); ok {
+		if !key.HasScope(scope) {
+			return nil, scopeError(ctx, key, scope)
+		}
+		return func() error { return nil }, nil
+	}
+
+	subject, ok := auth.UserIdFromContext(ctx)
+	if !ok {
+		return nil, catalogError(ctx, errcatalog.Unauthorized)
+	}
+
+	can := authorizerFromContext(ctx, s.rbacClient).can(ctx, subject, action, resource)
+	return func() error {
+		allowed, err := can()
+		if err != nil {
+			return catalogError(ctx, errcatalog.Internal)
+		}
+		if !allowed {
+			return catalogError(ctx, errcatalog.Forbidden)
+		}
+		return nil
+	}, nil
+}
+
+// readsAnyUser reports whether the caller may read every user record: API
+// keys with the read scope and subjects permitted on any user. Subjects are
+// asked about once per operation.
+func (s *Schema) readsAnyUser(ctx context.Context) (bool, error) {
+	if key, ok := apikeys.ApiKeyFromContext(ctx); ok {
+		if !key.HasScope(apikeys.ScopeUsersRead) {
+			return false, scopeError(ctx, key, apikeys.ScopeUsersRead)
+		}
+		return true, nil
+	}
+
+	subject, ok := auth.UserIdFromContext(ctx)
+	if !ok {
+		return false, catalogError(ctx, errcatalog.Unauthorized)
+	}
+
+	allowed, err := authorizerFromContext(ctx, s.rbacClient).readsAnyUser(ctx, subject)
+	if err != nil {
+		return false, catalogError(ctx, errcatalog.Internal)
+	}
+	return allowed, nil
+}
+
+func scopeError(ctx context.Context, key *apikeys.ApiKey, scope apikeys.Scope) error {
+	logging.FromContext(ctx).WithFields(log.Fields{"Key": key.Prefix, "Required Scope": scope}).Warn("API key missing required scope")
+	return catalogError(ctx, errcatalog.Forbidden)
+}
+
+func cursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
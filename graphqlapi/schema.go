@@ -0,0 +1,224 @@
+// Package graphqlapi serves users over GraphQL, on the same clients,
+// credentials and request schemas as the REST and gRPC APIs. Lookups by id
+// and email within an operation are batched into one query per level of
+// the selection set, and operations are checked against Limits before they
+// run.
+package graphqlapi
+
+import (
+	"context"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"db_practice/internal/openapi"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Events is where subscriptions get user events from.
+type Events interface {
+	Subscribe(ctx context.Context) <-chan users.Event
+}
+
+// Schema runs GraphQL operations over users.
+type Schema struct {
+	schema graphql.Schema
+	limits Limits
+
+	usersClient        users.Client
+	rbacClient         rbac.Client
+	verificationClient verification.Client
+	events             Events
+	validator          *openapi.Validator
+}
+
+// NewSchema builds the schema. Until SetValidator is called, arguments are
+// only checked for being present.
+func NewSchema(u users.Client, p rbac.Client, v verification.Client, events Events, limits Limits) (*Schema, error) {
+	s := &Schema{
+		limits:             limits,
+		usersClient:        u,
+		rbacClient:         p,
+		verificationClient: v,
+		events:             events,
+	}
+
+	schema, err := graphql.NewSchema(s.config())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s.schema = schema
+	return s, nil
+}
+
+// SetValidator checks arguments against the request schemas of the
+// matching REST routes, so every API accepts the same values. A nil
+// validator leaves the schema checks out, as turning off request
+// validation does for REST.
+func (s *Schema) SetValidator(v *openapi.Validator) {
+	s.validator = v
+}
+
+// Params is a GraphQL request.
+type Params struct {
+	Query         string
+	OperationName string
+	Variables     map[string]interface{}
+	// AcceptLanguage picks the language of error messages.
+	AcceptLanguage string
+	// Stream is set for clients that take a stream of results, which
+	// subscriptions need.
+	Stream bool
+}
+
+// Operation is a request that passed Prepare, ready to run.
+type Operation struct {
+	params     Params
+	doc        *ast.Document
+	definition *ast.OperationDefinition
+}
+
+// Subscription reports whether the operation is a subscription, which runs
+// with Subscribe rather than Execute.
+func (o *Operation) Subscription() bool {
+	return o.definition.Operation == ast.OperationTypeSubscription
+}
+
+// Prepare parses the request and checks it against the schema and the
+// limits. A request that fails is answered with the result returned.
+func (s *Schema) Prepare(ctx context.Context, p Params) (*Operation, *graphql.Result) {
+	ctx = withLanguage(ctx, p.AcceptLanguage)
+	fail := func(errs ...error) (*Operation, *graphql.Result) {
+		return nil, &graphql.Result{Errors: formatErrors(ctx, gqlerrors.FormatErrors(errs...))}
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(p.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if result := graphql.ValidateDocument(&s.schema, doc, nil); !result.IsValid {
+		return nil, &graphql.Result{Errors: formatErrors(ctx, result.Errors)}
+	}
+
+	definition, err := operation(doc, p.OperationName)
+	if err != nil {
+		return fail(err)
+	}
+	if definition.Operation == ast.OperationTypeSubscription && !p.Stream {
+		return fail(&Error{
+			message:   "Subscriptions are only served to clients accepting text/event-stream.",
+			code:      errcatalog.BadRequest,
+			requestID: logging.RequestID(ctx),
+		})
+	}
+	if !s.limits.Introspection && introspects(doc, definition.SelectionSet) {
+		return fail(catalogError(ctx, errcatalog.Forbidden))
+	}
+	depth, complexity := measure(doc, definition.SelectionSet, p.Variables)
+	if depth > s.limits.MaxDepth {
+		return fail(limitError(ctx, "depth", depth, s.limits.MaxDepth))
+	}
+	if complexity > s.limits.MaxComplexity {
+		return fail(limitError(ctx, "complexity", complexity, s.limits.MaxComplexity))
+	}
+
+	return &Operation{params: p, doc: doc, definition: definition}, nil
+}
+
+// Execute runs a query or mutation.
+func (s *Schema) Execute(ctx context.Context, op *Operation) *graphql.Result {
+	ctx = withLoader(withLanguage(ctx, op.params.AcceptLanguage), newLoader(s.usersClient))
+	ctx = withAuthorizer(ctx, newAuthorizer(s.rbacClient))
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           op.doc,
+		OperationName: op.params.OperationName,
+		Args:          op.params.Variables,
+		Context:       ctx,
+	})
+	result.Errors = formatErrors(ctx, result.Errors)
+	return result
+}
+
+// Subscribe runs a subscription, sending a result per event until ctx is
+// done. A subscription that can't start sends one result with its errors.
+// The channel is closed once the subscription has stopped.
+func (s *Schema) Subscribe(ctx context.Context, op *Operation) <-chan *graphql.Result {
+	ctx = withLanguage(ctx, op.params.AcceptLanguage)
+	results := graphql.ExecuteSubscription(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           op.doc,
+		OperationName: op.params.OperationName,
+		Args:          op.params.Variables,
+		Context:       ctx,
+	})
+
+	out := make(chan *graphql.Result)
+	go func() {
+		defer close(out)
+		for result := range results {
+			result.Errors = formatErrors(ctx, result.Errors)
+			select {
+			case out <- result:
+			case <-ctx.Done():
+				// graphql-go may be blocked sending the next result; it
+				// stops once it sees ctx is done.
+				for range results {
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// operation finds the operation to run: the one named, or the only one.
+func operation(doc *ast.Document, name string) (*ast.OperationDefinition, error) {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil, errors.New("Must provide operation name if query contains multiple operations.")
+			}
+			found = op
+		} else if op.Name != nil && op.Name.Value == name {
+			return op, nil
+		}
+	}
+	if found == nil {
+		if name != "" {
+			return nil, fmt.Errorf("Unknown operation named %q.", name)
+		}
+		return nil, errors.New("Must provide an operation.")
+	}
+	return found, nil
+}
+
+// limitError rejects an operation over one of the limits.
+func limitError(ctx context.Context, limit string, value, max int) *Error {
+	logging.FromContext(ctx).Warnf("GraphQL operation rejected: %s %d over %d", limit, value, max)
+	return &Error{
+		message:   fmt.Sprintf("Operation %s %d exceeds the maximum of %d.", limit, value, max),
+		code:      errcatalog.BadRequest,
+		requestID: logging.RequestID(ctx),
+	}
+}
@@ -0,0 +1,404 @@
+package graphqlapi
+
+import (
+	"context"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testLimits = Limits{MaxDepth: 5, MaxComplexity: 100}
+
+const createMutation = `mutation($input: CreateUserInput!) { createUser(input: $input) { id email } }`
+
+func createInput(overrides map[string]interface{}) map[string]interface{} {
+	input := map[string]interface{}{
+		"firstName": "Jane",
+		"lastName":  "Doe",
+		"email":     "Jane@Example.com",
+		"address":   "1 Main St",
+		"city":      "Springfield",
+		"state":     "IL",
+		"zip":       "62701",
+		"dob":       "1990-01-01",
+	}
+	for k, v := range overrides {
+		input[k] = v
+	}
+	return map[string]interface{}{"input": input}
+}
+
+// errorCodes lists the code of each of the result's errors, and the fields
+// of their field errors.
+func errorCodes(t *testing.T, result *graphql.Result) (codes, fields []string) {
+	for _, e := range result.Errors {
+		code, _ := e.Extensions["code"].(string)
+		codes = append(codes, code)
+		if fe, ok := e.Extensions["fields"].([]FieldError); ok {
+			for _, f := range fe {
+				fields = append(fields, f.Field)
+				assert.NotEmpty(t, f.Message)
+			}
+		}
+	}
+	return codes, fields
+}
+
+func TestExecute(t *testing.T) {
+	stored := []*users.User{
+		{Id: "1", FirstName: "Jane", Email: "jane@example.com"},
+		{Id: "2", FirstName: "John", Email: "john@example.com"},
+		{Id: "3", FirstName: "Ann", Email: "ann@example.com"},
+	}
+	asUser := auth.WithUserId(context.Background(), "1")
+	withKey := func(scope apikeys.Scope) context.Context {
+		return apikeys.WithApiKey(context.Background(), &apikeys.ApiKey{Prefix: "k", Scopes: []apikeys.Scope{scope}})
+	}
+
+	testCases := []struct {
+		description    string
+		ctx            context.Context
+		query          string
+		variables      map[string]interface{}
+		users          users.TestClient
+		rbac           rbac.Client
+		limits         *Limits
+		expectedData   string
+		expectedCodes  []string
+		expectedFields []string
+	}{
+		{
+			description:  "Success: User by id",
+			ctx:          asUser,
+			query:        `{ user(id: "1") { id firstName email } }`,
+			expectedData: `{"user":{"id":"1","firstName":"Jane","email":"jane@example.com"}}`,
+		},
+		{
+			description:  "Success: User by email, lowercased",
+			ctx:          asUser,
+			query:        `{ userByEmail(email: "John@Example.com") { id } }`,
+			expectedData: `{"userByEmail":{"id":"2"}}`,
+		},
+		{
+			description:  "Success: Own user by email without permission on any user",
+			ctx:          asUser,
+			query:        `{ userByEmail(email: "jane@example.com") { id } }`,
+			rbac:         rbac.TestClient{CanData: true, OwnOnly: true},
+			expectedData: `{"userByEmail":{"id":"1"}}`,
+		},
+		{
+			description:   "Failure: Someone else's email answered as unknown",
+			ctx:           asUser,
+			query:         `{ userByEmail(email: "john@example.com") { id } }`,
+			rbac:          rbac.TestClient{CanData: true, OwnOnly: true},
+			expectedData:  `{"userByEmail":null}`,
+			expectedCodes: []string{"not_found"},
+		},
+		{
+			description:  "Success: Page of users with an API key",
+			ctx:          withKey(apikeys.ScopeUsersAdmin),
+			query:        `{ users(first: 2) { edges { cursor node { id } } pageInfo { hasNextPage endCursor } } }`,
+			users:        users.TestClient{ListUsersData: stored},
+			expectedData: `{"users":{"edges":[{"cursor":"MQ","node":{"id":"1"}},{"cursor":"Mg","node":{"id":"2"}}],"pageInfo":{"hasNextPage":true,"endCursor":"Mg"}}}`,
+		},
+		{
+			description:  "Success: Last page",
+			ctx:          asUser,
+			query:        `{ users(first: 5, after: "Mg") { edges { node { id } } pageInfo { hasNextPage } } }`,
+			users:        users.TestClient{ListUsersData: stored[2:]},
+			expectedData: `{"users":{"edges":[{"node":{"id":"3"}}],"pageInfo":{"hasNextPage":false}}}`,
+		},
+		{
+			description:  "Success: Signed up without credentials",
+			query:        createMutation,
+			variables:    createInput(nil),
+			users:        users.TestClient{CreateUserData: stored[0]},
+			expectedData: `{"createUser":{"id":"1","email":"jane@example.com"}}`,
+		},
+		{
+			description:  "Success: Updated",
+			ctx:          asUser,
+			query:        `mutation($input: UpdateUserInput!) { updateUser(id: "1", input: $input) { id } }`,
+			variables:    createInput(nil),
+			users:        users.TestClient{UpdateUserData: stored[0]},
+			expectedData: `{"updateUser":{"id":"1"}}`,
+		},
+		{
+			description:   "Failure: Not found",
+			ctx:           asUser,
+			query:         `{ user(id: "4") { id } }`,
+			expectedData:  `{"user":null}`,
+			expectedCodes: []string{"not_found"},
+		},
+		{
+			description:   "Failure: No credentials",
+			ctx:           context.Background(),
+			query:         `{ user(id: "1") { id } }`,
+			expectedData:  `{"user":null}`,
+			expectedCodes: []string{"unauthorized"},
+		},
+		{
+			description:   "Failure: Not permitted",
+			ctx:           asUser,
+			query:         `{ user(id: "2") { id } }`,
+			rbac:          rbac.TestClient{},
+			expectedData:  `{"user":null}`,
+			expectedCodes: []string{"forbidden"},
+		},
+		{
+			description:   "Failure: Listing needs the admin scope",
+			ctx:           withKey(apikeys.ScopeUsersWrite),
+			query:         `{ users { edges { cursor } } }`,
+			expectedData:  `null`,
+			expectedCodes: []string{"forbidden"},
+		},
+		{
+			description:    "Failure: Page too large",
+			ctx:            asUser,
+			query:          `{ users(first: 101) { edges { cursor } } }`,
+			limits:         &Limits{MaxDepth: 5, MaxComplexity: 1000},
+			expectedData:   `null`,
+			expectedCodes:  []string{"invalid"},
+			expectedFields: []string{"first"},
+		},
+		{
+			description:    "Failure: Missing fields and short password",
+			query:          createMutation,
+			variables:      createInput(map[string]interface{}{"city": "", "password": "short"}),
+			expectedData:   `null`,
+			expectedCodes:  []string{"invalid"},
+			expectedFields: []string{"input.city"},
+		},
+		{
+			description:    "Failure: Short password",
+			query:          createMutation,
+			variables:      createInput(map[string]interface{}{"password": "short"}),
+			expectedData:   `null`,
+			expectedCodes:  []string{"invalid"},
+			expectedFields: []string{"input.password"},
+		},
+		{
+			description:    "Failure: Email taken",
+			query:          createMutation,
+			variables:      createInput(nil),
+			users:          users.TestClient{CreateUserErr: users.ErrEmailExists},
+			expectedData:   `null`,
+			expectedCodes:  []string{"conflict_error"},
+			expectedFields: []string{"input.email"},
+		},
+		{
+			description:   "Failure: API key can't write",
+			ctx:           withKey(apikeys.ScopeUsersRead),
+			query:         createMutation,
+			variables:     createInput(nil),
+			expectedData:  `null`,
+			expectedCodes: []string{"forbidden"},
+		},
+		{
+			description:   "Failure: Database error",
+			ctx:           asUser,
+			query:         `mutation($input: UpdateUserInput!) { updateUser(id: "1", input: $input) { id } }`,
+			variables:     createInput(nil),
+			users:         users.TestClient{UpdateUserErr: errors.New("connection refused")},
+			expectedData:  `null`,
+			expectedCodes: []string{"internal_error"},
+		},
+		{
+			description:   "Failure: Syntax error",
+			ctx:           asUser,
+			query:         `{ user(id: "1") { id }`,
+			expectedData:  `null`,
+			expectedCodes: []string{"invalid"},
+		},
+		{
+			description:   "Failure: Unknown field",
+			ctx:           asUser,
+			query:         `{ user(id: "1") { password } }`,
+			expectedData:  `null`,
+			expectedCodes: []string{"invalid"},
+		},
+		{
+			description:   "Failure: Too complex",
+			ctx:           asUser,
+			query:         `{ users(first: 50) { edges { node { id email } } } }`,
+			expectedData:  `null`,
+			expectedCodes: []string{"bad_request"},
+		},
+		{
+			description:   "Failure: Introspection disabled",
+			ctx:           asUser,
+			query:         `{ __schema { queryType { name } } }`,
+			expectedData:  `null`,
+			expectedCodes: []string{"forbidden"},
+		},
+		{
+			description:   "Failure: Subscription without a stream",
+			ctx:           asUser,
+			query:         `subscription { userEvents { type } }`,
+			expectedData:  `null`,
+			expectedCodes: []string{"bad_request"},
+		},
+		{
+			description:  "Success: Introspection enabled",
+			ctx:          asUser,
+			query:        `{ __schema { queryType { name } } }`,
+			limits:       &Limits{MaxDepth: 5, MaxComplexity: 100, Introspection: true},
+			expectedData: `{"__schema":{"queryType":{"name":"Query"}}}`,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			if tc.ctx == nil {
+				tc.ctx = context.Background()
+			}
+			if tc.rbac == nil {
+				tc.rbac = rbac.TestClient{CanData: true}
+			}
+			limits := testLimits
+			if tc.limits != nil {
+				limits = *tc.limits
+			}
+			client := &batchingClient{TestClient: tc.users, stored: stored}
+			schema, err := NewSchema(client, tc.rbac, verification.TestClient{}, nil, limits)
+			require.NoError(t, err)
+
+			op, result := schema.Prepare(tc.ctx, Params{Query: tc.query, Variables: tc.variables})
+			if result == nil {
+				result = schema.Execute(tc.ctx, op)
+			}
+
+			data, err := json.Marshal(result.Data)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.expectedData, string(data))
+			codes, fields := errorCodes(t, result)
+			assert.Equal(t, tc.expectedCodes, codes)
+			assert.Equal(t, tc.expectedFields, fields)
+			for _, e := range result.Errors {
+				assert.NotContains(t, e.Message, "connection refused")
+			}
+		})
+	}
+}
+
+func TestExecuteBatches(t *testing.T) {
+	client := &batchingClient{stored: []*users.User{{Id: "1"}, {Id: "2"}}}
+	schema, err := NewSchema(client, rbac.TestClient{CanData: true}, verification.TestClient{}, nil, testLimits)
+	require.NoError(t, err)
+
+	ctx := auth.WithUserId(context.Background(), "1")
+	op, result := schema.Prepare(ctx, Params{
+		Query: `{ a: user(id: "1") { id } b: user(id: "2") { id } c: user(id: "1") { id } d: user(id: "3") { id } }`,
+	})
+	require.Nil(t, result)
+	result = schema.Execute(ctx, op)
+
+	data, err := json.Marshal(result.Data)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":{"id":"1"},"b":{"id":"2"},"c":{"id":"1"},"d":null}`, string(data))
+	codes, _ := errorCodes(t, result)
+	assert.Equal(t, []string{"not_found"}, codes)
+	// Fields resolve in no set order, but in one batch.
+	require.Len(t, client.batches, 1)
+	assert.ElementsMatch(t, []string{"1", "2", "3"}, client.batches[0])
+}
+
+// testEvents hands subscriptions the events sent on it.
+type testEvents chan users.Event
+
+func (e testEvents) Subscribe(ctx context.Context) <-chan users.Event {
+	return e
+}
+
+func TestSubscribe(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		description    string
+		ctx            context.Context
+		query          string
+		events         []users.Event
+		expectedData   []string
+		expectedCodes  []string
+		expectedClosed bool
+	}{
+		{
+			description: "Success: Events for one user",
+			ctx:         auth.WithUserId(context.Background(), "1"),
+			query:       `subscription { userEvents(id: "1") { type at user { id email } } }`,
+			events: []users.Event{
+				{Type: users.EventUpdated, User: &users.User{Id: "2"}, At: at},
+				{Type: users.EventUpdated, User: &users.User{Id: "1", Email: "jane@example.com"}, At: at},
+				{Type: users.EventDeleted, User: &users.User{Id: "1"}, At: at},
+			},
+			expectedData: []string{
+				`{"userEvents":{"type":"UPDATED","at":"2024-01-02T03:04:05Z","user":{"id":"1","email":"jane@example.com"}}}`,
+				`{"userEvents":{"type":"DELETED","at":"2024-01-02T03:04:05Z","user":{"id":"1","email":""}}}`,
+			},
+		},
+		{
+			description:    "Failure: No credentials",
+			ctx:            context.Background(),
+			query:          `subscription { userEvents { type } }`,
+			expectedCodes:  []string{"unauthorized"},
+			expectedClosed: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			events := make(testEvents)
+			t.Cleanup(func() { close(events) })
+			schema, err := NewSchema(&batchingClient{}, rbac.TestClient{CanData: true}, verification.TestClient{}, events, testLimits)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(tc.ctx)
+			defer cancel()
+			op, result := schema.Prepare(ctx, Params{Query: tc.query, Stream: true})
+			require.Nil(t, result)
+			require.True(t, op.Subscription())
+			results := schema.Subscribe(ctx, op)
+
+			if tc.expectedClosed {
+				result := <-results
+				codes, _ := errorCodes(t, result)
+				assert.Equal(t, tc.expectedCodes, codes)
+				_, ok := <-results
+				assert.False(t, ok)
+				return
+			}
+
+			go func() {
+				for _, e := range tc.events {
+					select {
+					case events <- e:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+			for _, expected := range tc.expectedData {
+				result := <-results
+				assert.Empty(t, result.Errors)
+				data, err := json.Marshal(result.Data)
+				require.NoError(t, err)
+				assert.JSONEq(t, expected, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package grpcapi
+
+import (
+	"context"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// Credentials travel in metadata named after the HTTP headers.
+const (
+	ApiKeyMetadata        = "x-api-key"
+	AuthorizationMetadata = "authorization"
+)
+
+// AuthPolicy is what each method asks of its callers.
+type AuthPolicy struct {
+	// Scopes holds the scope an API key needs, by full method name.
+	Scopes map[string]apikeys.Scope
+	// Public lists the methods callers may use without credentials, by
+	// full method name or, ending in "/", by service.
+	Public []string
+}
+
+// Authenticator checks calls the way EnforceScopes and RequireAuth check
+// HTTP requests: an API key must have the scope the method needs, and
+// without one a bearer access token identifies the user. Credentials that
+// are sent are checked even for public methods.
+type Authenticator struct {
+	authClient    auth.Client
+	apiKeysClient apikeys.Client
+	policy        AuthPolicy
+}
+
+func NewAuthenticator(a auth.Client, k apikeys.Client, policy AuthPolicy) *Authenticator {
+	return &Authenticator{
+		authClient:    a,
+		apiKeysClient: k,
+		policy:        policy,
+	}
+}
+
+// Unary is the unary server interceptor.
+func (a *Authenticator) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// Stream is the stream server interceptor.
+func (a *Authenticator) Stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate returns ctx carrying the caller's API key or user id.
+func (a *Authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if rawKey := firstValue(ctx, ApiKeyMetadata); rawKey != "" {
+		key, err := a.apiKeysClient.Authenticate(ctx, rawKey)
+		if err != nil {
+			if errors.Cause(err) == apikeys.ErrInvalidKey {
+				logging.FromContext(ctx).Warn("API key rejected")
+				return nil, catalogError(ctx, codes.Unauthenticated, errcatalog.Unauthorized)
+			}
+			logging.FromContext(ctx).Errorf("%+v", err)
+			return nil, catalogError(ctx, codes.Internal, errcatalog.Internal)
+		}
+
+		if required, ok := a.policy.Scopes[method]; ok && !key.HasScope(required) {
+			fields := log.Fields{"Key": key.Prefix, "Required Scope": required}
+			logging.FromContext(ctx).WithFields(fields).Warn("API key missing required scope")
+			return nil, catalogError(ctx, codes.PermissionDenied, errcatalog.Forbidden)
+		}
+		return apikeys.WithApiKey(ctx, key), nil
+	}
+
+	if header := firstValue(ctx, AuthorizationMetadata); header != "" {
+		token, ok := bearerToken(header)
+		if !ok {
+			return nil, catalogError(ctx, codes.Unauthenticated, errcatalog.Unauthorized)
+		}
+		claims, err := a.authClient.ValidateAccessToken(token)
+		if err != nil {
+			logging.FromContext(ctx).Warnf("Access token rejected: %v", err)
+			return nil, catalogError(ctx, codes.Unauthenticated, errcatalog.Unauthorized)
+		}
+		return auth.WithUserId(ctx, claims.Subject), nil
+	}
+
+	if a.public(method) {
+		return ctx, nil
+	}
+	return nil, catalogError(ctx, codes.Unauthenticated, errcatalog.Unauthorized)
+}
+
+func (a *Authenticator) public(method string) bool {
+	for _, p := range a.policy.Public {
+		if p == method || strings.HasSuffix(p, "/") && strings.HasPrefix(method, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerToken(header string) (string, bool) {
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+func firstValue(ctx context.Context, key string) string {
+	values := metadata.ValueFromIncomingContext(ctx, key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// serverStream replaces a stream's context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,121 @@
+package grpcapi
+
+import (
+	"context"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	usersv1 "db_practice/proto/users/v1"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthenticate(t *testing.T) {
+	readKey := &apikeys.ApiKey{Prefix: "dbp_read", Scopes: []apikeys.Scope{apikeys.ScopeUsersRead}}
+	user := &users.User{Id: "1"}
+
+	testCases := []struct {
+		description  string
+		metadata     []string
+		auth         auth.Client
+		apiKeys      apikeys.Client
+		rbac         rbac.Client
+		expectedCode codes.Code
+	}{
+		{
+			description:  "Success: Bearer token",
+			metadata:     []string{AuthorizationMetadata, "Bearer token"},
+			expectedCode: codes.OK,
+		},
+		{
+			description:  "Success: API key with the scope",
+			metadata:     []string{ApiKeyMetadata, "dbp_read_secret"},
+			apiKeys:      apikeys.TestClient{AuthenticateData: readKey},
+			rbac:         rbac.TestClient{CanData: false},
+			expectedCode: codes.OK,
+		},
+		{
+			description:  "Failure: No credentials",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			description:  "Failure: Not a bearer token",
+			metadata:     []string{AuthorizationMetadata, "Basic dXNlcjpwYXNz"},
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			description:  "Failure: Token rejected",
+			metadata:     []string{AuthorizationMetadata, "Bearer token"},
+			auth:         auth.TestClient{ValidateAccessTokenErr: errors.New("expired")},
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			description:  "Failure: API key rejected",
+			metadata:     []string{ApiKeyMetadata, "dbp_bad"},
+			apiKeys:      apikeys.TestClient{AuthenticateErr: apikeys.ErrInvalidKey},
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			description:  "Failure: API key lookup failing",
+			metadata:     []string{ApiKeyMetadata, "dbp_read_secret"},
+			apiKeys:      apikeys.TestClient{AuthenticateErr: errors.New("connection refused")},
+			expectedCode: codes.Internal,
+		},
+		{
+			description:  "Failure: Role not allowed",
+			metadata:     []string{AuthorizationMetadata, "Bearer token"},
+			rbac:         rbac.TestClient{CanData: false},
+			expectedCode: codes.PermissionDenied,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			conn := testServer{
+				users:   users.TestClient{GetUserByIdData: user},
+				auth:    tc.auth,
+				apiKeys: tc.apiKeys,
+				rbac:    tc.rbac,
+			}.dial(t)
+			ctx := metadata.AppendToOutgoingContext(context.Background(), tc.metadata...)
+			_, err := usersv1.NewUserServiceClient(conn).GetUser(ctx, &usersv1.GetUserRequest{Id: "1"})
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestAuthenticateScopes(t *testing.T) {
+	readKey := &apikeys.ApiKey{Prefix: "dbp_read", Scopes: []apikeys.Scope{apikeys.ScopeUsersRead}}
+	conn := testServer{apiKeys: apikeys.TestClient{AuthenticateData: readKey}}.dial(t)
+	client := usersv1.NewUserServiceClient(conn)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), ApiKeyMetadata, "dbp_read_secret")
+
+	// Credentials sent to a public method are still checked.
+	_, err := client.CreateUser(ctx, &usersv1.CreateUserRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "forbidden", errorReason(t, err))
+
+	stream, err := client.ListUsers(ctx, &usersv1.ListUsersRequest{})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestPublic(t *testing.T) {
+	a := NewAuthenticator(auth.TestClient{}, apikeys.TestClient{}, testPolicy)
+
+	assert.True(t, a.public(usersv1.UserService_CreateUser_FullMethodName))
+	assert.True(t, a.public("/grpc.health.v1.Health/Watch"))
+	assert.False(t, a.public(usersv1.UserService_GetUser_FullMethodName))
+	assert.False(t, a.public("/grpc.health.v1.HealthExtra/Check"))
+}
@@ -0,0 +1,77 @@
+package grpcapi
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"db_practice/internal/openapi"
+	"db_practice/internal/users"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail on every error status,
+// whose reason is the error catalog code REST clients see as "code".
+const ErrorDomain = "db_practice"
+
+// catalogError is the status for an error catalog code, with the code's
+// message in the language the accept-language metadata asks for. Its
+// details carry the code, the request id and, for invalid requests, a
+// field violation per violation.
+func catalogError(ctx context.Context, c codes.Code, code errcatalog.Code, violations ...openapi.Violation) error {
+	tag := errcatalog.Default.Match(strings.Join(metadata.ValueFromIncomingContext(ctx, "accept-language"), ","))
+	entry, _ := errcatalog.Default.Lookup(tag, code)
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: string(code), Domain: ErrorDomain}}
+	if id := logging.RequestID(ctx); id != "" {
+		details = append(details, &errdetails.RequestInfo{RequestId: id})
+	}
+	if len(violations) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, v := range violations {
+			field := v.Field
+			if field == "" {
+				field = "request"
+			}
+			params := map[string]string{"field": field}
+			for k, p := range v.Params {
+				params[k] = p
+			}
+			fieldEntry, _ := errcatalog.Default.Lookup(tag, errcatalog.Code(v.Code))
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field,
+				Description: errcatalog.Render(fieldEntry.FieldMessage, params),
+			})
+		}
+		details = append(details, badRequest)
+	}
+
+	st, err := status.New(c, entry.Message).WithDetails(details...)
+	if err != nil {
+		return status.Error(c, entry.Message)
+	}
+	return st.Err()
+}
+
+// statusError is the status for an error from the users client: NOT_FOUND
+// for a missing user, ALREADY_EXISTS for a taken email and INTERNAL, logged,
+// for anything else.
+func statusError(ctx context.Context, err error) error {
+	switch errors.Cause(err) {
+	case sql.ErrNoRows:
+		return catalogError(ctx, codes.NotFound, errcatalog.NotFound)
+	case users.ErrEmailExists:
+		return catalogError(ctx, codes.AlreadyExists, errcatalog.Conflict,
+			openapi.Violation{Field: "email", Code: string(errcatalog.Conflict)})
+	default:
+		logging.FromContext(ctx).Errorf("%+v", err)
+		return catalogError(ctx, codes.Internal, errcatalog.Internal)
+	}
+}
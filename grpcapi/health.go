@@ -0,0 +1,101 @@
+package grpcapi
+
+import (
+	"context"
+	"db_practice/internal/health"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// defaultWatchInterval is used when NewHealthServer is given no interval.
+const defaultWatchInterval = 5 * time.Second
+
+// HealthServer answers the gRPC health checking protocol from the readiness
+// checks behind /readyz. The server as a whole (service "") and each of its
+// services share one status.
+type HealthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+
+	healthClient health.Client
+	services     map[string]bool
+	// interval is how often Watch runs the checks for changes.
+	interval time.Duration
+
+	shutdownOnce sync.Once
+	shutdown     chan struct{}
+}
+
+// NewHealthServer returns a health service for the server and the named
+// services. Polling more often than the readiness cache TTL only rereads the
+// cached result.
+func NewHealthServer(h health.Client, interval time.Duration, services ...string) *HealthServer {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	known := map[string]bool{"": true}
+	for _, s := range services {
+		known[s] = true
+	}
+	return &HealthServer{
+		healthClient: h,
+		services:     known,
+		interval:     interval,
+		shutdown:     make(chan struct{}),
+	}
+}
+
+func (h *HealthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if !h.services[req.GetService()] {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.GetService())
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: h.status(ctx, req.GetService())}, nil
+}
+
+// Watch sends the status, then again whenever it changes, until the call
+// ends or the server shuts down.
+func (h *HealthServer) Watch(req *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	ctx := stream.Context()
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	sent := false
+	var last grpc_health_v1.HealthCheckResponse_ServingStatus
+	for {
+		current := h.status(ctx, req.GetService())
+		if !sent || current != last {
+			if err := stream.Send(&grpc_health_v1.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+			sent, last = true, current
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-h.shutdown:
+			// Watchers learn the server is going away rather than keeping
+			// a graceful stop waiting.
+			return stream.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_NOT_SERVING})
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown ends every Watch with a final NOT_SERVING.
+func (h *HealthServer) Shutdown() {
+	h.shutdownOnce.Do(func() { close(h.shutdown) })
+}
+
+func (h *HealthServer) status(ctx context.Context, service string) grpc_health_v1.HealthCheckResponse_ServingStatus {
+	if !h.services[service] {
+		return grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	if h.healthClient.Ready(ctx).Status != health.StatusOK {
+		return grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	}
+	return grpc_health_v1.HealthCheckResponse_SERVING
+}
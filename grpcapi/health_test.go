@@ -0,0 +1,105 @@
+package grpcapi
+
+import (
+	"context"
+	"db_practice/internal/health"
+	usersv1 "db_practice/proto/users/v1"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestHealthCheck(t *testing.T) {
+	pass := health.Check{Name: "database", Run: func(ctx context.Context) error { return nil }}
+	fail := health.Check{Name: "database", Run: func(ctx context.Context) error { return errors.New("connection refused") }}
+
+	testCases := []struct {
+		description    string
+		service        string
+		checks         []health.Check
+		expectedStatus grpc_health_v1.HealthCheckResponse_ServingStatus
+		expectedCode   codes.Code
+	}{
+		{
+			description:    "Success: Server serving",
+			checks:         []health.Check{pass},
+			expectedStatus: grpc_health_v1.HealthCheckResponse_SERVING,
+		},
+		{
+			description:    "Success: Service serving",
+			service:        usersv1.UserService_ServiceDesc.ServiceName,
+			checks:         []health.Check{pass},
+			expectedStatus: grpc_health_v1.HealthCheckResponse_SERVING,
+		},
+		{
+			description:    "Failure: Check failing",
+			checks:         []health.Check{fail},
+			expectedStatus: grpc_health_v1.HealthCheckResponse_NOT_SERVING,
+		},
+		{
+			description:  "Failure: Unknown service",
+			service:      "users.v1.Other",
+			expectedCode: codes.NotFound,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			conn := testServer{health: health.NewChecker(0, tc.checks...)}.dial(t)
+			resp, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: tc.service})
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			assert.Equal(t, tc.expectedStatus, resp.GetStatus())
+		})
+	}
+}
+
+func TestHealthWatch(t *testing.T) {
+	var failing atomic.Bool
+	checker := health.NewChecker(0, health.Check{Name: "database", Run: func(ctx context.Context) error {
+		if failing.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}})
+	h := NewHealthServer(checker, 10*time.Millisecond)
+	conn := testServer{healthServer: h}.dial(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := grpc_health_v1.NewHealthClient(conn).Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	expected := []grpc_health_v1.HealthCheckResponse_ServingStatus{
+		grpc_health_v1.HealthCheckResponse_SERVING,
+		grpc_health_v1.HealthCheckResponse_NOT_SERVING,
+		grpc_health_v1.HealthCheckResponse_SERVING,
+	}
+	for i, status := range expected {
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, status, resp.GetStatus(), i)
+		// Each change is sent once, when the next poll sees it.
+		if i < len(expected)-1 {
+			failing.Store(!failing.Load())
+		}
+	}
+
+	h.Shutdown()
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, resp.GetStatus())
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+}
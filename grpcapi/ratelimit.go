@@ -0,0 +1,136 @@
+package grpcapi
+
+import (
+	"context"
+	"db_practice/handlers"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"db_practice/internal/ratelimit"
+	usersv1 "db_practice/proto/users/v1"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// RetryAfterMetadata tells a rate limited caller how many seconds to wait,
+// like the Retry-After header.
+const RetryAfterMetadata = "retry-after"
+
+// methodRoutes names the HTTP route each method mirrors. A method counts
+// against that route's limit, in the same bucket, so a client has one
+// budget across both APIs.
+var methodRoutes = map[string]string{
+	usersv1.UserService_CreateUser_FullMethodName:     "users.create",
+	usersv1.UserService_GetUser_FullMethodName:        "users.get",
+	usersv1.UserService_GetUserByEmail_FullMethodName: "users.search",
+	usersv1.UserService_UpdateUser_FullMethodName:     "users.update",
+}
+
+// RateLimiter applies the HTTP API's rate limits to calls of the user
+// service, counting them against the caller's user, API key or address as
+// the route's limit asks. Methods no route mirrors share the default. A
+// failing store lets calls through, as it does for HTTP requests.
+type RateLimiter struct {
+	store  ratelimit.Store
+	def    handlers.RouteLimit
+	routes map[string]handlers.RouteLimit
+	now    func() time.Time
+}
+
+// NewRateLimiter returns a limiter using the limits the HTTP API has for
+// each route name, and def for the rest.
+func NewRateLimiter(store ratelimit.Store, def handlers.RouteLimit, routes map[string]handlers.RouteLimit) *RateLimiter {
+	return &RateLimiter{
+		store:  store,
+		def:    def,
+		routes: routes,
+		now:    time.Now,
+	}
+}
+
+// Unary is the unary server interceptor. It runs after the Authenticator,
+// which identifies the caller.
+func (l *RateLimiter) Unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	setHeader := func(md metadata.MD) error { return grpc.SetHeader(ctx, md) }
+	if err := l.take(ctx, info.FullMethod, setHeader); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// Stream is the stream server interceptor. A stream counts once, when it
+// is opened.
+func (l *RateLimiter) Stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := l.take(ss.Context(), info.FullMethod, ss.SetHeader); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// take spends a token for the call, returning RESOURCE_EXHAUSTED once the
+// caller has none left.
+func (l *RateLimiter) take(ctx context.Context, method string, setHeader func(metadata.MD) error) error {
+	if !strings.HasPrefix(method, "/"+usersv1.UserService_ServiceDesc.ServiceName+"/") {
+		return nil
+	}
+
+	name, limit := "default", l.def
+	if route, ok := methodRoutes[method]; ok {
+		if routeLimit, ok := l.routes[route]; ok {
+			name, limit = route, routeLimit
+		}
+	}
+	if !limit.Policy.Enabled() {
+		return nil
+	}
+
+	key := name + "|" + identity(ctx, limit.Key)
+	result, err := l.store.Take(ctx, key, limit.Policy, l.now())
+	if err != nil {
+		logging.FromContext(ctx).WithField("Route", name).Errorf("%+v", err)
+		return nil
+	}
+	if result.Allowed {
+		return nil
+	}
+
+	fields := log.Fields{"Route": name, "Key": limit.Key, "Method": method}
+	logging.FromContext(ctx).WithFields(fields).Warn("Rate limit exceeded")
+	// Fails only once headers are sent, which they can't be yet.
+	_ = setHeader(metadata.Pairs(RetryAfterMetadata, strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds())))))
+	return catalogError(ctx, codes.ResourceExhausted, errcatalog.RateLimited)
+}
+
+// identity names the caller a call is counted against, falling back from
+// the user to the API key to the peer address as the HTTP limiter does.
+func identity(ctx context.Context, key handlers.RateLimitKey) string {
+	if key == handlers.LimitByUser {
+		if userId, ok := auth.UserIdFromContext(ctx); ok {
+			return "user:" + userId
+		}
+	}
+	if key == handlers.LimitByUser || key == handlers.LimitByApiKey {
+		if k, ok := apikeys.ApiKeyFromContext(ctx); ok {
+			return "key:" + k.Id
+		}
+	}
+
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+	return "ip:" + addr
+}
@@ -0,0 +1,102 @@
+package grpcapi
+
+import (
+	"context"
+	"db_practice/handlers"
+	"db_practice/internal/ratelimit"
+	"db_practice/internal/users"
+	usersv1 "db_practice/proto/users/v1"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type failingLimitStore struct{}
+
+func (failingLimitStore) Take(ctx context.Context, key string, p ratelimit.Policy, now time.Time) (*ratelimit.Result, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	oncePerMinute := ratelimit.Policy{Requests: 1, Per: time.Minute}
+
+	testCases := []struct {
+		description   string
+		store         ratelimit.Store
+		def           handlers.RouteLimit
+		routes        map[string]handlers.RouteLimit
+		call          func(conn *grpc.ClientConn, header *metadata.MD) error
+		expectedCodes []codes.Code
+	}{
+		{
+			description: "Failure: Anonymous sign ups limited like POST /v1/users",
+			routes:      map[string]handlers.RouteLimit{"users.create": {Key: handlers.LimitByIP, Policy: oncePerMinute}},
+			call: func(conn *grpc.ClientConn, header *metadata.MD) error {
+				_, err := usersv1.NewUserServiceClient(conn).CreateUser(context.Background(), validCreateRequest(), grpc.Header(header))
+				return err
+			},
+			expectedCodes: []codes.Code{codes.OK, codes.ResourceExhausted},
+		},
+		{
+			description: "Failure: Methods without a route limit share the default",
+			def:         handlers.RouteLimit{Key: handlers.LimitByUser, Policy: oncePerMinute},
+			call: func(conn *grpc.ClientConn, header *metadata.MD) error {
+				_, err := usersv1.NewUserServiceClient(conn).GetUser(withToken(), &usersv1.GetUserRequest{Id: "1"}, grpc.Header(header))
+				return err
+			},
+			expectedCodes: []codes.Code{codes.OK, codes.ResourceExhausted},
+		},
+		{
+			description: "Success: Health checks not limited",
+			def:         handlers.RouteLimit{Key: handlers.LimitByIP, Policy: oncePerMinute},
+			call: func(conn *grpc.ClientConn, header *metadata.MD) error {
+				_, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{}, grpc.Header(header))
+				return err
+			},
+			expectedCodes: []codes.Code{codes.OK, codes.OK},
+		},
+		{
+			description: "Success: Failing store lets calls through",
+			store:       failingLimitStore{},
+			routes:      map[string]handlers.RouteLimit{"users.create": {Key: handlers.LimitByIP, Policy: oncePerMinute}},
+			call: func(conn *grpc.ClientConn, header *metadata.MD) error {
+				_, err := usersv1.NewUserServiceClient(conn).CreateUser(context.Background(), validCreateRequest(), grpc.Header(header))
+				return err
+			},
+			expectedCodes: []codes.Code{codes.OK, codes.OK},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			store := tc.store
+			if store == nil {
+				store = ratelimit.NewMemoryStore()
+			}
+			conn := testServer{
+				users:   users.TestClient{CreateUserData: &users.User{Id: "1"}, GetUserByIdData: &users.User{Id: "1"}},
+				limiter: NewRateLimiter(store, tc.def, tc.routes),
+			}.dial(t)
+
+			for _, expected := range tc.expectedCodes {
+				var header metadata.MD
+				err := tc.call(conn, &header)
+				assert.Equal(t, expected, status.Code(err))
+				if expected == codes.ResourceExhausted {
+					assert.Equal(t, "too_many_requests", errorReason(t, err))
+					assert.Equal(t, []string{"60"}, header.Get(RetryAfterMetadata))
+				}
+			}
+		})
+	}
+}
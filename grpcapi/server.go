@@ -0,0 +1,190 @@
+// Package grpcapi serves the user API over gRPC, next to the HTTP API in the
+// same process. It is built on the same clients as the handlers package and
+// shares its authentication, validation rules and error catalog.
+package grpcapi
+
+import (
+	"context"
+	"db_practice/internal/crash"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/lifecycle"
+	"db_practice/internal/logging"
+	usersv1 "db_practice/proto/users/v1"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDMetadata carries the request id both ways, like X-Request-ID.
+const RequestIDMetadata = "x-request-id"
+
+type Options struct {
+	// Reflection registers server reflection, so tools like grpcurl can
+	// call the services without their .proto files.
+	Reflection bool
+	// Reporter is given every recovered panic.
+	Reporter crash.Reporter
+	// RateLimiter, if set, limits calls once they are authenticated.
+	RateLimiter *RateLimiter
+}
+
+// NewServer returns a server for the user and health services. Calls are
+// traced, given a request id and logged, recovered from panics,
+// authenticated and then rate limited, in that order.
+func NewServer(users *UsersServer, health *HealthServer, a *Authenticator, opts Options) *grpc.Server {
+	r := &recoverer{reporter: opts.Reporter}
+	unary := []grpc.UnaryServerInterceptor{logUnary, r.unary, a.Unary}
+	stream := []grpc.StreamServerInterceptor{logStream, r.stream, a.Stream}
+	if opts.RateLimiter != nil {
+		unary = append(unary, opts.RateLimiter.Unary)
+		stream = append(stream, opts.RateLimiter.Stream)
+	}
+	s := grpc.NewServer(
+		// The span continues any trace started by the caller's traceparent.
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	usersv1.RegisterUserServiceServer(s, users)
+	grpc_health_v1.RegisterHealthServer(s, health)
+	if opts.Reflection {
+		reflection.Register(s)
+	}
+	return s
+}
+
+// Hook serves s on addr for as long as the app runs. Stopping ends health
+// watches, then lets calls in flight finish until the shutdown deadline,
+// when the rest are cancelled.
+func Hook(s *grpc.Server, health *HealthServer, addr string) lifecycle.Hook {
+	return lifecycle.Hook{
+		Name: "grpc server",
+		Start: func(ctx context.Context) error {
+			ln, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			go func() {
+				if err := s.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+					log.Errorf("gRPC server failed: %v", err)
+				}
+			}()
+			log.WithFields(log.Fields{"Addr": ln.Addr().String()}).Info("gRPC server started")
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			health.Shutdown()
+			stopped := make(chan struct{})
+			go func() {
+				s.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				s.Stop()
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+func logUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx = withRequestID(ctx, func(md metadata.MD) error { return grpc.SetHeader(ctx, md) })
+
+	resp, err := handler(ctx, req)
+	logCall(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+func logStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := withRequestID(ss.Context(), ss.SetHeader)
+
+	err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	logCall(ctx, info.FullMethod, start, err)
+	return err
+}
+
+// withRequestID gives the call a request id, the caller's when usable,
+// and echoes it in the response header through setHeader.
+func withRequestID(ctx context.Context, setHeader func(metadata.MD) error) context.Context {
+	ctx, id := logging.NewContext(ctx, firstValue(ctx, RequestIDMetadata))
+	// Fails only once headers are sent, which they can't be yet.
+	_ = setHeader(metadata.Pairs(RequestIDMetadata, id))
+	return ctx
+}
+
+// logCall writes the call's access log line.
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	entry := logging.FromContext(ctx).WithFields(log.Fields{
+		"grpc_method": method,
+		"grpc_code":   code.String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		entry.Error("Call completed")
+	default:
+		entry.Info("Call completed")
+	}
+}
+
+// recoverer turns a panic in a handler into an INTERNAL status instead of a
+// crashed process, logging and reporting it as RecoveryHandler does.
+type recoverer struct {
+	reporter crash.Reporter
+}
+
+func (r *recoverer) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = r.recovered(ctx, info.FullMethod, v)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func (r *recoverer) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = r.recovered(ss.Context(), info.FullMethod, v)
+		}
+	}()
+	return handler(srv, ss)
+}
+
+func (r *recoverer) recovered(ctx context.Context, method string, v interface{}) error {
+	stack := string(debug.Stack())
+	logger := logging.FromContext(ctx)
+	logger.WithFields(log.Fields{"Panic": fmt.Sprint(v), "Method": method, "Stack": stack}).Error("Recovered from panic")
+
+	if r.reporter != nil {
+		report := &crash.Report{
+			Time:      time.Now(),
+			RequestID: logging.RequestID(ctx),
+			Method:    "gRPC",
+			Route:     method,
+			Panic:     fmt.Sprint(v),
+			Stack:     stack,
+		}
+		if err := r.reporter.Report(ctx, report); err != nil {
+			logger.Errorf("Failed to report crash: %+v", err)
+		}
+	}
+	return catalogError(ctx, codes.Internal, errcatalog.Internal)
+}
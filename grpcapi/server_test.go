@@ -0,0 +1,156 @@
+package grpcapi
+
+import (
+	"context"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/crash"
+	"db_practice/internal/health"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	usersv1 "db_practice/proto/users/v1"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var testPolicy = AuthPolicy{
+	Scopes: map[string]apikeys.Scope{
+		usersv1.UserService_CreateUser_FullMethodName: apikeys.ScopeUsersWrite,
+		usersv1.UserService_GetUser_FullMethodName:    apikeys.ScopeUsersRead,
+		usersv1.UserService_ListUsers_FullMethodName:  apikeys.ScopeUsersAdmin,
+	},
+	Public: []string{usersv1.UserService_CreateUser_FullMethodName, "/grpc.health.v1.Health/"},
+}
+
+// testServer holds what a test server is built from; unset clients are
+// test clients that succeed.
+type testServer struct {
+	users    users.Client
+	rbac     rbac.Client
+	auth     auth.Client
+	apiKeys  apikeys.Client
+	health   health.Client
+	reporter crash.Reporter
+	limiter  *RateLimiter
+	// healthServer, if set, replaces the one built on health.
+	healthServer *HealthServer
+}
+
+// dial serves s in memory and returns a connection to it.
+func (s testServer) dial(t *testing.T) *grpc.ClientConn {
+	if s.users == nil {
+		s.users = users.TestClient{}
+	}
+	if s.rbac == nil {
+		s.rbac = rbac.TestClient{CanData: true}
+	}
+	if s.auth == nil {
+		s.auth = auth.TestClient{ValidateAccessTokenData: &auth.Claims{Subject: "1"}}
+	}
+	if s.apiKeys == nil {
+		s.apiKeys = apikeys.TestClient{}
+	}
+	if s.health == nil {
+		s.health = health.NewChecker(0)
+	}
+	if s.healthServer == nil {
+		s.healthServer = NewHealthServer(s.health, 10*time.Millisecond, usersv1.UserService_ServiceDesc.ServiceName)
+	}
+
+	server := NewServer(
+		NewUsersServer(s.users, s.rbac, verification.TestClient{}, nil),
+		s.healthServer,
+		NewAuthenticator(s.auth, s.apiKeys, testPolicy),
+		Options{Reporter: s.reporter, RateLimiter: s.limiter},
+	)
+	ln := bufconn.Listen(1 << 20)
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// withToken is a context sending a bearer access token.
+func withToken() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), AuthorizationMetadata, "Bearer token")
+}
+
+// errorReason is the ErrorInfo reason of a status error.
+func errorReason(t *testing.T, err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			assert.Equal(t, ErrorDomain, info.Domain)
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+type panicUsersClient struct {
+	users.TestClient
+}
+
+func (panicUsersClient) GetUserById(ctx context.Context, id string) (*users.User, error) {
+	panic("boom")
+}
+
+type testReporter struct {
+	reports []*crash.Report
+}
+
+func (r *testReporter) Report(ctx context.Context, report *crash.Report) error {
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+func TestRecover(t *testing.T) {
+	reporter := &testReporter{}
+	conn := testServer{users: panicUsersClient{}, reporter: reporter}.dial(t)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(withToken(), RequestIDMetadata, "req-123")
+	_, err := usersv1.NewUserServiceClient(conn).GetUser(ctx, &usersv1.GetUserRequest{Id: "1"}, grpc.Header(&header))
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "internal_error", errorReason(t, err))
+	require.Len(t, reporter.reports, 1)
+	assert.Equal(t, usersv1.UserService_GetUser_FullMethodName, reporter.reports[0].Route)
+	assert.Equal(t, "boom", reporter.reports[0].Panic)
+	assert.Equal(t, "req-123", reporter.reports[0].RequestID)
+	assert.Equal(t, []string{"req-123"}, header.Get(RequestIDMetadata))
+}
+
+func TestRequestID(t *testing.T) {
+	conn := testServer{users: users.TestClient{GetUserByIdData: &users.User{Id: "1"}}}.dial(t)
+	client := usersv1.NewUserServiceClient(conn)
+
+	var header metadata.MD
+	_, err := client.GetUser(withToken(), &usersv1.GetUserRequest{Id: "1"}, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Len(t, header.Get(RequestIDMetadata), 1)
+	assert.NotEmpty(t, header.Get(RequestIDMetadata)[0])
+
+	stream, err := client.ListUsers(withToken(), &usersv1.ListUsersRequest{})
+	require.NoError(t, err)
+	header, err = stream.Header()
+	require.NoError(t, err)
+	assert.Len(t, header.Get(RequestIDMetadata), 1)
+}
@@ -0,0 +1,343 @@
+package grpcapi
+
+import (
+	"context"
+	"db_practice/handlers"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"db_practice/internal/openapi"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	usersv1 "db_practice/proto/users/v1"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// listPageSize is how many users ListUsers reads from the database at a
+// time while streaming.
+const listPageSize = 100
+
+const minPasswordLength = 8
+
+// UsersServer implements UserService on the clients the REST users routes
+// use. Requests are checked against the OpenAPI schemas of the matching
+// REST requests, so both APIs accept the same values.
+type UsersServer struct {
+	usersv1.UnimplementedUserServiceServer
+
+	usersClient        users.Client
+	rbacClient         rbac.Client
+	verificationClient verification.Client
+	validator          *openapi.Validator
+}
+
+// NewUsersServer returns the service. A nil validator leaves out the schema
+// checks, as turning off request validation does for REST.
+func NewUsersServer(u users.Client, p rbac.Client, v verification.Client, validator *openapi.Validator) *UsersServer {
+	return &UsersServer{
+		usersClient:        u,
+		rbacClient:         p,
+		verificationClient: v,
+		validator:          validator,
+	}
+}
+
+func (s *UsersServer) CreateUser(ctx context.Context, req *usersv1.CreateUserRequest) (*usersv1.User, error) {
+	body := handlers.CreateUserRequest{
+		FirstName:   req.GetFirstName(),
+		LastName:    req.GetLastName(),
+		Email:       strings.ToLower(req.GetEmail()),
+		Address:     req.GetAddress(),
+		City:        req.GetCity(),
+		State:       req.GetState(),
+		ZipCode:     req.GetZip(),
+		DateOfBirth: req.GetDob(),
+		Password:    req.GetPassword(),
+	}
+	if err := s.validate(ctx, "POST", "/v1/users", body); err != nil {
+		return nil, err
+	}
+	if err := required(ctx, map[string]string{
+		"first_name": body.FirstName, "last_name": body.LastName, "email": body.Email, "address": body.Address,
+		"city": body.City, "state": body.State, "zip": body.ZipCode, "dob": body.DateOfBirth,
+	}); err != nil {
+		return nil, err
+	}
+	if body.Password != "" && len(body.Password) < minPasswordLength {
+		return nil, catalogError(ctx, codes.InvalidArgument, errcatalog.Invalid, openapi.Violation{
+			Field:  "password",
+			Code:   openapi.ViolationTooShort,
+			Params: map[string]string{"min": strconv.Itoa(minPasswordLength)},
+		})
+	}
+
+	user, err := s.usersClient.CreateUser(ctx, body.FirstName, body.LastName, body.Email, body.Address, body.City, body.State, body.ZipCode, body.DateOfBirth)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	if body.Password != "" {
+		if err := s.usersClient.SetPassword(ctx, user.Id, body.Password); err != nil {
+			return nil, statusError(ctx, err)
+		}
+	}
+
+	// The account exists either way; a failed send can be retried through
+	// the resend endpoint.
+	if err := s.verificationClient.SendVerification(ctx, user.Id); err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"Id": user.Id}).Errorf("%+v", err)
+	}
+
+	return toProto(user), nil
+}
+
+func (s *UsersServer) GetUser(ctx context.Context, req *usersv1.GetUserRequest) (*usersv1.User, error) {
+	id := req.GetId()
+	if err := required(ctx, map[string]string{"id": id}); err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, rbac.ActionReadUser, rbac.UserResource(id)); err != nil {
+		return nil, err
+	}
+
+	user, err := s.usersClient.GetUserById(ctx, id)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return toProto(user), nil
+}
+
+func (s *UsersServer) GetUserByEmail(ctx context.Context, req *usersv1.GetUserByEmailRequest) (*usersv1.User, error) {
+	body := handlers.SearchUsersRequest{Email: strings.ToLower(req.GetEmail())}
+	if err := s.validate(ctx, "POST", "/v1/users/search", body); err != nil {
+		return nil, err
+	}
+	if err := required(ctx, map[string]string{"email": body.Email}); err != nil {
+		return nil, err
+	}
+
+	readsAny, err := s.readsAnyUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.usersClient.GetUserByEmail(ctx, body.Email)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+
+	// Someone else's email is answered as unknown, so callers who can't read
+	// every user aren't told which emails are registered.
+	if !readsAny {
+		if subject, _ := auth.UserIdFromContext(ctx); user.Id != subject {
+			return nil, catalogError(ctx, codes.NotFound, errcatalog.NotFound)
+		}
+		if err := s.authorize(ctx, rbac.ActionReadUser, rbac.UserResource(user.Id)); err != nil {
+			return nil, err
+		}
+	}
+	return toProto(user), nil
+}
+
+// ListUsers streams users a page at a time, so a long listing holds
+// neither every user in memory nor a database connection between pages.
+func (s *UsersServer) ListUsers(req *usersv1.ListUsersRequest, stream usersv1.UserService_ListUsersServer) error {
+	ctx := stream.Context()
+	if req.GetLimit() < 0 {
+		return catalogError(ctx, codes.InvalidArgument, errcatalog.Invalid, openapi.Violation{
+			Field: "limit",
+			Code:  string(errcatalog.Invalid),
+		})
+	}
+
+	// No user owns the whole list, so only permissions on any user allow it.
+	if err := s.authorize(ctx, rbac.ActionReadUser, rbac.Resource{Type: "users"}); err != nil {
+		return err
+	}
+
+	after := req.GetAfterId()
+	remaining := int(req.GetLimit())
+	for {
+		size := listPageSize
+		if remaining > 0 && remaining < size {
+			size = remaining
+		}
+
+		page, err := s.usersClient.ListUsers(ctx, after, size)
+		if err != nil {
+			return statusError(ctx, err)
+		}
+		for _, user := range page {
+			if err := stream.Send(toProto(user)); err != nil {
+				return err
+			}
+		}
+
+		if remaining > 0 {
+			remaining -= len(page)
+			if remaining == 0 {
+				return nil
+			}
+		}
+		if len(page) < size {
+			return nil
+		}
+		after = page[len(page)-1].Id
+	}
+}
+
+func (s *UsersServer) UpdateUser(ctx context.Context, req *usersv1.UpdateUserRequest) (*usersv1.User, error) {
+	id := req.GetId()
+	if err := required(ctx, map[string]string{"id": id}); err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, rbac.ActionUpdateUser, rbac.UserResource(id)); err != nil {
+		return nil, err
+	}
+
+	body := handlers.UpdateUserRequest{
+		FirstName:   req.GetFirstName(),
+		LastName:    req.GetLastName(),
+		Email:       strings.ToLower(req.GetEmail()),
+		Address:     req.GetAddress(),
+		City:        req.GetCity(),
+		State:       req.GetState(),
+		ZipCode:     req.GetZip(),
+		DateOfBirth: req.GetDob(),
+	}
+	if err := s.validate(ctx, "PUT", "/v1/users/{id}", body); err != nil {
+		return nil, err
+	}
+	if err := required(ctx, map[string]string{
+		"first_name": body.FirstName, "last_name": body.LastName, "email": body.Email, "address": body.Address,
+		"city": body.City, "state": body.State, "zip": body.ZipCode, "dob": body.DateOfBirth,
+	}); err != nil {
+		return nil, err
+	}
+
+	user, err := s.usersClient.UpdateUser(ctx, id, body.FirstName, body.LastName, body.Email, body.Address, body.City, body.State, body.ZipCode, body.DateOfBirth)
+	if err != nil {
+		return nil, statusError(ctx, err)
+	}
+	return toProto(user), nil
+}
+
+// validate checks body against the request schema of the REST route for
+// method and template.
+func (s *UsersServer) validate(ctx context.Context, method, template string, body interface{}) error {
+	if s.validator == nil {
+		return nil
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("%+v", err)
+		return catalogError(ctx, codes.Internal, errcatalog.Internal)
+	}
+	// Request only fails for bodies that aren't JSON.
+	violations, _ := s.validator.Request(method, template, nil, b)
+	return invalid(ctx, violations)
+}
+
+// required checks none of the values, by field, are empty. It holds with
+// schema validation off too, as the REST handlers' own checks do.
+func required(ctx context.Context, values map[string]string) error {
+	var violations []openapi.Violation
+	for field, value := range values {
+		if value == "" {
+			violations = append(violations, openapi.Violation{Field: field, Code: openapi.ViolationRequired})
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Field < violations[j].Field
+	})
+	return invalid(ctx, violations)
+}
+
+// invalid is the INVALID_ARGUMENT status for violations, if there are any.
+func invalid(ctx context.Context, violations []openapi.Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fields := make([]string, len(violations))
+	for i, v := range violations {
+		fields[i] = v.String()
+	}
+	logging.FromContext(ctx).WithFields(log.Fields{"Violations": strings.Join(fields, "; ")}).Warn("Request failed validation")
+	return catalogError(ctx, codes.InvalidArgument, errcatalog.Invalid, violations...)
+}
+
+// authorize checks the caller may perform the action on the resource. API
+// key callers were already checked against their scopes by the
+// Authenticator.
+func (s *UsersServer) authorize(ctx context.Context, action rbac.Action, resource rbac.Resource) error {
+	if _, ok := apikeys.ApiKeyFromContext(ctx); ok {
+		return nil
+	}
+
+	subject, ok := auth.UserIdFromContext(ctx)
+	if !ok {
+		return catalogError(ctx, codes.Unauthenticated, errcatalog.Unauthorized)
+	}
+
+	allowed, err := s.rbacClient.Can(ctx, subject, action, resource)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"Subject": subject, "Action": action}).Errorf("%+v", err)
+		return catalogError(ctx, codes.Internal, errcatalog.Internal)
+	}
+	if !allowed {
+		return catalogError(ctx, codes.PermissionDenied, errcatalog.Forbidden)
+	}
+	return nil
+}
+
+// readsAnyUser reports whether the caller may read every user record: API
+// key callers, whose scopes were already checked, and subjects permitted on
+// any user.
+func (s *UsersServer) readsAnyUser(ctx context.Context) (bool, error) {
+	if _, ok := apikeys.ApiKeyFromContext(ctx); ok {
+		return true, nil
+	}
+
+	subject, ok := auth.UserIdFromContext(ctx)
+	if !ok {
+		return false, catalogError(ctx, codes.Unauthenticated, errcatalog.Unauthorized)
+	}
+
+	allowed, err := s.rbacClient.CanAny(ctx, subject, rbac.ActionReadUser)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"Subject": subject, "Action": rbac.ActionReadUser}).Errorf("%+v", err)
+		return false, catalogError(ctx, codes.Internal, errcatalog.Internal)
+	}
+	return allowed, nil
+}
+
+func toProto(u *users.User) *usersv1.User {
+	user := &usersv1.User{
+		Id:        u.Id,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		Address:   u.Address,
+		City:      u.City,
+		State:     u.State,
+		Zip:       u.ZipCode,
+		Dob:       u.DateOfBirth,
+		Status:    u.Status,
+	}
+	if u.EmailVerifiedAt != nil {
+		user.EmailVerifiedAt = timestamppb.New(*u.EmailVerifiedAt)
+	}
+	return user
+}
@@ -0,0 +1,270 @@
+package grpcapi
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	usersv1 "db_practice/proto/users/v1"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func validCreateRequest() *usersv1.CreateUserRequest {
+	return &usersv1.CreateUserRequest{
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Email:     "Jane@Example.com",
+		Address:   "1 Main St",
+		City:      "Springfield",
+		State:     "IL",
+		Zip:       "62701",
+		Dob:       "1990-01-01",
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	testCases := []struct {
+		description        string
+		request            func(r *usersv1.CreateUserRequest)
+		users              users.Client
+		expectedCode       codes.Code
+		expectedReason     string
+		expectedViolations []string
+	}{
+		{
+			description:  "Success: Created without credentials",
+			users:        users.TestClient{CreateUserData: &users.User{Id: "1", Email: "jane@example.com"}},
+			expectedCode: codes.OK,
+		},
+		{
+			description:        "Failure: Missing fields",
+			request:            func(r *usersv1.CreateUserRequest) { r.FirstName, r.Zip = "", "" },
+			expectedCode:       codes.InvalidArgument,
+			expectedReason:     "invalid",
+			expectedViolations: []string{"first_name", "zip"},
+		},
+		{
+			description:        "Failure: Short password",
+			request:            func(r *usersv1.CreateUserRequest) { r.Password = "short" },
+			expectedCode:       codes.InvalidArgument,
+			expectedReason:     "invalid",
+			expectedViolations: []string{"password"},
+		},
+		{
+			description:        "Failure: Email taken",
+			users:              users.TestClient{CreateUserErr: users.ErrEmailExists},
+			expectedCode:       codes.AlreadyExists,
+			expectedReason:     "conflict_error",
+			expectedViolations: []string{"email"},
+		},
+		{
+			description:    "Failure: Database error",
+			users:          users.TestClient{CreateUserErr: errors.New("connection refused")},
+			expectedCode:   codes.Internal,
+			expectedReason: "internal_error",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			req := validCreateRequest()
+			if tc.request != nil {
+				tc.request(req)
+			}
+			conn := testServer{users: tc.users}.dial(t)
+			user, err := usersv1.NewUserServiceClient(conn).CreateUser(context.Background(), req)
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			if tc.expectedCode == codes.OK {
+				assert.Equal(t, "1", user.GetId())
+				return
+			}
+			assert.Equal(t, tc.expectedReason, errorReason(t, err))
+
+			var violations []string
+			for _, d := range status.Convert(err).Details() {
+				if br, ok := d.(*errdetails.BadRequest); ok {
+					for _, v := range br.FieldViolations {
+						violations = append(violations, v.Field)
+						assert.NotEmpty(t, v.Description)
+					}
+				}
+			}
+			assert.Equal(t, tc.expectedViolations, violations)
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	verified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		description  string
+		id           string
+		users        users.Client
+		expectedCode codes.Code
+	}{
+		{
+			description:  "Success: Found",
+			id:           "1",
+			users:        users.TestClient{GetUserByIdData: &users.User{Id: "1", Email: "jane@example.com", EmailVerifiedAt: &verified}},
+			expectedCode: codes.OK,
+		},
+		{
+			description:  "Failure: Missing id",
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			description:  "Failure: Not found",
+			id:           "2",
+			users:        users.TestClient{GetUserByIdErr: sql.ErrNoRows},
+			expectedCode: codes.NotFound,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			conn := testServer{users: tc.users}.dial(t)
+			user, err := usersv1.NewUserServiceClient(conn).GetUser(withToken(), &usersv1.GetUserRequest{Id: tc.id})
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+			if tc.expectedCode == codes.OK {
+				assert.Equal(t, "jane@example.com", user.GetEmail())
+				assert.True(t, verified.Equal(user.GetEmailVerifiedAt().AsTime()))
+			}
+		})
+	}
+}
+
+func TestGetUserByEmail(t *testing.T) {
+	jane := &users.User{Id: "1", Email: "jane@example.com"}
+	john := &users.User{Id: "2", Email: "john@example.com"}
+
+	testCases := []struct {
+		description  string
+		email        string
+		users        users.Client
+		rbac         rbac.Client
+		expectedCode codes.Code
+	}{
+		{
+			description:  "Success: Any user with permission on any user",
+			email:        "John@Example.com",
+			users:        users.TestClient{GetUserByEmailData: john},
+			expectedCode: codes.OK,
+		},
+		{
+			description:  "Success: Own user",
+			email:        "jane@example.com",
+			users:        users.TestClient{GetUserByEmailData: jane},
+			rbac:         rbac.TestClient{CanData: true, OwnOnly: true},
+			expectedCode: codes.OK,
+		},
+		{
+			description:  "Failure: Someone else's email answered as unknown",
+			email:        "john@example.com",
+			users:        users.TestClient{GetUserByEmailData: john},
+			rbac:         rbac.TestClient{CanData: true, OwnOnly: true},
+			expectedCode: codes.NotFound,
+		},
+		{
+			description:  "Failure: Not found",
+			email:        "nobody@example.com",
+			users:        users.TestClient{GetUserByEmailErr: sql.ErrNoRows},
+			rbac:         rbac.TestClient{CanData: true, OwnOnly: true},
+			expectedCode: codes.NotFound,
+		},
+		{
+			description:  "Failure: Lookup failed",
+			email:        "jane@example.com",
+			users:        users.TestClient{GetUserByEmailErr: errors.New("connection refused")},
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			conn := testServer{users: tc.users, rbac: tc.rbac}.dial(t)
+			_, err := usersv1.NewUserServiceClient(conn).GetUserByEmail(withToken(), &usersv1.GetUserByEmailRequest{Email: tc.email})
+
+			assert.Equal(t, tc.expectedCode, status.Code(err))
+		})
+	}
+}
+
+func TestListUsersStream(t *testing.T) {
+	page := []*users.User{{Id: "1"}, {Id: "2"}, {Id: "3"}}
+
+	testCases := []struct {
+		description  string
+		limit        int32
+		users        users.Client
+		expectedIds  []string
+		expectedCode codes.Code
+	}{
+		{
+			description:  "Success: Every user",
+			users:        users.TestClient{ListUsersData: page},
+			expectedIds:  []string{"1", "2", "3"},
+			expectedCode: codes.OK,
+		},
+		{
+			description:  "Success: Up to the limit",
+			limit:        3,
+			users:        users.TestClient{ListUsersData: page},
+			expectedIds:  []string{"1", "2", "3"},
+			expectedCode: codes.OK,
+		},
+		{
+			description:  "Failure: Negative limit",
+			limit:        -1,
+			expectedCode: codes.InvalidArgument,
+		},
+		{
+			description:  "Failure: Database error",
+			users:        users.TestClient{ListUsersErr: errors.New("connection refused")},
+			expectedCode: codes.Internal,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			conn := testServer{users: tc.users}.dial(t)
+			stream, err := usersv1.NewUserServiceClient(conn).ListUsers(withToken(), &usersv1.ListUsersRequest{Limit: tc.limit})
+			require.NoError(t, err)
+
+			var ids []string
+			for {
+				user, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					assert.Equal(t, tc.expectedCode, status.Code(err))
+					return
+				}
+				ids = append(ids, user.GetId())
+			}
+			assert.Equal(t, codes.OK, tc.expectedCode)
+			assert.Equal(t, tc.expectedIds, ids)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"database/sql"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/logging"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const ApiKeyHeader = "X-API-Key"
+
+type ApiKeysHandler struct {
+	apiKeysClient apikeys.Client
+}
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type CreateApiKeyResponse struct {
+	*apikeys.ApiKey
+	Key string `json:"key"`
+}
+
+// RouteScope is the scope a named route requires from API key callers. When
+// KeyRequired is false, requests without a key fall through to the route's
+// own authentication.
+type RouteScope struct {
+	Scope       apikeys.Scope
+	KeyRequired bool
+}
+
+func NewApiKeysHandler(a apikeys.Client) *ApiKeysHandler {
+	return &ApiKeysHandler{
+		apiKeysClient: a,
+	}
+}
+
+func (a *ApiKeysHandler) CreateApiKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateApiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "ApiKeys")
+		return
+	}
+	defer r.Body.Close()
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		BadRequest400(w, r, "ApiKeys", "Name")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		BadRequest400(w, r, "ApiKeys", "Scopes")
+		return
+	}
+
+	scopes := make([]apikeys.Scope, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		scope, err := apikeys.ParseScope(s)
+		if err != nil {
+			BadRequest400(w, r, "ApiKeys", "Scopes")
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		BadRequest400(w, r, "ApiKeys", "Expires At")
+		return
+	}
+
+	key, rawKey, err := a.apiKeysClient.CreateApiKey(r.Context(), req.Name, scopes, req.ExpiresAt)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Name": req.Name}).Errorf("%+v", err)
+		InternalError500(w, r, "ApiKeys", err)
+		return
+	}
+
+	Created201(w, CreateApiKeyResponse{ApiKey: key, Key: rawKey})
+}
+
+func (a *ApiKeysHandler) ListApiKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.apiKeysClient.ListApiKeys(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Errorf("%+v", err)
+		InternalError500(w, r, "ApiKeys", err)
+		return
+	}
+
+	OK200(w, keys)
+}
+
+func (a *ApiKeysHandler) RevokeApiKey(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	fields := log.Fields{"Id": id}
+	if id == "" {
+		BadRequest400(w, r, "ApiKeys", "MISSING_ARG_ID")
+		return
+	}
+
+	if err := a.apiKeysClient.RevokeApiKey(r.Context(), id); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			NotFound404(w, r, "ApiKeys")
+			return
+		}
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, "ApiKeys", err)
+		return
+	}
+
+	NoContent204(w)
+}
+
+// EnforceScopes is router middleware that authenticates the X-API-Key header
+// and checks it against the scope the matched route requires. Routes are
+// looked up by name.
+func (a *ApiKeysHandler) EnforceScopes(policy map[string]RouteScope) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var required RouteScope
+			var hasPolicy bool
+			if route := mux.CurrentRoute(r); route != nil {
+				required, hasPolicy = policy[route.GetName()]
+			}
+
+			rawKey := r.Header.Get(ApiKeyHeader)
+			if rawKey == "" {
+				if hasPolicy && required.KeyRequired {
+					Unauthorized401(w, r, "ApiKeys")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := a.apiKeysClient.Authenticate(r.Context(), rawKey)
+			if err != nil {
+				if errors.Cause(err) == apikeys.ErrInvalidKey {
+					logging.FromContext(r.Context()).Warn("API key rejected")
+					Unauthorized401(w, r, "ApiKeys")
+					return
+				}
+				logging.FromContext(r.Context()).Errorf("%+v", err)
+				InternalError500(w, r, "ApiKeys", err)
+				return
+			}
+
+			if hasPolicy && !key.HasScope(required.Scope) {
+				fields := log.Fields{"Key": key.Prefix, "Required Scope": required.Scope}
+				logging.FromContext(r.Context()).WithFields(fields).Warn("API key missing required scope")
+				Forbidden403(w, r, "ApiKeys")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(apikeys.WithApiKey(r.Context(), key)))
+		})
+	}
+}
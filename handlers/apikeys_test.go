@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"db_practice/internal/apikeys"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var testApiKey = &apikeys.ApiKey{
+	Id:        "key-1",
+	Name:      "billing-service",
+	Prefix:    "dbp_1a2b3c4d",
+	Scopes:    []apikeys.Scope{apikeys.ScopeUsersRead},
+	CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestCreateApiKey(t *testing.T) {
+	testCases := []struct {
+		description  string
+		apiKeyClient *apikeys.TestClient
+		requestBody  io.Reader
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description: "Success: Key created",
+			apiKeyClient: &apikeys.TestClient{
+				CreateApiKeyData:   testApiKey,
+				CreateApiKeySecret: "dbp_1a2b3c4d_secret",
+			},
+			requestBody:  strings.NewReader(`{"name": "billing-service", "scopes": ["users:read"]}`),
+			expectedBody: `{"id":"key-1","name":"billing-service","prefix":"dbp_1a2b3c4d","scopes":["users:read"],"created_at":"2024-01-01T00:00:00Z","key":"dbp_1a2b3c4d_secret"}`,
+			expectedCode: 201,
+		},
+		{
+			description:  "Failure: Unknown scope",
+			requestBody:  strings.NewReader(`{"name": "billing-service", "scopes": ["users:everything"]}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"ApiKeys","description":"The value provided is invalid.","errors":[{"field":"Scopes","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+		{
+			description:  "Failure: Missing name",
+			requestBody:  strings.NewReader(`{"scopes": ["users:read"]}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"ApiKeys","description":"The value provided is invalid.","errors":[{"field":"Name","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+		{
+			description: "Failure: Internal error",
+			apiKeyClient: &apikeys.TestClient{
+				CreateApiKeyErr: errors.New("error"),
+			},
+			requestBody:  strings.NewReader(`{"name": "billing-service", "scopes": ["users:read"]}`),
+			expectedBody: `{"message":"INTERNAL_ERROR","resource":"ApiKeys","description":"An internal error occurred."}`,
+			expectedCode: 500,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewApiKeysHandler(tc.apiKeyClient)
+			r := httptest.NewRequest("POST", "/admin/api-keys", tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+
+			w := httptest.NewRecorder()
+			h.CreateApiKey(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestEnforceScopes(t *testing.T) {
+	policy := map[string]RouteScope{
+		"users.get":    {Scope: apikeys.ScopeUsersRead},
+		"users.create": {Scope: apikeys.ScopeUsersWrite},
+		"apikeys.list": {Scope: apikeys.ScopeUsersAdmin, KeyRequired: true},
+	}
+
+	testCases := []struct {
+		description  string
+		apiKeyClient *apikeys.TestClient
+		method       string
+		url          string
+		apiKey       string
+		expectedCode int
+	}{
+		{
+			description: "Success: Key has scope",
+			apiKeyClient: &apikeys.TestClient{
+				AuthenticateData: testApiKey,
+			},
+			method:       "GET",
+			url:          "/users/testemail@mail.com",
+			apiKey:       "dbp_1a2b3c4d_secret",
+			expectedCode: 200,
+		},
+		{
+			description:  "Success: No key falls through",
+			apiKeyClient: &apikeys.TestClient{},
+			method:       "GET",
+			url:          "/users/testemail@mail.com",
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Key missing scope",
+			apiKeyClient: &apikeys.TestClient{
+				AuthenticateData: testApiKey,
+			},
+			method:       "POST",
+			url:          "/users/create",
+			apiKey:       "dbp_1a2b3c4d_secret",
+			expectedCode: 403,
+		},
+		{
+			description: "Failure: Invalid key",
+			apiKeyClient: &apikeys.TestClient{
+				AuthenticateErr: apikeys.ErrInvalidKey,
+			},
+			method:       "GET",
+			url:          "/users/testemail@mail.com",
+			apiKey:       "dbp_1a2b3c4d_wrong",
+			expectedCode: 401,
+		},
+		{
+			description:  "Failure: Key required",
+			apiKeyClient: &apikeys.TestClient{},
+			method:       "GET",
+			url:          "/admin/api-keys",
+			expectedCode: 401,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			ok := func(w http.ResponseWriter, r *http.Request) {}
+
+			h := NewApiKeysHandler(tc.apiKeyClient)
+			router := mux.NewRouter()
+			router.Use(h.EnforceScopes(policy))
+			router.HandleFunc("/users/create", ok).Methods("POST").Name("users.create")
+			router.HandleFunc("/users/{email}", ok).Methods("GET").Name("users.get")
+			router.HandleFunc("/admin/api-keys", ok).Methods("GET").Name("apikeys.list")
+
+			r := httptest.NewRequest(tc.method, tc.url, nil)
+
+			r.Header.Set("Accept", legacyAccept)
+			if tc.apiKey != "" {
+				r.Header.Set(ApiKeyHeader, tc.apiKey)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+		})
+	}
+}
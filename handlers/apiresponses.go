@@ -1,58 +1,37 @@
 package handlers
 
 import (
+	"db_practice/internal/errcatalog"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	NotFound    = NewOutput("not_found", "What you are looking for cannot be found.")
-	BadRequest  = NewOutput("bad_request", "The request is invalid.")
-	InvalidJSON = NewOutput("invalid_json", "The JSON value provided is invalid.")
-	Invalid     = NewOutput("invalid", "The value provided is invalid.")
-	Internal    = NewOutput("internal_error", "An internal error occurred.")
-	Conflict    = NewOutput("conflict_error", "there is a conflict with your request")
-)
-
-type Output struct {
-	Value string
-	Desc  string
-}
-
-func NewOutput(value, desc string) *Output {
-	return &Output{
-		Value: value,
-		Desc:  desc,
-	}
-}
-
-func (o Output) String() string {
-	return o.Value
-}
-
-func (o Output) ToUpper() string {
-	return strings.ToUpper(o.String())
-}
-
-func (o Output) Description() string {
-	return o.Desc
-}
-
 type FieldError struct {
 	Field     string `json:"field,omitempty"`
 	ErrorCode string `json:"error_code"`
 	Message   string `json:"message,omitempty"`
+
+	// params fill the placeholders of the code's field message.
+	params map[string]string
 }
 
+// Error is the legacy error body, still served to clients that prefer
+// application/json over application/problem+json. See Problem.
 type Error struct {
 	Message     string        `json:"message"`
 	Resource    string        `json:"resource"`
 	Description string        `json:"description"`
 	Errors      []*FieldError `json:"errors,omitempty"`
+
+	// code is the catalog entry the error was built from.
+	code errcatalog.Code
 }
 
 func (e Error) Error() string {
@@ -68,7 +47,9 @@ func write(w http.ResponseWriter, code int, data interface{}) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	w.WriteHeader(code)
 
 	if data != nil {
@@ -90,25 +71,46 @@ func write(w http.ResponseWriter, code int, data interface{}) {
 	}
 }
 
-func Err(w http.ResponseWriter, e *Error, code int) {
+// Err writes e as problem details, or in the legacy format to clients that
+// ask for it.
+func Err(w http.ResponseWriter, r *http.Request, e *Error, code int) {
 	if e == nil {
 		panic("error must not be empty")
 	}
-	write(w, code, e)
+
+	tag := errorLanguage(r)
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", tag.String())
+	if prefersLegacyErrors(r) {
+		if entry, ok := errcatalog.Default.Lookup(tag, e.code); ok {
+			e.Description = entry.Message
+		}
+		w.Header().Set("Deprecation", DeprecationDate(LegacyErrorsDeprecated))
+		write(w, code, e)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	write(w, code, NewProblem(r, e, code))
 }
 
 func (e *Error) AddInvalidError(field string) {
 	e.Errors = append(e.Errors, &FieldError{
-		ErrorCode: Invalid.String(),
+		ErrorCode: string(errcatalog.Invalid),
 		Field:     field,
 	})
 }
 
-func New(message, resource string, output *Output, e ...*FieldError) *Error {
+// New builds an error from a catalog entry, described in the Fallback
+// language until Err localizes it.
+func New(message, resource string, code errcatalog.Code, e ...*FieldError) *Error {
+	entry, _ := errcatalog.Default.Lookup(errcatalog.Fallback, code)
 	err := &Error{
 		Message:     message,
 		Resource:    resource,
-		Description: output.Description(),
+		Description: entry.Message,
+		code:        code,
 	}
 	if len(e) != 0 && e[0] != nil {
 		err.Errors = e
@@ -117,26 +119,46 @@ func New(message, resource string, output *Output, e ...*FieldError) *Error {
 }
 
 func NewInvalidError(message, resource, field string) *Error {
-	return New(message, resource, Invalid, &FieldError{
+	return New(message, resource, errcatalog.Invalid, &FieldError{
 		Field:     field,
-		ErrorCode: Invalid.String(),
+		ErrorCode: string(errcatalog.Invalid),
 	})
 }
 
 func NewInvalidJSONError(message, resource string) *Error {
-	return New(message, resource, InvalidJSON, nil)
+	return New(message, resource, errcatalog.InvalidJSON, nil)
 }
 
 func NewInternalError(resource string) *Error {
-	return New(Internal.ToUpper(), resource, Internal, nil)
+	return New(upper(errcatalog.Internal), resource, errcatalog.Internal, nil)
 }
 
 func NewConflictError(message, resource, field string) *Error {
-	return New(Conflict.ToUpper(), resource, Conflict, nil)
+	return New(message, resource, errcatalog.Conflict, &FieldError{
+		Field:     field,
+		ErrorCode: string(errcatalog.Conflict),
+	})
 }
 
 func NewNotFoundError(resource string) *Error {
-	return New(NotFound.ToUpper(), resource, NotFound, nil)
+	return New(upper(errcatalog.NotFound), resource, errcatalog.NotFound, nil)
+}
+
+func NewUnauthorizedError(resource string) *Error {
+	return New(upper(errcatalog.Unauthorized), resource, errcatalog.Unauthorized, nil)
+}
+
+func NewForbiddenError(resource string) *Error {
+	return New(upper(errcatalog.Forbidden), resource, errcatalog.Forbidden, nil)
+}
+
+func NewTooManyRequestsError(resource string) *Error {
+	return New(upper(errcatalog.RateLimited), resource, errcatalog.RateLimited, nil)
+}
+
+// upper is the legacy Message for a code.
+func upper(code errcatalog.Code) string {
+	return strings.ToUpper(string(code))
 }
 
 func OK200(w http.ResponseWriter, data interface{}) {
@@ -147,18 +169,72 @@ func Created201(w http.ResponseWriter, data interface{}) {
 	write(w, 201, data)
 }
 
-func BadRequest400(w http.ResponseWriter, resource, field string) {
-	Err(w, NewInvalidError("BAD_REQUEST", resource, field), 400)
+func Accepted202(w http.ResponseWriter, data interface{}) {
+	write(w, 202, data)
+}
+
+func NoContent204(w http.ResponseWriter) {
+	write(w, 204, nil)
+}
+
+func ServiceUnavailable503(w http.ResponseWriter, data interface{}) {
+	write(w, 503, data)
+}
+
+// BadRequest400 reports one invalid value error per field.
+func BadRequest400(w http.ResponseWriter, r *http.Request, resource string, fields ...string) {
+	e := New("BAD_REQUEST", resource, errcatalog.Invalid)
+	for _, field := range fields {
+		e.AddInvalidError(field)
+	}
+	Err(w, r, e, 400)
+}
+
+func InvalidJSON400(w http.ResponseWriter, r *http.Request, resource string) {
+	Err(w, r, NewInvalidJSONError(upper(errcatalog.InvalidJSON), resource), 400)
+}
+
+func Unauthorized401(w http.ResponseWriter, r *http.Request, resource string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	Err(w, r, NewUnauthorizedError(resource), 401)
 }
 
-func NotFound404(w http.ResponseWriter, resource string) {
-	Err(w, NewNotFoundError(resource), 404)
+func Forbidden403(w http.ResponseWriter, r *http.Request, resource string) {
+	Err(w, r, NewForbiddenError(resource), 403)
 }
 
-func InternalError500(w http.ResponseWriter, resource string, err error) {
-	Err(w, NewInternalError(resource), 500)
+func NotFound404(w http.ResponseWriter, r *http.Request, resource string) {
+	Err(w, r, NewNotFoundError(resource), 404)
 }
 
-func ConflictError409(w http.ResponseWriter, resource, field string) {
-	Err(w, NewConflictError("CONFLICT_ERROR", resource, field), 409)
+// InternalError500 keeps err out of the response but records it on the
+// request's trace span, where the request_id in the body leads.
+func InternalError500(w http.ResponseWriter, r *http.Request, resource string, err error) {
+	if err != nil {
+		trace.SpanFromContext(r.Context()).RecordError(err)
+	}
+	Err(w, r, NewInternalError(resource), 500)
+}
+
+func ConflictError409(w http.ResponseWriter, r *http.Request, resource, field string) {
+	Err(w, r, NewConflictError("CONFLICT_ERROR", resource, field), 409)
+}
+
+func PayloadTooLarge413(w http.ResponseWriter, r *http.Request, resource string) {
+	Err(w, r, New(upper(errcatalog.TooLarge), resource, errcatalog.TooLarge), 413)
+}
+
+func TooManyRequests429(w http.ResponseWriter, r *http.Request, resource string) {
+	Err(w, r, NewTooManyRequestsError(resource), 429)
+}
+
+// RateLimited429 is TooManyRequests429 with a Retry-After header, in whole
+// seconds rounded up so a client waiting that long will get through.
+func RateLimited429(w http.ResponseWriter, r *http.Request, resource string, retryAfter time.Duration) {
+	wait := seconds(retryAfter)
+	if wait < 1 {
+		wait = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(wait))
+	TooManyRequests429(w, r, resource)
 }
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/logging"
+	"db_practice/internal/mfa"
+	"db_practice/internal/sessions"
+	"db_practice/internal/users"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type AuthHandler struct {
+	usersClient users.Client
+	authClient  auth.Client
+	mfaClient   mfa.Client
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// MfaChallengeResponse is returned by Login in place of tokens when the user
+// has MFA enabled.
+type MfaChallengeResponse struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+}
+
+type LoginMfaRequest struct {
+	MfaToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func NewAuthHandler(u users.Client, a auth.Client, m mfa.Client) *AuthHandler {
+	return &AuthHandler{
+		usersClient: u,
+		authClient:  a,
+		mfaClient:   m,
+	}
+}
+
+func (a *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	user, ok := passwordLogin(w, r, a.usersClient, "Auth")
+	if !ok {
+		return
+	}
+	if challenged, ok := mfaChallenge(w, r, a.mfaClient, user.Id, "Auth"); challenged || !ok {
+		return
+	}
+
+	tokens, err := a.authClient.IssueTokens(r.Context(), user.Id)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Id": user.Id}).Errorf("%+v", err)
+		InternalError500(w, r, "Auth", err)
+		return
+	}
+
+	OK200(w, tokens)
+}
+
+// LoginMfa completes a login that Login answered with an MFA challenge.
+func (a *AuthHandler) LoginMfa(w http.ResponseWriter, r *http.Request) {
+	userId, ok := mfaLogin(w, r, a.mfaClient, "Auth")
+	if !ok {
+		return
+	}
+
+	tokens, err := a.authClient.IssueTokens(r.Context(), userId)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Id": userId}).Errorf("%+v", err)
+		InternalError500(w, r, "Auth", err)
+		return
+	}
+
+	OK200(w, tokens)
+}
+
+func (a *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "Auth")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.RefreshToken == "" {
+		BadRequest400(w, r, "Auth", "MISSING_REFRESH_TOKEN")
+		return
+	}
+
+	tokens, err := a.authClient.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		switch errors.Cause(err) {
+		case auth.ErrInvalidToken, auth.ErrTokenReused:
+			logging.FromContext(r.Context()).Warnf("Refresh rejected: %v", err)
+			Unauthorized401(w, r, "Auth")
+		default:
+			logging.FromContext(r.Context()).Errorf("%+v", err)
+			InternalError500(w, r, "Auth", err)
+		}
+		return
+	}
+
+	OK200(w, tokens)
+}
+
+func (a *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "Auth")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.RefreshToken == "" {
+		BadRequest400(w, r, "Auth", "MISSING_REFRESH_TOKEN")
+		return
+	}
+
+	if err := a.authClient.Revoke(r.Context(), req.RefreshToken); err != nil && errors.Cause(err) != auth.ErrInvalidToken {
+		logging.FromContext(r.Context()).Errorf("%+v", err)
+		InternalError500(w, r, "Auth", err)
+		return
+	}
+
+	NoContent204(w)
+}
+
+func (a *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	OK200(w, a.authClient.JWKS())
+}
+
+// RequireAuth is mux middleware that rejects requests without a valid bearer
+// access token and stores the token subject in the request context.
+func (a *AuthHandler) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Service callers already authenticated with an API key, and
+		// browsers with a session cookie.
+		if _, ok := apikeys.ApiKeyFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := sessions.SessionFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := bearerToken(r)
+		if !ok {
+			Unauthorized401(w, r, "Auth")
+			return
+		}
+
+		claims, err := a.authClient.ValidateAccessToken(token)
+		if err != nil {
+			logging.FromContext(r.Context()).Warnf("Access token rejected: %v", err)
+			Unauthorized401(w, r, "Auth")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithUserId(r.Context(), claims.Subject)))
+	})
+}
+
+// OptionalAuth is RequireAuth for routes that also serve anonymous callers,
+// leaving each operation to decide whether it needs a user. A bearer token
+// that is sent must still be valid.
+func (a *AuthHandler) OptionalAuth(next http.Handler) http.Handler {
+	required := a.RequireAuth(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		required.ServeHTTP(w, r)
+	})
+}
+
+// passwordLogin reads a LoginRequest and checks the password, writing the
+// error response when the login fails.
+func passwordLogin(w http.ResponseWriter, r *http.Request, u users.Client, resource string) (*users.User, bool) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, resource)
+		return nil, false
+	}
+	defer r.Body.Close()
+
+	req.Email = strings.ToLower(req.Email)
+	fields := log.Fields{"Email": req.Email}
+
+	if req.Email == "" || req.Password == "" {
+		BadRequest400(w, r, resource, "MISSING_CREDENTIALS")
+		return nil, false
+	}
+
+	user, err := u.Authenticate(r.Context(), req.Email, req.Password)
+	if err != nil {
+		switch errors.Cause(err) {
+		case users.ErrInvalidCredentials:
+			logging.FromContext(r.Context()).WithFields(fields).Warn("Invalid login attempt")
+			Unauthorized401(w, r, resource)
+		case users.ErrEmailNotVerified:
+			logging.FromContext(r.Context()).WithFields(fields).Warn("Login before email verification")
+			Forbidden403(w, r, resource)
+		default:
+			logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+			InternalError500(w, r, resource, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+// mfaChallenge answers with an MFA challenge when the user has MFA enabled.
+// It reports whether it did, and false for ok if it wrote an error.
+func mfaChallenge(w http.ResponseWriter, r *http.Request, m mfa.Client, userId, resource string) (bool, bool) {
+	fields := log.Fields{"Id": userId}
+
+	enabled, err := m.Enabled(r.Context(), userId)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, resource, err)
+		return false, false
+	}
+	if !enabled {
+		return false, true
+	}
+
+	challenge, err := m.Challenge(r.Context(), userId)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, resource, err)
+		return false, false
+	}
+
+	OK200(w, MfaChallengeResponse{MfaRequired: true, MfaToken: challenge})
+	return true, true
+}
+
+// mfaLogin reads a LoginMfaRequest and checks the challenge and code,
+// writing the error response when they are rejected.
+func mfaLogin(w http.ResponseWriter, r *http.Request, m mfa.Client, resource string) (string, bool) {
+	var req LoginMfaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, resource)
+		return "", false
+	}
+	defer r.Body.Close()
+
+	if req.MfaToken == "" || req.Code == "" {
+		BadRequest400(w, r, resource, "MISSING_CREDENTIALS")
+		return "", false
+	}
+
+	userId, err := m.VerifyChallenge(r.Context(), req.MfaToken, req.Code)
+	if err != nil {
+		if !writeMfaError(w, r, resource, err) {
+			logging.FromContext(r.Context()).Errorf("%+v", err)
+			InternalError500(w, r, resource, err)
+		}
+		return "", false
+	}
+
+	return userId, true
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"db_practice/internal/auth"
+	"db_practice/internal/mfa"
+	"db_practice/internal/sessions"
+	"db_practice/internal/users"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testTokens = &auth.TokenPair{
+	AccessToken:  "access",
+	RefreshToken: "refresh",
+	TokenType:    "Bearer",
+	ExpiresIn:    900,
+}
+
+func TestLogin(t *testing.T) {
+	testCases := []struct {
+		description  string
+		userClient   *users.TestClient
+		authClient   *auth.TestClient
+		mfaClient    *mfa.TestClient
+		requestBody  io.Reader
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description: "Success: Tokens issued",
+			userClient: &users.TestClient{
+				AuthenticateData: testUserEli,
+			},
+			authClient: &auth.TestClient{
+				IssueTokensData: testTokens,
+			},
+			mfaClient:    &mfa.TestClient{},
+			requestBody:  strings.NewReader(`{"email": "TestEmail@mail.com", "password": "password123"}`),
+			expectedBody: `{"access_token":"access","refresh_token":"refresh","token_type":"Bearer","expires_in":900}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Success: MFA challenge issued",
+			userClient: &users.TestClient{
+				AuthenticateData: testUserEli,
+			},
+			mfaClient: &mfa.TestClient{
+				EnabledData:   true,
+				ChallengeData: "challenge",
+			},
+			requestBody:  strings.NewReader(`{"email": "testemail@mail.com", "password": "password123"}`),
+			expectedBody: `{"mfa_required":true,"mfa_token":"challenge"}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Invalid credentials",
+			userClient: &users.TestClient{
+				AuthenticateErr: users.ErrInvalidCredentials,
+			},
+			requestBody:  strings.NewReader(`{"email": "testemail@mail.com", "password": "wrong"}`),
+			expectedBody: `{"message":"UNAUTHORIZED","resource":"Auth","description":"Valid credentials are required to access this resource."}`,
+			expectedCode: 401,
+		},
+		{
+			description: "Failure: Email not verified",
+			userClient: &users.TestClient{
+				AuthenticateErr: users.ErrEmailNotVerified,
+			},
+			requestBody:  strings.NewReader(`{"email": "testemail@mail.com", "password": "password123"}`),
+			expectedBody: `{"message":"FORBIDDEN","resource":"Auth","description":"You do not have permission to access this resource."}`,
+			expectedCode: 403,
+		},
+		{
+			description:  "Failure: Missing password",
+			requestBody:  strings.NewReader(`{"email": "testemail@mail.com"}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"Auth","description":"The value provided is invalid.","errors":[{"field":"MISSING_CREDENTIALS","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewAuthHandler(tc.userClient, tc.authClient, tc.mfaClient)
+			r := httptest.NewRequest("POST", "/auth/login", tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+
+			w := httptest.NewRecorder()
+			h.Login(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestLoginMfa(t *testing.T) {
+	testCases := []struct {
+		description  string
+		authClient   *auth.TestClient
+		mfaClient    *mfa.TestClient
+		requestBody  io.Reader
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description: "Success: Tokens issued",
+			authClient: &auth.TestClient{
+				IssueTokensData: testTokens,
+			},
+			mfaClient: &mfa.TestClient{
+				VerifyChallengeData: testUserEli.Id,
+			},
+			requestBody:  strings.NewReader(`{"mfa_token": "challenge", "code": "123456"}`),
+			expectedBody: `{"access_token":"access","refresh_token":"refresh","token_type":"Bearer","expires_in":900}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Invalid code",
+			mfaClient: &mfa.TestClient{
+				VerifyChallengeErr: mfa.ErrInvalidCode,
+			},
+			requestBody:  strings.NewReader(`{"mfa_token": "challenge", "code": "000000"}`),
+			expectedBody: `{"message":"UNAUTHORIZED","resource":"Auth","description":"Valid credentials are required to access this resource."}`,
+			expectedCode: 401,
+		},
+		{
+			description: "Failure: Locked out",
+			mfaClient: &mfa.TestClient{
+				VerifyChallengeErr: mfa.ErrTooManyAttempts,
+			},
+			requestBody:  strings.NewReader(`{"mfa_token": "challenge", "code": "000000"}`),
+			expectedBody: `{"message":"TOO_MANY_REQUESTS","resource":"Auth","description":"Too many requests, please try again later."}`,
+			expectedCode: 429,
+		},
+		{
+			description:  "Failure: Missing code",
+			requestBody:  strings.NewReader(`{"mfa_token": "challenge"}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"Auth","description":"The value provided is invalid.","errors":[{"field":"MISSING_CREDENTIALS","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewAuthHandler(nil, tc.authClient, tc.mfaClient)
+			r := httptest.NewRequest("POST", "/auth/login/mfa", tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+
+			w := httptest.NewRecorder()
+			h.LoginMfa(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	testCases := []struct {
+		description  string
+		authClient   *auth.TestClient
+		requestBody  io.Reader
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description: "Success: Tokens rotated",
+			authClient: &auth.TestClient{
+				RefreshData: testTokens,
+			},
+			requestBody:  strings.NewReader(`{"refresh_token": "refresh"}`),
+			expectedBody: `{"access_token":"access","refresh_token":"refresh","token_type":"Bearer","expires_in":900}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Token reused",
+			authClient: &auth.TestClient{
+				RefreshErr: auth.ErrTokenReused,
+			},
+			requestBody:  strings.NewReader(`{"refresh_token": "refresh"}`),
+			expectedBody: `{"message":"UNAUTHORIZED","resource":"Auth","description":"Valid credentials are required to access this resource."}`,
+			expectedCode: 401,
+		},
+		{
+			description: "Failure: Internal error",
+			authClient: &auth.TestClient{
+				RefreshErr: errors.New("error"),
+			},
+			requestBody:  strings.NewReader(`{"refresh_token": "refresh"}`),
+			expectedBody: `{"message":"INTERNAL_ERROR","resource":"Auth","description":"An internal error occurred."}`,
+			expectedCode: 500,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewAuthHandler(nil, tc.authClient, nil)
+			r := httptest.NewRequest("POST", "/auth/refresh", tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+
+			w := httptest.NewRecorder()
+			h.Refresh(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	testCases := []struct {
+		description     string
+		authClient      *auth.TestClient
+		authorization   string
+		session         *sessions.Session
+		expectedSubject string
+		expectedCode    int
+	}{
+		{
+			description: "Success: Subject in context",
+			authClient: &auth.TestClient{
+				ValidateAccessTokenData: &auth.Claims{Subject: "12infioed"},
+			},
+			authorization:   "Bearer access",
+			expectedSubject: "12infioed",
+			expectedCode:    200,
+		},
+		{
+			description:     "Success: Session cookie already authenticated",
+			authClient:      &auth.TestClient{},
+			session:         testSession,
+			expectedSubject: testSession.UserId,
+			expectedCode:    200,
+		},
+		{
+			description:   "Failure: No token",
+			authClient:    &auth.TestClient{},
+			authorization: "",
+			expectedCode:  401,
+		},
+		{
+			description: "Failure: Invalid token",
+			authClient: &auth.TestClient{
+				ValidateAccessTokenErr: auth.ErrInvalidToken,
+			},
+			authorization: "Bearer access",
+			expectedCode:  401,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			var subject string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subject, _ = auth.UserIdFromContext(r.Context())
+			})
+
+			h := NewAuthHandler(nil, tc.authClient, nil)
+			r := httptest.NewRequest("GET", "/users/testemail@mail.com", nil)
+			r.Header.Set("Accept", legacyAccept)
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+			if tc.session != nil {
+				ctx := auth.WithUserId(r.Context(), tc.session.UserId)
+				r = r.WithContext(sessions.WithSession(ctx, tc.session))
+			}
+
+			w := httptest.NewRecorder()
+			h.RequireAuth(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedSubject, subject)
+		})
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	testCases := []struct {
+		description     string
+		authClient      *auth.TestClient
+		authorization   string
+		expectedSubject string
+		expectedCode    int
+	}{
+		{
+			description: "Success: Subject in context",
+			authClient: &auth.TestClient{
+				ValidateAccessTokenData: &auth.Claims{Subject: "12infioed"},
+			},
+			authorization:   "Bearer access",
+			expectedSubject: "12infioed",
+			expectedCode:    200,
+		},
+		{
+			description:  "Success: Anonymous caller let through",
+			authClient:   &auth.TestClient{},
+			expectedCode: 200,
+		},
+		{
+			description:   "Failure: Not a bearer token",
+			authClient:    &auth.TestClient{},
+			authorization: "Basic dXNlcjpwYXNz",
+			expectedCode:  401,
+		},
+		{
+			description: "Failure: Invalid token",
+			authClient: &auth.TestClient{
+				ValidateAccessTokenErr: auth.ErrInvalidToken,
+			},
+			authorization: "Bearer access",
+			expectedCode:  401,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			var subject string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subject, _ = auth.UserIdFromContext(r.Context())
+			})
+
+			h := NewAuthHandler(nil, tc.authClient, nil)
+			r := httptest.NewRequest("POST", "/graphql", nil)
+			r.Header.Set("Accept", legacyAccept)
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			h.OptionalAuth(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedSubject, subject)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"db_practice/internal/errcatalog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type ErrorCatalogHandler struct {
+	catalog *errcatalog.Catalog
+}
+
+func NewErrorCatalogHandler(c *errcatalog.Catalog) *ErrorCatalogHandler {
+	return &ErrorCatalogHandler{
+		catalog: c,
+	}
+}
+
+// ListErrors lists every error code the API can answer with, in the
+// language asked for by Accept-Language, so clients can generate their own
+// enums from it.
+func (h *ErrorCatalogHandler) ListErrors(w http.ResponseWriter, r *http.Request) {
+	tag := errorLanguage(r)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", tag.String())
+	OK200(w, h.catalog.Entries(tag))
+}
+
+// GetError describes one code. Problem types point here.
+func (h *ErrorCatalogHandler) GetError(w http.ResponseWriter, r *http.Request) {
+	tag := errorLanguage(r)
+	entry, ok := h.catalog.Lookup(tag, errcatalog.Code(mux.Vars(r)["code"]))
+	if !ok {
+		NotFound404(w, r, "Errors")
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", tag.String())
+	OK200(w, entry)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"db_practice/internal/errcatalog"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListErrors(t *testing.T) {
+	h := NewErrorCatalogHandler(errcatalog.Default)
+
+	r := httptest.NewRequest("GET", "/errors", nil)
+	r.Header.Set("Accept-Language", "fr")
+	w := httptest.NewRecorder()
+	h.ListErrors(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "fr", w.Header().Get("Content-Language"))
+	var entries []errcatalog.Entry
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+	require.NotEmpty(t, entries)
+	assert.Equal(t, errcatalog.Entry{
+		Code:    errcatalog.NotFound,
+		Status:  404,
+		Title:   "Introuvable",
+		Message: "Ce que vous cherchez est introuvable.",
+	}, entries[0])
+}
+
+func TestGetError(t *testing.T) {
+	testCases := []struct {
+		description  string
+		code         string
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description:  "Success: Entry found",
+			code:         "invalid",
+			expectedBody: `{"code":"invalid","status":400,"title":"Invalid Value","message":"The value provided is invalid.","field_message":"{field} is invalid.","params":["field"]}`,
+			expectedCode: 200,
+		},
+		{
+			description:  "Failure: Unknown code",
+			code:         "teapot",
+			expectedBody: `{"message":"NOT_FOUND","resource":"Errors","description":"What you are looking for cannot be found."}`,
+			expectedCode: 404,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewErrorCatalogHandler(errcatalog.Default)
+			router := mux.NewRouter()
+			router.HandleFunc("/errors/{code}", h.GetError)
+
+			r := httptest.NewRequest("GET", "/errors/"+tc.code, nil)
+			r.Header.Set("Accept", legacyAccept)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
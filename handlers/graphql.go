@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"db_practice/graphqlapi"
+	"db_practice/internal/logging"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GraphQLHandler serves GraphQL over HTTP: queries and mutations as JSON,
+// subscriptions as server-sent events.
+type GraphQLHandler struct {
+	schema *graphqlapi.Schema
+
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+type GraphQLRequest struct {
+	Query         string                 `json:"query" openapi:"minLength=1"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// GraphQLResponse documents the body Serve answers with. Errors carry their
+// error catalog code, and the request id, in their extensions.
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []GraphQLLocation      `json:"locations"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+const eventStreamContentType = "text/event-stream"
+
+func NewGraphQLHandler(schema *graphqlapi.Schema) *GraphQLHandler {
+	return &GraphQLHandler{
+		schema:   schema,
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Serve runs a GraphQL operation. Results are answered with 200 even when
+// they hold errors, as GraphQL over HTTP does. Subscriptions are streamed to
+// clients accepting text/event-stream, an event per result.
+func (h *GraphQLHandler) Serve(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "GraphQL")
+		return
+	}
+	defer r.Body.Close()
+
+	op, result := h.schema.Prepare(r.Context(), graphqlapi.Params{
+		Query:          req.Query,
+		OperationName:  req.OperationName,
+		Variables:      req.Variables,
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Stream:         acceptsEventStream(r),
+	})
+	if result != nil {
+		OK200(w, result)
+		return
+	}
+
+	if op.Subscription() {
+		h.stream(w, r, op)
+		return
+	}
+	OK200(w, h.schema.Execute(r.Context(), op))
+}
+
+// Shutdown ends every subscription with a complete event, so open streams
+// don't hold up the server's shutdown.
+func (h *GraphQLHandler) Shutdown() {
+	h.shutdownOnce.Do(func() { close(h.shutdown) })
+}
+
+// stream sends the subscription's results as next events until it ends,
+// the client goes away or the server shuts down.
+func (h *GraphQLHandler) stream(w http.ResponseWriter, r *http.Request, op *graphqlapi.Operation) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	results := h.schema.Subscribe(ctx, op)
+
+	w.Header().Set("Content-Type", eventStreamContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+
+	// Streams outlive the server's write timeout. Writers that can't flush
+	// or clear the deadline still get every event, only later.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	rc.Flush()
+
+	for {
+		select {
+		case result, ok := <-results:
+			if !ok {
+				writeEvent(w, rc, "complete", nil)
+				return
+			}
+			data, err := json.Marshal(result)
+			if err != nil {
+				logging.FromContext(ctx).Errorf("%+v", err)
+				return
+			}
+			if err := writeEvent(w, rc, "next", data); err != nil {
+				return
+			}
+		case <-h.shutdown:
+			writeEvent(w, rc, "complete", nil)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func writeEvent(w io.Writer, rc *http.ResponseController, event string, data []byte) error {
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	rc.Flush()
+	return nil
+}
+
+// acceptsEventStream reports whether the Accept header lists
+// text/event-stream.
+func acceptsEventStream(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mediaType == eventStreamContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
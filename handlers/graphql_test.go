@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"db_practice/graphqlapi"
+	"db_practice/internal/auth"
+	"db_practice/internal/openapi"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEvents hands subscriptions the events sent on it.
+type testEvents chan users.Event
+
+func (e testEvents) Subscribe(ctx context.Context) <-chan users.Event {
+	return e
+}
+
+func testGraphQLHandler(t *testing.T, events testEvents) *GraphQLHandler {
+	u := users.TestClient{GetUsersByIdsData: []*users.User{{Id: "1", Email: "jane@example.com"}}}
+	schema, err := graphqlapi.NewSchema(u, rbac.TestClient{CanData: true}, verification.TestClient{}, events,
+		graphqlapi.Limits{MaxDepth: 5, MaxComplexity: 100})
+	require.NoError(t, err)
+	return NewGraphQLHandler(schema)
+}
+
+func TestGraphQL(t *testing.T) {
+	testCases := []struct {
+		description  string
+		body         string
+		accept       string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			description:  "Success: Query",
+			body:         `{"query":"query One($id: ID!) { user(id: $id) { email } }","operationName":"One","variables":{"id":"1"}}`,
+			expectedCode: 200,
+			expectedBody: `{"data":{"user":{"email":"jane@example.com"}}}`,
+		},
+		{
+			description:  "Success: Errors answered with 200",
+			body:         `{"query":"{ user { email } }"}`,
+			expectedCode: 200,
+			expectedBody: `"code":"invalid"`,
+		},
+		{
+			description:  "Failure: Invalid JSON",
+			body:         `{"query":`,
+			expectedCode: 400,
+			expectedBody: `"code":"invalid_json"`,
+		},
+		{
+			description:  "Failure: Subscription without an event stream",
+			body:         `{"query":"subscription { userEvents { type } }"}`,
+			accept:       "application/json",
+			expectedCode: 200,
+			expectedBody: `"code":"bad_request"`,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := testGraphQLHandler(t, nil)
+			r := httptest.NewRequest("POST", "/graphql", strings.NewReader(tc.body))
+			r = r.WithContext(auth.WithUserId(r.Context(), "1"))
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			h.Serve(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedBody)
+		})
+	}
+}
+
+func TestGraphQLSubscription(t *testing.T) {
+	event := users.Event{Type: users.EventCreated, User: &users.User{Id: "1"}, At: time.Now()}
+
+	testCases := []struct {
+		description  string
+		events       []users.Event
+		shutdown     bool
+		expectedBody string
+	}{
+		{
+			description: "Success: Event per result, then complete",
+			events:      []users.Event{event},
+			expectedBody: "event: next\ndata: {\"data\":{\"userEvents\":{\"type\":\"CREATED\",\"user\":{\"id\":\"1\"}}}}\n\n" +
+				"event: complete\ndata: \n\n",
+		},
+		{
+			description:  "Success: Completed by shutdown",
+			shutdown:     true,
+			expectedBody: "event: complete\ndata: \n\n",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			events := make(testEvents)
+			h := testGraphQLHandler(t, events)
+
+			body := `{"query":"subscription { userEvents(id: \"1\") { type user { id } } }"}`
+			r := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+			r = r.WithContext(auth.WithUserId(r.Context(), "1"))
+			r.Header.Set("Accept", "application/json, text/event-stream")
+			w := httptest.NewRecorder()
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				h.Serve(w, r)
+			}()
+
+			for _, e := range tc.events {
+				events <- e
+			}
+			if tc.shutdown {
+				h.Shutdown()
+			} else {
+				// The subscription ends once its events do.
+				close(events)
+			}
+			<-done
+
+			assert.Equal(t, 200, w.Code)
+			assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+// flushRecorder records a response, passing on the body written so far at
+// every flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes chan string
+}
+
+func (f *flushRecorder) Flush() {
+	f.ResponseRecorder.Flush()
+	f.flushes <- f.Body.String()
+}
+
+func TestGraphQLSubscriptionValidated(t *testing.T) {
+	events := make(testEvents)
+	gql := testGraphQLHandler(t, events)
+
+	spec := OpenAPISpec(true)
+	for _, e := range spec.Endpoints {
+		if e.Method == "POST" && e.Path == "/graphql" {
+			spec.Endpoints = []openapi.Endpoint{e}
+			break
+		}
+	}
+	h := NewOpenAPIHandler(true, true, 1<<20)
+	router := mux.NewRouter()
+	router.Use(h.Validate)
+	router.HandleFunc("/graphql", gql.Serve).Methods("POST")
+	doc, err := openapi.Build(router, spec)
+	require.NoError(t, err)
+	require.NoError(t, h.Load(doc))
+
+	body := `{"query":"subscription { userEvents(id: \"1\") { type user { id } } }"}`
+	r := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	r = r.WithContext(auth.WithUserId(r.Context(), "1"))
+	r.Header.Set("Accept", "application/json, text/event-stream")
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder(), flushes: make(chan string, 16)}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		router.ServeHTTP(w, r)
+	}()
+
+	// Each event reaches the client while the subscription is still open,
+	// rather than being held for response validation until it ends.
+	events <- users.Event{Type: users.EventCreated, User: &users.User{Id: "1"}, At: time.Now()}
+	timeout := time.After(time.Second)
+	for delivered := false; !delivered; {
+		select {
+		case flushed := <-w.flushes:
+			delivered = strings.Contains(flushed, "event: next")
+		case <-timeout:
+			t.Fatal("event not flushed while the subscription was open")
+		}
+	}
+
+	close(events)
+	<-done
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.True(t, strings.HasSuffix(w.Body.String(), "event: complete\ndata: \n\n"))
+}
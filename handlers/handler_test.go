@@ -1,16 +1,21 @@
 package handlers
 
 import (
-	"os"
+	"db_practice/config"
+	"errors"
+	"io/fs"
 	"path/filepath"
 	"runtime"
 
 	"github.com/joho/godotenv"
-	"github.com/spf13/viper"
 )
 
 var connStr string
 
+// legacyAccept asks for the deprecated error format, which the existing
+// body assertions were written against. See problems_test.go.
+const legacyAccept = "application/json"
+
 func init() {
 	_, filename, _, ok := runtime.Caller(0)
 	if !ok {
@@ -19,22 +24,13 @@ func init() {
 
 	dir := filepath.Dir(filename)
 	projectRoot := filepath.Join(dir, "..")
-	configPath := filepath.Join(projectRoot, "config", "test.yml")
-	if err := godotenv.Load(filepath.Join(projectRoot, ".env")); err != nil {
+	if err := godotenv.Load(filepath.Join(projectRoot, ".env")); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		panic("Error loading .env file: " + err.Error())
 	}
 
-	viper.SetConfigFile(configPath)
-	if err := viper.ReadInConfig(); err != nil {
-		panic("Error reading testing configuration file: " + err.Error())
-	}
-	viper.SetDefault("environment.test.database.user", os.Getenv("TEST_USER"))
-	viper.SetDefault("environment.test.database.password", os.Getenv("TEST_PASSWORD"))
-	viper.SetDefault("environment.test.database.name", os.Getenv("TEST_DB"))
-	viper.SetDefault("environment.test.database.connection_string", os.Getenv("TEST_CONN_STR"))
-
-	connStr = viper.GetString("environment.test.database.connection_string")
-	if connStr == "" {
-		panic("Connection string not found in configuration")
+	cfg, err := config.Load([]string{"-env", "test", "-config-dir", filepath.Join(projectRoot, "config")})
+	if err != nil {
+		panic("Error loading testing configuration: " + err.Error())
 	}
+	connStr = cfg.Database.ConnectionString
 }
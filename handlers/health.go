@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"db_practice/internal/health"
+	"net/http"
+)
+
+type HealthHandler struct {
+	healthClient health.Client
+}
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+func NewHealthHandler(h health.Client) *HealthHandler {
+	return &HealthHandler{
+		healthClient: h,
+	}
+}
+
+// Liveness reports only that the process is serving requests. It checks no
+// dependencies, so a database outage doesn't get every instance restarted.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	OK200(w, HealthResponse{Status: health.StatusOK})
+}
+
+// Readiness answers 200 when every dependency check passes and 503
+// otherwise. With ?verbose the body breaks down each check.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	report := h.healthClient.Ready(r.Context())
+
+	var body interface{} = HealthResponse{Status: report.Status}
+	if r.URL.Query().Has("verbose") {
+		body = report
+	}
+
+	if report.Status != health.StatusOK {
+		ServiceUnavailable503(w, body)
+		return
+	}
+	OK200(w, body)
+}
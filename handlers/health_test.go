@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"db_practice/internal/health"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLiveness(t *testing.T) {
+	h := NewHealthHandler(health.NewChecker(time.Second))
+	w := httptest.NewRecorder()
+	h.Liveness(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestReadiness(t *testing.T) {
+	pass := health.Check{Name: "database", Run: func(ctx context.Context) error { return nil }}
+	fail := health.Check{Name: "migrations", Run: func(ctx context.Context) error { return errors.New("missing migrations: x") }}
+
+	testCases := []struct {
+		description    string
+		checks         []health.Check
+		drain          bool
+		path           string
+		expectedCode   int
+		expectedBody   string
+		expectedChecks map[string]string
+	}{
+		{
+			description:  "Success: Ready",
+			checks:       []health.Check{pass},
+			path:         "/readyz",
+			expectedCode: 200,
+			expectedBody: `{"status":"ok"}`,
+		},
+		{
+			description:  "Failure: Check failing",
+			checks:       []health.Check{pass, fail},
+			path:         "/readyz",
+			expectedCode: 503,
+			expectedBody: `{"status":"fail"}`,
+		},
+		{
+			description:    "Failure: Verbose breakdown",
+			checks:         []health.Check{pass, fail},
+			path:           "/readyz?verbose",
+			expectedCode:   503,
+			expectedChecks: map[string]string{"database": "ok", "migrations": "fail"},
+		},
+		{
+			description:    "Failure: Draining",
+			checks:         []health.Check{pass},
+			drain:          true,
+			path:           "/readyz?verbose",
+			expectedCode:   503,
+			expectedChecks: map[string]string{"shutdown": "fail"},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			c := health.NewChecker(time.Second, tc.checks...)
+			if tc.drain {
+				c.Drain()
+			}
+			h := NewHealthHandler(c)
+
+			w := httptest.NewRecorder()
+			h.Readiness(w, httptest.NewRequest("GET", tc.path, nil))
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			if tc.expectedChecks == nil {
+				assert.Equal(t, tc.expectedBody, w.Body.String())
+				return
+			}
+
+			var report health.Report
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+			statuses := map[string]string{}
+			for _, c := range report.Checks {
+				statuses[c.Name] = c.Status
+			}
+			assert.Equal(t, tc.expectedChecks, statuses)
+		})
+	}
+}
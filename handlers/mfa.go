@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"db_practice/internal/auth"
+	"db_practice/internal/logging"
+	"db_practice/internal/mfa"
+	"db_practice/internal/users"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type MfaHandler struct {
+	usersClient users.Client
+	mfaClient   mfa.Client
+}
+
+type MfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// MfaReauthRequest re-authenticates the caller before a change that weakens
+// or resets their second factor.
+type MfaReauthRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func NewMfaHandler(u users.Client, m mfa.Client) *MfaHandler {
+	return &MfaHandler{
+		usersClient: u,
+		mfaClient:   m,
+	}
+}
+
+func (m *MfaHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	subject, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		Unauthorized401(w, r, "Mfa")
+		return
+	}
+	fields := log.Fields{"Id": subject}
+
+	user, err := m.usersClient.GetUserById(r.Context(), subject)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		NotFound404(w, r, "Mfa")
+		return
+	}
+
+	enrollment, err := m.mfaClient.Enroll(r.Context(), subject, user.Email)
+	if err != nil {
+		if errors.Cause(err) == mfa.ErrAlreadyEnabled {
+			ConflictError409(w, r, "Mfa", "mfa")
+			return
+		}
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, "Mfa", err)
+		return
+	}
+
+	OK200(w, enrollment)
+}
+
+func (m *MfaHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	subject, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		Unauthorized401(w, r, "Mfa")
+		return
+	}
+
+	var req MfaCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "Mfa")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Code == "" {
+		BadRequest400(w, r, "Mfa", "Code")
+		return
+	}
+
+	codes, err := m.mfaClient.Activate(r.Context(), subject, req.Code)
+	if err != nil {
+		switch errors.Cause(err) {
+		case mfa.ErrAlreadyEnabled:
+			ConflictError409(w, r, "Mfa", "mfa")
+		case mfa.ErrNotEnrolled:
+			NotFound404(w, r, "Mfa")
+		default:
+			if !writeMfaError(w, r, "Mfa", err) {
+				logging.FromContext(r.Context()).WithFields(log.Fields{"Id": subject}).Errorf("%+v", err)
+				InternalError500(w, r, "Mfa", err)
+			}
+		}
+		return
+	}
+
+	OK200(w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (m *MfaHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	subject, ok := m.reauthenticate(w, r)
+	if !ok {
+		return
+	}
+
+	if err := m.mfaClient.Disable(r.Context(), subject); err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Id": subject}).Errorf("%+v", err)
+		InternalError500(w, r, "Mfa", err)
+		return
+	}
+
+	NoContent204(w)
+}
+
+func (m *MfaHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	subject, ok := m.reauthenticate(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := m.mfaClient.RegenerateRecoveryCodes(r.Context(), subject)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Id": subject}).Errorf("%+v", err)
+		InternalError500(w, r, "Mfa", err)
+		return
+	}
+
+	OK200(w, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// reauthenticate checks the caller's password and a current MFA code, and
+// writes the error response when either is wrong.
+func (m *MfaHandler) reauthenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	subject, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		Unauthorized401(w, r, "Mfa")
+		return "", false
+	}
+	fields := log.Fields{"Id": subject}
+
+	var req MfaReauthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "Mfa")
+		return "", false
+	}
+	defer r.Body.Close()
+
+	if req.Password == "" || req.Code == "" {
+		BadRequest400(w, r, "Mfa", "MISSING_CREDENTIALS")
+		return "", false
+	}
+
+	user, err := m.usersClient.GetUserById(r.Context(), subject)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		NotFound404(w, r, "Mfa")
+		return "", false
+	}
+
+	if _, err := m.usersClient.Authenticate(r.Context(), user.Email, req.Password); err != nil {
+		if errors.Cause(err) == users.ErrInvalidCredentials {
+			logging.FromContext(r.Context()).WithFields(fields).Warn("MFA re-authentication failed")
+			Unauthorized401(w, r, "Mfa")
+			return "", false
+		}
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, "Mfa", err)
+		return "", false
+	}
+
+	if err := m.mfaClient.Verify(r.Context(), subject, req.Code); err != nil {
+		if errors.Cause(err) == mfa.ErrNotEnabled {
+			NotFound404(w, r, "Mfa")
+			return "", false
+		}
+		if !writeMfaError(w, r, "Mfa", err) {
+			logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+			InternalError500(w, r, "Mfa", err)
+		}
+		return "", false
+	}
+
+	return subject, true
+}
+
+// writeMfaError writes the response for a rejected code or challenge. It
+// returns false for errors it does not handle.
+func writeMfaError(w http.ResponseWriter, r *http.Request, resource string, err error) bool {
+	switch errors.Cause(err) {
+	case mfa.ErrInvalidCode, mfa.ErrInvalidChallenge:
+		logging.FromContext(r.Context()).Warnf("MFA rejected: %v", err)
+		Unauthorized401(w, r, resource)
+	case mfa.ErrTooManyAttempts:
+		TooManyRequests429(w, r, resource)
+	default:
+		return false
+	}
+	return true
+}
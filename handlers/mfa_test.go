@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"db_practice/internal/auth"
+	"db_practice/internal/mfa"
+	"db_practice/internal/users"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnrollMfa(t *testing.T) {
+	testCases := []struct {
+		description  string
+		userClient   *users.TestClient
+		mfaClient    *mfa.TestClient
+		subject      string
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description: "Success: Enrollment started",
+			userClient: &users.TestClient{
+				GetUserByIdData: testUserEli,
+			},
+			mfaClient: &mfa.TestClient{
+				EnrollData: &mfa.Enrollment{Secret: "SECRET", OtpauthURI: "otpauth://totp/db_practice:testemail@mail.com?secret=SECRET"},
+			},
+			subject:      testUserEli.Id,
+			expectedBody: `{"secret":"SECRET","otpauth_uri":"otpauth://totp/db_practice:testemail@mail.com?secret=SECRET"}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Already enabled",
+			userClient: &users.TestClient{
+				GetUserByIdData: testUserEli,
+			},
+			mfaClient: &mfa.TestClient{
+				EnrollErr: mfa.ErrAlreadyEnabled,
+			},
+			subject:      testUserEli.Id,
+			expectedBody: `{"message":"CONFLICT_ERROR","resource":"Mfa","description":"there is a conflict with your request","errors":[{"field":"mfa","error_code":"conflict_error"}]}`,
+			expectedCode: 409,
+		},
+		{
+			description:  "Failure: No subject",
+			expectedBody: `{"message":"UNAUTHORIZED","resource":"Mfa","description":"Valid credentials are required to access this resource."}`,
+			expectedCode: 401,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewMfaHandler(tc.userClient, tc.mfaClient)
+			r := httptest.NewRequest("POST", "/auth/mfa/enroll", nil)
+			r.Header.Set("Accept", legacyAccept)
+			if tc.subject != "" {
+				r = r.WithContext(auth.WithUserId(r.Context(), tc.subject))
+			}
+
+			w := httptest.NewRecorder()
+			h.Enroll(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestActivateMfa(t *testing.T) {
+	testCases := []struct {
+		description  string
+		mfaClient    *mfa.TestClient
+		requestBody  io.Reader
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description: "Success: Recovery codes returned",
+			mfaClient: &mfa.TestClient{
+				ActivateData: []string{"abcde-fghij"},
+			},
+			requestBody:  strings.NewReader(`{"code": "123456"}`),
+			expectedBody: `{"recovery_codes":["abcde-fghij"]}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Wrong code",
+			mfaClient: &mfa.TestClient{
+				ActivateErr: mfa.ErrInvalidCode,
+			},
+			requestBody:  strings.NewReader(`{"code": "000000"}`),
+			expectedBody: `{"message":"UNAUTHORIZED","resource":"Mfa","description":"Valid credentials are required to access this resource."}`,
+			expectedCode: 401,
+		},
+		{
+			description: "Failure: Not enrolled",
+			mfaClient: &mfa.TestClient{
+				ActivateErr: mfa.ErrNotEnrolled,
+			},
+			requestBody:  strings.NewReader(`{"code": "123456"}`),
+			expectedBody: `{"message":"NOT_FOUND","resource":"Mfa","description":"What you are looking for cannot be found."}`,
+			expectedCode: 404,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewMfaHandler(nil, tc.mfaClient)
+			r := httptest.NewRequest("POST", "/auth/mfa/activate", tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+			r = r.WithContext(auth.WithUserId(r.Context(), testUserEli.Id))
+
+			w := httptest.NewRecorder()
+			h.Activate(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestDisableMfa(t *testing.T) {
+	testCases := []struct {
+		description  string
+		userClient   *users.TestClient
+		mfaClient    *mfa.TestClient
+		requestBody  io.Reader
+		expectedCode int
+	}{
+		{
+			description: "Success: MFA disabled",
+			userClient: &users.TestClient{
+				GetUserByIdData:  testUserEli,
+				AuthenticateData: testUserEli,
+			},
+			mfaClient:    &mfa.TestClient{},
+			requestBody:  strings.NewReader(`{"password": "password123", "code": "123456"}`),
+			expectedCode: 204,
+		},
+		{
+			description: "Failure: Wrong password",
+			userClient: &users.TestClient{
+				GetUserByIdData: testUserEli,
+				AuthenticateErr: users.ErrInvalidCredentials,
+			},
+			mfaClient:    &mfa.TestClient{},
+			requestBody:  strings.NewReader(`{"password": "wrong", "code": "123456"}`),
+			expectedCode: 401,
+		},
+		{
+			description: "Failure: Wrong code",
+			userClient: &users.TestClient{
+				GetUserByIdData:  testUserEli,
+				AuthenticateData: testUserEli,
+			},
+			mfaClient: &mfa.TestClient{
+				VerifyErr: mfa.ErrInvalidCode,
+			},
+			requestBody:  strings.NewReader(`{"password": "password123", "code": "000000"}`),
+			expectedCode: 401,
+		},
+		{
+			description:  "Failure: Missing code",
+			requestBody:  strings.NewReader(`{"password": "password123"}`),
+			expectedCode: 400,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewMfaHandler(tc.userClient, tc.mfaClient)
+			r := httptest.NewRequest("POST", "/auth/mfa/disable", tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+			r = r.WithContext(auth.WithUserId(r.Context(), testUserEli.Id))
+
+			w := httptest.NewRecorder()
+			h.Disable(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestRegenerateRecoveryCodes(t *testing.T) {
+	h := NewMfaHandler(
+		&users.TestClient{GetUserByIdData: testUserEli, AuthenticateData: testUserEli},
+		&mfa.TestClient{RegenerateRecoveryCodesData: []string{"abcde-fghij", "klmno-pqrst"}},
+	)
+	r := httptest.NewRequest("POST", "/auth/mfa/recovery-codes", strings.NewReader(`{"password": "password123", "code": "123456"}`))
+	r.Header.Set("Accept", legacyAccept)
+	r = r.WithContext(auth.WithUserId(r.Context(), testUserEli.Id))
+
+	w := httptest.NewRecorder()
+	h.RegenerateRecoveryCodes(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `{"recovery_codes":["abcde-fghij","klmno-pqrst"]}`, w.Body.String())
+}
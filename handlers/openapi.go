@@ -0,0 +1,438 @@
+package handlers
+
+import (
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/health"
+	"db_practice/internal/mfa"
+	"db_practice/internal/openapi"
+	"db_practice/internal/users"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// OpenAPIHandler serves the OpenAPI document and a viewer for it, and
+// validates requests and responses against it (see Validate). The document
+// is built from the router its own routes are registered on, so it is
+// loaded once routing is set up.
+type OpenAPIHandler struct {
+	spec      []byte
+	validator *openapi.Validator
+
+	validateRequests  bool
+	validateResponses bool
+	maxBodyBytes      int64
+}
+
+//go:embed openapi.html
+var openAPIViewer []byte
+
+// NewOpenAPIHandler serves the document once it is loaded. Response
+// validation buffers every response, so it is meant for tests. Request
+// validation reads bodies of up to maxBodyBytes.
+func NewOpenAPIHandler(validateRequests, validateResponses bool, maxBodyBytes int64) *OpenAPIHandler {
+	return &OpenAPIHandler{
+		validateRequests:  validateRequests,
+		validateResponses: validateResponses,
+		maxBodyBytes:      maxBodyBytes,
+	}
+}
+
+// Load sets the document to serve and compiles its schemas for Validate.
+// It must be called before the server starts.
+func (h *OpenAPIHandler) Load(doc *openapi.Document) error {
+	spec, err := json.Marshal(doc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	validator, err := openapi.NewValidator(doc)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	h.spec = spec
+	h.validator = validator
+	return nil
+}
+
+// Validator checks values against the loaded document, so other APIs can
+// apply the same rules as the HTTP routes. It is nil until Load, and when
+// request validation is off.
+func (h *OpenAPIHandler) Validator() *openapi.Validator {
+	if !h.validateRequests {
+		return nil
+	}
+	return h.validator
+}
+
+func (h *OpenAPIHandler) Spec(w http.ResponseWriter, r *http.Request) {
+	if h.spec == nil {
+		NotFound404(w, r, "OpenAPI")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(h.spec)
+}
+
+// Docs serves a page that renders /openapi.json. It is self-contained, so
+// it works without reaching any CDN.
+func (h *OpenAPIHandler) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(openAPIViewer)
+}
+
+// Security schemes, as named in the OpenAPI document.
+const (
+	securityBearer  = "bearerAuth"
+	securitySession = "sessionCookie"
+	securityApiKey  = "apiKey"
+)
+
+// authenticated is what routes behind RequireAuth accept.
+var authenticated = []string{securityBearer, securitySession, securityApiKey}
+
+// jsonBody is a JSON response of v's type.
+func jsonBody(status int, description string, v interface{}) openapi.Body {
+	return openapi.Body{
+		Status:      status,
+		Description: description,
+		Content:     map[string]interface{}{"application/json": v},
+	}
+}
+
+// errorBodies are error responses, in either format Err negotiates.
+func errorBodies(statuses ...int) []openapi.Body {
+	errs := make([]openapi.Body, 0, len(statuses))
+	for _, status := range statuses {
+		errs = append(errs, openapi.Body{
+			Status: status,
+			Content: map[string]interface{}{
+				ProblemContentType: Problem{},
+				"application/json": Error{},
+			},
+		})
+	}
+	return errs
+}
+
+// responses lists a route's success responses followed by its errors.
+func responses(success []openapi.Body, errorStatuses ...int) []openapi.Body {
+	return append(success, errorBodies(errorStatuses...)...)
+}
+
+// bodies lists responses.
+func bodies(b ...openapi.Body) []openapi.Body {
+	return b
+}
+
+// OpenAPISpec documents every route main registers. Each route must have an
+// Endpoint here: building the document reports the ones that don't.
+func OpenAPISpec(secureCookies bool) openapi.Spec {
+	cookie := SessionCookieName
+	if secureCookies {
+		cookie = SecureSessionCookieName
+	}
+	text := func(status int, description string) openapi.Body {
+		return openapi.Body{
+			Status:      status,
+			Description: description,
+			Content:     map[string]interface{}{"text/plain": ""},
+		}
+	}
+	empty := func(status int, description string) openapi.Body {
+		return openapi.Body{Status: status, Description: description}
+	}
+	created := jsonBody(201, "The user", users.User{})
+	created.Headers = map[string]string{"Location": "The user's URL."}
+
+	return openapi.Spec{
+		Info: openapi.Info{
+			Title:   "Practice API",
+			Version: "1.0.0",
+			Description: "Routes are versioned under /v1. Unversioned paths are still served " +
+				"as v1, with a Warning header, unless Accept asks for a version, e.g. " +
+				VersionMediaType("v1") + ". Deprecated versions send Deprecation and Sunset headers. " +
+				"Errors are RFC 9457 problem details, or the legacy Error format " +
+				"for clients preferring application/json. Codes are listed at /errors.",
+		},
+		SecuritySchemes: map[string]*openapi.SecurityScheme{
+			securityBearer: {
+				Type:         "http",
+				Scheme:       "bearer",
+				BearerFormat: "JWT",
+				Description:  "Access token from /v1/auth/login or /v1/auth/refresh.",
+			},
+			securitySession: {
+				Type:        "apiKey",
+				In:          "cookie",
+				Name:        cookie,
+				Description: "Session cookie set by /v1/auth/sessions.",
+			},
+			securityApiKey: {
+				Type:        "apiKey",
+				In:          "header",
+				Name:        ApiKeyHeader,
+				Description: "Service API key; the route's scope is required.",
+			},
+		},
+		Endpoints: []openapi.Endpoint{
+			{
+				Method: "GET", Path: "/", Tags: []string{"meta"},
+				Summary:   "Welcome message",
+				Responses: bodies(text(200, "Welcome message")),
+			},
+			{
+				Method: "GET", Path: "/healthz", Tags: []string{"health"},
+				Summary:   "Liveness",
+				Responses: bodies(jsonBody(200, "Serving requests", HealthResponse{})),
+			},
+			{
+				Method: "GET", Path: "/readyz", Tags: []string{"health"},
+				Summary: "Readiness",
+				Query:   []openapi.Query{{Name: "verbose", Description: "Break the result down per check."}},
+				Responses: bodies(
+					jsonBody(200, "Every check passed", openapi.AnyOf(HealthResponse{}, health.Report{})),
+					jsonBody(503, "A check failed", openapi.AnyOf(HealthResponse{}, health.Report{})),
+				),
+			},
+			{
+				Method: "GET", Path: "/metrics", Tags: []string{"meta"},
+				Summary:   "Prometheus metrics",
+				Responses: bodies(text(200, "Metrics in the Prometheus text format")),
+			},
+			{
+				Method: "POST", Path: "/v1/admin/api-keys", Tags: []string{"api-keys"},
+				Summary:  "Create an API key",
+				Security: []string{securityApiKey},
+				Request:  CreateApiKeyRequest{},
+				Responses: responses(bodies(jsonBody(201, "The key; its secret is only ever shown here", CreateApiKeyResponse{})),
+					400, 401, 403, 429, 500),
+			},
+			{
+				Method: "GET", Path: "/v1/admin/api-keys", Tags: []string{"api-keys"},
+				Summary:   "List API keys",
+				Security:  []string{securityApiKey},
+				Responses: responses(bodies(jsonBody(200, "Every key", []*apikeys.ApiKey{})), 401, 403, 429, 500),
+			},
+			{
+				Method: "DELETE", Path: "/v1/admin/api-keys/{id}", Tags: []string{"api-keys"},
+				Summary:   "Revoke an API key",
+				Security:  []string{securityApiKey},
+				Responses: responses(bodies(empty(204, "Revoked")), 400, 401, 403, 404, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/login", Tags: []string{"auth"},
+				Summary:     "Log in for tokens",
+				Description: "Users with MFA enabled get a challenge to complete at /auth/login/mfa.",
+				Request:     LoginRequest{},
+				Responses: responses(bodies(jsonBody(200, "Tokens, or an MFA challenge", openapi.AnyOf(auth.TokenPair{}, MfaChallengeResponse{}))),
+					400, 401, 403, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/login/mfa", Tags: []string{"auth"},
+				Summary:   "Complete an MFA login",
+				Request:   LoginMfaRequest{},
+				Responses: responses(bodies(jsonBody(200, "Tokens", auth.TokenPair{})), 400, 401, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/refresh", Tags: []string{"auth"},
+				Summary:   "Exchange a refresh token",
+				Request:   RefreshRequest{},
+				Responses: responses(bodies(jsonBody(200, "New tokens", auth.TokenPair{})), 400, 401, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/logout", Tags: []string{"auth"},
+				Summary:   "Revoke a refresh token",
+				Request:   RefreshRequest{},
+				Responses: responses(bodies(empty(204, "Logged out")), 400, 429, 500),
+			},
+			{
+				Method: "GET", Path: "/.well-known/jwks.json", Tags: []string{"auth"},
+				Summary:   "Access token signing keys",
+				Responses: responses(bodies(jsonBody(200, "The JSON Web Key Set", auth.JWKS{})), 429),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/password-reset", Tags: []string{"auth"},
+				Summary:     "Request a password reset",
+				Description: "Accepted whether or not the email belongs to an account.",
+				Request:     PasswordResetRequest{},
+				Responses:   responses(bodies(empty(202, "A reset email is sent if the account exists")), 400, 429),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/password-reset/confirm", Tags: []string{"auth"},
+				Summary:   "Reset a password",
+				Request:   PasswordResetConfirmRequest{},
+				Responses: responses(bodies(empty(204, "Password changed")), 400, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/sessions", Tags: []string{"sessions"},
+				Summary:     "Log in with a session cookie",
+				Description: "Users with MFA enabled get a challenge to complete at /auth/sessions/mfa.",
+				Request:     LoginRequest{},
+				Responses: responses(bodies(
+					jsonBody(200, "An MFA challenge", MfaChallengeResponse{}),
+					jsonBody(201, "The session; its cookie is set", SessionResponse{}),
+				), 400, 401, 403, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/sessions/mfa", Tags: []string{"sessions"},
+				Summary:   "Complete an MFA session login",
+				Request:   LoginMfaRequest{},
+				Responses: responses(bodies(jsonBody(201, "The session; its cookie is set", SessionResponse{})), 400, 401, 429, 500),
+			},
+			{
+				Method: "DELETE", Path: "/v1/auth/sessions/current", Tags: []string{"sessions"},
+				Summary:   "Log out of the current session",
+				Responses: responses(bodies(empty(204, "Logged out; the cookie is cleared")), 429, 500),
+			},
+			{
+				Method: "GET", Path: "/errors", Tags: []string{"errors"},
+				Summary:   "List error codes",
+				Responses: responses(bodies(jsonBody(200, "Every code, localized by Accept-Language", []errcatalog.Entry{})), 429),
+			},
+			{
+				Method: "GET", Path: "/errors/{code}", Tags: []string{"errors"},
+				Summary:   "Describe an error code",
+				Responses: responses(bodies(jsonBody(200, "The code, localized by Accept-Language", errcatalog.Entry{})), 404, 429),
+			},
+			{
+				Method: "GET", Path: "/openapi.json", Tags: []string{"meta"},
+				Summary:   "This document",
+				Responses: responses(bodies(jsonBody(200, "The OpenAPI document", map[string]interface{}{})), 429),
+			},
+			{
+				Method: "GET", Path: "/docs", Tags: []string{"meta"},
+				Summary: "API reference",
+				Responses: responses(bodies(openapi.Body{
+					Status:      200,
+					Description: "A page rendering this document",
+					Content:     map[string]interface{}{"text/html": ""},
+				}), 429),
+			},
+			{
+				Method: "POST", Path: "/graphql", Tags: []string{"graphql"},
+				Summary: "Run a GraphQL operation",
+				Description: "Queries and mutations answer with JSON, errors included. Subscriptions stream " +
+					"text/event-stream to clients that accept it. createUser needs no credentials; " +
+					"every other field does, and API key callers need the users:read scope.",
+				Security: authenticated,
+				Request:  GraphQLRequest{},
+				Responses: responses(bodies(openapi.Body{
+					Status:      200,
+					Description: "The result, or a stream of them for subscriptions",
+					Content: map[string]interface{}{
+						"application/json":     GraphQLResponse{},
+						eventStreamContentType: "",
+					},
+				}), 400, 401, 403, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/users", Tags: []string{"users"},
+				Summary:     "Create a user",
+				Description: "API key callers need the users:write scope.",
+				Request:     CreateUserRequest{},
+				Responses:   responses(bodies(created), 400, 401, 403, 409, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/users/create", Tags: []string{"users"},
+				Summary:     "Create a user",
+				Description: "Deprecated for POST /v1/users.",
+				Request:     CreateUserRequest{},
+				Responses:   responses(bodies(created), 400, 401, 403, 409, 429, 500),
+				Deprecated:  true,
+			},
+			{
+				Method: "GET", Path: "/v1/verify", Tags: []string{"users"},
+				Summary:   "Verify an email address",
+				Query:     []openapi.Query{{Name: "token", Description: "Token from the verification email.", Required: true}},
+				Responses: responses(bodies(jsonBody(200, "The verified user", users.User{})), 400, 429, 500),
+			},
+			{
+				Method: "GET", Path: "/v1/users/{id}", Tags: []string{"users"},
+				Summary: "Get a user",
+				Description: "An email in place of the id is still looked up, but deprecated " +
+					"for POST /v1/users/search: emails in URLs end up in access logs.",
+				Security:  authenticated,
+				Responses: responses(bodies(jsonBody(200, "The user", users.User{})), 400, 401, 403, 404, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/users/search", Tags: []string{"users"},
+				Summary:   "Find a user by email",
+				Security:  authenticated,
+				Request:   SearchUsersRequest{},
+				Responses: responses(bodies(jsonBody(200, "The user", users.User{})), 400, 401, 403, 404, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/users/batch-get", Tags: []string{"users"},
+				Summary: "Get users by id or email",
+				Description: "Up to 100 ids or emails, not both. Users come back in the order asked for; " +
+					"ids or emails matching no user are listed as missing. Needs permission to read any user.",
+				Security:  authenticated,
+				Request:   BatchGetUsersRequest{},
+				Responses: responses(bodies(jsonBody(200, "The users found and the misses", BatchGetUsersResponse{})), 400, 401, 403, 429, 500),
+			},
+			{
+				Method: "PUT", Path: "/v1/users/{id}", Tags: []string{"users"},
+				Summary:   "Update a user",
+				Security:  authenticated,
+				Request:   UpdateUserRequest{},
+				Responses: responses(bodies(jsonBody(200, "The updated user", users.User{})), 400, 401, 403, 404, 409, 429, 500),
+			},
+			{
+				Method: "DELETE", Path: "/v1/users/{id}", Tags: []string{"users"},
+				Summary:   "Delete a user",
+				Security:  authenticated,
+				Responses: responses(bodies(empty(204, "Deleted")), 400, 401, 403, 404, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/users/{id}/verify/resend", Tags: []string{"users"},
+				Summary:   "Resend the verification email",
+				Security:  authenticated,
+				Responses: responses(bodies(empty(204, "Sent")), 400, 401, 403, 404, 409, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/mfa/enroll", Tags: []string{"mfa"},
+				Summary:   "Start MFA enrollment",
+				Security:  authenticated,
+				Responses: responses(bodies(jsonBody(200, "The TOTP secret", mfa.Enrollment{})), 401, 404, 409, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/mfa/activate", Tags: []string{"mfa"},
+				Summary:   "Activate MFA",
+				Security:  authenticated,
+				Request:   MfaCodeRequest{},
+				Responses: responses(bodies(jsonBody(200, "Recovery codes, only ever shown here", RecoveryCodesResponse{})), 400, 401, 404, 409, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/mfa/disable", Tags: []string{"mfa"},
+				Summary:   "Disable MFA",
+				Security:  authenticated,
+				Request:   MfaReauthRequest{},
+				Responses: responses(bodies(empty(204, "Disabled")), 400, 401, 404, 429, 500),
+			},
+			{
+				Method: "POST", Path: "/v1/auth/mfa/recovery-codes", Tags: []string{"mfa"},
+				Summary:   "Regenerate recovery codes",
+				Security:  authenticated,
+				Request:   MfaReauthRequest{},
+				Responses: responses(bodies(jsonBody(200, "New recovery codes", RecoveryCodesResponse{})), 400, 401, 404, 429, 500),
+			},
+			{
+				Method: "GET", Path: "/v1/auth/sessions", Tags: []string{"sessions"},
+				Summary:   "List your sessions",
+				Security:  authenticated,
+				Responses: responses(bodies(jsonBody(200, "Every active session", []SessionResponse{})), 401, 429, 500),
+			},
+			{
+				Method: "DELETE", Path: "/v1/auth/sessions/{id}", Tags: []string{"sessions"},
+				Summary:   "Revoke a session",
+				Security:  authenticated,
+				Responses: responses(bodies(empty(204, "Revoked")), 400, 401, 404, 429, 500),
+			},
+		},
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"db_practice/internal/logging"
+	"db_practice/internal/passwordreset"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type PasswordResetHandler struct {
+	resetClient passwordreset.Client
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func NewPasswordResetHandler(p passwordreset.Client) *PasswordResetHandler {
+	return &PasswordResetHandler{
+		resetClient: p,
+	}
+}
+
+// RequestReset always answers 202 for well-formed requests, whether or not
+// the email belongs to an account.
+func (p *PasswordResetHandler) RequestReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "PasswordReset")
+		return
+	}
+	defer r.Body.Close()
+
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		BadRequest400(w, r, "PasswordReset", "Email")
+		return
+	}
+
+	if err := p.resetClient.RequestReset(r.Context(), req.Email, clientIP(r)); err != nil {
+		if errors.Cause(err) == passwordreset.ErrRateLimited {
+			TooManyRequests429(w, r, "PasswordReset")
+			return
+		}
+		// Failures are logged but not surfaced, so the response does not
+		// depend on whether the account exists.
+		logging.FromContext(r.Context()).Errorf("%+v", err)
+	}
+
+	Accepted202(w, nil)
+}
+
+func (p *PasswordResetHandler) ConfirmReset(w http.ResponseWriter, r *http.Request) {
+	var req PasswordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "PasswordReset")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Token == "" {
+		BadRequest400(w, r, "PasswordReset", "Token")
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		BadRequest400(w, r, "PasswordReset", "Password")
+		return
+	}
+
+	if err := p.resetClient.ConfirmReset(r.Context(), req.Token, req.Password); err != nil {
+		if errors.Cause(err) == passwordreset.ErrInvalidToken {
+			logging.FromContext(r.Context()).Warn("Password reset token rejected")
+			BadRequest400(w, r, "PasswordReset", "Token")
+			return
+		}
+		logging.FromContext(r.Context()).Errorf("%+v", err)
+		InternalError500(w, r, "PasswordReset", err)
+		return
+	}
+
+	NoContent204(w)
+}
+
+// clientIP is the address of the connecting peer.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
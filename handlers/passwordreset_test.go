@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"db_practice/internal/passwordreset"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestPasswordReset(t *testing.T) {
+	testCases := []struct {
+		description  string
+		resetClient  *passwordreset.TestClient
+		requestBody  io.Reader
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description:  "Success: Reset requested",
+			resetClient:  &passwordreset.TestClient{},
+			requestBody:  strings.NewReader(`{"email": "testemail@mail.com"}`),
+			expectedBody: "",
+			expectedCode: 202,
+		},
+		{
+			description: "Success: Send failure is not revealed",
+			resetClient: &passwordreset.TestClient{
+				RequestResetErr: errors.New("smtp unavailable"),
+			},
+			requestBody:  strings.NewReader(`{"email": "testemail@mail.com"}`),
+			expectedBody: "",
+			expectedCode: 202,
+		},
+		{
+			description: "Failure: Rate limited",
+			resetClient: &passwordreset.TestClient{
+				RequestResetErr: passwordreset.ErrRateLimited,
+			},
+			requestBody:  strings.NewReader(`{"email": "testemail@mail.com"}`),
+			expectedBody: `{"message":"TOO_MANY_REQUESTS","resource":"PasswordReset","description":"Too many requests, please try again later."}`,
+			expectedCode: 429,
+		},
+		{
+			description:  "Failure: Missing email",
+			requestBody:  strings.NewReader(`{}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"PasswordReset","description":"The value provided is invalid.","errors":[{"field":"Email","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewPasswordResetHandler(tc.resetClient)
+			r := httptest.NewRequest("POST", "/auth/password-reset", tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+
+			w := httptest.NewRecorder()
+			h.RequestReset(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	testCases := []struct {
+		description  string
+		resetClient  *passwordreset.TestClient
+		requestBody  io.Reader
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description:  "Success: Password reset",
+			resetClient:  &passwordreset.TestClient{},
+			requestBody:  strings.NewReader(`{"token": "abc", "password": "newpassword123"}`),
+			expectedBody: "",
+			expectedCode: 204,
+		},
+		{
+			description: "Failure: Invalid token",
+			resetClient: &passwordreset.TestClient{
+				ConfirmResetErr: passwordreset.ErrInvalidToken,
+			},
+			requestBody:  strings.NewReader(`{"token": "abc", "password": "newpassword123"}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"PasswordReset","description":"The value provided is invalid.","errors":[{"field":"Token","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+		{
+			description:  "Failure: Password too short",
+			requestBody:  strings.NewReader(`{"token": "abc", "password": "short"}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"PasswordReset","description":"The value provided is invalid.","errors":[{"field":"Password","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewPasswordResetHandler(tc.resetClient)
+			r := httptest.NewRequest("POST", "/auth/password-reset/confirm", tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+
+			w := httptest.NewRecorder()
+			h.ConfirmReset(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
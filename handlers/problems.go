@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details.
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypeBase prefixes the catalog code to form a problem's type, a URI
+// reference relative to the API's base URL where the entry is served.
+const ProblemTypeBase = "/errors/"
+
+// LegacyErrorsDeprecated is when the legacy error body format was
+// deprecated, announced with the Deprecation header on every legacy body.
+var LegacyErrorsDeprecated = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+// Problem is an RFC 9457 problem details body. Code, Resource, RequestID and
+// Errors are extension members.
+type Problem struct {
+	Type      string        `json:"type"`
+	Title     string        `json:"title"`
+	Status    int           `json:"status"`
+	Detail    string        `json:"detail,omitempty"`
+	Instance  string        `json:"instance,omitempty"`
+	Code      string        `json:"code,omitempty"`
+	Resource  string        `json:"resource,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+	Errors    []*FieldError `json:"errors,omitempty"`
+}
+
+// NewProblem describes e, answered to r with status, as problem details in
+// the language r asks for.
+func NewProblem(r *http.Request, e *Error, status int) *Problem {
+	tag := errorLanguage(r)
+	p := &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    e.Description,
+		Instance:  r.URL.Path,
+		Resource:  e.Resource,
+		RequestID: logging.RequestID(r.Context()),
+	}
+	if entry, ok := errcatalog.Default.Lookup(tag, e.code); ok {
+		p.Type = ProblemTypeBase + string(entry.Code)
+		p.Title = entry.Title
+		p.Detail = entry.Message
+		p.Code = string(entry.Code)
+	}
+
+	for _, fe := range e.Errors {
+		localized := *fe
+		entry, ok := errcatalog.Default.Lookup(tag, errcatalog.Code(fe.ErrorCode))
+		if localized.Message == "" && ok && entry.FieldMessage != "" {
+			params := map[string]string{"field": fe.Field}
+			for k, v := range fe.params {
+				params[k] = v
+			}
+			localized.Message = errcatalog.Render(entry.FieldMessage, params)
+		}
+		p.Errors = append(p.Errors, &localized)
+	}
+	return p
+}
+
+// errorLanguage is the catalog language best matching r's Accept-Language.
+func errorLanguage(r *http.Request) language.Tag {
+	return errcatalog.Default.Match(strings.Join(r.Header.Values("Accept-Language"), ","))
+}
+
+// prefersLegacyErrors reports whether r's Accept header ranks
+// application/json above application/problem+json. Clients that send no
+// Accept header or accept both equally get problem details.
+func prefersLegacyErrors(r *http.Request) bool {
+	accept := r.Header.Values("Accept")
+	return acceptQuality(accept, "application/json") > acceptQuality(accept, ProblemContentType)
+}
+
+// acceptQuality is the q value the Accept header values give mediaType,
+// taken from the most specific matching range. No header accepts anything.
+func acceptQuality(accept []string, mediaType string) float64 {
+	if len(accept) == 0 {
+		return 1
+	}
+	mainType := strings.SplitN(mediaType, "/", 2)[0]
+
+	quality, specificity := 0.0, -1
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			var s int
+			switch mediaRange {
+			case mediaType:
+				s = 2
+			case mainType + "/*":
+				s = 1
+			case "*/*":
+				s = 0
+			default:
+				continue
+			}
+			if s <= specificity {
+				continue
+			}
+
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					q = 0
+				}
+			}
+			quality, specificity = q, s
+		}
+	}
+	return quality
+}
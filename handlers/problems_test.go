@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPrefersLegacyErrors(t *testing.T) {
+	testCases := []struct {
+		description string
+		accept      []string
+		expected    bool
+	}{
+		{
+			description: "Success: No Accept header gets problem details",
+			expected:    false,
+		},
+		{
+			description: "Success: Anything accepted gets problem details",
+			accept:      []string{"*/*"},
+			expected:    false,
+		},
+		{
+			description: "Success: Problem details asked for",
+			accept:      []string{"application/problem+json"},
+			expected:    false,
+		},
+		{
+			description: "Success: Tie goes to problem details",
+			accept:      []string{"application/json, text/plain, */*"},
+			expected:    false,
+		},
+		{
+			description: "Success: Plain JSON asked for gets the legacy format",
+			accept:      []string{"application/json"},
+			expected:    true,
+		},
+		{
+			description: "Success: Problem details ranked lower",
+			accept:      []string{"application/problem+json;q=0.5", "application/json"},
+			expected:    true,
+		},
+		{
+			description: "Success: Most specific range wins",
+			accept:      []string{"application/problem+json;q=0, application/*;q=0.9, application/json;q=0.8"},
+			expected:    true,
+		},
+		{
+			description: "Success: Malformed ranges ignored",
+			accept:      []string{"application/json;q=oops, ;;"},
+			expected:    false,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := httptest.NewRequest("GET", "/users/a@mail.com", nil)
+			for _, a := range tc.accept {
+				r.Header.Add("Accept", a)
+			}
+			assert.Equal(t, tc.expected, prefersLegacyErrors(r))
+		})
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	testCases := []struct {
+		description string
+		write       func(w http.ResponseWriter, r *http.Request)
+		expected    Problem
+	}{
+		{
+			description: "Failure: Every invalid field listed",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				BadRequest400(w, r, "Users", "Address", "First Name")
+			},
+			expected: Problem{
+				Type:   "/errors/invalid",
+				Title:  "Invalid Value",
+				Status: 400,
+				Detail: "The value provided is invalid.",
+				Code:   "invalid",
+				Errors: []*FieldError{
+					{Field: "Address", ErrorCode: "invalid", Message: "Address is invalid."},
+					{Field: "First Name", ErrorCode: "invalid", Message: "First Name is invalid."},
+				},
+			},
+		},
+		{
+			description: "Failure: Invalid JSON",
+			write:       func(w http.ResponseWriter, r *http.Request) { InvalidJSON400(w, r, "Users") },
+			expected: Problem{
+				Type:   "/errors/invalid_json",
+				Title:  "Invalid JSON",
+				Status: 400,
+				Detail: "The JSON value provided is invalid.",
+				Code:   "invalid_json",
+			},
+		},
+		{
+			description: "Failure: Conflicting field named",
+			write:       func(w http.ResponseWriter, r *http.Request) { ConflictError409(w, r, "Users", "email") },
+			expected: Problem{
+				Type:   "/errors/conflict_error",
+				Title:  "Conflict",
+				Status: 409,
+				Detail: "there is a conflict with your request",
+				Code:   "conflict_error",
+				Errors: []*FieldError{{Field: "email", ErrorCode: "conflict_error", Message: "email conflicts with an existing value."}},
+			},
+		},
+		{
+			description: "Failure: Error outside the catalog",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				Err(w, r, &Error{Message: "GONE", Resource: "Users", Description: "The user was deleted."}, 410)
+			},
+			expected: Problem{
+				Type:   "about:blank",
+				Title:  "Gone",
+				Status: 410,
+				Detail: "The user was deleted.",
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := httptest.NewRequest("POST", "/users/create", nil)
+			w := httptest.NewRecorder()
+			tc.write(w, r)
+
+			assert.Equal(t, tc.expected.Status, w.Code)
+			assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, []string{"Accept", "Accept-Language"}, w.Header().Values("Vary"))
+			assert.Equal(t, "en", w.Header().Get("Content-Language"))
+			assert.Empty(t, w.Header().Get("Deprecation"))
+
+			var body Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			tc.expected.Instance = "/users/create"
+			tc.expected.Resource = "Users"
+			assert.Equal(t, tc.expected, body)
+		})
+	}
+}
+
+func TestLocalizedProblem(t *testing.T) {
+	testCases := []struct {
+		description     string
+		acceptLanguage  string
+		legacy          bool
+		expectedLang    string
+		expectedTitle   string
+		expectedDetail  string
+		expectedMessage string
+	}{
+		{
+			description:     "Success: Spanish problem details",
+			acceptLanguage:  "es-ES,es;q=0.9,en;q=0.5",
+			expectedLang:    "es",
+			expectedTitle:   "Valor no válido",
+			expectedDetail:  "El valor proporcionado no es válido.",
+			expectedMessage: "Email no es válido.",
+		},
+		{
+			description:     "Success: French problem details",
+			acceptLanguage:  "fr-CA",
+			expectedLang:    "fr",
+			expectedTitle:   "Valeur non valide",
+			expectedDetail:  "La valeur fournie n'est pas valide.",
+			expectedMessage: "Email n'est pas valide.",
+		},
+		{
+			description:     "Success: Unavailable language falls back to English",
+			acceptLanguage:  "ja",
+			expectedLang:    "en",
+			expectedTitle:   "Invalid Value",
+			expectedDetail:  "The value provided is invalid.",
+			expectedMessage: "Email is invalid.",
+		},
+		{
+			description:    "Success: Legacy description localized",
+			acceptLanguage: "es",
+			legacy:         true,
+			expectedLang:   "es",
+			expectedDetail: "El valor proporcionado no es válido.",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := httptest.NewRequest("POST", "/users/create", nil)
+			r.Header.Set("Accept-Language", tc.acceptLanguage)
+			if tc.legacy {
+				r.Header.Set("Accept", legacyAccept)
+			}
+			w := httptest.NewRecorder()
+			BadRequest400(w, r, "Users", "Email")
+
+			assert.Equal(t, tc.expectedLang, w.Header().Get("Content-Language"))
+			if tc.legacy {
+				var body Error
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, tc.expectedDetail, body.Description)
+				assert.Equal(t, []*FieldError{{Field: "Email", ErrorCode: "invalid"}}, body.Errors)
+				return
+			}
+
+			var body Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, "invalid", body.Code)
+			assert.Equal(t, tc.expectedTitle, body.Title)
+			assert.Equal(t, tc.expectedDetail, body.Detail)
+			require.Len(t, body.Errors, 1)
+			assert.Equal(t, tc.expectedMessage, body.Errors[0].Message)
+		})
+	}
+}
+
+func TestLegacyErrorResponse(t *testing.T) {
+	r := httptest.NewRequest("GET", "/users/a@mail.com", nil)
+	r.Header.Set("Accept", legacyAccept)
+	w := httptest.NewRecorder()
+	NotFound404(w, r, "Users")
+
+	assert.Equal(t, 404, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, DeprecationDate(LegacyErrorsDeprecated), w.Header().Get("Deprecation"))
+	assert.Equal(t, `{"message":"NOT_FOUND","resource":"Users","description":"What you are looking for cannot be found."}`, w.Body.String())
+}
+
+func TestInternalErrorRecorded(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := provider.Tracer("test").Start(context.Background(), "POST /users/create")
+
+	r := httptest.NewRequest("POST", "/users/create", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	InternalError500(w, r, "Users", errors.New("connection refused"))
+	span.End()
+
+	// The cause goes to the trace, not the client.
+	assert.NotContains(t, w.Body.String(), "connection refused")
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Len(t, spans[0].Events(), 1)
+	assert.Equal(t, "exception", spans[0].Events()[0].Name)
+	assert.Contains(t, fmt.Sprint(spans[0].Events()[0].Attributes), "connection refused")
+}
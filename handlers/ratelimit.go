@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/logging"
+	"db_practice/internal/ratelimit"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// RateLimitKey is what requests are counted against.
+type RateLimitKey string
+
+const (
+	LimitByIP     RateLimitKey = "ip"
+	LimitByApiKey RateLimitKey = "api_key"
+	// LimitByUser counts authenticated users, so it only sees a user on
+	// routes behind RequireAuth.
+	LimitByUser RateLimitKey = "user"
+)
+
+// RouteLimit is the rate limit for a named route. Requests without the
+// identity Key asks for fall back to the API key, then the client address.
+type RouteLimit struct {
+	Key    RateLimitKey
+	Policy ratelimit.Policy
+}
+
+type RateLimitHandler struct {
+	store ratelimit.Store
+	// trustForwardedFor takes the client address from X-Forwarded-For,
+	// which only a proxy that sets the header makes safe.
+	trustForwardedFor bool
+	now               func() time.Time
+}
+
+func NewRateLimitHandler(store ratelimit.Store, trustForwardedFor bool) *RateLimitHandler {
+	return &RateLimitHandler{
+		store:             store,
+		trustForwardedFor: trustForwardedFor,
+		now:               time.Now,
+	}
+}
+
+// Limit is router middleware that answers 429 once a client has used up the
+// matched route's limit. Routes are looked up by name; the rest share def.
+// Every limited response carries RateLimit-* headers. A failing store lets
+// requests through rather than take the API down with it.
+func (h *RateLimitHandler) Limit(def RouteLimit, routes map[string]RouteLimit) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, limit := "default", def
+			if route := mux.CurrentRoute(r); route != nil {
+				if l, ok := routes[route.GetName()]; ok {
+					name, limit = route.GetName(), l
+				}
+			}
+			if !limit.Policy.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := name + "|" + h.identity(r, limit.Key)
+			result, err := h.store.Take(r.Context(), key, limit.Policy, h.now())
+			if err != nil {
+				logging.FromContext(r.Context()).WithField("Route", name).Errorf("%+v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Policy.Requests, seconds(limit.Policy.Per)))
+
+			if !result.Allowed {
+				fields := log.Fields{"Route": name, "Key": limit.Key}
+				logging.FromContext(r.Context()).WithFields(fields).Warn("Rate limit exceeded")
+				RateLimited429(w, r, "RateLimit", result.RetryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// identity names the client a request is counted against.
+func (h *RateLimitHandler) identity(r *http.Request, key RateLimitKey) string {
+	if key == LimitByUser {
+		if userId, ok := auth.UserIdFromContext(r.Context()); ok {
+			return "user:" + userId
+		}
+	}
+	if key == LimitByUser || key == LimitByApiKey {
+		if k, ok := apikeys.ApiKeyFromContext(r.Context()); ok {
+			return "key:" + k.Id
+		}
+	}
+	return "ip:" + h.clientAddr(r)
+}
+
+// clientAddr is the address the request came from. With trustForwardedFor
+// it is the last X-Forwarded-For entry, the one added by our own proxy;
+// earlier entries are whatever the client chose to send.
+func (h *RateLimitHandler) clientAddr(r *http.Request) string {
+	if h.trustForwardedFor {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			hops := strings.Split(values[len(values)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	return clientIP(r)
+}
+
+// seconds rounds d up to whole seconds, as the RateLimit headers use.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/ratelimit"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingLimitStore struct{}
+
+func (failingLimitStore) Take(ctx context.Context, key string, p ratelimit.Policy, now time.Time) (*ratelimit.Result, error) {
+	return nil, errors.New("connection refused")
+}
+
+// testRequest is one request made against the rate limited router.
+type testRequest struct {
+	path          string
+	remoteAddr    string
+	forwardedFor  string
+	userId        string
+	apiKey        *apikeys.ApiKey
+	expectedCode  int
+	expectedLimit string
+}
+
+func TestRateLimit(t *testing.T) {
+	def := RouteLimit{Key: LimitByIP, Policy: ratelimit.Policy{Requests: 2, Per: time.Minute}}
+	routes := map[string]RouteLimit{
+		"users.get":    {Key: LimitByUser, Policy: ratelimit.Policy{Requests: 1, Per: time.Minute}},
+		"users.create": {Key: LimitByApiKey, Policy: ratelimit.Policy{Requests: 1, Per: time.Minute}},
+		"health":       {Key: LimitByIP},
+	}
+
+	testCases := []struct {
+		description       string
+		store             ratelimit.Store
+		trustForwardedFor bool
+		requests          []testRequest
+	}{
+		{
+			description: "Failure: Client over the default limit",
+			requests: []testRequest{
+				{path: "/auth/login", remoteAddr: "1.2.3.4:1000", expectedCode: 200, expectedLimit: "1"},
+				{path: "/auth/login", remoteAddr: "1.2.3.4:2000", expectedCode: 200, expectedLimit: "0"},
+				{path: "/auth/login", remoteAddr: "1.2.3.4:3000", expectedCode: 429, expectedLimit: "0"},
+				{path: "/auth/login", remoteAddr: "5.6.7.8:1000", expectedCode: 200, expectedLimit: "1"},
+			},
+		},
+		{
+			description: "Failure: User over the route limit from any address",
+			requests: []testRequest{
+				{path: "/users/a@mail.com", remoteAddr: "1.2.3.4:1000", userId: "u1", expectedCode: 200, expectedLimit: "0"},
+				{path: "/users/b@mail.com", remoteAddr: "5.6.7.8:1000", userId: "u1", expectedCode: 429, expectedLimit: "0"},
+				{path: "/users/a@mail.com", remoteAddr: "1.2.3.4:1000", userId: "u2", expectedCode: 200, expectedLimit: "0"},
+				// Route limits are separate from the default.
+				{path: "/auth/login", remoteAddr: "1.2.3.4:1000", expectedCode: 200, expectedLimit: "1"},
+			},
+		},
+		{
+			description: "Failure: API key over the route limit",
+			requests: []testRequest{
+				{path: "/users/create", remoteAddr: "1.2.3.4:1000", apiKey: testApiKey, expectedCode: 200, expectedLimit: "0"},
+				{path: "/users/create", remoteAddr: "5.6.7.8:1000", apiKey: testApiKey, expectedCode: 429, expectedLimit: "0"},
+				// Without a key the address is counted instead.
+				{path: "/users/create", remoteAddr: "1.2.3.4:1000", expectedCode: 200, expectedLimit: "0"},
+			},
+		},
+		{
+			description:       "Failure: Forwarded address counted behind a proxy",
+			trustForwardedFor: true,
+			requests: []testRequest{
+				{path: "/users/create", remoteAddr: "10.0.0.1:1000", forwardedFor: "9.9.9.9, 1.2.3.4", expectedCode: 200, expectedLimit: "0"},
+				{path: "/users/create", remoteAddr: "10.0.0.2:1000", forwardedFor: "8.8.8.8, 1.2.3.4", expectedCode: 429, expectedLimit: "0"},
+				{path: "/users/create", remoteAddr: "10.0.0.1:1000", forwardedFor: "not-an-ip", expectedCode: 200, expectedLimit: "0"},
+			},
+		},
+		{
+			description: "Success: Forwarded address ignored without a proxy",
+			requests: []testRequest{
+				{path: "/users/create", remoteAddr: "1.2.3.4:1000", forwardedFor: "9.9.9.9", expectedCode: 200, expectedLimit: "0"},
+				{path: "/users/create", remoteAddr: "1.2.3.5:1000", forwardedFor: "9.9.9.9", expectedCode: 200, expectedLimit: "0"},
+			},
+		},
+		{
+			description: "Success: Disabled route not limited",
+			requests: []testRequest{
+				{path: "/healthz", remoteAddr: "1.2.3.4:1000", expectedCode: 200},
+				{path: "/healthz", remoteAddr: "1.2.3.4:1000", expectedCode: 200},
+				{path: "/healthz", remoteAddr: "1.2.3.4:1000", expectedCode: 200},
+			},
+		},
+		{
+			description: "Success: Store failure lets requests through",
+			store:       failingLimitStore{},
+			requests: []testRequest{
+				{path: "/auth/login", remoteAddr: "1.2.3.4:1000", expectedCode: 200},
+				{path: "/auth/login", remoteAddr: "1.2.3.4:1000", expectedCode: 200},
+				{path: "/auth/login", remoteAddr: "1.2.3.4:1000", expectedCode: 200},
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			store := tc.store
+			if store == nil {
+				store = ratelimit.NewMemoryStore()
+			}
+			h := NewRateLimitHandler(store, tc.trustForwardedFor)
+			h.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+			ok := func(w http.ResponseWriter, r *http.Request) { OK200(w, nil) }
+			router := mux.NewRouter()
+			router.Use(h.Limit(def, routes))
+			router.HandleFunc("/auth/login", ok)
+			router.HandleFunc("/users/create", ok).Name("users.create")
+			router.HandleFunc("/users/{email}", ok).Name("users.get")
+			router.HandleFunc("/healthz", ok).Name("health")
+
+			for _, req := range tc.requests {
+				r := httptest.NewRequest("GET", req.path, nil)
+				r.RemoteAddr = req.remoteAddr
+				if req.forwardedFor != "" {
+					r.Header.Set("X-Forwarded-For", req.forwardedFor)
+				}
+				ctx := r.Context()
+				if req.userId != "" {
+					ctx = auth.WithUserId(ctx, req.userId)
+				}
+				if req.apiKey != nil {
+					ctx = apikeys.WithApiKey(ctx, req.apiKey)
+				}
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r.WithContext(ctx))
+
+				assert.Equal(t, req.expectedCode, w.Code, req.path)
+				assert.Equal(t, req.expectedLimit, w.Header().Get("RateLimit-Remaining"), req.path)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	h := NewRateLimitHandler(ratelimit.NewMemoryStore(), false)
+	h.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+	limit := h.Limit(RouteLimit{Key: LimitByIP, Policy: ratelimit.Policy{Requests: 2, Per: 3 * time.Second, Burst: 1}}, nil)
+	handler := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { NoContent204(w) }))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/users/create", nil))
+	assert.Equal(t, 204, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=3", w.Header().Get("RateLimit-Policy"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/users/create", nil))
+	assert.Equal(t, 429, w.Code)
+	// 1.5s until the next token, rounded up.
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, `{"type":"/errors/too_many_requests","title":"Too Many Requests","status":429,"detail":"Too many requests, please try again later.","instance":"/users/create","code":"too_many_requests","resource":"RateLimit"}`, w.Body.String())
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"db_practice/internal/crash"
+	"db_practice/internal/logging"
+	"db_practice/internal/route"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// PanicRecorder is told about every recovered panic so it can be counted.
+type PanicRecorder interface {
+	PanicRecovered(route string)
+}
+
+type RecoveryHandler struct {
+	reporter crash.Reporter
+	recorder PanicRecorder
+}
+
+func NewRecoveryHandler(reporter crash.Reporter, recorder PanicRecorder) *RecoveryHandler {
+	return &RecoveryHandler{
+		reporter: reporter,
+		recorder: recorder,
+	}
+}
+
+// Recover turns a panic in next into a 500 response instead of a dropped
+// connection. The panic is logged with its stack, counted and passed to the
+// crash reporter. Wrap it around the whole handler rather than using it as
+// router middleware, which only runs for matched routes, and inside the
+// logging middleware so the log line and report carry the request id.
+func (h *RecoveryHandler) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hw := &headerWriter{ResponseWriter: w}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// net/http's sentinel for deliberately aborting a response.
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			stack := string(debug.Stack())
+			route := route.Template(r)
+
+			logger := logging.FromContext(r.Context())
+			fields := log.Fields{"Panic": fmt.Sprint(v), "Route": route, "Stack": stack}
+			logger.WithFields(fields).Error("Recovered from panic")
+			h.recorder.PanicRecovered(route)
+
+			report := &crash.Report{
+				Time:      time.Now(),
+				RequestID: logging.RequestID(r.Context()),
+				Method:    r.Method,
+				Route:     route,
+				Panic:     fmt.Sprint(v),
+				Stack:     stack,
+			}
+			if err := h.reporter.Report(r.Context(), report); err != nil {
+				logger.Errorf("Failed to report crash: %+v", err)
+			}
+
+			// Once the status line is out the response can't be replaced.
+			if hw.wroteHeader {
+				return
+			}
+			InternalError500(w, r, "Server", nil)
+		}()
+
+		next.ServeHTTP(hw, r)
+	})
+}
+
+// headerWriter remembers whether the response has started.
+type headerWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *headerWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
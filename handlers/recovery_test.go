@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"db_practice/internal/crash"
+	"db_practice/internal/logging"
+	"db_practice/internal/route"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testReporter struct {
+	reports []*crash.Report
+	err     error
+}
+
+func (r *testReporter) Report(ctx context.Context, report *crash.Report) error {
+	r.reports = append(r.reports, report)
+	return r.err
+}
+
+type testPanicRecorder struct {
+	routes []string
+}
+
+func (r *testPanicRecorder) PanicRecovered(route string) {
+	r.routes = append(r.routes, route)
+}
+
+var testInternalProblem = &Problem{
+	Type:      "/errors/internal_error",
+	Title:     "Internal Server Error",
+	Status:    500,
+	Detail:    "An internal error occurred.",
+	Instance:  "/users/a@mail.com",
+	Code:      "internal_error",
+	Resource:  "Server",
+	RequestID: "abc-123",
+}
+
+func TestRecover(t *testing.T) {
+	testCases := []struct {
+		description   string
+		handler       http.HandlerFunc
+		reporterErr   error
+		expectedCode  int
+		expectedBody  *Problem
+		expectedPanic string
+	}{
+		{
+			description:   "Failure: Panic answered with a 500",
+			handler:       func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			expectedCode:  500,
+			expectedBody:  testInternalProblem,
+			expectedPanic: "boom",
+		},
+		{
+			description:   "Failure: Invalid status code from write",
+			handler:       func(w http.ResponseWriter, r *http.Request) { write(w, 100, nil) },
+			expectedCode:  500,
+			expectedBody:  testInternalProblem,
+			expectedPanic: "status code 100 must be >= 200",
+		},
+		{
+			description:   "Failure: Nil error passed to Err",
+			handler:       func(w http.ResponseWriter, r *http.Request) { Err(w, r, nil, 400) },
+			reporterErr:   errors.New("reporter down"),
+			expectedCode:  500,
+			expectedBody:  testInternalProblem,
+			expectedPanic: "error must not be empty",
+		},
+		{
+			description: "Failure: Panic after the response started",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("late")
+			},
+			expectedCode:  202,
+			expectedPanic: "late",
+		},
+		{
+			description:  "Success: No panic",
+			handler:      func(w http.ResponseWriter, r *http.Request) { NoContent204(w) },
+			expectedCode: 204,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			reporter := &testReporter{err: tc.reporterErr}
+			recorder := &testPanicRecorder{}
+			router := mux.NewRouter()
+			router.Use(route.Record)
+			router.HandleFunc("/users/{email}", tc.handler)
+			handler := route.Track(logging.Middleware(NewRecoveryHandler(reporter, recorder).Recover(router)))
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/users/a@mail.com", nil)
+			r.Header.Set(logging.RequestIDHeader, "abc-123")
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			if tc.expectedBody != nil {
+				assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+				var body Problem
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, *tc.expectedBody, body)
+			}
+
+			if tc.expectedPanic == "" {
+				assert.Empty(t, reporter.reports)
+				assert.Empty(t, recorder.routes)
+				return
+			}
+			assert.Equal(t, []string{"/users/{email}"}, recorder.routes)
+			require.Len(t, reporter.reports, 1)
+			report := reporter.reports[0]
+			assert.Equal(t, tc.expectedPanic, report.Panic)
+			assert.Equal(t, "abc-123", report.RequestID)
+			assert.Equal(t, "GET", report.Method)
+			assert.Equal(t, "/users/{email}", report.Route)
+			assert.Contains(t, report.Stack, "recovery_test.go")
+		})
+	}
+}
+
+func TestRecoverOutsideRouter(t *testing.T) {
+	reporter := &testReporter{}
+	recorder := &testPanicRecorder{}
+	// Stands in for the wrappers around the router, e.g. CORS and API
+	// versioning, which no router middleware can protect.
+	wrapper := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("wrapper") })
+	handler := NewRecoveryHandler(reporter, recorder).Recover(route.Track(wrapper))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/users/a@mail.com", nil))
+
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, []string{route.Unmatched}, recorder.routes)
+	require.Len(t, reporter.reports, 1)
+	assert.Equal(t, "wrapper", reporter.reports[0].Panic)
+	assert.Equal(t, route.Unmatched, reporter.reports[0].Route)
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	reporter := &testReporter{}
+	h := NewRecoveryHandler(reporter, &testPanicRecorder{}).Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "partial")
+		panic(http.ErrAbortHandler)
+	}))
+
+	// Left for net/http, which drops the connection without logging.
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+	assert.Empty(t, reporter.reports)
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"database/sql"
+	"db_practice/internal/auth"
+	"db_practice/internal/logging"
+	"db_practice/internal/mfa"
+	"db_practice/internal/sessions"
+	"db_practice/internal/users"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Session cookie names. The __Host- prefix makes browsers refuse the cookie
+// unless it is Secure, host-only and scoped to /, so it is only used when
+// cookies are Secure.
+const (
+	SessionCookieName       = "session"
+	SecureSessionCookieName = "__Host-session"
+)
+
+type SessionsHandler struct {
+	usersClient    users.Client
+	mfaClient      mfa.Client
+	sessionsClient sessions.Client
+	secureCookies  bool
+}
+
+type SessionResponse struct {
+	*sessions.Session
+	Current bool `json:"current"`
+}
+
+// NewSessionsHandler serves cookie sessions for browser clients.
+// secureCookies should only be false for local development over plain HTTP.
+func NewSessionsHandler(u users.Client, m mfa.Client, s sessions.Client, secureCookies bool) *SessionsHandler {
+	return &SessionsHandler{
+		usersClient:    u,
+		mfaClient:      m,
+		sessionsClient: s,
+		secureCookies:  secureCookies,
+	}
+}
+
+// Login signs in with email and password and sets the session cookie. Users
+// with MFA enabled get a challenge to complete with LoginMfa instead.
+func (s *SessionsHandler) Login(w http.ResponseWriter, r *http.Request) {
+	user, ok := passwordLogin(w, r, s.usersClient, "Sessions")
+	if !ok {
+		return
+	}
+	if challenged, ok := mfaChallenge(w, r, s.mfaClient, user.Id, "Sessions"); challenged || !ok {
+		return
+	}
+
+	s.startSession(w, r, user.Id)
+}
+
+func (s *SessionsHandler) LoginMfa(w http.ResponseWriter, r *http.Request) {
+	userId, ok := mfaLogin(w, r, s.mfaClient, "Sessions")
+	if !ok {
+		return
+	}
+
+	s.startSession(w, r, userId)
+}
+
+// Logout ends the session in the cookie, if any, and clears the cookie.
+func (s *SessionsHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(s.cookieName()); err == nil {
+		err := s.sessionsClient.RevokeToken(r.Context(), cookie.Value)
+		if err != nil && errors.Cause(err) != sessions.ErrInvalidSession {
+			logging.FromContext(r.Context()).Errorf("%+v", err)
+			InternalError500(w, r, "Sessions", err)
+			return
+		}
+	}
+
+	s.clearCookie(w)
+	NoContent204(w)
+}
+
+func (s *SessionsHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	subject, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		Unauthorized401(w, r, "Sessions")
+		return
+	}
+
+	list, err := s.sessionsClient.List(r.Context(), subject)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Id": subject}).Errorf("%+v", err)
+		InternalError500(w, r, "Sessions", err)
+		return
+	}
+
+	current, _ := sessions.SessionFromContext(r.Context())
+	resp := make([]SessionResponse, len(list))
+	for i, session := range list {
+		resp[i] = SessionResponse{
+			Session: session,
+			Current: current != nil && current.Id == session.Id,
+		}
+	}
+
+	OK200(w, resp)
+}
+
+func (s *SessionsHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	subject, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		Unauthorized401(w, r, "Sessions")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	fields := log.Fields{"Id": subject, "Session Id": id}
+	if id == "" {
+		BadRequest400(w, r, "Sessions", "MISSING_ARG_ID")
+		return
+	}
+
+	if err := s.sessionsClient.Revoke(r.Context(), subject, id); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			NotFound404(w, r, "Sessions")
+			return
+		}
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, "Sessions", err)
+		return
+	}
+
+	if current, ok := sessions.SessionFromContext(r.Context()); ok && current.Id == id {
+		s.clearCookie(w)
+	}
+
+	NoContent204(w)
+}
+
+// LoadSession is mux middleware that authenticates the session cookie, if
+// present, and stores the session and its user in the request context.
+// Requests with a bearer token are left to RequireAuth. Invalid cookies are
+// cleared and the request continues unauthenticated.
+func (s *SessionsHandler) LoadSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := bearerToken(r); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie(s.cookieName())
+		if err != nil || cookie.Value == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session, extended, err := s.sessionsClient.Authenticate(r.Context(), cookie.Value)
+		if err != nil {
+			if errors.Cause(err) != sessions.ErrInvalidSession {
+				logging.FromContext(r.Context()).Errorf("%+v", err)
+				InternalError500(w, r, "Sessions", err)
+				return
+			}
+			logging.FromContext(r.Context()).Warn("Session cookie rejected")
+			s.clearCookie(w)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if extended {
+			s.setCookie(w, cookie.Value, session.ExpiresAt)
+		}
+
+		ctx := auth.WithUserId(r.Context(), session.UserId)
+		ctx = sessions.WithSession(ctx, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *SessionsHandler) startSession(w http.ResponseWriter, r *http.Request, userId string) {
+	session, token, err := s.sessionsClient.Create(r.Context(), userId, r.UserAgent(), clientIP(r))
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Id": userId}).Errorf("%+v", err)
+		InternalError500(w, r, "Sessions", err)
+		return
+	}
+
+	s.setCookie(w, token, session.ExpiresAt)
+	Created201(w, SessionResponse{Session: session, Current: true})
+}
+
+func (s *SessionsHandler) cookieName() string {
+	if s.secureCookies {
+		return SecureSessionCookieName
+	}
+	return SessionCookieName
+}
+
+// setCookie writes the session cookie. SameSite=Lax keeps the cookie off
+// cross-site subrequests and form posts, which is the CSRF defence for
+// cookie-authenticated requests.
+func (s *SessionsHandler) setCookie(w http.ResponseWriter, token string, expiresAt time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		Secure:   s.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *SessionsHandler) clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   s.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
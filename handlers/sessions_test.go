@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"database/sql"
+	"db_practice/internal/auth"
+	"db_practice/internal/mfa"
+	"db_practice/internal/sessions"
+	"db_practice/internal/users"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSession = &sessions.Session{
+	Id:         "session-1",
+	UserId:     "12infioed",
+	UserAgent:  "Mozilla/5.0",
+	CreatedAt:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	LastSeenAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	ExpiresAt:  time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC),
+}
+
+func TestSessionLogin(t *testing.T) {
+	testCases := []struct {
+		description    string
+		userClient     *users.TestClient
+		mfaClient      *mfa.TestClient
+		secureCookies  bool
+		expectedCookie string
+		expectedCode   int
+	}{
+		{
+			description: "Success: Secure cookie set",
+			userClient: &users.TestClient{
+				AuthenticateData: testUserEli,
+			},
+			mfaClient:      &mfa.TestClient{},
+			secureCookies:  true,
+			expectedCookie: "__Host-session=token; Path=/; Expires=Mon, 08 Jan 2024 00:00:00 GMT; HttpOnly; Secure; SameSite=Lax",
+			expectedCode:   201,
+		},
+		{
+			description: "Success: Local development cookie",
+			userClient: &users.TestClient{
+				AuthenticateData: testUserEli,
+			},
+			mfaClient:      &mfa.TestClient{},
+			expectedCookie: "session=token; Path=/; Expires=Mon, 08 Jan 2024 00:00:00 GMT; HttpOnly; SameSite=Lax",
+			expectedCode:   201,
+		},
+		{
+			description: "Success: MFA challenge before cookie",
+			userClient: &users.TestClient{
+				AuthenticateData: testUserEli,
+			},
+			mfaClient: &mfa.TestClient{
+				EnabledData:   true,
+				ChallengeData: "challenge",
+			},
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Invalid credentials",
+			userClient: &users.TestClient{
+				AuthenticateErr: users.ErrInvalidCredentials,
+			},
+			expectedCode: 401,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			s := &sessions.TestClient{CreateData: testSession, CreateToken: "token"}
+			h := NewSessionsHandler(tc.userClient, tc.mfaClient, s, tc.secureCookies)
+			r := httptest.NewRequest("POST", "/auth/sessions", strings.NewReader(`{"email": "testemail@mail.com", "password": "password123"}`))
+
+			w := httptest.NewRecorder()
+			h.Login(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedCookie, w.Header().Get("Set-Cookie"))
+		})
+	}
+}
+
+func TestLoadSession(t *testing.T) {
+	testCases := []struct {
+		description     string
+		sessionsClient  *sessions.TestClient
+		cookie          string
+		authorization   string
+		expectedSubject string
+		expectRefresh   bool
+		expectClear     bool
+		expectedCode    int
+	}{
+		{
+			description: "Success: Subject in context",
+			sessionsClient: &sessions.TestClient{
+				AuthenticateData: testSession,
+			},
+			cookie:          "token",
+			expectedSubject: testSession.UserId,
+			expectedCode:    200,
+		},
+		{
+			description: "Success: Sliding expiry refreshes cookie",
+			sessionsClient: &sessions.TestClient{
+				AuthenticateData:     testSession,
+				AuthenticateExtended: true,
+			},
+			cookie:          "token",
+			expectedSubject: testSession.UserId,
+			expectRefresh:   true,
+			expectedCode:    200,
+		},
+		{
+			description: "Success: Invalid cookie cleared",
+			sessionsClient: &sessions.TestClient{
+				AuthenticateErr: sessions.ErrInvalidSession,
+			},
+			cookie:       "token",
+			expectClear:  true,
+			expectedCode: 200,
+		},
+		{
+			description:    "Success: Bearer token takes precedence",
+			sessionsClient: &sessions.TestClient{},
+			cookie:         "token",
+			authorization:  "Bearer access",
+			expectedCode:   200,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			var subject string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				subject, _ = auth.UserIdFromContext(r.Context())
+			})
+
+			h := NewSessionsHandler(nil, nil, tc.sessionsClient, false)
+			r := httptest.NewRequest("GET", "/auth/sessions", nil)
+			r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tc.cookie})
+			if tc.authorization != "" {
+				r.Header.Set("Authorization", tc.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			h.LoadSession(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedSubject, subject)
+
+			setCookie := w.Header().Get("Set-Cookie")
+			switch {
+			case tc.expectRefresh:
+				assert.Contains(t, setCookie, "session=token;")
+			case tc.expectClear:
+				assert.Contains(t, setCookie, "Max-Age=0")
+			default:
+				assert.Empty(t, setCookie)
+			}
+		})
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	other := &sessions.Session{Id: "session-2", UserId: "12infioed", CreatedAt: testSession.CreatedAt, LastSeenAt: testSession.LastSeenAt, ExpiresAt: testSession.ExpiresAt}
+	h := NewSessionsHandler(nil, nil, &sessions.TestClient{ListData: []*sessions.Session{testSession, other}}, false)
+
+	r := httptest.NewRequest("GET", "/auth/sessions", nil)
+	ctx := auth.WithUserId(r.Context(), testSession.UserId)
+	r = r.WithContext(sessions.WithSession(ctx, testSession))
+
+	w := httptest.NewRecorder()
+	h.ListSessions(w, r)
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, `[{"id":"session-1","user_id":"12infioed","user_agent":"Mozilla/5.0","created_at":"2024-01-01T00:00:00Z","last_seen_at":"2024-01-01T00:00:00Z","expires_at":"2024-01-08T00:00:00Z","current":true},{"id":"session-2","user_id":"12infioed","created_at":"2024-01-01T00:00:00Z","last_seen_at":"2024-01-01T00:00:00Z","expires_at":"2024-01-08T00:00:00Z","current":false}]`, w.Body.String())
+}
+
+func TestRevokeSession(t *testing.T) {
+	testCases := []struct {
+		description    string
+		sessionsClient *sessions.TestClient
+		id             string
+		expectClear    bool
+		expectedCode   int
+	}{
+		{
+			description:    "Success: Other session revoked",
+			sessionsClient: &sessions.TestClient{},
+			id:             "session-2",
+			expectedCode:   204,
+		},
+		{
+			description:    "Success: Current session revoked clears cookie",
+			sessionsClient: &sessions.TestClient{},
+			id:             testSession.Id,
+			expectClear:    true,
+			expectedCode:   204,
+		},
+		{
+			description: "Failure: Not the user's session",
+			sessionsClient: &sessions.TestClient{
+				RevokeErr: sql.ErrNoRows,
+			},
+			id:           "session-3",
+			expectedCode: 404,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewSessionsHandler(nil, nil, tc.sessionsClient, false)
+			r := httptest.NewRequest("DELETE", "/auth/sessions/"+tc.id, nil)
+			r = mux.SetURLVars(r, map[string]string{"id": tc.id})
+			ctx := auth.WithUserId(r.Context(), testSession.UserId)
+			r = r.WithContext(sessions.WithSession(ctx, testSession))
+
+			w := httptest.NewRecorder()
+			h.RevokeSession(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectClear, w.Header().Get("Set-Cookie") != "")
+		})
+	}
+}
@@ -1,40 +1,97 @@
 package handlers
 
 import (
+	"database/sql"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/logging"
+	"db_practice/internal/rbac"
 	"db_practice/internal/users"
+	"db_practice/internal/verification"
 	"encoding/json"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 type UsersHandler struct {
-	usersClient users.Client
+	usersClient        users.Client
+	rbacClient         rbac.Client
+	verificationClient verification.Client
 }
 
+// CreateUserRequest is validated against its OpenAPI schema before it
+// reaches the handler; the length limits are those of the users table.
 type CreateUserRequest struct {
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	Email       string `json:"email"`
-	Address     string `json:"address"`
-	City        string `json:"city"`
-	State       string `json:"state"`
-	ZipCode     string `json:"zip"`
-	DateOfBirth string `json:"dob"`
+	FirstName   string `json:"first_name" openapi:"minLength=1,maxLength=50"`
+	LastName    string `json:"last_name" openapi:"minLength=1,maxLength=50"`
+	Email       string `json:"email" openapi:"minLength=1,maxLength=100,format=email"`
+	Address     string `json:"address" openapi:"minLength=1,maxLength=255"`
+	City        string `json:"city" openapi:"minLength=1,maxLength=100"`
+	State       string `json:"state" openapi:"minLength=1,maxLength=100"`
+	ZipCode     string `json:"zip" openapi:"minLength=1,maxLength=20"`
+	DateOfBirth string `json:"dob" openapi:"minLength=1,maxLength=20"`
+	Password    string `json:"password,omitempty"`
 }
 
-func NewUsersHandler(u users.Client) *UsersHandler {
+type UpdateUserRequest struct {
+	FirstName   string `json:"first_name" openapi:"minLength=1,maxLength=50"`
+	LastName    string `json:"last_name" openapi:"minLength=1,maxLength=50"`
+	Email       string `json:"email" openapi:"minLength=1,maxLength=100,format=email"`
+	Address     string `json:"address" openapi:"minLength=1,maxLength=255"`
+	City        string `json:"city" openapi:"minLength=1,maxLength=100"`
+	State       string `json:"state" openapi:"minLength=1,maxLength=100"`
+	ZipCode     string `json:"zip" openapi:"minLength=1,maxLength=20"`
+	DateOfBirth string `json:"dob" openapi:"minLength=1,maxLength=20"`
+}
+
+// SearchUsersRequest looks a user up by email. Emails are unique, so a
+// search finds one user or none.
+type SearchUsersRequest struct {
+	Email string `json:"email" openapi:"minLength=1,maxLength=100,format=email"`
+}
+
+// BatchGetUsersRequest looks users up by id or by email, not both, up to
+// maxBatchGetUsers at a time.
+type BatchGetUsersRequest struct {
+	Ids    []string `json:"ids,omitempty"`
+	Emails []string `json:"emails,omitempty"`
+}
+
+// BatchGetUsersResponse lists the users found in the order they were asked
+// for, and the ids or emails that matched none.
+type BatchGetUsersResponse struct {
+	Users   []*users.User `json:"users"`
+	Missing []string      `json:"missing"`
+}
+
+const minPasswordLength = 8
+
+const maxBatchGetUsers = 100
+
+// LegacyUserRoutesDeprecated is when POST /users/create and email lookups
+// through GET /users/{id} were deprecated for POST /users and POST
+// /users/search, which keeps emails out of URLs and access logs.
+var LegacyUserRoutesDeprecated = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+func NewUsersHandler(u users.Client, p rbac.Client, v verification.Client) *UsersHandler {
 	return &UsersHandler{
-		usersClient: u,
+		usersClient:        u,
+		rbacClient:         p,
+		verificationClient: v,
 	}
 }
 
 func (u *UsersHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var req CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		BadRequest400(w, "Users", "INVALID_JSON")
+		InvalidJSON400(w, r, "Users")
 		return
 	}
 	defer r.Body.Close()
@@ -42,60 +99,426 @@ func (u *UsersHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	req.Email = strings.ToLower(req.Email)
 	fields := map[string]string{"First Name": req.FirstName, "Last Name": req.LastName, "Email": req.Email, "Address": req.Address, "City": req.City, "State": req.State, "Zip Code": req.ZipCode, "Date of Birth": req.DateOfBirth}
 
-	missingFields := []string{}
-	for field, value := range fields {
-		if value == "" {
-			missingFields = append(missingFields, field)
-		}
-	}
-
+	missingFields := missingFields(fields)
 	if len(missingFields) > 0 {
 		fields := log.Fields{"missing_fields": strings.Join(missingFields, ", ")}
-		log.WithFields(fields).Error("Missing required fields")
+		logging.FromContext(r.Context()).WithFields(fields).Error("Missing required fields")
+		BadRequest400(w, r, "Users", missingFields...)
+		return
 	}
 
-	if len(missingFields) > 0 {
-		BadRequest400(w, "Users", strings.Join(missingFields, ", "))
+	if req.Password != "" && len(req.Password) < minPasswordLength {
+		BadRequest400(w, r, "Users", "Password")
 		return
 	}
 
 	loggedFields := log.Fields{"First Name": req.FirstName, "Last Name": req.LastName, "Email": req.Email, "Address": req.Address, "City": req.City, "State": req.State, "Zip Code": req.ZipCode, "Date of Birth": req.DateOfBirth}
 
-	emailCheck, _ := u.usersClient.GetUserByEmail(fields["Email"])
+	emailCheck, _ := u.usersClient.GetUserByEmail(r.Context(), fields["Email"])
 	if emailCheck != nil {
-		log.WithFields(loggedFields).Errorf("Email already in use: %s", req.Email)
-		ConflictError409(w, "Users", "email")
+		logging.FromContext(r.Context()).WithFields(loggedFields).Errorf("Email already in use: %s", req.Email)
+		ConflictError409(w, r, "Users", "email")
 		return
 	}
 
-	user, err := u.usersClient.CreateUser(req.FirstName, req.LastName, req.Email, req.Address, req.City, req.State, req.ZipCode, req.DateOfBirth)
+	user, err := u.usersClient.CreateUser(r.Context(), req.FirstName, req.LastName, req.Email, req.Address, req.City, req.State, req.ZipCode, req.DateOfBirth)
 	if err != nil {
-		log.WithFields(loggedFields).Errorf("%+v", err)
-		InternalError500(w, "Users", err)
+		logging.FromContext(r.Context()).WithFields(loggedFields).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
 		return
 	}
 
+	if req.Password != "" {
+		if err := u.usersClient.SetPassword(r.Context(), user.Id, req.Password); err != nil {
+			logging.FromContext(r.Context()).WithFields(loggedFields).Errorf("%+v", err)
+			InternalError500(w, r, "Users", err)
+			return
+		}
+	}
+
+	// The account exists either way; a failed send can be retried through
+	// the resend endpoint.
+	if err := u.verificationClient.SendVerification(r.Context(), user.Id); err != nil {
+		logging.FromContext(r.Context()).WithFields(loggedFields).Errorf("%+v", err)
+	}
+
+	w.Header().Set("Location", versionPath(r, "/users/"+url.PathEscape(user.Id)))
 	Created201(w, user)
 }
 
-func (u *UsersHandler) GetUserByEmail(w http.ResponseWriter, r *http.Request) {
-	log.Println("Handling /users/:email request")
+// GetUser serves GET /users/{id}. An id holding an @ is taken for an email,
+// the lookup the route used to serve, and answered as a deprecated one.
+func (u *UsersHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if strings.Contains(id, "@") {
+		deprecate(w, r, LegacyUserRoutesDeprecated, "/users/search")
+		u.getUserByEmail(w, r, id)
+		return
+	}
+
+	fields := log.Fields{"Id": id}
+	if id == "" {
+		logging.FromContext(r.Context()).WithFields(fields).Error("MISSING_ARG_ID")
+		BadRequest400(w, r, "Users", "MISSING_ARG_ID")
+		return
+	}
+
+	if !u.authorize(w, r, rbac.ActionReadUser, id) {
+		return
+	}
+
+	user, err := u.usersClient.GetUserById(r.Context(), id)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			NotFound404(w, r, "Users")
+			return
+		}
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
+		return
+	}
+
+	OK200(w, user)
+}
 
-	vars := mux.Vars(r)
-	email, exists := vars["email"]
+// SearchUsers serves POST /users/search, looking a user up by the email in
+// the body.
+func (u *UsersHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	var req SearchUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "Users")
+		return
+	}
+	defer r.Body.Close()
+
+	u.getUserByEmail(w, r, req.Email)
+}
+
+// BatchGetUsers serves POST /users/batch-get, looking users up by id or
+// email in one query. Repeated ids or emails are looked up once. No user owns
+// the whole batch, so only permissions on any user allow it.
+func (u *UsersHandler) BatchGetUsers(w http.ResponseWriter, r *http.Request) {
+	var req BatchGetUsersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "Users")
+		return
+	}
+	defer r.Body.Close()
+
+	field, keys := "ids", req.Ids
+	if len(req.Emails) > 0 {
+		field, keys = "emails", req.Emails
+	}
+	fields := log.Fields{"Ids": len(req.Ids), "Emails": len(req.Emails)}
+	if subject, ok := auth.UserIdFromContext(r.Context()); ok {
+		fields["Subject"] = subject
+	}
+	switch {
+	case len(req.Ids) == 0 && len(req.Emails) == 0:
+		logging.FromContext(r.Context()).WithFields(fields).Error("MISSING_ARG_IDS")
+		BadRequest400(w, r, "Users", "MISSING_ARG_IDS")
+		return
+	case len(req.Ids) > 0 && len(req.Emails) > 0:
+		logging.FromContext(r.Context()).WithFields(fields).Error("IDS_AND_EMAILS")
+		BadRequest400(w, r, "Users", "IDS_AND_EMAILS")
+		return
+	case len(keys) > maxBatchGetUsers:
+		logging.FromContext(r.Context()).WithFields(fields).Error("TOO_MANY_" + strings.ToUpper(field))
+		BadRequest400(w, r, "Users", "TOO_MANY_"+strings.ToUpper(field))
+		return
+	}
+
+	seen := make(map[string]bool, len(keys))
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if field == "emails" {
+			key = strings.ToLower(key)
+		}
+		if key == "" {
+			logging.FromContext(r.Context()).WithFields(fields).Error("EMPTY_" + strings.ToUpper(field))
+			BadRequest400(w, r, "Users", "EMPTY_"+strings.ToUpper(field))
+			return
+		}
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+
+	if !u.authorizeResource(w, r, rbac.ActionReadUser, rbac.Resource{Type: "users"}) {
+		return
+	}
+
+	var found []*users.User
+	var err error
+	keyOf := func(user *users.User) string { return user.Id }
+	if field == "emails" {
+		found, err = u.usersClient.GetUsersByEmails(r.Context(), unique)
+		keyOf = func(user *users.User) string { return user.Email }
+	} else {
+		found, err = u.usersClient.GetUsersByIds(r.Context(), unique)
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
+		return
+	}
+
+	byKey := make(map[string]*users.User, len(found))
+	for _, user := range found {
+		byKey[keyOf(user)] = user
+	}
+	resp := BatchGetUsersResponse{Users: []*users.User{}, Missing: []string{}}
+	for _, key := range unique {
+		if user, ok := byKey[key]; ok {
+			resp.Users = append(resp.Users, user)
+		} else {
+			resp.Missing = append(resp.Missing, key)
+		}
+	}
+	OK200(w, resp)
+}
+
+// getUserByEmail looks a user up by email. Callers who can't read every user
+// get the same 404 for an unknown email as for someone else's, so the lookup
+// doesn't tell them which emails are registered.
+func (u *UsersHandler) getUserByEmail(w http.ResponseWriter, r *http.Request, email string) {
 	email = strings.ToLower(email)
-	fields := log.Fields{"Email": email}
-	if !exists || email == "" {
-		log.WithFields(fields).Error("MISSING_ARG_EMAIL")
-		BadRequest400(w, "Users", "MISSING_ARG_EMAIL")
+	// The email stays out of the logs, like it does out of the URL.
+	fields := log.Fields{}
+	subject, ok := auth.UserIdFromContext(r.Context())
+	if ok {
+		fields["Subject"] = subject
+	}
+	if email == "" {
+		logging.FromContext(r.Context()).WithFields(fields).Error("MISSING_ARG_EMAIL")
+		BadRequest400(w, r, "Users", "MISSING_ARG_EMAIL")
 		return
 	}
 
-	user, err := u.usersClient.GetUserByEmail(email)
+	readsAny, ok := u.readsAnyUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := u.usersClient.GetUserByEmail(r.Context(), email)
 	if err != nil {
-		log.WithFields(fields).Errorf("%+v", err)
-		NotFound404(w, "Users")
+		if errors.Cause(err) == sql.ErrNoRows {
+			NotFound404(w, r, "Users")
+			return
+		}
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
 		return
 	}
+
+	if !readsAny {
+		if user.Id != subject {
+			NotFound404(w, r, "Users")
+			return
+		}
+		if !u.authorize(w, r, rbac.ActionReadUser, user.Id) {
+			return
+		}
+	}
 	OK200(w, user)
 }
+
+func (u *UsersHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	fields := log.Fields{"Id": id}
+	if id == "" {
+		logging.FromContext(r.Context()).WithFields(fields).Error("MISSING_ARG_ID")
+		BadRequest400(w, r, "Users", "MISSING_ARG_ID")
+		return
+	}
+
+	if !u.authorize(w, r, rbac.ActionUpdateUser, id) {
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		InvalidJSON400(w, r, "Users")
+		return
+	}
+	defer r.Body.Close()
+
+	req.Email = strings.ToLower(req.Email)
+	values := map[string]string{"First Name": req.FirstName, "Last Name": req.LastName, "Email": req.Email, "Address": req.Address, "City": req.City, "State": req.State, "Zip Code": req.ZipCode, "Date of Birth": req.DateOfBirth}
+
+	missingFields := missingFields(values)
+	if len(missingFields) > 0 {
+		fields["missing_fields"] = strings.Join(missingFields, ", ")
+		logging.FromContext(r.Context()).WithFields(fields).Error("Missing required fields")
+		BadRequest400(w, r, "Users", missingFields...)
+		return
+	}
+
+	user, err := u.usersClient.UpdateUser(r.Context(), id, req.FirstName, req.LastName, req.Email, req.Address, req.City, req.State, req.ZipCode, req.DateOfBirth)
+	if err != nil {
+		switch errors.Cause(err) {
+		case sql.ErrNoRows:
+			NotFound404(w, r, "Users")
+		case users.ErrEmailExists:
+			ConflictError409(w, r, "Users", "email")
+		default:
+			logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+			InternalError500(w, r, "Users", err)
+		}
+		return
+	}
+
+	OK200(w, user)
+}
+
+func (u *UsersHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	fields := log.Fields{"Id": id}
+	if id == "" {
+		logging.FromContext(r.Context()).WithFields(fields).Error("MISSING_ARG_ID")
+		BadRequest400(w, r, "Users", "MISSING_ARG_ID")
+		return
+	}
+
+	if !u.authorize(w, r, rbac.ActionDeleteUser, id) {
+		return
+	}
+
+	if err := u.usersClient.DeleteUser(r.Context(), id); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			NotFound404(w, r, "Users")
+			return
+		}
+		logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
+		return
+	}
+
+	NoContent204(w)
+}
+
+func (u *UsersHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	fields := log.Fields{"Id": id}
+	if id == "" {
+		logging.FromContext(r.Context()).WithFields(fields).Error("MISSING_ARG_ID")
+		BadRequest400(w, r, "Users", "MISSING_ARG_ID")
+		return
+	}
+
+	if !u.authorize(w, r, rbac.ActionUpdateUser, id) {
+		return
+	}
+
+	if err := u.verificationClient.SendVerification(r.Context(), id); err != nil {
+		switch errors.Cause(err) {
+		case sql.ErrNoRows:
+			NotFound404(w, r, "Users")
+		case verification.ErrAlreadyVerified:
+			ConflictError409(w, r, "Users", "email_verified_at")
+		default:
+			logging.FromContext(r.Context()).WithFields(fields).Errorf("%+v", err)
+			InternalError500(w, r, "Users", err)
+		}
+		return
+	}
+
+	NoContent204(w)
+}
+
+func (u *UsersHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		BadRequest400(w, r, "Users", "MISSING_ARG_TOKEN")
+		return
+	}
+
+	userId, err := u.verificationClient.Verify(r.Context(), token)
+	if err != nil {
+		if errors.Cause(err) == verification.ErrInvalidToken {
+			logging.FromContext(r.Context()).Warn("Verification token rejected")
+			BadRequest400(w, r, "Users", "token")
+			return
+		}
+		logging.FromContext(r.Context()).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
+		return
+	}
+
+	user, err := u.usersClient.GetUserById(r.Context(), userId)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Id": userId}).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
+		return
+	}
+
+	OK200(w, user)
+}
+
+// authorize checks the caller may perform the action on the user record and
+// writes the error response when it may not.
+func (u *UsersHandler) authorize(w http.ResponseWriter, r *http.Request, action rbac.Action, ownerId string) bool {
+	return u.authorizeResource(w, r, action, rbac.UserResource(ownerId))
+}
+
+// authorizeResource is authorize for any resource. API key callers were
+// already checked against their scopes by EnforceScopes.
+func (u *UsersHandler) authorizeResource(w http.ResponseWriter, r *http.Request, action rbac.Action, resource rbac.Resource) bool {
+	if _, ok := apikeys.ApiKeyFromContext(r.Context()); ok {
+		return true
+	}
+
+	subject, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		Unauthorized401(w, r, "Users")
+		return false
+	}
+
+	allowed, err := u.rbacClient.Can(r.Context(), subject, action, resource)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Subject": subject, "Action": action}).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
+		return false
+	}
+	if !allowed {
+		Forbidden403(w, r, "Users")
+		return false
+	}
+
+	return true
+}
+
+// readsAnyUser reports whether the caller may read every user record: API
+// key callers, whose scopes EnforceScopes checked, and subjects permitted on
+// any user. ok is false once an error response has been written.
+func (u *UsersHandler) readsAnyUser(w http.ResponseWriter, r *http.Request) (readsAny bool, ok bool) {
+	if _, ok := apikeys.ApiKeyFromContext(r.Context()); ok {
+		return true, true
+	}
+
+	subject, ok := auth.UserIdFromContext(r.Context())
+	if !ok {
+		Unauthorized401(w, r, "Users")
+		return false, false
+	}
+
+	allowed, err := u.rbacClient.CanAny(r.Context(), subject, rbac.ActionReadUser)
+	if err != nil {
+		logging.FromContext(r.Context()).WithFields(log.Fields{"Subject": subject, "Action": rbac.ActionReadUser}).Errorf("%+v", err)
+		InternalError500(w, r, "Users", err)
+		return false, false
+	}
+	return allowed, true
+}
+
+func missingFields(values map[string]string) []string {
+	missing := []string{}
+	for field, value := range values {
+		if value == "" {
+			missing = append(missing, field)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
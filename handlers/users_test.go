@@ -1,7 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/rbac"
 	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -83,6 +89,22 @@ func TestCreateUser(t *testing.T) {
 			expectedBody: `{"message":"BAD_REQUEST","resource":"Users","description":"The value provided is invalid.","errors":[{"field":"First Name","error_code":"invalid"}]}`,
 			expectedCode: 400,
 		},
+		{
+			description: "Failure: Several missing fields",
+			url:         "/create",
+			requestBody: strings.NewReader(`{
+					"first_name": "",
+					"last_name": "Fuchsman",
+					"email": "testemail@mail.com",
+					"address": "",
+					"city": "Denver",
+					"state": "CO",
+					"zip": "80108",
+					"dob": "12/14/1993"
+			}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"Users","description":"The value provided is invalid.","errors":[{"field":"Address","error_code":"invalid"},{"field":"First Name","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
 		{
 			description: "Failure: Bad JSON",
 			url:         "/create",
@@ -96,7 +118,7 @@ func TestCreateUser(t *testing.T) {
 				"zip": "80108",
 				"dob": "12/14/1993"
 			}`),
-			expectedBody: `{"message":"BAD_REQUEST","resource":"Users","description":"The value provided is invalid.","errors":[{"field":"INVALID_JSON","error_code":"invalid"}]}`,
+			expectedBody: `{"message":"INVALID_JSON","resource":"Users","description":"The JSON value provided is invalid."}`,
 			expectedCode: 400,
 		},
 		{
@@ -134,31 +156,228 @@ func TestCreateUser(t *testing.T) {
 				"zip": "80108",
 				"dob": "12/14/1993"
 			}`),
-			expectedBody: `{"message":"CONFLICT_ERROR","resource":"Users","description":"there is a conflict with your request"}`,
+			expectedBody: `{"message":"CONFLICT_ERROR","resource":"Users","description":"there is a conflict with your request","errors":[{"field":"email","error_code":"conflict_error"}]}`,
 			expectedCode: 409,
 		},
+		{
+			description: "Failure: Password too short",
+			url:         "/create",
+			requestBody: strings.NewReader(`{
+				"first_name": "Eli",
+				"last_name": "Fuchsman",
+				"email": "testemail@mail.com",
+				"address": "1123 Street St.",
+				"city": "Denver",
+				"state": "CO",
+				"zip": "80108",
+				"dob": "12/14/1993",
+				"password": "short"
+			}`),
+			expectedBody: `{"message":"BAD_REQUEST","resource":"Users","description":"The value provided is invalid.","errors":[{"field":"Password","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+		{
+			description: "Success: User created with password",
+			url:         "/create",
+			userClient: &users.TestClient{
+				CreateUserData: testUserEli,
+			},
+			requestBody: strings.NewReader(`{
+				"first_name": "Eli",
+				"last_name": "Fuchsman",
+				"email": "testemail@mail.com",
+				"address": "1123 Street St.",
+				"city": "Denver",
+				"state": "CO",
+				"zip": "80108",
+				"dob": "12/14/1993",
+				"password": "password123"
+			}`),
+			expectedBody: `{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}`,
+			expectedCode: 201,
+		},
 	}
 	for i, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
 			t.Log(tc.description)
 
-			h := NewUsersHandler(tc.userClient)
+			h := NewUsersHandler(tc.userClient, nil, &verification.TestClient{})
 			r := httptest.NewRequest("POST", tc.url, tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
 
 			w := httptest.NewRecorder()
 			h.CreateUser(w, r)
 
 			assert.Equal(t, tc.expectedCode, w.Code)
 			assert.Equal(t, tc.expectedBody, w.Body.String())
+			if tc.expectedCode == 201 {
+				assert.Equal(t, "/users/"+testUserEli.Id, w.Header().Get("Location"))
+			}
 		})
 	}
 }
 
-func TestGetUserByEmail(t *testing.T) {
+func TestGetUser(t *testing.T) {
+	testCases := []struct {
+		description        string
+		userClient         *users.TestClient
+		rbacClient         *rbac.TestClient
+		id                 string
+		expectedBody       string
+		expectedCode       int
+		expectedDeprecated bool
+	}{
+		{
+			description: "Success: User found",
+			userClient: &users.TestClient{
+				GetUserByIdData: testUserEli,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			id:           testUserEli.Id,
+			expectedBody: `{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Success: User found by the deprecated email lookup",
+			userClient: &users.TestClient{
+				GetUserByEmailData: testUserEli,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			id:                 testUserEli.Email,
+			expectedBody:       `{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}`,
+			expectedCode:       200,
+			expectedDeprecated: true,
+		},
+		{
+			description:  "Failure: No Id",
+			id:           "",
+			expectedBody: `{"message":"BAD_REQUEST","resource":"Users","description":"The value provided is invalid.","errors":[{"field":"MISSING_ARG_ID","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+		{
+			description: "Failure: No User",
+			userClient: &users.TestClient{
+				GetUserByIdErr: sql.ErrNoRows,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			id:           testUserEli.Id,
+			expectedBody: `{"message":"NOT_FOUND","resource":"Users","description":"What you are looking for cannot be found."}`,
+			expectedCode: 404,
+		},
+		{
+			description: "Success: Own user found by email without permission on any user",
+			userClient: &users.TestClient{
+				GetUserByEmailData: testUserEli,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+				OwnOnly: true,
+			},
+			id:                 testUserEli.Email,
+			expectedBody:       `{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}`,
+			expectedCode:       200,
+			expectedDeprecated: true,
+		},
+		{
+			description: "Failure: No User by email",
+			userClient: &users.TestClient{
+				GetUserByEmailErr: sql.ErrNoRows,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			id:                 testUserEli2.Email,
+			expectedBody:       `{"message":"NOT_FOUND","resource":"Users","description":"What you are looking for cannot be found."}`,
+			expectedCode:       404,
+			expectedDeprecated: true,
+		},
+		{
+			description: "Failure: Not permitted",
+			rbacClient: &rbac.TestClient{
+				CanData: false,
+			},
+			id:           testUserEli2.Id,
+			expectedBody: `{"message":"FORBIDDEN","resource":"Users","description":"You do not have permission to access this resource."}`,
+			expectedCode: 403,
+		},
+		{
+			description: "Failure: Someone else's email answered as unknown",
+			userClient: &users.TestClient{
+				GetUserByEmailData: testUserEli2,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+				OwnOnly: true,
+			},
+			id:                 testUserEli2.Email,
+			expectedBody:       `{"message":"NOT_FOUND","resource":"Users","description":"What you are looking for cannot be found."}`,
+			expectedCode:       404,
+			expectedDeprecated: true,
+		},
+		{
+			description: "Failure: Email lookup failed",
+			userClient: &users.TestClient{
+				GetUserByEmailErr: errors.New("connection refused"),
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			id:                 testUserEli.Email,
+			expectedBody:       `{"message":"INTERNAL_ERROR","resource":"Users","description":"An internal error occurred."}`,
+			expectedCode:       500,
+			expectedDeprecated: true,
+		},
+		{
+			description: "Failure: Lookup failed",
+			userClient: &users.TestClient{
+				GetUserByIdErr: errors.New("connection refused"),
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			id:           testUserEli.Id,
+			expectedBody: `{"message":"INTERNAL_ERROR","resource":"Users","description":"An internal error occurred."}`,
+			expectedCode: 500,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewUsersHandler(tc.userClient, tc.rbacClient, nil)
+			url := fmt.Sprintf("/users/%s", tc.id)
+			r := httptest.NewRequest("GET", url, nil)
+			r.Header.Set("Accept", legacyAccept)
+			r = mux.SetURLVars(r, map[string]string{"id": tc.id})
+			r = r.WithContext(auth.WithUserId(r.Context(), testUserEli.Id))
+
+			w := httptest.NewRecorder()
+			h.GetUser(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+			if tc.expectedDeprecated {
+				assert.Equal(t, DeprecationDate(LegacyUserRoutesDeprecated), w.Header().Get("Deprecation"))
+				assert.Equal(t, `</users/search>; rel="successor-version"`, w.Header().Get("Link"))
+			} else {
+				assert.Empty(t, w.Header().Get("Link"))
+			}
+		})
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
 	testCases := []struct {
 		description  string
 		userClient   *users.TestClient
-		email        string
+		rbacClient   *rbac.TestClient
+		body         string
 		expectedBody string
 		expectedCode int
 	}{
@@ -167,37 +386,456 @@ func TestGetUserByEmail(t *testing.T) {
 			userClient: &users.TestClient{
 				GetUserByEmailData: testUserEli,
 			},
-			email:        testUserEli.Email,
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			body:         `{"email":"TestEmail@mail.com"}`,
 			expectedBody: `{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}`,
 			expectedCode: 200,
 		},
 		{
 			description:  "Failure: No Email",
-			email:        "",
+			body:         `{}`,
 			expectedBody: `{"message":"BAD_REQUEST","resource":"Users","description":"The value provided is invalid.","errors":[{"field":"MISSING_ARG_EMAIL","error_code":"invalid"}]}`,
 			expectedCode: 400,
 		},
+		{
+			description:  "Failure: Bad JSON",
+			body:         `{"email":`,
+			expectedBody: `{"message":"INVALID_JSON","resource":"Users","description":"The JSON value provided is invalid."}`,
+			expectedCode: 400,
+		},
 		{
 			description: "Failure: No User",
 			userClient: &users.TestClient{
-				GetUserByEmailErr: errors.New("NOT_FOUND"),
+				GetUserByEmailErr: sql.ErrNoRows,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
 			},
-			email:        testUserEli2.Email,
+			body:         `{"email":"testemail2@mail.com"}`,
 			expectedBody: `{"message":"NOT_FOUND","resource":"Users","description":"What you are looking for cannot be found."}`,
 			expectedCode: 404,
 		},
+		{
+			description: "Failure: Someone else's email answered as unknown",
+			userClient: &users.TestClient{
+				GetUserByEmailData: testUserEli2,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+				OwnOnly: true,
+			},
+			body:         `{"email":"testemail2@mail.com"}`,
+			expectedBody: `{"message":"NOT_FOUND","resource":"Users","description":"What you are looking for cannot be found."}`,
+			expectedCode: 404,
+		},
+		{
+			description: "Failure: Own email not permitted",
+			userClient: &users.TestClient{
+				GetUserByEmailData: testUserEli,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: false,
+			},
+			body:         `{"email":"testemail@mail.com"}`,
+			expectedBody: `{"message":"FORBIDDEN","resource":"Users","description":"You do not have permission to access this resource."}`,
+			expectedCode: 403,
+		},
 	}
 	for i, tc := range testCases {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
 			t.Log(tc.description)
 
-			h := NewUsersHandler(tc.userClient)
-			url := fmt.Sprintf("/users/%s", tc.email)
-			r := httptest.NewRequest("GET", url, nil)
-			r = mux.SetURLVars(r, map[string]string{"email": tc.email})
+			h := NewUsersHandler(tc.userClient, tc.rbacClient, nil)
+			r := httptest.NewRequest("POST", "/users/search", strings.NewReader(tc.body))
+			r.Header.Set("Accept", legacyAccept)
+			r = r.WithContext(auth.WithUserId(r.Context(), testUserEli.Id))
+
+			w := httptest.NewRecorder()
+			h.SearchUsers(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestBatchGetUsers(t *testing.T) {
+	tooMany := make([]string, maxBatchGetUsers+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("%d", i)
+	}
+	tooManyBody, _ := json.Marshal(BatchGetUsersRequest{Ids: tooMany})
+
+	testCases := []struct {
+		description  string
+		userClient   *users.TestClient
+		rbacClient   *rbac.TestClient
+		body         string
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description: "Success: Ids in request order, with misses",
+			userClient: &users.TestClient{
+				GetUsersByIdsData: []*users.User{testUserEli, testUserEli2},
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			body:         `{"ids":["12infioEd","nope","12infioed","12infioEd"]}`,
+			expectedBody: `{"users":[{"id":"12infioEd","first_name":"Eli","last_name":"Fuchsman","email":"testemail2@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"},{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}],"missing":["nope"]}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Success: Emails lowercased",
+			userClient: &users.TestClient{
+				GetUsersByEmailsData: []*users.User{testUserEli},
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			body:         `{"emails":["TestEmail@mail.com","Nobody@mail.com"]}`,
+			expectedBody: `{"users":[{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}],"missing":["nobody@mail.com"]}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Success: Nothing found",
+			userClient:  &users.TestClient{},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			body:         `{"ids":["nope"]}`,
+			expectedBody: `{"users":[],"missing":["nope"]}`,
+			expectedCode: 200,
+		},
+		{
+			description:  "Failure: Bad JSON",
+			body:         `{"ids":`,
+			expectedBody: `"code":"invalid_json"`,
+			expectedCode: 400,
+		},
+		{
+			description:  "Failure: Neither ids nor emails",
+			body:         `{}`,
+			expectedBody: `"field":"MISSING_ARG_IDS"`,
+			expectedCode: 400,
+		},
+		{
+			description:  "Failure: Both ids and emails",
+			body:         `{"ids":["12infioed"],"emails":["testemail@mail.com"]}`,
+			expectedBody: `"field":"IDS_AND_EMAILS"`,
+			expectedCode: 400,
+		},
+		{
+			description:  "Failure: Too many ids",
+			body:         string(tooManyBody),
+			expectedBody: `"field":"TOO_MANY_IDS"`,
+			expectedCode: 400,
+		},
+		{
+			description:  "Failure: Empty email",
+			body:         `{"emails":["testemail@mail.com",""]}`,
+			expectedBody: `"field":"EMPTY_EMAILS"`,
+			expectedCode: 400,
+		},
+		{
+			description: "Failure: Not permitted",
+			userClient:  &users.TestClient{},
+			rbacClient: &rbac.TestClient{
+				CanData: false,
+			},
+			body:         `{"ids":["12infioed"]}`,
+			expectedBody: `"code":"forbidden"`,
+			expectedCode: 403,
+		},
+		{
+			description: "Failure: Lookup failed",
+			userClient: &users.TestClient{
+				GetUsersByIdsErr: errors.New("connection refused"),
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			body:         `{"ids":["12infioed"]}`,
+			expectedBody: `"code":"internal_error"`,
+			expectedCode: 500,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewUsersHandler(tc.userClient, tc.rbacClient, nil)
+			r := httptest.NewRequest("POST", "/users/batch-get", strings.NewReader(tc.body))
+			r = r.WithContext(auth.WithUserId(r.Context(), testUserEli.Id))
+
+			w := httptest.NewRecorder()
+			h.BatchGetUsers(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedBody)
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	body := `{
+		"first_name": "Eli",
+		"last_name": "Fuchsman",
+		"email": "testemail@mail.com",
+		"address": "1123 Street St.",
+		"city": "Denver",
+		"state": "CO",
+		"zip": "80108",
+		"dob": "12/14/1993"
+	}`
+
+	testCases := []struct {
+		description  string
+		userClient   *users.TestClient
+		rbacClient   *rbac.TestClient
+		subject      string
+		requestBody  io.Reader
+		expectedBody string
+		expectedCode int
+	}{
+		{
+			description: "Success: User updated",
+			userClient: &users.TestClient{
+				UpdateUserData: testUserEli,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			subject:      testUserEli.Id,
+			requestBody:  strings.NewReader(body),
+			expectedBody: `{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Email in use",
+			userClient: &users.TestClient{
+				UpdateUserErr: users.ErrEmailExists,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			subject:      testUserEli.Id,
+			requestBody:  strings.NewReader(body),
+			expectedBody: `{"message":"CONFLICT_ERROR","resource":"Users","description":"there is a conflict with your request","errors":[{"field":"email","error_code":"conflict_error"}]}`,
+			expectedCode: 409,
+		},
+		{
+			description: "Failure: Not permitted",
+			rbacClient: &rbac.TestClient{
+				CanData: false,
+			},
+			subject:      testUserEli2.Id,
+			requestBody:  strings.NewReader(body),
+			expectedBody: `{"message":"FORBIDDEN","resource":"Users","description":"You do not have permission to access this resource."}`,
+			expectedCode: 403,
+		},
+		{
+			description:  "Failure: Not authenticated",
+			requestBody:  strings.NewReader(body),
+			expectedBody: `{"message":"UNAUTHORIZED","resource":"Users","description":"Valid credentials are required to access this resource."}`,
+			expectedCode: 401,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewUsersHandler(tc.userClient, tc.rbacClient, nil)
+			r := httptest.NewRequest("PUT", "/users/"+testUserEli.Id, tc.requestBody)
+			r.Header.Set("Accept", legacyAccept)
+			r = mux.SetURLVars(r, map[string]string{"id": testUserEli.Id})
+			if tc.subject != "" {
+				r = r.WithContext(auth.WithUserId(r.Context(), tc.subject))
+			}
+
+			w := httptest.NewRecorder()
+			h.UpdateUser(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	testCases := []struct {
+		description  string
+		userClient   *users.TestClient
+		rbacClient   *rbac.TestClient
+		apiKey       *apikeys.ApiKey
+		expectedCode int
+	}{
+		{
+			description: "Success: Admin deletes user",
+			userClient:  &users.TestClient{},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			expectedCode: 204,
+		},
+		{
+			description: "Success: API key caller skips RBAC",
+			userClient:  &users.TestClient{},
+			apiKey: &apikeys.ApiKey{
+				Scopes: []apikeys.Scope{apikeys.ScopeUsersAdmin},
+			},
+			expectedCode: 204,
+		},
+		{
+			description: "Failure: Not permitted",
+			rbacClient: &rbac.TestClient{
+				CanData: false,
+			},
+			expectedCode: 403,
+		},
+		{
+			description: "Failure: No User",
+			userClient: &users.TestClient{
+				DeleteUserErr: sql.ErrNoRows,
+			},
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			expectedCode: 404,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewUsersHandler(tc.userClient, tc.rbacClient, nil)
+			r := httptest.NewRequest("DELETE", "/users/"+testUserEli.Id, nil)
+			r.Header.Set("Accept", legacyAccept)
+			r = mux.SetURLVars(r, map[string]string{"id": testUserEli.Id})
+			if tc.apiKey != nil {
+				r = r.WithContext(apikeys.WithApiKey(r.Context(), tc.apiKey))
+			} else {
+				r = r.WithContext(auth.WithUserId(r.Context(), testUserEli2.Id))
+			}
+
+			w := httptest.NewRecorder()
+			h.DeleteUser(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	testCases := []struct {
+		description        string
+		rbacClient         *rbac.TestClient
+		verificationClient *verification.TestClient
+		expectedCode       int
+	}{
+		{
+			description: "Success: Verification resent",
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			verificationClient: &verification.TestClient{},
+			expectedCode:       204,
+		},
+		{
+			description: "Failure: Already verified",
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			verificationClient: &verification.TestClient{
+				SendVerificationErr: verification.ErrAlreadyVerified,
+			},
+			expectedCode: 409,
+		},
+		{
+			description: "Failure: No User",
+			rbacClient: &rbac.TestClient{
+				CanData: true,
+			},
+			verificationClient: &verification.TestClient{
+				SendVerificationErr: sql.ErrNoRows,
+			},
+			expectedCode: 404,
+		},
+		{
+			description: "Failure: Not permitted",
+			rbacClient: &rbac.TestClient{
+				CanData: false,
+			},
+			expectedCode: 403,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewUsersHandler(nil, tc.rbacClient, tc.verificationClient)
+			r := httptest.NewRequest("POST", "/users/"+testUserEli.Id+"/verify/resend", nil)
+			r.Header.Set("Accept", legacyAccept)
+			r = mux.SetURLVars(r, map[string]string{"id": testUserEli.Id})
+			r = r.WithContext(auth.WithUserId(r.Context(), testUserEli.Id))
+
+			w := httptest.NewRecorder()
+			h.ResendVerification(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	testCases := []struct {
+		description        string
+		userClient         *users.TestClient
+		verificationClient *verification.TestClient
+		token              string
+		expectedBody       string
+		expectedCode       int
+	}{
+		{
+			description: "Success: Email verified",
+			userClient: &users.TestClient{
+				GetUserByIdData: testUserEli,
+			},
+			verificationClient: &verification.TestClient{
+				VerifyData: testUserEli.Id,
+			},
+			token:        "abc.123.sig",
+			expectedBody: `{"id":"12infioed","first_name":"Eli","last_name":"Fuchsman","email":"testemail@mail.com","address":"1123 Street St.","city":"Denver","state":"CO","zip":"80108","dob":"12/14/1993"}`,
+			expectedCode: 200,
+		},
+		{
+			description: "Failure: Invalid token",
+			verificationClient: &verification.TestClient{
+				VerifyErr: verification.ErrInvalidToken,
+			},
+			token:        "abc.123.sig",
+			expectedBody: `{"message":"BAD_REQUEST","resource":"Users","description":"The value provided is invalid.","errors":[{"field":"token","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+		{
+			description:  "Failure: No token",
+			expectedBody: `{"message":"BAD_REQUEST","resource":"Users","description":"The value provided is invalid.","errors":[{"field":"MISSING_ARG_TOKEN","error_code":"invalid"}]}`,
+			expectedCode: 400,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			h := NewUsersHandler(tc.userClient, nil, tc.verificationClient)
+			r := httptest.NewRequest("GET", "/verify?token="+tc.token, nil)
+			r.Header.Set("Accept", legacyAccept)
 
 			w := httptest.NewRecorder()
-			h.GetUserByEmail(w, r)
+			h.VerifyEmail(w, r)
 
 			assert.Equal(t, tc.expectedCode, w.Code)
 			assert.Equal(t, tc.expectedBody, w.Body.String())
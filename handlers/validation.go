@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/logging"
+	"db_practice/internal/openapi"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Validate is router middleware that checks requests against the loaded
+// OpenAPI document before they reach the route's handler, answering 400
+// with a field error per violation. With response validation on, responses
+// that break the document are replaced by a 500, so tests catch handlers
+// drifting from it. Event streams, such as GraphQL subscriptions, are passed
+// through unvalidated, as they can't be held until they end.
+func (h *OpenAPIHandler) Validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if h.validator == nil || route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if h.validateRequests && !h.validRequest(w, r, template) {
+			return
+		}
+		if !h.validateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &bufferedResponse{w: w, header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.streaming {
+			return
+		}
+		violations := h.validator.Response(r.Method, template, rec.status, rec.header.Get("Content-Type"), rec.body.Bytes())
+		if len(violations) > 0 {
+			err := fmt.Errorf("%s %s answered %d against the OpenAPI document: %s",
+				r.Method, template, rec.status, joinViolations(violations))
+			logging.FromContext(r.Context()).Errorf("%v", err)
+			InternalError500(w, r, "OpenAPI", err)
+			return
+		}
+		rec.send()
+	})
+}
+
+// validRequest checks r, writing the error response when it is invalid.
+// Bodies over the limit are answered 413 without being read further.
+// The body is read in full and put back for the handler.
+func (h *OpenAPIHandler) validRequest(w http.ResponseWriter, r *http.Request, template string) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodyBytes))
+	r.Body.Close()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		fields := log.Fields{"Route": template, "Limit": tooLarge.Limit}
+		logging.FromContext(r.Context()).WithFields(fields).Warn("Request body too large")
+		PayloadTooLarge413(w, r, "Validation")
+		return false
+	}
+	if err != nil {
+		InvalidJSON400(w, r, "Validation")
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	violations, err := h.validator.Request(r.Method, template, r.URL.Query(), body)
+	if err != nil {
+		InvalidJSON400(w, r, "Validation")
+		return false
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	fields := log.Fields{"Route": template, "Violations": joinViolations(violations)}
+	logging.FromContext(r.Context()).WithFields(fields).Warn("Request failed validation")
+	e := New("BAD_REQUEST", "Validation", errcatalog.Invalid)
+	for _, v := range violations {
+		field := v.Field
+		if field == "" {
+			field = "body"
+		}
+		e.Errors = append(e.Errors, &FieldError{
+			Field:     field,
+			ErrorCode: v.Code,
+			params:    v.Params,
+		})
+	}
+	Err(w, r, e, 400)
+	return false
+}
+
+func joinViolations(violations []openapi.Violation) string {
+	s := make([]string, len(violations))
+	for i, v := range violations {
+		s[i] = v.String()
+	}
+	return strings.Join(s, "; ")
+}
+
+// bufferedResponse holds a response until it has been validated, except
+// for an event stream, which goes straight to w from its status line on.
+type bufferedResponse struct {
+	w           http.ResponseWriter
+	header      http.Header
+	status      int
+	wroteHeader bool
+	streaming   bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.wroteHeader {
+		return
+	}
+	b.status = code
+	b.wroteHeader = true
+
+	mediaType, _, err := mime.ParseMediaType(b.header.Get("Content-Type"))
+	if err == nil && mediaType == eventStreamContentType {
+		b.streaming = true
+		b.copyHeader()
+		b.w.WriteHeader(code)
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if !b.wroteHeader {
+		b.WriteHeader(http.StatusOK)
+	}
+	if b.streaming {
+		return b.w.Write(p)
+	}
+	return b.body.Write(p)
+}
+
+// FlushError flushes an event stream. Anything else stays held.
+func (b *bufferedResponse) FlushError() error {
+	if !b.streaming {
+		return nil
+	}
+	return http.NewResponseController(b.w).Flush()
+}
+
+// Unwrap lets http.ResponseController reach w, e.g. to clear a stream's
+// write deadline.
+func (b *bufferedResponse) Unwrap() http.ResponseWriter {
+	return b.w
+}
+
+// send writes the held response to w.
+func (b *bufferedResponse) send() {
+	b.copyHeader()
+	b.w.WriteHeader(b.status)
+	b.w.Write(b.body.Bytes())
+}
+
+func (b *bufferedResponse) copyHeader() {
+	for k, v := range b.header {
+		b.w.Header()[k] = v
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"db_practice/internal/openapi"
+	"db_practice/internal/users"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMaxBodyBytes is the body limit validatedRouter's requests are held
+// to.
+const testMaxBodyBytes = 1 << 10
+
+// validatedRouter serves create as POST /v1/users, behind Validate
+// with the endpoint's real OpenAPI description.
+func validatedRouter(t *testing.T, validateResponses bool, create http.HandlerFunc) *mux.Router {
+	spec := OpenAPISpec(true)
+	for _, e := range spec.Endpoints {
+		if e.Method == "POST" && e.Path == "/v1/users" {
+			spec.Endpoints = []openapi.Endpoint{e}
+			break
+		}
+	}
+
+	h := NewOpenAPIHandler(true, validateResponses, testMaxBodyBytes)
+	router := mux.NewRouter()
+	router.Use(h.Validate)
+	router.HandleFunc("/v1/users", create).Methods("POST")
+	doc, err := openapi.Build(router, spec)
+	require.NoError(t, err)
+	require.NoError(t, h.Load(doc))
+	return router
+}
+
+func TestValidateRequests(t *testing.T) {
+	user := users.User{Id: "1", FirstName: "Ann", LastName: "Lee", Email: "ann@example.com"}
+	created := func(w http.ResponseWriter, r *http.Request) {
+		var req CreateUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			InvalidJSON400(w, r, "Users")
+			return
+		}
+		Created201(w, user)
+	}
+	valid := `{"first_name":"Ann","last_name":"Lee","email":"ann@example.com","address":"1 Main St",` +
+		`"city":"Springfield","state":"IL","zip":"62701","dob":"1990-01-01"}`
+
+	testCases := []struct {
+		description    string
+		body           string
+		acceptLanguage string
+		expectedStatus int
+		expectedErrors []*FieldError
+	}{
+		{
+			description:    "Success: Valid request reaches the handler with its body",
+			body:           valid,
+			expectedStatus: 201,
+		},
+		{
+			description:    "Failure: Every violation listed",
+			body:           strings.Replace(valid, `"Ann"`, `"`+strings.Repeat("a", 51)+`","nickname":"A"`, 1),
+			expectedStatus: 400,
+			expectedErrors: []*FieldError{
+				{Field: "first_name", ErrorCode: "too_long", Message: "first_name must be at most 50 characters."},
+				{Field: "nickname", ErrorCode: "unknown_field", Message: "nickname is not a known field."},
+			},
+		},
+		{
+			description:    "Failure: Missing field and bad format",
+			body:           `{"first_name":"Ann","email":"ann","address":"1 Main St","city":"Springfield","state":"IL","zip":"62701","dob":"1990-01-01"}`,
+			expectedStatus: 400,
+			expectedErrors: []*FieldError{
+				{Field: "last_name", ErrorCode: "required", Message: "last_name is required."},
+				{Field: "email", ErrorCode: "invalid_format", Message: "email is not a valid email."},
+			},
+		},
+		{
+			description:    "Failure: Violations localized",
+			body:           strings.Replace(valid, `"Lee"`, `42`, 1),
+			acceptLanguage: "es",
+			expectedStatus: 400,
+			expectedErrors: []*FieldError{
+				{Field: "last_name", ErrorCode: "invalid_type", Message: "last_name debe ser string."},
+			},
+		},
+		{
+			description:    "Failure: Body that isn't JSON",
+			body:           `{"first_name":`,
+			expectedStatus: 400,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			router := validatedRouter(t, false, created)
+			r := httptest.NewRequest("POST", "/v1/users", strings.NewReader(tc.body))
+			r.Header.Set("Accept-Language", tc.acceptLanguage)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedErrors == nil {
+				return
+			}
+			var body Problem
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, "invalid", body.Code)
+			assert.ElementsMatch(t, tc.expectedErrors, body.Errors)
+		})
+	}
+}
+
+func TestValidateRequestTooLarge(t *testing.T) {
+	reached := false
+	router := validatedRouter(t, false, func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})
+
+	body := `{"first_name":"` + strings.Repeat("a", testMaxBodyBytes) + `"}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/users", strings.NewReader(body)))
+
+	assert.Equal(t, 413, w.Code)
+	assert.False(t, reached)
+	var problem Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, "payload_too_large", problem.Code)
+}
+
+func TestValidateResponses(t *testing.T) {
+	valid := `{"first_name":"Ann","last_name":"Lee","email":"ann@example.com","address":"1 Main St",` +
+		`"city":"Springfield","state":"IL","zip":"62701","dob":"1990-01-01"}`
+
+	testCases := []struct {
+		description       string
+		validateResponses bool
+		handler           http.HandlerFunc
+		expectedStatus    int
+	}{
+		{
+			description:       "Success: Documented response passed through",
+			validateResponses: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				Created201(w, users.User{Id: "1", Email: "ann@example.com"})
+			},
+			expectedStatus: 201,
+		},
+		{
+			description:       "Success: Drift ignored with response validation off",
+			validateResponses: false,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			},
+			expectedStatus: 202,
+		},
+		{
+			description:       "Failure: Undocumented status",
+			validateResponses: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			},
+			expectedStatus: 500,
+		},
+		{
+			description:       "Failure: Body drifted from the schema",
+			validateResponses: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				Created201(w, map[string]string{"id": "1"})
+			},
+			expectedStatus: 500,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			router := validatedRouter(t, tc.validateResponses, tc.handler)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/users", strings.NewReader(valid)))
+
+			assert.Equal(t, tc.expectedStatus, w.Code)
+		})
+	}
+}
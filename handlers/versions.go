@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"db_practice/internal/errcatalog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Vendor media types select an API version through the Accept header:
+// application/vnd.practice.v1+json asks for v1.
+const (
+	versionMediaTypePrefix = "application/vnd.practice."
+	versionMediaTypeSuffix = "+json"
+)
+
+// VersionMediaType is the media type asking for the named API version.
+func VersionMediaType(name string) string {
+	return versionMediaTypePrefix + name + versionMediaTypeSuffix
+}
+
+// APIVersion is a version of the API, served under /{Name}.
+type APIVersion struct {
+	Name string
+	// Deprecated and Sunset, when set, are announced on every response of
+	// the version: the Deprecation header (RFC 9745) gives the date it was
+	// deprecated, the Sunset header (RFC 8594) the date it stops being
+	// served.
+	Deprecated time.Time
+	Sunset     time.Time
+}
+
+type contextKey int
+
+const versionKey contextKey = iota
+
+// Middleware records the version on the request's context and announces
+// its deprecation and sunset.
+func (v APIVersion) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !v.Deprecated.IsZero() {
+			w.Header().Set("Deprecation", DeprecationDate(v.Deprecated))
+		}
+		if !v.Sunset.IsZero() {
+			w.Header().Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey, v.Name)))
+	})
+}
+
+// VersionFromContext returns the name of the API version serving the
+// request, if any.
+func VersionFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(versionKey).(string)
+	return name, ok && name != ""
+}
+
+// VersionPath is path within the named API version.
+func VersionPath(name, path string) string {
+	return "/" + name + path
+}
+
+// versionPath is path within the API version serving r.
+func versionPath(r *http.Request, path string) string {
+	if name, ok := VersionFromContext(r.Context()); ok {
+		return VersionPath(name, path)
+	}
+	return path
+}
+
+// Deprecated wraps the handler of a route kept for compatibility. Its
+// responses give the date it was deprecated and link to successor, a path
+// within the same API version.
+func Deprecated(since time.Time, successor string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deprecate(w, r, since, successor)
+		next(w, r)
+	})
+}
+
+func deprecate(w http.ResponseWriter, r *http.Request, since time.Time, successor string) {
+	w.Header().Set("Deprecation", DeprecationDate(since))
+	w.Header().Add("Link", "<"+versionPath(r, successor)+`>; rel="successor-version"`)
+}
+
+// DeprecationDate formats t for the Deprecation header (RFC 9745).
+func DeprecationDate(t time.Time) string {
+	return "@" + strconv.FormatInt(t.Unix(), 10)
+}
+
+// VersionRouter serves router's versioned routes for unversioned paths:
+// GET /users/x is served as GET /v1/users/x. The version is the one the
+// Accept header asks for, or else the alias version, announced with a
+// Warning header since unversioned paths are only kept for compatibility.
+// Paths router serves as they are, like /healthz, are left alone.
+type VersionRouter struct {
+	router   *mux.Router
+	versions map[string]bool
+	alias    string
+}
+
+func NewVersionRouter(router *mux.Router, versions []APIVersion, alias string) *VersionRouter {
+	known := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		known[v.Name] = true
+	}
+	return &VersionRouter{
+		router:   router,
+		versions: known,
+		alias:    alias,
+	}
+}
+
+func (v *VersionRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	served, asked, ok := v.resolve(r)
+	if !ok {
+		w.Header().Add("Vary", "Accept")
+		Err(w, r, New(upper(errcatalog.NotAcceptable), "Versions", errcatalog.NotAcceptable), 406)
+		return
+	}
+	if served != r {
+		w.Header().Add("Vary", "Accept")
+		if !asked {
+			w.Header().Set("Warning", `299 - "Unversioned paths are deprecated, use `+served.URL.Path+`"`)
+		}
+	}
+	v.router.ServeHTTP(w, served)
+}
+
+// Match is the router's Match for the request r is served as.
+func (v *VersionRouter) Match(r *http.Request, match *mux.RouteMatch) bool {
+	served, _, ok := v.resolve(r)
+	return ok && v.router.Match(served, match)
+}
+
+// resolve gives the request r is served as: r itself when its path is
+// versioned or the router serves it as it is, or else a copy under the
+// version prefix if the router has a route there. It isn't ok when the
+// Accept header only asks for unknown versions.
+func (v *VersionRouter) resolve(r *http.Request) (served *http.Request, asked, ok bool) {
+	if v.versioned(r.URL.Path) || v.matches(r) {
+		return r, false, true
+	}
+	version, asked, ok := v.requestedVersion(r)
+	if !ok {
+		return nil, false, false
+	}
+
+	aliased := r.Clone(r.Context())
+	aliased.URL.Path = "/" + version + r.URL.Path
+	if r.URL.RawPath != "" {
+		aliased.URL.RawPath = "/" + version + r.URL.RawPath
+	}
+	if !v.matches(aliased) {
+		return r, false, true
+	}
+	return aliased, asked, true
+}
+
+// versioned reports whether path starts with a known version.
+func (v *VersionRouter) versioned(path string) bool {
+	first, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return v.versions[first]
+}
+
+// matches reports whether router has a route for r's path, even if not for
+// its method.
+func (v *VersionRouter) matches(r *http.Request) bool {
+	var match mux.RouteMatch
+	return v.router.Match(r, &match) || match.MatchErr == mux.ErrMethodMismatch
+}
+
+// requestedVersion is the known version the Accept header ranks highest,
+// with asked set, or the alias version if it names none. It isn't ok when
+// the header only names unknown versions.
+func (v *VersionRouter) requestedVersion(r *http.Request) (version string, asked, ok bool) {
+	named := false
+	best := 0.0
+	for _, value := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(value, ",") {
+			mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || !strings.HasPrefix(mediaRange, versionMediaTypePrefix) || !strings.HasSuffix(mediaRange, versionMediaTypeSuffix) {
+				continue
+			}
+			named = true
+			name := strings.TrimSuffix(strings.TrimPrefix(mediaRange, versionMediaTypePrefix), versionMediaTypeSuffix)
+
+			q := 1.0
+			if s, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(s, 64); err != nil {
+					q = 0
+				}
+			}
+			if v.versions[name] && q > best {
+				version, best = name, q
+			}
+		}
+	}
+	if version != "" {
+		return version, true, true
+	}
+	return v.alias, false, !named
+}
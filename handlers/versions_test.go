@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionRouter(t *testing.T) {
+	versions := []APIVersion{
+		{
+			Name:       "v1",
+			Deprecated: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+			Sunset:     time.Date(2027, 4, 19, 0, 0, 0, 0, time.UTC),
+		},
+		{Name: "v2"},
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "root")
+	}).Methods("GET")
+	for _, v := range versions {
+		versioned := router.PathPrefix("/" + v.Name).Subrouter()
+		versioned.Use(v.Middleware)
+		versioned.HandleFunc("/pets/{id}", func(w http.ResponseWriter, r *http.Request) {
+			name, _ := VersionFromContext(r.Context())
+			fmt.Fprint(w, name+" "+mux.Vars(r)["id"])
+		}).Methods("GET")
+	}
+	api := NewVersionRouter(router, versions, "v1")
+
+	testCases := []struct {
+		description         string
+		method              string
+		path                string
+		accept              string
+		expectedCode        int
+		expectedBody        string
+		expectedWarning     string
+		expectedDeprecation string
+		expectedSunset      string
+	}{
+		{
+			description:         "Success: Deprecated version announced",
+			method:              "GET",
+			path:                "/v1/pets/7",
+			expectedCode:        200,
+			expectedBody:        "v1 7",
+			expectedDeprecation: "@1792368000",
+			expectedSunset:      "Mon, 19 Apr 2027 00:00:00 GMT",
+		},
+		{
+			description:  "Success: Current version",
+			method:       "GET",
+			path:         "/v2/pets/7",
+			expectedCode: 200,
+			expectedBody: "v2 7",
+		},
+		{
+			description:         "Success: Unversioned path aliases v1",
+			method:              "GET",
+			path:                "/pets/7",
+			expectedCode:        200,
+			expectedBody:        "v1 7",
+			expectedWarning:     `299 - "Unversioned paths are deprecated, use /v1/pets/7"`,
+			expectedDeprecation: "@1792368000",
+			expectedSunset:      "Mon, 19 Apr 2027 00:00:00 GMT",
+		},
+		{
+			description:  "Success: Highest ranked known version asked for",
+			method:       "GET",
+			path:         "/pets/7",
+			accept:       "application/vnd.practice.v1+json;q=0.5, application/vnd.practice.v2+json, application/vnd.practice.v3+json",
+			expectedCode: 200,
+			expectedBody: "v2 7",
+		},
+		{
+			description:  "Success: Path wins over the Accept header",
+			method:       "GET",
+			path:         "/v2/pets/7",
+			accept:       VersionMediaType("v1"),
+			expectedCode: 200,
+			expectedBody: "v2 7",
+		},
+		{
+			description:  "Success: Unversioned route left alone",
+			method:       "GET",
+			path:         "/healthz",
+			accept:       VersionMediaType("v3"),
+			expectedCode: 200,
+			expectedBody: "root",
+		},
+		{
+			description:     "Failure: Alias keeps the route's methods",
+			method:          "POST",
+			path:            "/pets/7",
+			expectedCode:    405,
+			expectedWarning: `299 - "Unversioned paths are deprecated, use /v1/pets/7"`,
+		},
+		{
+			description:  "Failure: No route in any version",
+			method:       "GET",
+			path:         "/owners/7",
+			expectedCode: 404,
+		},
+		{
+			description:  "Failure: Only unknown versions asked for",
+			method:       "GET",
+			path:         "/pets/7",
+			accept:       VersionMediaType("v3"),
+			expectedCode: 406,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			if tc.expectedBody != "" {
+				assert.Equal(t, tc.expectedBody, w.Body.String())
+			}
+			assert.Equal(t, tc.expectedWarning, w.Header().Get("Warning"))
+			assert.Equal(t, tc.expectedDeprecation, w.Header().Get("Deprecation"))
+			assert.Equal(t, tc.expectedSunset, w.Header().Get("Sunset"))
+
+			var match mux.RouteMatch
+			assert.Equal(t, tc.expectedCode == 200, api.Match(r, &match))
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"db_practice/internal/db"
+	"db_practice/internal/logging"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type Scope string
+
+const (
+	ScopeUsersRead  Scope = "users:read"
+	ScopeUsersWrite Scope = "users:write"
+	ScopeUsersAdmin Scope = "users:admin"
+)
+
+// KeyPrefix marks every key we issue so leaked keys are easy to grep for.
+const KeyPrefix = "dbp_"
+
+// touchInterval limits how often last-used tracking writes to the database.
+const touchInterval = time.Minute
+
+var (
+	ErrInvalidKey   = errors.New("Invalid or expired API key")
+	ErrUnknownScope = errors.New("Unknown scope")
+)
+
+type Client interface {
+	CreateApiKey(ctx context.Context, name string, scopes []Scope, expiresAt *time.Time) (*ApiKey, string, error)
+	ListApiKeys(ctx context.Context) ([]*ApiKey, error)
+	RevokeApiKey(ctx context.Context, id string) error
+	Authenticate(ctx context.Context, rawKey string) (*ApiKey, error)
+}
+
+type ApiKeysClient struct {
+	db           db.ApiKeysClient
+	bootstrapKey string
+	now          func() time.Time
+}
+
+type ApiKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []Scope    `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// NewApiKeysClient returns a client backed by the api_keys table. A non-empty
+// bootstrapKey is accepted as an admin key so the first real keys can be
+// created.
+func NewApiKeysClient(data db.ApiKeysClient, bootstrapKey string) *ApiKeysClient {
+	return &ApiKeysClient{
+		db:           data,
+		bootstrapKey: bootstrapKey,
+		now:          time.Now,
+	}
+}
+
+func ParseScope(s string) (Scope, error) {
+	switch scope := Scope(s); scope {
+	case ScopeUsersRead, ScopeUsersWrite, ScopeUsersAdmin:
+		return scope, nil
+	}
+	return "", ErrUnknownScope
+}
+
+// HasScope reports whether the key grants the scope. Admin implies write and
+// write implies read.
+func (k *ApiKey) HasScope(s Scope) bool {
+	for _, granted := range k.Scopes {
+		switch {
+		case granted == s:
+			return true
+		case granted == ScopeUsersAdmin:
+			return true
+		case granted == ScopeUsersWrite && s == ScopeUsersRead:
+			return true
+		}
+	}
+	return false
+}
+
+// CreateApiKey stores a new key and returns it along with the raw secret,
+// which is never retrievable again.
+func (a *ApiKeysClient) CreateApiKey(ctx context.Context, name string, scopes []Scope, expiresAt *time.Time) (*ApiKey, string, error) {
+	fields := log.Fields{"Name": name}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	prefix, err := randomHex(4)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	visible := KeyPrefix + prefix
+	rawKey := visible + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	stored := &db.ApiKey{
+		Id:        id,
+		Name:      name,
+		Prefix:    visible,
+		KeyHash:   hashKey(rawKey),
+		Scopes:    make([]string, len(scopes)),
+		ExpiresAt: expiresAt,
+	}
+	for i, s := range scopes {
+		stored.Scopes[i] = string(s)
+	}
+
+	if err := a.db.CreateApiKey(ctx, stored); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to create API key: %+v", err)
+		return nil, "", errors.WithStack(err)
+	}
+
+	return toApiKey(stored), rawKey, nil
+}
+
+func (a *ApiKeysClient) ListApiKeys(ctx context.Context) ([]*ApiKey, error) {
+	stored, err := a.db.ListApiKeys(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to list API keys: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+
+	keys := make([]*ApiKey, len(stored))
+	for i, k := range stored {
+		keys[i] = toApiKey(k)
+	}
+	return keys, nil
+}
+
+func (a *ApiKeysClient) RevokeApiKey(ctx context.Context, id string) error {
+	fields := log.Fields{"Id": id}
+
+	if err := a.db.RevokeApiKey(ctx, id); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to revoke API key: %+v", err)
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// Authenticate resolves a raw key to its record, rejecting unknown, revoked
+// and expired keys.
+func (a *ApiKeysClient) Authenticate(ctx context.Context, rawKey string) (*ApiKey, error) {
+	if a.bootstrapKey != "" && subtle.ConstantTimeCompare([]byte(rawKey), []byte(a.bootstrapKey)) == 1 {
+		return &ApiKey{Id: "bootstrap", Name: "bootstrap", Scopes: []Scope{ScopeUsersAdmin}}, nil
+	}
+
+	prefix, ok := splitKey(rawKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	stored, err := a.db.GetApiKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ErrInvalidKey
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashKey(rawKey)), []byte(stored.KeyHash)) != 1 {
+		return nil, ErrInvalidKey
+	}
+
+	now := a.now()
+	if stored.RevokedAt != nil || (stored.ExpiresAt != nil && !now.Before(*stored.ExpiresAt)) {
+		return nil, ErrInvalidKey
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= touchInterval {
+		if err := a.db.TouchApiKey(ctx, stored.Id, now); err != nil {
+			logging.FromContext(ctx).WithFields(log.Fields{"Id": stored.Id}).Errorf("Failed to record API key use: %+v", err)
+		} else {
+			stored.LastUsedAt = &now
+		}
+	}
+
+	return toApiKey(stored), nil
+}
+
+// splitKey returns the visible prefix of a dbp_<prefix>_<secret> key.
+func splitKey(rawKey string) (string, bool) {
+	if !strings.HasPrefix(rawKey, KeyPrefix) {
+		return "", false
+	}
+	i := strings.Index(rawKey[len(KeyPrefix):], "_")
+	if i <= 0 {
+		return "", false
+	}
+	return rawKey[:len(KeyPrefix)+i], true
+}
+
+func toApiKey(k *db.ApiKey) *ApiKey {
+	scopes := make([]Scope, len(k.Scopes))
+	for i, s := range k.Scopes {
+		scopes[i] = Scope(s)
+	}
+
+	return &ApiKey{
+		Id:         k.Id,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     scopes,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+		RevokedAt:  k.RevokedAt,
+	}
+}
+
+func hashKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,146 @@
+package apikeys
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/db"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRawKey = "dbp_1a2b3c4d_c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0"
+
+func TestCreateApiKey(t *testing.T) {
+	c := NewApiKeysClient(&db.TestClient{}, "")
+
+	key, rawKey, err := c.CreateApiKey(context.Background(), "billing-service", []Scope{ScopeUsersRead}, nil)
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(rawKey, key.Prefix+"_"))
+	assert.True(t, strings.HasPrefix(key.Prefix, KeyPrefix))
+	assert.Equal(t, []Scope{ScopeUsersRead}, key.Scopes)
+
+	prefix, ok := splitKey(rawKey)
+	assert.True(t, ok)
+	assert.Equal(t, key.Prefix, prefix)
+}
+
+func TestAuthenticate(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	stored := func(mod func(k *db.ApiKey)) *db.ApiKey {
+		k := &db.ApiKey{Id: "key-1", Name: "billing-service", Prefix: "dbp_1a2b3c4d", KeyHash: hashKey(testRawKey), Scopes: []string{"users:read"}}
+		if mod != nil {
+			mod(k)
+		}
+		return k
+	}
+
+	testCases := []struct {
+		description  string
+		rawKey       string
+		bootstrapKey string
+		db           *db.TestClient
+		expectedId   string
+		expectedErr  error
+	}{
+		{
+			description: "Success: Key authenticated",
+			rawKey:      testRawKey,
+			db: &db.TestClient{
+				GetApiKeyByPrefixData: stored(nil),
+			},
+			expectedId:  "key-1",
+			expectedErr: nil,
+		},
+		{
+			description:  "Success: Bootstrap key",
+			rawKey:       "bootstrap-secret",
+			bootstrapKey: "bootstrap-secret",
+			db:           &db.TestClient{},
+			expectedId:   "bootstrap",
+			expectedErr:  nil,
+		},
+		{
+			description: "Failure: Malformed key",
+			rawKey:      "not-a-key",
+			db:          &db.TestClient{},
+			expectedErr: ErrInvalidKey,
+		},
+		{
+			description: "Failure: Unknown key",
+			rawKey:      testRawKey,
+			db: &db.TestClient{
+				GetApiKeyByPrefixErr: sql.ErrNoRows,
+			},
+			expectedErr: ErrInvalidKey,
+		},
+		{
+			description: "Failure: Wrong secret",
+			rawKey:      "dbp_1a2b3c4d_wrong",
+			db: &db.TestClient{
+				GetApiKeyByPrefixData: stored(nil),
+			},
+			expectedErr: ErrInvalidKey,
+		},
+		{
+			description: "Failure: Expired key",
+			rawKey:      testRawKey,
+			db: &db.TestClient{
+				GetApiKeyByPrefixData: stored(func(k *db.ApiKey) { k.ExpiresAt = &past }),
+			},
+			expectedErr: ErrInvalidKey,
+		},
+		{
+			description: "Failure: Revoked key",
+			rawKey:      testRawKey,
+			db: &db.TestClient{
+				GetApiKeyByPrefixData: stored(func(k *db.ApiKey) { k.RevokedAt = &past }),
+			},
+			expectedErr: ErrInvalidKey,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			c := NewApiKeysClient(tc.db, tc.bootstrapKey)
+			key, err := c.Authenticate(context.Background(), tc.rawKey)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				assert.Nil(t, key)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedId, key.Id)
+			}
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	testCases := []struct {
+		description string
+		granted     []Scope
+		required    Scope
+		expected    bool
+	}{
+		{description: "Exact scope", granted: []Scope{ScopeUsersRead}, required: ScopeUsersRead, expected: true},
+		{description: "Write implies read", granted: []Scope{ScopeUsersWrite}, required: ScopeUsersRead, expected: true},
+		{description: "Admin implies write", granted: []Scope{ScopeUsersAdmin}, required: ScopeUsersWrite, expected: true},
+		{description: "Read does not imply write", granted: []Scope{ScopeUsersRead}, required: ScopeUsersWrite, expected: false},
+		{description: "Write does not imply admin", granted: []Scope{ScopeUsersWrite}, required: ScopeUsersAdmin, expected: false},
+		{description: "No scopes", granted: nil, required: ScopeUsersRead, expected: false},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			k := &ApiKey{Scopes: tc.granted}
+			assert.Equal(t, tc.expected, k.HasScope(tc.required))
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package apikeys
+
+import "context"
+
+type contextKey int
+
+const apiKeyKey contextKey = iota
+
+// WithApiKey returns a copy of ctx carrying the authenticated API key.
+func WithApiKey(ctx context.Context, k *ApiKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey, k)
+}
+
+// ApiKeyFromContext returns the API key the request authenticated with, if any.
+func ApiKeyFromContext(ctx context.Context) (*ApiKey, bool) {
+	k, ok := ctx.Value(apiKeyKey).(*ApiKey)
+	return k, ok && k != nil
+}
@@ -0,0 +1,36 @@
+package apikeys
+
+import (
+	"context"
+	"time"
+)
+
+type TestClient struct {
+	CreateApiKeyData   *ApiKey
+	CreateApiKeySecret string
+	CreateApiKeyErr    error
+
+	ListApiKeysData []*ApiKey
+	ListApiKeysErr  error
+
+	RevokeApiKeyErr error
+
+	AuthenticateData *ApiKey
+	AuthenticateErr  error
+}
+
+func (c TestClient) CreateApiKey(ctx context.Context, name string, scopes []Scope, expiresAt *time.Time) (*ApiKey, string, error) {
+	return c.CreateApiKeyData, c.CreateApiKeySecret, c.CreateApiKeyErr
+}
+
+func (c TestClient) ListApiKeys(ctx context.Context) ([]*ApiKey, error) {
+	return c.ListApiKeysData, c.ListApiKeysErr
+}
+
+func (c TestClient) RevokeApiKey(ctx context.Context, id string) error {
+	return c.RevokeApiKeyErr
+}
+
+func (c TestClient) Authenticate(ctx context.Context, rawKey string) (*ApiKey, error) {
+	return c.AuthenticateData, c.AuthenticateErr
+}
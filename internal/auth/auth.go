@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"db_practice/internal/db"
+	"db_practice/internal/logging"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken = errors.New("Invalid or expired token")
+	ErrTokenReused  = errors.New("Refresh token reuse detected")
+)
+
+type Client interface {
+	IssueTokens(ctx context.Context, userId string) (*TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	Revoke(ctx context.Context, refreshToken string) error
+	RevokeAll(ctx context.Context, userId string) error
+	ValidateAccessToken(token string) (*Claims, error)
+	JWKS() JWKS
+}
+
+type AuthClient struct {
+	db     db.TokensClient
+	keys   *KeyRing
+	issuer string
+	now    func() time.Time
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func NewAuthClient(data db.TokensClient, keys *KeyRing, issuer string) *AuthClient {
+	return &AuthClient{
+		db:     data,
+		keys:   keys,
+		issuer: issuer,
+		now:    time.Now,
+	}
+}
+
+// IssueTokens starts a new refresh token family for the user.
+func (a *AuthClient) IssueTokens(ctx context.Context, userId string) (*TokenPair, error) {
+	familyId, err := randomHex(16)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return a.issue(ctx, userId, familyId)
+}
+
+// Refresh exchanges a refresh token for a new pair. Each refresh token can be
+// used once; presenting a used token again revokes its whole family, since
+// either the client or an attacker is holding a stolen copy.
+func (a *AuthClient) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	stored, err := a.db.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ErrInvalidToken
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	fields := log.Fields{"User Id": stored.UserId, "Family Id": stored.FamilyId}
+
+	if stored.UsedAt != nil {
+		logging.FromContext(ctx).WithFields(fields).Warn("Refresh token reuse detected, revoking family")
+		if err := a.db.RevokeRefreshTokenFamily(ctx, stored.FamilyId); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return nil, ErrTokenReused
+	}
+	if stored.RevokedAt != nil || !a.now().Before(stored.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	ok, err := a.db.MarkRefreshTokenUsed(ctx, stored.Id)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !ok {
+		// Lost a race with a concurrent refresh of the same token.
+		logging.FromContext(ctx).WithFields(fields).Warn("Refresh token reuse detected, revoking family")
+		if err := a.db.RevokeRefreshTokenFamily(ctx, stored.FamilyId); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return nil, ErrTokenReused
+	}
+
+	return a.issue(ctx, stored.UserId, stored.FamilyId)
+}
+
+// Revoke ends the family the refresh token belongs to.
+func (a *AuthClient) Revoke(ctx context.Context, refreshToken string) error {
+	stored, err := a.db.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return ErrInvalidToken
+		}
+		return errors.WithStack(err)
+	}
+
+	if err := a.db.RevokeRefreshTokenFamily(ctx, stored.FamilyId); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// RevokeAll ends every refresh token family belonging to the user.
+func (a *AuthClient) RevokeAll(ctx context.Context, userId string) error {
+	if err := a.db.RevokeUserRefreshTokens(ctx, userId); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (a *AuthClient) ValidateAccessToken(token string) (*Claims, error) {
+	return verifyToken(a.keys, token, a.issuer, a.now())
+}
+
+func (a *AuthClient) JWKS() JWKS {
+	return a.keys.JWKS()
+}
+
+func (a *AuthClient) issue(ctx context.Context, userId, familyId string) (*TokenPair, error) {
+	key := a.keys.Active()
+	if key == nil {
+		return nil, errors.New("no active signing key")
+	}
+
+	now := a.now()
+	jti, err := randomHex(16)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	accessToken, err := signToken(key, &Claims{
+		Issuer:    a.issuer,
+		Subject:   userId,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+		Id:        jti,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tokenId, err := randomHex(16)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = a.db.CreateRefreshToken(ctx, &db.RefreshToken{
+		Id:        tokenId,
+		FamilyId:  familyId,
+		UserId:    userId,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// hashToken is what gets stored; refresh tokens have enough entropy that a
+// plain SHA-256 is sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
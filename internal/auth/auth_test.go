@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/db"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuthClient(t *testing.T, data db.TokensClient) *AuthClient {
+	return NewAuthClient(data, newTestKeyRing(t, AccessTokenTTL), "test")
+}
+
+func TestIssueTokens(t *testing.T) {
+	testCases := []struct {
+		description string
+		db          *db.TestClient
+		expectedErr bool
+	}{
+		{
+			description: "Success: Tokens issued",
+			db:          &db.TestClient{},
+			expectedErr: false,
+		},
+		{
+			description: "Failure: Refresh token not stored",
+			db: &db.TestClient{
+				CreateRefreshTokenErr: sql.ErrConnDone,
+			},
+			expectedErr: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			a := newTestAuthClient(t, tc.db)
+			pair, err := a.IssueTokens(context.Background(), "12infioed")
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "Bearer", pair.TokenType)
+			assert.Equal(t, 900, pair.ExpiresIn)
+			assert.NotEmpty(t, pair.RefreshToken)
+
+			claims, err := a.ValidateAccessToken(pair.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "12infioed", claims.Subject)
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	used := time.Now().Add(-time.Minute)
+
+	testCases := []struct {
+		description string
+		db          *db.TestClient
+		expectedErr error
+	}{
+		{
+			description: "Success: Token rotated",
+			db: &db.TestClient{
+				GetRefreshTokenByHashData: &db.RefreshToken{Id: "t1", FamilyId: "f1", UserId: "12infioed", ExpiresAt: time.Now().Add(time.Hour)},
+				MarkRefreshTokenUsedData:  true,
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Unknown token",
+			db: &db.TestClient{
+				GetRefreshTokenByHashErr: sql.ErrNoRows,
+			},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Expired token",
+			db: &db.TestClient{
+				GetRefreshTokenByHashData: &db.RefreshToken{Id: "t1", FamilyId: "f1", UserId: "12infioed", ExpiresAt: time.Now().Add(-time.Hour)},
+			},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Reused token",
+			db: &db.TestClient{
+				GetRefreshTokenByHashData: &db.RefreshToken{Id: "t1", FamilyId: "f1", UserId: "12infioed", ExpiresAt: time.Now().Add(time.Hour), UsedAt: &used},
+			},
+			expectedErr: ErrTokenReused,
+		},
+		{
+			description: "Failure: Concurrent reuse",
+			db: &db.TestClient{
+				GetRefreshTokenByHashData: &db.RefreshToken{Id: "t1", FamilyId: "f1", UserId: "12infioed", ExpiresAt: time.Now().Add(time.Hour)},
+				MarkRefreshTokenUsedData:  false,
+			},
+			expectedErr: ErrTokenReused,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			a := newTestAuthClient(t, tc.db)
+			pair, err := a.Refresh(context.Background(), "refresh-token")
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				assert.Nil(t, pair)
+			} else {
+				require.NoError(t, err)
+				assert.NotEmpty(t, pair.AccessToken)
+				assert.NotEmpty(t, pair.RefreshToken)
+			}
+		})
+	}
+}
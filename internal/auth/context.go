@@ -0,0 +1,18 @@
+package auth
+
+import "context"
+
+type contextKey int
+
+const userIdKey contextKey = iota
+
+// WithUserId returns a copy of ctx carrying the authenticated user's id.
+func WithUserId(ctx context.Context, userId string) context.Context {
+	return context.WithValue(ctx, userIdKey, userId)
+}
+
+// UserIdFromContext returns the authenticated user's id, if any.
+func UserIdFromContext(ctx context.Context) (string, bool) {
+	userId, ok := ctx.Value(userIdKey).(string)
+	return userId, ok && userId != ""
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"db_practice/internal/db"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// SigningKey is an Ed25519 key pair identified by its kid.
+type SigningKey struct {
+	Id         string
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+	CreatedAt  time.Time
+	RetiredAt  time.Time
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySyncInterval is how often StartRotation reloads the ring, picking up
+// keys rotated by other instances.
+const KeySyncInterval = time.Minute
+
+// KeyRing holds the keys used to sign and verify access tokens. The keys live
+// in the database so every instance signs with the same key and verifies
+// every other instance's tokens, across restarts too. Rotation is staged so it
+// never invalidates a token a client could still hold: the next key is
+// published in the JWKS one rotation before it starts signing, and a retired
+// key keeps verifying until the retention period has passed.
+type KeyRing struct {
+	mu        sync.RWMutex
+	active    *SigningKey
+	next      *SigningKey
+	retired   []*SigningKey
+	data      db.SigningKeysClient
+	cipherKey []byte
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewKeyRing returns a key ring stored in data, empty until the first Rotate
+// or RotateIfDue. Private keys are stored encrypted with cipherKey. Retention
+// must be at least the access token lifetime plus KeySyncInterval, as an
+// instance may sign with a key for that long after another retired it.
+func NewKeyRing(data db.SigningKeysClient, cipherKey []byte, retention time.Duration) *KeyRing {
+	return &KeyRing{
+		data:      data,
+		cipherKey: cipherKey,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+func GenerateSigningKey(now time.Time) (*SigningKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		Id:         hex.EncodeToString(id),
+		PrivateKey: priv,
+		PublicKey:  pub,
+		CreatedAt:  now,
+	}, nil
+}
+
+// Rotate promotes the pre-published key to active, retires the current one
+// and publishes a fresh next key. The first rotation fills both slots.
+func (k *KeyRing) Rotate(ctx context.Context) error {
+	return k.sync(ctx, 0)
+}
+
+// RotateIfDue rotates once the active key has been signing for interval,
+// whichever instance rotated it, and otherwise only reloads the ring. A ring
+// without keys is always rotated.
+func (k *KeyRing) RotateIfDue(ctx context.Context, interval time.Duration) error {
+	return k.sync(ctx, interval)
+}
+
+func (k *KeyRing) sync(ctx context.Context, interval time.Duration) error {
+	var stored []*db.SigningKey
+	err := k.data.UpdateSigningKeys(ctx, func(keys []*db.SigningKey) ([]*db.SigningKey, error) {
+		stored = keys
+		now := k.now()
+
+		var active, next *db.SigningKey
+		var retired []*db.SigningKey
+		for _, key := range keys {
+			switch {
+			case key.RetiredAt != nil:
+				retired = append(retired, key)
+			case key.ActivatedAt != nil:
+				active = key
+			case next == nil:
+				next = key
+			}
+		}
+		if active != nil && now.Sub(*active.ActivatedAt) < interval {
+			return nil, nil
+		}
+
+		if next == nil {
+			generated, err := k.generate(now)
+			if err != nil {
+				return nil, err
+			}
+			next = generated
+		}
+		upcoming, err := k.generate(now)
+		if err != nil {
+			return nil, err
+		}
+
+		if active != nil {
+			active.RetiredAt = &now
+			retired = append(retired, active)
+		}
+		next.ActivatedAt = &now
+
+		// Retired keys whose retention has expired are dropped.
+		stored = []*db.SigningKey{next, upcoming}
+		for _, key := range retired {
+			if now.Sub(*key.RetiredAt) < k.retention {
+				stored = append(stored, key)
+			}
+		}
+		return stored, nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return k.load(stored)
+}
+
+// generate seals a new key for storage.
+func (k *KeyRing) generate(now time.Time) (*db.SigningKey, error) {
+	key, err := GenerateSigningKey(now)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := seal(k.cipherKey, key.PrivateKey, key.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &db.SigningKey{
+		Id:                   key.Id,
+		PrivateKeyCiphertext: ciphertext,
+		PublicKey:            key.PublicKey,
+		CreatedAt:            now,
+	}, nil
+}
+
+// load replaces the ring's keys with the stored ones.
+func (k *KeyRing) load(stored []*db.SigningKey) error {
+	var active, next *SigningKey
+	var retired []*SigningKey
+	for _, s := range stored {
+		priv, err := open(k.cipherKey, s.PrivateKeyCiphertext, s.Id)
+		if err != nil {
+			return errors.Wrapf(err, "failed to decrypt signing key %s", s.Id)
+		}
+		key := &SigningKey{
+			Id:         s.Id,
+			PrivateKey: ed25519.PrivateKey(priv),
+			PublicKey:  ed25519.PublicKey(s.PublicKey),
+			CreatedAt:  s.CreatedAt,
+		}
+
+		switch {
+		case s.RetiredAt != nil:
+			key.RetiredAt = *s.RetiredAt
+			retired = append(retired, key)
+		case s.ActivatedAt != nil:
+			active = key
+		case next == nil:
+			next = key
+		}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.active, k.next, k.retired = active, next, retired
+	return nil
+}
+
+func (k *KeyRing) Active() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Get returns the key with the given kid if it may verify tokens.
+func (k *KeyRing) Get(kid string) (*SigningKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.active != nil && k.active.Id == kid {
+		return k.active, true
+	}
+	// Another instance may already be signing with it.
+	if k.next != nil && k.next.Id == kid {
+		return k.next, true
+	}
+	now := k.now()
+	for _, key := range k.retired {
+		if key.Id == kid && now.Sub(key.RetiredAt) < k.retention {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// JWKS lists the public half of every published key.
+func (k *KeyRing) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := []JWK{}
+	for _, key := range append([]*SigningKey{k.next, k.active}, k.retired...) {
+		if key == nil {
+			continue
+		}
+		keys = append(keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key.PublicKey),
+			Kid: key.Id,
+			Use: "sig",
+			Alg: "EdDSA",
+		})
+	}
+	return JWKS{Keys: keys}
+}
+
+// StartRotation rotates the ring every interval until the returned stop
+// function is called. It checks every KeySyncInterval, so keys another
+// instance rotated are picked up within that time.
+func (k *KeyRing) StartRotation(interval time.Duration) (stop func()) {
+	period := KeySyncInterval
+	if interval < period {
+		period = interval
+	}
+	ticker := time.NewTicker(period)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := k.RotateIfDue(context.Background(), interval); err != nil {
+					log.Errorf("failed to rotate signing keys: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
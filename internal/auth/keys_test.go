@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"db_practice/internal/db"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCipherKey = bytes.Repeat([]byte{1}, 32)
+
+// memoryKeys is a signing_keys table shared by the rings of one test.
+type memoryKeys struct {
+	keys []*db.SigningKey
+}
+
+func (m *memoryKeys) UpdateSigningKeys(ctx context.Context, update func(keys []*db.SigningKey) ([]*db.SigningKey, error)) error {
+	loaded := make([]*db.SigningKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		copied := *k
+		loaded = append(loaded, &copied)
+	}
+
+	updated, err := update(loaded)
+	if err != nil || updated == nil {
+		return err
+	}
+	m.keys = updated
+	return nil
+}
+
+func newTestKeyRing(t *testing.T, retention time.Duration) *KeyRing {
+	k := NewKeyRing(&memoryKeys{}, testCipherKey, retention)
+	require.NoError(t, k.Rotate(context.Background()))
+	return k
+}
+
+func TestKeyRingRotate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	k := NewKeyRing(&memoryKeys{}, testCipherKey, time.Hour)
+	k.now = func() time.Time { return now }
+
+	require.NoError(t, k.Rotate(ctx))
+	first := k.Active()
+	require.NotNil(t, first)
+	assert.Len(t, k.JWKS().Keys, 2, "active and next keys are published")
+
+	upcoming := k.next
+	require.NoError(t, k.Rotate(ctx))
+	assert.Equal(t, upcoming.Id, k.Active().Id, "the pre-published key becomes active")
+
+	_, ok := k.Get(first.Id)
+	assert.True(t, ok, "retired key still verifies within retention")
+	assert.Len(t, k.JWKS().Keys, 3)
+
+	now = now.Add(2 * time.Hour)
+	_, ok = k.Get(first.Id)
+	assert.False(t, ok, "retired key stops verifying after retention")
+
+	require.NoError(t, k.Rotate(ctx))
+	assert.Len(t, k.JWKS().Keys, 3, "expired keys are pruned on rotation")
+}
+
+func TestKeyRingShared(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &memoryKeys{}
+	a := NewKeyRing(store, testCipherKey, time.Hour)
+	a.now = func() time.Time { return now }
+	b := NewKeyRing(store, testCipherKey, time.Hour)
+	b.now = func() time.Time { return now }
+
+	require.NoError(t, a.RotateIfDue(ctx, 24*time.Hour))
+	first := a.Active()
+	require.NotNil(t, first)
+	for _, stored := range store.keys {
+		assert.False(t, bytes.Contains(stored.PrivateKeyCiphertext, first.PrivateKey), "private keys are stored encrypted")
+	}
+
+	require.NoError(t, b.RotateIfDue(ctx, 24*time.Hour))
+	assert.Equal(t, first.Id, b.Active().Id, "a restarted or second instance loads the keys instead of rotating")
+	assert.Equal(t, first.PrivateKey, b.Active().PrivateKey)
+
+	now = now.Add(25 * time.Hour)
+	require.NoError(t, b.RotateIfDue(ctx, 24*time.Hour))
+	second := b.Active()
+	assert.NotEqual(t, first.Id, second.Id, "the instance that finds the key due rotates it")
+
+	_, ok := a.Get(second.Id)
+	assert.True(t, ok, "the key another instance promoted verifies before the next sync")
+
+	require.NoError(t, a.RotateIfDue(ctx, 24*time.Hour))
+	assert.Equal(t, second.Id, a.Active().Id, "the other instance picks up the rotation without rotating again")
+
+	wrongKey := NewKeyRing(store, bytes.Repeat([]byte{2}, 32), time.Hour)
+	assert.Error(t, wrongKey.RotateIfDue(ctx, 24*time.Hour), "keys sealed with another cipher key fail to load")
+}
+
+func TestVerifyToken(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	k := NewKeyRing(&memoryKeys{}, testCipherKey, time.Hour)
+	k.now = func() time.Time { return now }
+	require.NoError(t, k.Rotate(context.Background()))
+
+	other := newTestKeyRing(t, time.Hour)
+
+	valid := &Claims{Issuer: "test", Subject: "12infioed", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+	expired := &Claims{Issuer: "test", Subject: "12infioed", IssuedAt: now.Unix(), ExpiresAt: now.Unix()}
+	wrongIssuer := &Claims{Issuer: "other", Subject: "12infioed", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+
+	testCases := []struct {
+		description string
+		key         *SigningKey
+		claims      *Claims
+		tamper      bool
+		expectedErr error
+	}{
+		{
+			description: "Success: Valid token",
+			key:         k.Active(),
+			claims:      valid,
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Expired token",
+			key:         k.Active(),
+			claims:      expired,
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Wrong issuer",
+			key:         k.Active(),
+			claims:      wrongIssuer,
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Unknown key",
+			key:         other.Active(),
+			claims:      valid,
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Tampered signature",
+			key:         k.Active(),
+			claims:      valid,
+			tamper:      true,
+			expectedErr: ErrInvalidToken,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			token, err := signToken(tc.key, tc.claims)
+			require.NoError(t, err)
+			if tc.tamper {
+				token = token[:len(token)-2] + "AA"
+			}
+
+			claims, err := verifyToken(k, token, "test", now)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.claims, claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import "context"
+
+type TestClient struct {
+	IssueTokensData *TokenPair
+	IssueTokensErr  error
+
+	RefreshData *TokenPair
+	RefreshErr  error
+
+	RevokeErr    error
+	RevokeAllErr error
+
+	ValidateAccessTokenData *Claims
+	ValidateAccessTokenErr  error
+
+	JWKSData JWKS
+}
+
+func (c TestClient) IssueTokens(ctx context.Context, userId string) (*TokenPair, error) {
+	return c.IssueTokensData, c.IssueTokensErr
+}
+
+func (c TestClient) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	return c.RefreshData, c.RefreshErr
+}
+
+func (c TestClient) Revoke(ctx context.Context, refreshToken string) error {
+	return c.RevokeErr
+}
+
+func (c TestClient) RevokeAll(ctx context.Context, userId string) error {
+	return c.RevokeAllErr
+}
+
+func (c TestClient) ValidateAccessToken(token string) (*Claims, error) {
+	return c.ValidateAccessTokenData, c.ValidateAccessTokenErr
+}
+
+func (c TestClient) JWKS() JWKS {
+	return c.JWKSData
+}
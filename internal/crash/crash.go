@@ -0,0 +1,69 @@
+package crash
+
+import (
+	"context"
+	"db_practice/internal/logging"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Report describes one recovered panic.
+type Report struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+}
+
+// Reporter forwards crashes somewhere they will be looked at. Implement it
+// to send reports to a crash reporting service.
+type Reporter interface {
+	Report(ctx context.Context, r *Report) error
+}
+
+// NopReporter drops every report; the panic is still logged.
+type NopReporter struct{}
+
+func (NopReporter) Report(ctx context.Context, r *Report) error {
+	return nil
+}
+
+// FileReporter writes each report to its own JSON file, for local runs.
+type FileReporter struct {
+	dir string
+}
+
+func NewFileReporter(dir string) (*FileReporter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &FileReporter{
+		dir: dir,
+	}, nil
+}
+
+func (f *FileReporter) Report(ctx context.Context, r *Report) error {
+	body, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	name := fmt.Sprintf("%s-%s.json", r.Time.UTC().Format("20060102T150405.000000000"), r.RequestID)
+	path := filepath.Join(f.dir, name)
+
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(log.Fields{"RequestId": r.RequestID, "Path": path}).Info("Crash report written to file")
+	return nil
+}
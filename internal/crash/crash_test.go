@@ -0,0 +1,40 @@
+package crash
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileReporter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "crashes")
+	f, err := NewFileReporter(dir)
+	require.NoError(t, err)
+
+	report := &Report{
+		Time:      time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		RequestID: "abc-123",
+		Method:    "GET",
+		Route:     "/users/{email}",
+		Panic:     "boom",
+		Stack:     "goroutine 1 [running]:",
+	}
+	require.NoError(t, f.Report(context.Background(), report))
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "20240101T120000.000000000-abc-123.json", files[0].Name())
+
+	contents, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	var written Report
+	require.NoError(t, json.Unmarshal(contents, &written))
+	assert.Equal(t, *report, written)
+}
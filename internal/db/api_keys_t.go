@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Table "public.api_keys"
+// Column       |           Type           | Collation | Nullable | Default
+// -------------+--------------------------+-----------+----------+---------
+// id           | character varying(32)    |           | not null |
+// name         | character varying(100)   |           | not null |
+// prefix       | character varying(20)    |           | not null |
+// key_hash     | character varying(64)    |           | not null |
+// scopes       | text[]                   |           | not null |
+// expires_at   | timestamp with time zone |           |          |
+// last_used_at | timestamp with time zone |           |          |
+// created_at   | timestamp with time zone |           | not null | now()
+// revoked_at   | timestamp with time zone |           |          |
+// Indexes:
+//
+//	"api_keys_pkey" PRIMARY KEY, btree (id)
+//	"api_keys_prefix_key" UNIQUE CONSTRAINT, btree (prefix)
+
+type ApiKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at`
+
+func (db *DB) CreateApiKey(ctx context.Context, k *ApiKey) (err error) {
+	defer db.observe("CreateApiKey", time.Now())
+
+	query := `
+		INSERT INTO api_keys (id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at;`
+	ctx, span := startSpan(ctx, "CreateApiKey", query)
+	defer func() { endSpan(span, err) }()
+
+	return db.Conn.QueryRowContext(ctx, query, k.Id, k.Name, k.Prefix, k.KeyHash, pq.Array(k.Scopes), k.ExpiresAt).Scan(&k.CreatedAt)
+}
+
+func (db *DB) GetApiKeyByPrefix(ctx context.Context, prefix string) (_ *ApiKey, err error) {
+	defer db.observe("GetApiKeyByPrefix", time.Now())
+
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE prefix = $1
+  `
+	ctx, span := startSpan(ctx, "GetApiKeyByPrefix", query)
+	defer func() { endSpan(span, err) }()
+
+	k, err := scanApiKey(db.Conn.QueryRowContext(ctx, query, prefix))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (db *DB) ListApiKeys(ctx context.Context) (_ []*ApiKey, err error) {
+	defer db.observe("ListApiKeys", time.Now())
+
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		ORDER BY created_at
+  `
+	ctx, span := startSpan(ctx, "ListApiKeys", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := db.Conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*ApiKey{}
+	for rows.Next() {
+		k, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+func (db *DB) RevokeApiKey(ctx context.Context, id string) (err error) {
+	defer db.observe("RevokeApiKey", time.Now())
+
+	query := `
+		UPDATE api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "RevokeApiKey", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *DB) TouchApiKey(ctx context.Context, id string, usedAt time.Time) (err error) {
+	defer db.observe("TouchApiKey", time.Now())
+
+	query := `
+		UPDATE api_keys
+		SET last_used_at = $2
+		WHERE id = $1
+  `
+	ctx, span := startSpan(ctx, "TouchApiKey", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = db.Conn.ExecContext(ctx, query, id, usedAt)
+	return err
+}
+
+func scanApiKey(row rowScanner) (*ApiKey, error) {
+	var k ApiKey
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&k.Id, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Scopes), &expiresAt, &lastUsedAt, &k.CreatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+
+	return &k, nil
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testApiKey = &ApiKey{
+	Id:      "key-1",
+	Name:    "billing-service",
+	Prefix:  "dbp_1a2b3c4d",
+	KeyHash: "hash-1",
+	Scopes:  []string{"users:read"},
+}
+
+func TestGetApiKeyByPrefix(t *testing.T) {
+	testCases := []struct {
+		description string
+		prefix      string
+		expectedErr error
+	}{
+		{
+			description: "Success: Key found",
+			prefix:      testApiKey.Prefix,
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: No key found",
+			prefix:      "dbp_00000000",
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			require.NoError(t, db.CreateApiKey(context.Background(), testApiKey))
+
+			key, err := db.GetApiKeyByPrefix(context.Background(), tc.prefix)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, testApiKey.Name, key.Name)
+				assert.Equal(t, testApiKey.Scopes, key.Scopes)
+				assert.Nil(t, key.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestRevokeApiKey(t *testing.T) {
+	testCases := []struct {
+		description string
+		id          string
+		expectedErr error
+	}{
+		{
+			description: "Success: Key revoked",
+			id:          testApiKey.Id,
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: No key found",
+			id:          "key-2",
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			require.NoError(t, db.CreateApiKey(context.Background(), testApiKey))
+
+			err = db.RevokeApiKey(context.Background(), tc.id)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
@@ -1,23 +1,118 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"db_practice/internal/tracing"
+	"time"
 
 	"github.com/DATA-DOG/go-txdb"
 	_ "github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Client interface {
-	CreateUser(firstName, lastName, email, address, city, state, zip, dob string) (*User, error)
-	GetUserByEmail(email string) (*User, error)
-	GetUserById(id string) (*User, error)
+	CreateUser(ctx context.Context, firstName, lastName, email, address, city, state, zip, dob string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserById(ctx context.Context, id string) (*User, error)
+	GetUsersByIds(ctx context.Context, ids []string) ([]*User, error)
+	GetUsersByEmails(ctx context.Context, emails []string) ([]*User, error)
+	ListUsers(ctx context.Context, afterId string, limit int) ([]*User, error)
+	UpdateUser(ctx context.Context, u *User) (*User, error)
+	DeleteUser(ctx context.Context, id string) error
+	SetUserPasswordHash(ctx context.Context, id, hash string) error
+	GetUserPasswordHash(ctx context.Context, id string) (string, error)
+}
+
+type TokensClient interface {
+	CreateRefreshToken(ctx context.Context, t *RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	MarkRefreshTokenUsed(ctx context.Context, id string) (bool, error)
+	RevokeRefreshToken(ctx context.Context, id string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyId string) error
+	RevokeUserRefreshTokens(ctx context.Context, userId string) error
+}
+
+type SessionsClient interface {
+	CreateSession(ctx context.Context, s *Session) error
+	GetSessionByHash(ctx context.Context, hash string) (*Session, error)
+	TouchSession(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error
+	ListUserSessions(ctx context.Context, userId string) ([]*Session, error)
+	RevokeSession(ctx context.Context, userId, id string) error
+	RevokeUserSessions(ctx context.Context, userId string) error
+}
+
+type VerificationClient interface {
+	GetUserById(ctx context.Context, id string) (*User, error)
+	MarkUserEmailVerified(ctx context.Context, id, email string) error
+	CreateEmailVerificationToken(ctx context.Context, t *EmailVerificationToken) error
+	ConsumeEmailVerificationToken(ctx context.Context, id string) (*EmailVerificationToken, error)
+}
+
+type PasswordResetClient interface {
+	CreatePasswordResetToken(ctx context.Context, t *PasswordResetToken) error
+	ConsumePasswordResetToken(ctx context.Context, hash string) (*PasswordResetToken, error)
+	InvalidatePasswordResetTokens(ctx context.Context, userId string) error
+}
+
+type MfaClient interface {
+	UpsertUserMfa(ctx context.Context, userId string, ciphertext []byte) error
+	GetUserMfa(ctx context.Context, userId string) (*UserMfa, error)
+	EnableUserMfa(ctx context.Context, userId string, codeHashes []string) error
+	DeleteUserMfa(ctx context.Context, userId string) error
+	AdvanceMfaStep(ctx context.Context, userId string, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userId, codeHash string) error
+}
+
+type RbacClient interface {
+	GetUserRoles(ctx context.Context, userId string) ([]string, error)
+	GetRolePermissions(ctx context.Context, roles []string) ([]*Permission, error)
+	CreateAuthzDecisions(ctx context.Context, ds []*AuthzDecision) error
+}
+
+type ApiKeysClient interface {
+	CreateApiKey(ctx context.Context, k *ApiKey) error
+	GetApiKeyByPrefix(ctx context.Context, prefix string) (*ApiKey, error)
+	ListApiKeys(ctx context.Context) ([]*ApiKey, error)
+	RevokeApiKey(ctx context.Context, id string) error
+	TouchApiKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+type RateLimitClient interface {
+	UpdateRateLimitBucket(ctx context.Context, key string, update func(b *RateLimitBucket)) error
+	DeleteExpiredRateLimitBuckets(ctx context.Context, now time.Time) (int64, error)
+}
+
+type SigningKeysClient interface {
+	UpdateSigningKeys(ctx context.Context, update func(keys []*SigningKey) ([]*SigningKey, error)) error
+}
+
+type HealthClient interface {
+	PingContext(ctx context.Context) error
+	AppliedMigrations(ctx context.Context) ([]string, error)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// QueryObserver is told how long each query method took. Query is the
+// method name, e.g. "CreateUser", which keeps metric labels bounded.
+type QueryObserver interface {
+	ObserveQuery(query string, d time.Duration)
 }
 
 type DB struct {
-	Conn  *sql.DB
-	TxDB  bool   // Flag to indicate whether to use txdb (only use for testing)
-	TxDrv string // Unique name for txdb registration
+	Conn     *sql.DB
+	TxDB     bool          // Flag to indicate whether to use txdb (only use for testing)
+	TxDrv    string        // Unique name for txdb registration
+	Observer QueryObserver // Optional, receives per-query latency
 }
 
 func NewDB(connStr string, useTxDB bool, TxDrv string) (*DB, error) {
@@ -40,7 +135,7 @@ func NewDB(connStr string, useTxDB bool, TxDrv string) (*DB, error) {
 		return nil, err
 	}
 
-	fmt.Println("Connected to the database")
+	log.Info("Connected to the database")
 	return &DB{
 		Conn:  db,
 		TxDB:  useTxDB,
@@ -48,7 +143,59 @@ func NewDB(connStr string, useTxDB bool, TxDrv string) (*DB, error) {
 	}, nil
 }
 
+// observe times a query method. Use as the method's first statement:
+//
+//	defer db.observe("CreateUser", time.Now())
+func (db *DB) observe(query string, start time.Time) {
+	if db.Observer != nil {
+		db.Observer.ObserveQuery(query, time.Since(start))
+	}
+}
+
+var tracer = otel.Tracer("db_practice/internal/db")
+
+// startSpan opens a span for a query method. With a query the span also
+// carries the sanitized statement; methods that run several statements pass
+// "" and each statement gets a child span of its own.
+func startSpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("db.system", "postgresql")}
+	if query != "" {
+		attrs = append(attrs,
+			attribute.String("db.operation", tracing.Operation(query)),
+			attribute.String("db.statement", tracing.SanitizeSQL(query)),
+		)
+	}
+	return tracer.Start(ctx, "db."+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, marking it failed for any error but sql.ErrNoRows,
+// which callers treat as a result rather than a failure.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// execTx runs one statement of a method that runs several, in a child span
+// named after the method and the statement.
+func execTx(ctx context.Context, tx *sql.Tx, name, query string, args ...interface{}) (_ sql.Result, err error) {
+	ctx, span := startSpan(ctx, name, query)
+	defer func() { endSpan(span, err) }()
+
+	return tx.ExecContext(ctx, query, args...)
+}
+
+// scanTx is execTx for a statement returning one row, scanned into dest.
+func scanTx(ctx context.Context, tx *sql.Tx, name, query string, args []interface{}, dest ...interface{}) (err error) {
+	ctx, span := startSpan(ctx, name, query)
+	defer func() { endSpan(span, err) }()
+
+	return tx.QueryRowContext(ctx, query, args...).Scan(dest...)
+}
+
 func (db *DB) Close() {
 	db.Conn.Close()
-	fmt.Println("Closed the database connection")
+	log.Info("Closed the database connection")
 }
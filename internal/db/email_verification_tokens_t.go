@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Table "public.email_verification_tokens"
+// Column     |           Type           | Collation | Nullable | Default
+// -----------+--------------------------+-----------+----------+---------
+// id         | character varying(32)    |           | not null |
+// user_id    | character varying(10)    |           | not null |
+// email      | character varying(100)   |           | not null |
+// expires_at | timestamp with time zone |           | not null |
+// created_at | timestamp with time zone |           | not null | now()
+// used_at    | timestamp with time zone |           |          |
+// Indexes:
+//
+//	"email_verification_tokens_pkey" PRIMARY KEY, btree (id)
+//	"email_verification_tokens_user_id_idx" btree (user_id)
+
+type EmailVerificationToken struct {
+	Id        string
+	UserId    string
+	Email     string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+func (db *DB) CreateEmailVerificationToken(ctx context.Context, t *EmailVerificationToken) (err error) {
+	defer db.observe("CreateEmailVerificationToken", time.Now())
+
+	query := `
+		INSERT INTO email_verification_tokens (id, user_id, email, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at;`
+	ctx, span := startSpan(ctx, "CreateEmailVerificationToken", query)
+	defer func() { endSpan(span, err) }()
+
+	return db.Conn.QueryRowContext(ctx, query, t.Id, t.UserId, t.Email, t.ExpiresAt).Scan(&t.CreatedAt)
+}
+
+// ConsumeEmailVerificationToken marks the token used and returns it. It
+// returns sql.ErrNoRows when the token is unknown or was already used.
+func (db *DB) ConsumeEmailVerificationToken(ctx context.Context, id string) (_ *EmailVerificationToken, err error) {
+	defer db.observe("ConsumeEmailVerificationToken", time.Now())
+
+	query := `
+		UPDATE email_verification_tokens
+		SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL
+		RETURNING id, user_id, email, expires_at, created_at, used_at
+  `
+	ctx, span := startSpan(ctx, "ConsumeEmailVerificationToken", query)
+	defer func() { endSpan(span, err) }()
+
+	var t EmailVerificationToken
+	var usedAt time.Time
+	err = db.Conn.QueryRowContext(ctx, query, id).Scan(&t.Id, &t.UserId, &t.Email, &t.ExpiresAt, &t.CreatedAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+
+		return nil, err
+	}
+	t.UsedAt = &usedAt
+
+	return &t, nil
+}
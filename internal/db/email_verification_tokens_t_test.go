@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumeEmailVerificationToken(t *testing.T) {
+	testCases := []struct {
+		description  string
+		id           string
+		consumeTwice bool
+		expectedErr  error
+	}{
+		{
+			description: "Success: Token consumed",
+			id:          "token-1",
+			expectedErr: nil,
+		},
+		{
+			description:  "Failure: Token already used",
+			id:           "token-1",
+			consumeTwice: true,
+			expectedErr:  sql.ErrNoRows,
+		},
+		{
+			description: "Failure: No token found",
+			id:          "token-2",
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.CreateEmailVerificationToken(context.Background(), &EmailVerificationToken{
+				Id:        "token-1",
+				UserId:    testUserEli.Id,
+				Email:     testUserEli.Email,
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			require.NoError(t, err)
+
+			if tc.consumeTwice {
+				_, err = db.ConsumeEmailVerificationToken(context.Background(), tc.id)
+				require.NoError(t, err)
+			}
+
+			token, err := db.ConsumeEmailVerificationToken(context.Background(), tc.id)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, testUserEli.Email, token.Email)
+				assert.NotNil(t, token.UsedAt)
+			}
+		})
+	}
+}
+
+func TestMarkUserEmailVerified(t *testing.T) {
+	testCases := []struct {
+		description string
+		email       string
+		expectedErr error
+	}{
+		{
+			description: "Success: User activated",
+			email:       testUserEli.Email,
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Email changed since token was issued",
+			email:       "old@mail.com",
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			user, err := db.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			require.NoError(t, err)
+			assert.Equal(t, UserStatusPending, user.Status)
+
+			err = db.MarkUserEmailVerified(context.Background(), user.Id, tc.email)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				found, err := db.GetUserById(context.Background(), user.Id)
+				require.NoError(t, err)
+				assert.Equal(t, UserStatusActive, found.Status)
+				assert.NotNil(t, found.EmailVerifiedAt)
+			}
+		})
+	}
+}
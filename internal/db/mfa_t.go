@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/logging"
+	"time"
+)
+
+// Table "public.user_mfa"
+// Column            |           Type           | Collation | Nullable | Default
+// ------------------+--------------------------+-----------+----------+---------
+// user_id           | character varying(10)    |           | not null |
+// secret_ciphertext | bytea                    |           | not null |
+// enabled_at        | timestamp with time zone |           |          |
+// last_used_step    | bigint                   |           | not null | 0
+// created_at        | timestamp with time zone |           | not null | now()
+// Indexes:
+//
+//	"user_mfa_pkey" PRIMARY KEY, btree (user_id)
+//
+// Table "public.mfa_recovery_codes"
+// Column     |           Type           | Collation | Nullable | Default
+// -----------+--------------------------+-----------+----------+------------------------------------------------
+// id         | integer                  |           | not null | nextval('mfa_recovery_codes_id_seq'::regclass)
+// user_id    | character varying(10)    |           | not null |
+// code_hash  | character varying(64)    |           | not null |
+// created_at | timestamp with time zone |           | not null | now()
+// used_at    | timestamp with time zone |           |          |
+// Indexes:
+//
+//	"mfa_recovery_codes_pkey" PRIMARY KEY, btree (id)
+//	"mfa_recovery_codes_user_id_idx" btree (user_id)
+
+type UserMfa struct {
+	UserId           string
+	SecretCiphertext []byte
+	EnabledAt        *time.Time
+	LastUsedStep     int64
+	CreatedAt        time.Time
+}
+
+// UpsertUserMfa stores a new, not yet enabled, secret for the user. It does
+// not replace a secret that is already enabled and returns sql.ErrNoRows
+// instead.
+func (db *DB) UpsertUserMfa(ctx context.Context, userId string, ciphertext []byte) (err error) {
+	defer db.observe("UpsertUserMfa", time.Now())
+
+	query := `
+		INSERT INTO user_mfa (user_id, secret_ciphertext)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_ciphertext = EXCLUDED.secret_ciphertext, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.enabled_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "UpsertUserMfa", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, userId, ciphertext)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *DB) GetUserMfa(ctx context.Context, userId string) (_ *UserMfa, err error) {
+	defer db.observe("GetUserMfa", time.Now())
+
+	query := `
+		SELECT user_id, secret_ciphertext, enabled_at, last_used_step, created_at
+		FROM user_mfa
+		WHERE user_id = $1
+  `
+	ctx, span := startSpan(ctx, "GetUserMfa", query)
+	defer func() { endSpan(span, err) }()
+
+	var m UserMfa
+	var enabledAt sql.NullTime
+	err = db.Conn.QueryRowContext(ctx, query, userId).Scan(&m.UserId, &m.SecretCiphertext, &enabledAt, &m.LastUsedStep, &m.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+
+		return nil, err
+	}
+	if enabledAt.Valid {
+		m.EnabledAt = &enabledAt.Time
+	}
+
+	return &m, nil
+}
+
+// EnableUserMfa turns MFA on and stores the user's recovery code hashes in
+// one transaction.
+func (db *DB) EnableUserMfa(ctx context.Context, userId string, codeHashes []string) (err error) {
+	defer db.observe("EnableUserMfa", time.Now())
+	ctx, span := startSpan(ctx, "EnableUserMfa", "")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("failed to begin transaction: %v", err)
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != sql.ErrTxDone && err != nil {
+			logging.FromContext(ctx).Errorf("failed to rollback transaction: %v", err)
+		}
+	}()
+
+	res, err := execTx(ctx, tx, "EnableUserMfa.enable", `UPDATE user_mfa SET enabled_at = NOW() WHERE user_id = $1 AND enabled_at IS NULL`, userId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := replaceRecoveryCodesTx(ctx, tx, userId, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(ctx).Errorf("failed to commit transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteUserMfa turns MFA off and drops the user's recovery codes.
+func (db *DB) DeleteUserMfa(ctx context.Context, userId string) (err error) {
+	defer db.observe("DeleteUserMfa", time.Now())
+	ctx, span := startSpan(ctx, "DeleteUserMfa", "")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("failed to begin transaction: %v", err)
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != sql.ErrTxDone && err != nil {
+			logging.FromContext(ctx).Errorf("failed to rollback transaction: %v", err)
+		}
+	}()
+
+	if _, err := execTx(ctx, tx, "DeleteUserMfa.codes", `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+	if _, err := execTx(ctx, tx, "DeleteUserMfa.secret", `DELETE FROM user_mfa WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(ctx).Errorf("failed to commit transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+// AdvanceMfaStep records the time step of an accepted code. It returns false
+// when a code from that step or a later one was already used, so each code
+// is accepted once.
+func (db *DB) AdvanceMfaStep(ctx context.Context, userId string, step int64) (_ bool, err error) {
+	defer db.observe("AdvanceMfaStep", time.Now())
+
+	query := `
+		UPDATE user_mfa
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2
+  `
+	ctx, span := startSpan(ctx, "AdvanceMfaStep", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, userId, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+func (db *DB) ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string) (err error) {
+	defer db.observe("ReplaceRecoveryCodes", time.Now())
+	ctx, span := startSpan(ctx, "ReplaceRecoveryCodes", "")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("failed to begin transaction: %v", err)
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != sql.ErrTxDone && err != nil {
+			logging.FromContext(ctx).Errorf("failed to rollback transaction: %v", err)
+		}
+	}()
+
+	if err := replaceRecoveryCodesTx(ctx, tx, userId, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(ctx).Errorf("failed to commit transaction: %v", err)
+		return err
+	}
+	return nil
+}
+
+func replaceRecoveryCodesTx(ctx context.Context, tx *sql.Tx, userId string, codeHashes []string) error {
+	if _, err := execTx(ctx, tx, "replaceRecoveryCodes.delete", `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := execTx(ctx, tx, "replaceRecoveryCodes.insert", `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userId, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks a matching unused code used. It returns
+// sql.ErrNoRows when no such code exists.
+func (db *DB) UseRecoveryCode(ctx context.Context, userId, codeHash string) (err error) {
+	defer db.observe("UseRecoveryCode", time.Now())
+
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "UseRecoveryCode", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, userId, codeHash)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
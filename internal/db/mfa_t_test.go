@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableUserMfa(t *testing.T) {
+	testCases := []struct {
+		description string
+		enableTwice bool
+		expectedErr error
+	}{
+		{
+			description: "Success: MFA enabled with recovery codes",
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Already enabled",
+			enableTwice: true,
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			require.NoError(t, db.UpsertUserMfa(context.Background(), testUserEli.Id, []byte("ciphertext")))
+
+			if tc.enableTwice {
+				require.NoError(t, db.EnableUserMfa(context.Background(), testUserEli.Id, []string{"hash-1"}))
+			}
+
+			err = db.EnableUserMfa(context.Background(), testUserEli.Id, []string{"hash-1", "hash-2"})
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+
+			m, err := db.GetUserMfa(context.Background(), testUserEli.Id)
+			require.NoError(t, err)
+			assert.NotNil(t, m.EnabledAt)
+			assert.Equal(t, []byte("ciphertext"), m.SecretCiphertext)
+
+			// An enabled secret cannot be replaced by a new enrollment.
+			assert.Equal(t, sql.ErrNoRows, db.UpsertUserMfa(context.Background(), testUserEli.Id, []byte("other")))
+		})
+	}
+}
+
+func TestAdvanceMfaStep(t *testing.T) {
+	db, err := NewDB(connStr, true, t.Name())
+	// Use txdb for testing
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.UpsertUserMfa(context.Background(), testUserEli.Id, []byte("ciphertext")))
+
+	ok, err := db.AdvanceMfaStep(context.Background(), testUserEli.Id, 100)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = db.AdvanceMfaStep(context.Background(), testUserEli.Id, 100)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	testCases := []struct {
+		description string
+		hash        string
+		useTwice    bool
+		expectedErr error
+	}{
+		{
+			description: "Success: Code used",
+			hash:        "hash-1",
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Code already used",
+			hash:        "hash-1",
+			useTwice:    true,
+			expectedErr: sql.ErrNoRows,
+		},
+		{
+			description: "Failure: Unknown code",
+			hash:        "hash-3",
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			require.NoError(t, db.ReplaceRecoveryCodes(context.Background(), testUserEli.Id, []string{"hash-1", "hash-2"}))
+
+			if tc.useTwice {
+				require.NoError(t, db.UseRecoveryCode(context.Background(), testUserEli.Id, tc.hash))
+			}
+
+			err = db.UseRecoveryCode(context.Background(), testUserEli.Id, tc.hash)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Table "public.password_reset_tokens"
+// Column     |           Type           | Collation | Nullable | Default
+// -----------+--------------------------+-----------+----------+---------
+// id         | character varying(32)    |           | not null |
+// user_id    | character varying(10)    |           | not null |
+// token_hash | character varying(64)    |           | not null |
+// request_ip | character varying(45)    |           |          |
+// expires_at | timestamp with time zone |           | not null |
+// created_at | timestamp with time zone |           | not null | now()
+// used_at    | timestamp with time zone |           |          |
+// Indexes:
+//
+//	"password_reset_tokens_pkey" PRIMARY KEY, btree (id)
+//	"password_reset_tokens_token_hash_key" UNIQUE CONSTRAINT, btree (token_hash)
+//	"password_reset_tokens_user_id_idx" btree (user_id)
+
+type PasswordResetToken struct {
+	Id        string
+	UserId    string
+	TokenHash string
+	RequestIP string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+func (db *DB) CreatePasswordResetToken(ctx context.Context, t *PasswordResetToken) (err error) {
+	defer db.observe("CreatePasswordResetToken", time.Now())
+
+	query := `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, request_ip, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+		RETURNING created_at;`
+	ctx, span := startSpan(ctx, "CreatePasswordResetToken", query)
+	defer func() { endSpan(span, err) }()
+
+	return db.Conn.QueryRowContext(ctx, query, t.Id, t.UserId, t.TokenHash, t.RequestIP, t.ExpiresAt).Scan(&t.CreatedAt)
+}
+
+// ConsumePasswordResetToken marks the token used and returns it. It returns
+// sql.ErrNoRows when the token is unknown or was already used.
+func (db *DB) ConsumePasswordResetToken(ctx context.Context, hash string) (_ *PasswordResetToken, err error) {
+	defer db.observe("ConsumePasswordResetToken", time.Now())
+
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL
+		RETURNING id, user_id, token_hash, COALESCE(request_ip, ''), expires_at, created_at, used_at
+  `
+	ctx, span := startSpan(ctx, "ConsumePasswordResetToken", query)
+	defer func() { endSpan(span, err) }()
+
+	var t PasswordResetToken
+	var usedAt time.Time
+	err = db.Conn.QueryRowContext(ctx, query, hash).Scan(&t.Id, &t.UserId, &t.TokenHash, &t.RequestIP, &t.ExpiresAt, &t.CreatedAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+
+		return nil, err
+	}
+	t.UsedAt = &usedAt
+
+	return &t, nil
+}
+
+// InvalidatePasswordResetTokens marks every outstanding token for the user
+// used, so older reset emails stop working once a reset completes.
+func (db *DB) InvalidatePasswordResetTokens(ctx context.Context, userId string) (err error) {
+	defer db.observe("InvalidatePasswordResetTokens", time.Now())
+
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "InvalidatePasswordResetTokens", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = db.Conn.ExecContext(ctx, query, userId)
+	return err
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumePasswordResetToken(t *testing.T) {
+	testCases := []struct {
+		description  string
+		hash         string
+		consumeTwice bool
+		invalidate   bool
+		expectedErr  error
+	}{
+		{
+			description: "Success: Token consumed",
+			hash:        "hash-1",
+			expectedErr: nil,
+		},
+		{
+			description:  "Failure: Token already used",
+			hash:         "hash-1",
+			consumeTwice: true,
+			expectedErr:  sql.ErrNoRows,
+		},
+		{
+			description: "Failure: Token invalidated",
+			hash:        "hash-1",
+			invalidate:  true,
+			expectedErr: sql.ErrNoRows,
+		},
+		{
+			description: "Failure: No token found",
+			hash:        "hash-2",
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.CreatePasswordResetToken(context.Background(), &PasswordResetToken{
+				Id:        "token-1",
+				UserId:    testUserEli.Id,
+				TokenHash: "hash-1",
+				RequestIP: "127.0.0.1",
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			require.NoError(t, err)
+
+			if tc.consumeTwice {
+				_, err = db.ConsumePasswordResetToken(context.Background(), tc.hash)
+				require.NoError(t, err)
+			}
+			if tc.invalidate {
+				require.NoError(t, db.InvalidatePasswordResetTokens(context.Background(), testUserEli.Id))
+			}
+
+			token, err := db.ConsumePasswordResetToken(context.Background(), tc.hash)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, testUserEli.Id, token.UserId)
+				assert.Equal(t, "127.0.0.1", token.RequestIP)
+				assert.NotNil(t, token.UsedAt)
+			}
+		})
+	}
+}
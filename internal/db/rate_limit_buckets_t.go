@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Table "public.rate_limit_buckets"
+// Column     |           Type           | Collation | Nullable | Default
+// -----------+--------------------------+-----------+----------+---------
+// key        | character varying(255)   |           | not null |
+// tokens     | double precision         |           | not null |
+// updated_at | timestamp with time zone |           | not null |
+// expires_at | timestamp with time zone |           | not null |
+// Indexes:
+//
+//	"rate_limit_buckets_pkey" PRIMARY KEY, btree (key)
+//	"rate_limit_buckets_expires_at_idx" btree (expires_at)
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+	// ExpiresAt is when the bucket will be full again, after which the row
+	// carries no information and may be pruned.
+	ExpiresAt time.Time
+}
+
+// UpdateRateLimitBucket loads key's bucket under a row lock, lets update
+// change it and saves the result, so concurrent instances never spend the
+// same token. A new bucket is passed to update with only Key set.
+func (db *DB) UpdateRateLimitBucket(ctx context.Context, key string, update func(b *RateLimitBucket)) (err error) {
+	defer db.observe("UpdateRateLimitBucket", time.Now())
+	ctx, span := startSpan(ctx, "UpdateRateLimitBucket", "")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Inserting a placeholder first means a concurrent first request for
+	// the same key waits on this row instead of creating its own.
+	query := `
+		INSERT INTO rate_limit_buckets (key, tokens, updated_at, expires_at)
+		VALUES ($1, 0, NOW(), NOW())
+		ON CONFLICT (key) DO NOTHING
+  `
+	res, err := execTx(ctx, tx, "UpdateRateLimitBucket.insert", query, key)
+	if err != nil {
+		return err
+	}
+	created, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	b := &RateLimitBucket{Key: key}
+	if created == 0 {
+		query = `
+			SELECT tokens, updated_at, expires_at
+			FROM rate_limit_buckets
+			WHERE key = $1
+			FOR UPDATE
+    `
+		if err := scanTx(ctx, tx, "UpdateRateLimitBucket.lock", query, []interface{}{key}, &b.Tokens, &b.UpdatedAt, &b.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	update(b)
+
+	query = `
+		UPDATE rate_limit_buckets
+		SET tokens = $2, updated_at = $3, expires_at = $4
+		WHERE key = $1
+  `
+	if _, err := execTx(ctx, tx, "UpdateRateLimitBucket.update", query, b.Key, b.Tokens, b.UpdatedAt, b.ExpiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpiredRateLimitBuckets removes buckets that were full again
+// before now.
+func (db *DB) DeleteExpiredRateLimitBuckets(ctx context.Context, now time.Time) (_ int64, err error) {
+	defer db.observe("DeleteExpiredRateLimitBuckets", time.Now())
+
+	query := `
+		DELETE FROM rate_limit_buckets
+		WHERE expires_at < $1
+  `
+	ctx, span := startSpan(ctx, "DeleteExpiredRateLimitBuckets", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateRateLimitBucket(t *testing.T) {
+	db, err := NewDB(connStr, true, t.Name())
+	// Use txdb for testing
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	var seen RateLimitBucket
+	err = db.UpdateRateLimitBucket(ctx, "users.get|ip:127.0.0.1", func(b *RateLimitBucket) {
+		seen = *b
+		b.Tokens = 4
+		b.UpdatedAt = now
+		b.ExpiresAt = now.Add(time.Minute)
+	})
+	require.NoError(t, err)
+	// A new bucket only has its key.
+	assert.Equal(t, RateLimitBucket{Key: "users.get|ip:127.0.0.1"}, seen)
+
+	err = db.UpdateRateLimitBucket(ctx, "users.get|ip:127.0.0.1", func(b *RateLimitBucket) {
+		seen = *b
+		b.Tokens--
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 4.0, seen.Tokens)
+	assert.True(t, now.Equal(seen.UpdatedAt))
+	assert.True(t, now.Add(time.Minute).Equal(seen.ExpiresAt))
+
+	err = db.UpdateRateLimitBucket(ctx, "users.get|ip:127.0.0.1", func(b *RateLimitBucket) {
+		seen = *b
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, seen.Tokens)
+}
+
+func TestDeleteExpiredRateLimitBuckets(t *testing.T) {
+	testCases := []struct {
+		description string
+		now         time.Time
+		expected    int64
+	}{
+		{
+			description: "Success: Full buckets deleted",
+			now:         time.Now().Add(2 * time.Hour),
+			expected:    2,
+		},
+		{
+			description: "Success: Refilling buckets kept",
+			now:         time.Now().Add(30 * time.Minute),
+			expected:    1,
+		},
+		{
+			description: "Success: Nothing expired",
+			now:         time.Now(),
+			expected:    0,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			ctx := context.Background()
+			for key, reset := range map[string]time.Duration{"a": time.Minute, "b": time.Hour} {
+				err := db.UpdateRateLimitBucket(ctx, key, func(b *RateLimitBucket) {
+					b.UpdatedAt = time.Now()
+					b.ExpiresAt = time.Now().Add(reset)
+				})
+				require.NoError(t, err)
+			}
+
+			deleted, err := db.DeleteExpiredRateLimitBuckets(ctx, tc.now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, deleted)
+		})
+	}
+}
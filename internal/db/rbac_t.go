@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Table "public.role_permissions"
+// Column |         Type          | Collation | Nullable | Default
+// -------+-----------------------+-----------+----------+---------
+// role   | character varying(50) |           | not null |
+// action | character varying(50) |           | not null |
+// scope  | character varying(10) |           | not null |
+// Indexes:
+//
+//	"role_permissions_pkey" PRIMARY KEY, btree (role, action, scope)
+//
+// Table "public.user_roles"
+// Column  |         Type          | Collation | Nullable | Default
+// --------+-----------------------+-----------+----------+---------
+// user_id | character varying(10) |           | not null |
+// role    | character varying(50) |           | not null |
+// Indexes:
+//
+//	"user_roles_pkey" PRIMARY KEY, btree (user_id, role)
+//
+// Table "public.authz_decisions"
+// Column     |           Type           | Collation | Nullable | Default
+// -----------+--------------------------+-----------+----------+---------
+// id         | bigint                   |           | not null | nextval(...)
+// subject    | character varying(50)    |           | not null |
+// action     | character varying(50)    |           | not null |
+// resource   | character varying(100)   |           | not null |
+// allowed    | boolean                  |           | not null |
+// reason     | character varying(255)   |           | not null |
+// decided_at | timestamp with time zone |           | not null | now()
+
+type Permission struct {
+	Role   string
+	Action string
+	Scope  string
+}
+
+type AuthzDecision struct {
+	Subject  string
+	Action   string
+	Resource string
+	Allowed  bool
+	Reason   string
+}
+
+func (db *DB) GetUserRoles(ctx context.Context, userId string) (_ []string, err error) {
+	defer db.observe("GetUserRoles", time.Now())
+
+	query := `
+		SELECT role
+		FROM user_roles
+		WHERE user_id = $1
+		ORDER BY role
+  `
+	ctx, span := startSpan(ctx, "GetUserRoles", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := db.Conn.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (db *DB) GetRolePermissions(ctx context.Context, roles []string) (_ []*Permission, err error) {
+	defer db.observe("GetRolePermissions", time.Now())
+
+	query := `
+		SELECT role, action, scope
+		FROM role_permissions
+		WHERE role = ANY($1)
+		ORDER BY role, action, scope
+  `
+	ctx, span := startSpan(ctx, "GetRolePermissions", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := db.Conn.QueryContext(ctx, query, pq.Array(roles))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	perms := []*Permission{}
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.Role, &p.Action, &p.Scope); err != nil {
+			return nil, err
+		}
+		perms = append(perms, &p)
+	}
+
+	return perms, rows.Err()
+}
+
+// CreateAuthzDecisions records decisions in one statement.
+func (db *DB) CreateAuthzDecisions(ctx context.Context, ds []*AuthzDecision) (err error) {
+	defer db.observe("CreateAuthzDecisions", time.Now())
+
+	query := `
+		INSERT INTO authz_decisions (subject, action, resource, allowed, reason)
+		SELECT * FROM UNNEST($1::varchar[], $2::varchar[], $3::varchar[], $4::boolean[], $5::varchar[])
+  `
+	ctx, span := startSpan(ctx, "CreateAuthzDecisions", query)
+	defer func() { endSpan(span, err) }()
+
+	subjects := make([]string, len(ds))
+	actions := make([]string, len(ds))
+	resources := make([]string, len(ds))
+	allowed := make([]bool, len(ds))
+	reasons := make([]string, len(ds))
+	for i, d := range ds {
+		subjects[i], actions[i], resources[i], allowed[i], reasons[i] = d.Subject, d.Action, d.Resource, d.Allowed, d.Reason
+	}
+
+	_, err = db.Conn.ExecContext(ctx, query, pq.Array(subjects), pq.Array(actions), pq.Array(resources), pq.Array(allowed), pq.Array(reasons))
+	return err
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRolePermissions(t *testing.T) {
+	testCases := []struct {
+		description    string
+		roles          []string
+		expectedOutput []*Permission
+	}{
+		{
+			description: "Success: Seeded user permissions",
+			roles:       []string{"user"},
+			expectedOutput: []*Permission{
+				{Role: "user", Action: "users:read", Scope: "own"},
+				{Role: "user", Action: "users:update", Scope: "own"},
+			},
+		},
+		{
+			description: "Success: Seeded support permissions",
+			roles:       []string{"support"},
+			expectedOutput: []*Permission{
+				{Role: "support", Action: "users:read", Scope: "any"},
+			},
+		},
+		{
+			description:    "Success: Unknown role",
+			roles:          []string{"nobody"},
+			expectedOutput: []*Permission{},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			perms, err := db.GetRolePermissions(context.Background(), tc.roles)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedOutput, perms)
+		})
+	}
+}
+
+func TestGetUserRoles(t *testing.T) {
+	db, err := NewDB(connStr, true, t.Name())
+	// Use txdb for testing
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Conn.Exec(`INSERT INTO user_roles (user_id, role) VALUES ($1, 'support'), ($1, 'admin')`, testUserEli.Id)
+	require.NoError(t, err)
+
+	roles, err := db.GetUserRoles(context.Background(), testUserEli.Id)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin", "support"}, roles)
+
+	roles, err = db.GetUserRoles(context.Background(), testUserEli2.Id)
+	require.NoError(t, err)
+	assert.Empty(t, roles)
+}
+
+func TestCreateAuthzDecisions(t *testing.T) {
+	db, err := NewDB(connStr, true, t.Name())
+	// Use txdb for testing
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.CreateAuthzDecisions(context.Background(), []*AuthzDecision{
+		{
+			Subject:  "user:" + testUserEli.Id,
+			Action:   "users:delete",
+			Resource: "users/" + testUserEli2.Id,
+			Allowed:  false,
+			Reason:   "no matching permission",
+		},
+		{
+			Subject:  "user:" + testUserEli.Id,
+			Action:   "users:read",
+			Resource: "users/" + testUserEli.Id,
+			Allowed:  true,
+			Reason:   "granted by role user on own resource",
+		},
+	})
+	require.NoError(t, err)
+
+	var count int
+	require.NoError(t, db.Conn.QueryRow(`SELECT COUNT(*) FROM authz_decisions WHERE subject = $1`, "user:"+testUserEli.Id).Scan(&count))
+	assert.Equal(t, 2, count)
+}
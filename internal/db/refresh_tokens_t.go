@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Table "public.refresh_tokens"
+// Column     |           Type           | Collation | Nullable | Default
+// -----------+--------------------------+-----------+----------+---------
+// id         | character varying(32)    |           | not null |
+// family_id  | character varying(32)    |           | not null |
+// user_id    | character varying(10)    |           | not null |
+// token_hash | character varying(64)    |           | not null |
+// expires_at | timestamp with time zone |           | not null |
+// created_at | timestamp with time zone |           | not null | now()
+// used_at    | timestamp with time zone |           |          |
+// revoked_at | timestamp with time zone |           |          |
+// Indexes:
+//
+//	"refresh_tokens_pkey" PRIMARY KEY, btree (id)
+//	"refresh_tokens_token_hash_key" UNIQUE CONSTRAINT, btree (token_hash)
+//	"refresh_tokens_family_id_idx" btree (family_id)
+//	"refresh_tokens_user_id_idx" btree (user_id)
+
+type RefreshToken struct {
+	Id        string
+	FamilyId  string
+	UserId    string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+	RevokedAt *time.Time
+}
+
+func (db *DB) CreateRefreshToken(ctx context.Context, t *RefreshToken) (err error) {
+	defer db.observe("CreateRefreshToken", time.Now())
+
+	query := `
+		INSERT INTO refresh_tokens (id, family_id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at;`
+	ctx, span := startSpan(ctx, "CreateRefreshToken", query)
+	defer func() { endSpan(span, err) }()
+
+	return db.Conn.QueryRowContext(ctx, query, t.Id, t.FamilyId, t.UserId, t.TokenHash, t.ExpiresAt).Scan(&t.CreatedAt)
+}
+
+func (db *DB) GetRefreshTokenByHash(ctx context.Context, hash string) (_ *RefreshToken, err error) {
+	defer db.observe("GetRefreshTokenByHash", time.Now())
+
+	query := `
+		SELECT id, family_id, user_id, token_hash, expires_at, created_at, used_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+  `
+	ctx, span := startSpan(ctx, "GetRefreshTokenByHash", query)
+	defer func() { endSpan(span, err) }()
+
+	var t RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err = db.Conn.QueryRowContext(ctx, query, hash).Scan(&t.Id, &t.FamilyId, &t.UserId, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &usedAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+
+		return nil, err
+	}
+
+	if usedAt.Valid {
+		t.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+
+	return &t, nil
+}
+
+// MarkRefreshTokenUsed flags a token as consumed. It reports false when the
+// token had already been used, which callers treat as reuse.
+func (db *DB) MarkRefreshTokenUsed(ctx context.Context, id string) (_ bool, err error) {
+	defer db.observe("MarkRefreshTokenUsed", time.Now())
+
+	query := `
+		UPDATE refresh_tokens
+		SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "MarkRefreshTokenUsed", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (db *DB) RevokeRefreshToken(ctx context.Context, id string) (err error) {
+	defer db.observe("RevokeRefreshToken", time.Now())
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "RevokeRefreshToken", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = db.Conn.ExecContext(ctx, query, id)
+	return err
+}
+
+func (db *DB) RevokeRefreshTokenFamily(ctx context.Context, familyId string) (err error) {
+	defer db.observe("RevokeRefreshTokenFamily", time.Now())
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "RevokeRefreshTokenFamily", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = db.Conn.ExecContext(ctx, query, familyId)
+	return err
+}
+
+func (db *DB) RevokeUserRefreshTokens(ctx context.Context, userId string) (err error) {
+	defer db.observe("RevokeUserRefreshTokens", time.Now())
+
+	query := `
+		UPDATE refresh_tokens
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "RevokeUserRefreshTokens", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = db.Conn.ExecContext(ctx, query, userId)
+	return err
+}
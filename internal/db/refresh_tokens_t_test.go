@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRefreshToken(id, familyId, hash string) *RefreshToken {
+	return &RefreshToken{
+		Id:        id,
+		FamilyId:  familyId,
+		UserId:    testUserEli.Id,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+func TestGetRefreshTokenByHash(t *testing.T) {
+	testCases := []struct {
+		description string
+		hash        string
+		expectedErr error
+	}{
+		{
+			description: "Success: Token found",
+			hash:        "hash-1",
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: No token found",
+			hash:        "hash-2",
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.CreateRefreshToken(context.Background(), newTestRefreshToken("token-1", "family-1", "hash-1"))
+			require.NoError(t, err)
+
+			token, err := db.GetRefreshTokenByHash(context.Background(), tc.hash)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "token-1", token.Id)
+				assert.Equal(t, "family-1", token.FamilyId)
+				assert.Nil(t, token.UsedAt)
+				assert.Nil(t, token.RevokedAt)
+			}
+		})
+	}
+}
+
+func TestMarkRefreshTokenUsed(t *testing.T) {
+	testCases := []struct {
+		description  string
+		markTwice    bool
+		expectedData bool
+	}{
+		{
+			description:  "Success: Token marked used",
+			markTwice:    false,
+			expectedData: true,
+		},
+		{
+			description:  "Failure: Token already used",
+			markTwice:    true,
+			expectedData: false,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.CreateRefreshToken(context.Background(), newTestRefreshToken("token-1", "family-1", "hash-1"))
+			require.NoError(t, err)
+
+			if tc.markTwice {
+				_, err = db.MarkRefreshTokenUsed(context.Background(), "token-1")
+				require.NoError(t, err)
+			}
+
+			ok, err := db.MarkRefreshTokenUsed(context.Background(), "token-1")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedData, ok)
+		})
+	}
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	db, err := NewDB(connStr, true, t.Name())
+	// Use txdb for testing
+	require.NoError(t, err)
+	defer db.Close()
+
+	require.NoError(t, db.CreateRefreshToken(context.Background(), newTestRefreshToken("token-1", "family-1", "hash-1")))
+	require.NoError(t, db.CreateRefreshToken(context.Background(), newTestRefreshToken("token-2", "family-1", "hash-2")))
+	require.NoError(t, db.CreateRefreshToken(context.Background(), newTestRefreshToken("token-3", "family-2", "hash-3")))
+
+	require.NoError(t, db.RevokeRefreshTokenFamily(context.Background(), "family-1"))
+
+	for hash, revoked := range map[string]bool{"hash-1": true, "hash-2": true, "hash-3": false} {
+		token, err := db.GetRefreshTokenByHash(context.Background(), hash)
+		require.NoError(t, err)
+		assert.Equal(t, revoked, token.RevokedAt != nil, hash)
+	}
+}
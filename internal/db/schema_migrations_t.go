@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Table "public.schema_migrations"
+// Column     |           Type           | Collation | Nullable | Default
+// -----------+--------------------------+-----------+----------+---------
+// version    | character varying(255)   |           | not null |
+// applied_at | timestamp with time zone |           | not null | now()
+// Indexes:
+//
+//	"schema_migrations_pkey" PRIMARY KEY, btree (version)
+
+func (db *DB) PingContext(ctx context.Context) error {
+	return db.Conn.PingContext(ctx)
+}
+
+func (db *DB) AppliedMigrations(ctx context.Context) ([]string, error) {
+	defer db.observe("AppliedMigrations", time.Now())
+
+	query := `
+		SELECT version
+		FROM schema_migrations
+		ORDER BY version
+  `
+
+	rows, err := db.Conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// ApplyMigrations runs, in order, the versions not yet recorded in
+// schema_migrations, reading each one's statements from statements, and
+// records them. Everything runs in one transaction, under a lock that makes
+// concurrent runs wait, so a failing migration leaves the schema as it was.
+// It returns the versions it applied.
+func (db *DB) ApplyMigrations(ctx context.Context, versions []string, statements func(version string) (string, error)) (applied []string, err error) {
+	defer db.observe("ApplyMigrations", time.Now())
+	ctx, span := startSpan(ctx, "ApplyMigrations", "")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := execTx(ctx, tx, "ApplyMigrations.lock", `SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))`); err != nil {
+		return nil, err
+	}
+
+	recorded, err := recordedMigrations(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied = []string{}
+	for _, v := range versions {
+		if recorded[v] {
+			continue
+		}
+		query, err := statements(v)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := execTx(ctx, tx, "ApplyMigrations."+v, query); err != nil {
+			return nil, err
+		}
+		// create_schema_migrations_table records the versions before it.
+		query = `
+			INSERT INTO schema_migrations (version)
+			VALUES ($1)
+			ON CONFLICT (version) DO NOTHING
+  `
+		if _, err := execTx(ctx, tx, "ApplyMigrations.record", query, v); err != nil {
+			return nil, err
+		}
+		applied = append(applied, v)
+	}
+
+	return applied, tx.Commit()
+}
+
+// recordedMigrations reads schema_migrations, which is empty before its own
+// migration has created it.
+func recordedMigrations(ctx context.Context, tx *sql.Tx) (_ map[string]bool, err error) {
+	var exists bool
+	query := `SELECT to_regclass('schema_migrations') IS NOT NULL`
+	if err := scanTx(ctx, tx, "ApplyMigrations.exists", query, nil, &exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return map[string]bool{}, nil
+	}
+
+	query = `
+		SELECT version
+		FROM schema_migrations
+  `
+	ctx, span := startSpan(ctx, "ApplyMigrations.recorded", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recorded := map[string]bool{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		recorded[v] = true
+	}
+	return recorded, rows.Err()
+}
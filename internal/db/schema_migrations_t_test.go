@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppliedMigrations(t *testing.T) {
+	testCases := []struct {
+		description string
+		version     string
+	}{
+		{
+			description: "Success: Backfilled migration listed",
+			version:     "create_users_table",
+		},
+		{
+			description: "Success: Newly recorded migration listed",
+			version:     "zz_test_migration",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			require.NoError(t, db.PingContext(context.Background()))
+
+			_, err = db.Conn.Exec(`INSERT INTO schema_migrations (version) VALUES ($1) ON CONFLICT DO NOTHING`, tc.version)
+			require.NoError(t, err)
+
+			versions, err := db.AppliedMigrations(context.Background())
+			require.NoError(t, err)
+			assert.Contains(t, versions, tc.version)
+		})
+	}
+}
+
+func TestApplyMigrations(t *testing.T) {
+	db, err := NewDB(connStr, true, t.Name())
+	// Use txdb for testing
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	statements := map[string]string{
+		// Recorded already, so never run.
+		"create_users_table": `NOT SQL`,
+		"zz_test_migration":  `CREATE TABLE zz_test_migration (id INT)`,
+	}
+	read := func(version string) (string, error) {
+		return statements[version], nil
+	}
+
+	applied, err := db.ApplyMigrations(ctx, []string{"create_users_table", "zz_test_migration"}, read)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zz_test_migration"}, applied)
+
+	versions, err := db.AppliedMigrations(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, versions, "zz_test_migration")
+
+	// Nothing is left to apply on a second run.
+	applied, err = db.ApplyMigrations(ctx, []string{"create_users_table", "zz_test_migration"}, read)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
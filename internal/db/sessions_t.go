@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Table "public.sessions"
+// Column       |           Type           | Collation | Nullable | Default
+// -------------+--------------------------+-----------+----------+---------
+// id           | character varying(32)    |           | not null |
+// user_id      | character varying(10)    |           | not null |
+// token_hash   | character varying(64)    |           | not null |
+// user_agent   | character varying(255)   |           |          |
+// ip           | character varying(45)    |           |          |
+// created_at   | timestamp with time zone |           | not null | now()
+// last_seen_at | timestamp with time zone |           | not null | now()
+// expires_at   | timestamp with time zone |           | not null |
+// revoked_at   | timestamp with time zone |           |          |
+// Indexes:
+//
+//	"sessions_pkey" PRIMARY KEY, btree (id)
+//	"sessions_token_hash_key" UNIQUE CONSTRAINT, btree (token_hash)
+//	"sessions_user_id_idx" btree (user_id)
+
+type Session struct {
+	Id         string
+	UserId     string
+	TokenHash  string
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  *time.Time
+}
+
+const sessionColumns = `id, user_id, token_hash, COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, last_seen_at, expires_at, revoked_at`
+
+func (db *DB) CreateSession(ctx context.Context, s *Session) (err error) {
+	defer db.observe("CreateSession", time.Now())
+
+	query := `
+		INSERT INTO sessions (id, user_id, token_hash, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $6, $7);`
+	ctx, span := startSpan(ctx, "CreateSession", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = db.Conn.ExecContext(ctx, query, s.Id, s.UserId, s.TokenHash, s.UserAgent, s.IP, s.CreatedAt, s.ExpiresAt)
+	return err
+}
+
+func (db *DB) GetSessionByHash(ctx context.Context, hash string) (_ *Session, err error) {
+	defer db.observe("GetSessionByHash", time.Now())
+
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE token_hash = $1
+  `
+	ctx, span := startSpan(ctx, "GetSessionByHash", query)
+	defer func() { endSpan(span, err) }()
+
+	return scanSession(db.Conn.QueryRowContext(ctx, query, hash))
+}
+
+// TouchSession records activity and slides the session's expiry.
+func (db *DB) TouchSession(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) (err error) {
+	defer db.observe("TouchSession", time.Now())
+
+	query := `
+		UPDATE sessions
+		SET last_seen_at = $2, expires_at = $3
+		WHERE id = $1 AND revoked_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "TouchSession", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = db.Conn.ExecContext(ctx, query, id, lastSeenAt, expiresAt)
+	return err
+}
+
+// ListUserSessions returns the user's live sessions, most recently used
+// first.
+func (db *DB) ListUserSessions(ctx context.Context, userId string) (_ []*Session, err error) {
+	defer db.observe("ListUserSessions", time.Now())
+
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+  `
+	ctx, span := startSpan(ctx, "ListUserSessions", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := db.Conn.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession ends one of the user's sessions. It returns sql.ErrNoRows
+// when the user has no live session with that id.
+func (db *DB) RevokeSession(ctx context.Context, userId, id string) (err error) {
+	defer db.observe("RevokeSession", time.Now())
+
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "RevokeSession", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, id, userId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (db *DB) RevokeUserSessions(ctx context.Context, userId string) (err error) {
+	defer db.observe("RevokeUserSessions", time.Now())
+
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+  `
+	ctx, span := startSpan(ctx, "RevokeUserSessions", query)
+	defer func() { endSpan(span, err) }()
+
+	_, err = db.Conn.ExecContext(ctx, query, userId)
+	return err
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	var s Session
+	var revokedAt sql.NullTime
+	err := row.Scan(&s.Id, &s.UserId, &s.TokenHash, &s.UserAgent, &s.IP, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &revokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+
+		return nil, err
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+
+	return &s, nil
+}
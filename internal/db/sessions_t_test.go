@@ -0,0 +1,77 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokeSession(t *testing.T) {
+	testCases := []struct {
+		description string
+		userId      string
+		id          string
+		expectedErr error
+	}{
+		{
+			description: "Success: Own session revoked",
+			userId:      testUserEli.Id,
+			id:          "session-1",
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Another user's session",
+			userId:      "otheruser",
+			id:          "session-1",
+			expectedErr: sql.ErrNoRows,
+		},
+		{
+			description: "Failure: No session found",
+			userId:      testUserEli.Id,
+			id:          "session-2",
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			now := time.Now()
+			err = db.CreateSession(context.Background(), &Session{
+				Id:        "session-1",
+				UserId:    testUserEli.Id,
+				TokenHash: "hash-1",
+				UserAgent: "Mozilla/5.0",
+				CreatedAt: now,
+				ExpiresAt: now.Add(time.Hour),
+			})
+			require.NoError(t, err)
+
+			err = db.RevokeSession(context.Background(), tc.userId, tc.id)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+
+			s, err := db.GetSessionByHash(context.Background(), "hash-1")
+			require.NoError(t, err)
+			assert.NotNil(t, s.RevokedAt)
+
+			sessions, err := db.ListUserSessions(context.Background(), testUserEli.Id)
+			require.NoError(t, err)
+			assert.Empty(t, sessions)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Table "public.signing_keys"
+// Column                 |           Type           | Collation | Nullable | Default
+// -----------------------+--------------------------+-----------+----------+---------
+// id                     | character varying(16)    |           | not null |
+// private_key_ciphertext | bytea                    |           | not null |
+// public_key             | bytea                    |           | not null |
+// created_at             | timestamp with time zone |           | not null | now()
+// activated_at           | timestamp with time zone |           |          |
+// retired_at             | timestamp with time zone |           |          |
+// Indexes:
+//
+//	"signing_keys_pkey" PRIMARY KEY, btree (id)
+
+// SigningKey is a stored access token signing key. It is published until
+// ActivatedAt, signs until RetiredAt and verifies until it is deleted.
+type SigningKey struct {
+	Id                   string
+	PrivateKeyCiphertext []byte
+	PublicKey            []byte
+	CreatedAt            time.Time
+	ActivatedAt          *time.Time
+	RetiredAt            *time.Time
+}
+
+const signingKeyColumns = `id, private_key_ciphertext, public_key, created_at, activated_at, retired_at`
+
+// UpdateSigningKeys loads every stored key under a table lock, lets update
+// change the set and saves the result, so instances sharing the table never
+// rotate at the same time. Keys update leaves out are deleted; only their
+// ActivatedAt and RetiredAt change for the ones it keeps. update returns nil
+// to leave the table as it is.
+func (db *DB) UpdateSigningKeys(ctx context.Context, update func(keys []*SigningKey) ([]*SigningKey, error)) (err error) {
+	defer db.observe("UpdateSigningKeys", time.Now())
+	ctx, span := startSpan(ctx, "UpdateSigningKeys", "")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Readers keep going; only another instance's update waits.
+	if _, err := execTx(ctx, tx, "UpdateSigningKeys.lock", `LOCK TABLE signing_keys IN EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	keys, err := listSigningKeys(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	updated, err := update(keys)
+	if err != nil || updated == nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO signing_keys (` + signingKeyColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE
+		SET activated_at = EXCLUDED.activated_at, retired_at = EXCLUDED.retired_at
+  `
+	ids := make([]string, 0, len(updated))
+	for _, k := range updated {
+		if _, err := execTx(ctx, tx, "UpdateSigningKeys.save", query, k.Id, k.PrivateKeyCiphertext, k.PublicKey, k.CreatedAt, k.ActivatedAt, k.RetiredAt); err != nil {
+			return err
+		}
+		ids = append(ids, k.Id)
+	}
+
+	query = `
+		DELETE FROM signing_keys
+		WHERE NOT (id = ANY($1))
+  `
+	if _, err := execTx(ctx, tx, "UpdateSigningKeys.delete", query, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func listSigningKeys(ctx context.Context, tx *sql.Tx) (_ []*SigningKey, err error) {
+	query := `
+		SELECT ` + signingKeyColumns + `
+		FROM signing_keys
+		ORDER BY created_at
+  `
+	ctx, span := startSpan(ctx, "UpdateSigningKeys.list", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*SigningKey{}
+	for rows.Next() {
+		var k SigningKey
+		var activatedAt, retiredAt sql.NullTime
+		if err := rows.Scan(&k.Id, &k.PrivateKeyCiphertext, &k.PublicKey, &k.CreatedAt, &activatedAt, &retiredAt); err != nil {
+			return nil, err
+		}
+		if activatedAt.Valid {
+			k.ActivatedAt = &activatedAt.Time
+		}
+		if retiredAt.Valid {
+			k.RetiredAt = &retiredAt.Time
+		}
+		keys = append(keys, &k)
+	}
+
+	return keys, rows.Err()
+}
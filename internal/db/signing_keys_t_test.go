@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateSigningKeys(t *testing.T) {
+	db, err := NewDB(connStr, true, t.Name())
+	// Use txdb for testing
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	first := &SigningKey{Id: "0000000000000001", PrivateKeyCiphertext: []byte("sealed-1"), PublicKey: []byte("public-1"), CreatedAt: now, ActivatedAt: &now}
+	second := &SigningKey{Id: "0000000000000002", PrivateKeyCiphertext: []byte("sealed-2"), PublicKey: []byte("public-2"), CreatedAt: now.Add(time.Second)}
+
+	var seen []*SigningKey
+	err = db.UpdateSigningKeys(ctx, func(keys []*SigningKey) ([]*SigningKey, error) {
+		seen = keys
+		return []*SigningKey{first, second}, nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, seen)
+
+	// Nil leaves the table as it is.
+	err = db.UpdateSigningKeys(ctx, func(keys []*SigningKey) ([]*SigningKey, error) {
+		seen = keys
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, seen, 2)
+	assert.Equal(t, first.Id, seen[0].Id)
+	assert.Equal(t, []byte("sealed-1"), seen[0].PrivateKeyCiphertext)
+	assert.True(t, now.Equal(*seen[0].ActivatedAt))
+	assert.Nil(t, seen[0].RetiredAt)
+	assert.Nil(t, seen[1].ActivatedAt)
+
+	// Keys left out are deleted.
+	err = db.UpdateSigningKeys(ctx, func(keys []*SigningKey) ([]*SigningKey, error) {
+		keys[1].ActivatedAt = &now
+		return keys[1:], nil
+	})
+	require.NoError(t, err)
+
+	err = db.UpdateSigningKeys(ctx, func(keys []*SigningKey) ([]*SigningKey, error) {
+		seen = keys
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, seen, 1)
+	assert.Equal(t, second.Id, seen[0].Id)
+	assert.True(t, now.Equal(*seen[0].ActivatedAt))
+}
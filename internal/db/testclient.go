@@ -1,5 +1,10 @@
 package db
 
+import (
+	"context"
+	"time"
+)
+
 type TestClient struct {
 	CreateUserData *User
 	CreateUserErr  error
@@ -9,16 +14,317 @@ type TestClient struct {
 
 	GetUserByIdData *User
 	GetUserByIdErr  error
+
+	GetUsersByIdsData []*User
+	GetUsersByIdsErr  error
+
+	GetUsersByEmailsData []*User
+	GetUsersByEmailsErr  error
+
+	ListUsersData []*User
+	ListUsersErr  error
+
+	UpdateUserData *User
+	UpdateUserErr  error
+
+	DeleteUserErr error
+
+	SetUserPasswordHashErr error
+
+	GetUserPasswordHashData string
+	GetUserPasswordHashErr  error
+
+	CreateRefreshTokenErr error
+
+	GetRefreshTokenByHashData *RefreshToken
+	GetRefreshTokenByHashErr  error
+
+	MarkRefreshTokenUsedData bool
+	MarkRefreshTokenUsedErr  error
+
+	RevokeRefreshTokenErr       error
+	RevokeRefreshTokenFamilyErr error
+	RevokeUserRefreshTokensErr  error
+
+	CreateApiKeyErr error
+
+	GetApiKeyByPrefixData *ApiKey
+	GetApiKeyByPrefixErr  error
+
+	ListApiKeysData []*ApiKey
+	ListApiKeysErr  error
+
+	RevokeApiKeyErr error
+	TouchApiKeyErr  error
+
+	GetUserRolesData []string
+	GetUserRolesErr  error
+
+	GetRolePermissionsData []*Permission
+	GetRolePermissionsErr  error
+
+	CreateAuthzDecisionsErr error
+
+	MarkUserEmailVerifiedErr error
+
+	CreateEmailVerificationTokenErr error
+
+	ConsumeEmailVerificationTokenData *EmailVerificationToken
+	ConsumeEmailVerificationTokenErr  error
+
+	CreatePasswordResetTokenErr error
+
+	ConsumePasswordResetTokenData *PasswordResetToken
+	ConsumePasswordResetTokenErr  error
+
+	InvalidatePasswordResetTokensErr error
+
+	UpsertUserMfaErr error
+
+	GetUserMfaData *UserMfa
+	GetUserMfaErr  error
+
+	EnableUserMfaErr error
+	DeleteUserMfaErr error
+
+	AdvanceMfaStepData bool
+	AdvanceMfaStepErr  error
+
+	ReplaceRecoveryCodesErr error
+	UseRecoveryCodeErr      error
+
+	CreateSessionErr error
+
+	GetSessionByHashData *Session
+	GetSessionByHashErr  error
+
+	TouchSessionErr error
+
+	ListUserSessionsData []*Session
+	ListUserSessionsErr  error
+
+	RevokeSessionErr      error
+	RevokeUserSessionsErr error
+
+	UpdateRateLimitBucketData *RateLimitBucket
+	UpdateRateLimitBucketErr  error
+
+	DeleteExpiredRateLimitBucketsData int64
+	DeleteExpiredRateLimitBucketsErr  error
+
+	UpdateSigningKeysData []*SigningKey
+	UpdateSigningKeysErr  error
+
+	PingContextErr error
+
+	AppliedMigrationsData []string
+	AppliedMigrationsErr  error
 }
 
-func (c TestClient) CreateUser(firstName, lastName, email, address, city, state, zip, dob string) (*User, error) {
+func (c TestClient) CreateUser(ctx context.Context, firstName, lastName, email, address, city, state, zip, dob string) (*User, error) {
 	return c.CreateUserData, c.CreateUserErr
 }
 
-func (c TestClient) GetUserByEmail(email string) (*User, error) {
+func (c TestClient) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	return c.GetUserByEmailData, c.GetUserByEmailErr
 }
 
-func (c TestClient) GetUserById(id string) (*User, error) {
+func (c TestClient) GetUserById(ctx context.Context, id string) (*User, error) {
 	return c.GetUserByIdData, c.GetUserByIdErr
 }
+
+func (c TestClient) GetUsersByIds(ctx context.Context, ids []string) ([]*User, error) {
+	return c.GetUsersByIdsData, c.GetUsersByIdsErr
+}
+
+func (c TestClient) GetUsersByEmails(ctx context.Context, emails []string) ([]*User, error) {
+	return c.GetUsersByEmailsData, c.GetUsersByEmailsErr
+}
+
+func (c TestClient) ListUsers(ctx context.Context, afterId string, limit int) ([]*User, error) {
+	return c.ListUsersData, c.ListUsersErr
+}
+
+func (c TestClient) UpdateUser(ctx context.Context, u *User) (*User, error) {
+	return c.UpdateUserData, c.UpdateUserErr
+}
+
+func (c TestClient) DeleteUser(ctx context.Context, id string) error {
+	return c.DeleteUserErr
+}
+
+func (c TestClient) SetUserPasswordHash(ctx context.Context, id, hash string) error {
+	return c.SetUserPasswordHashErr
+}
+
+func (c TestClient) GetUserPasswordHash(ctx context.Context, id string) (string, error) {
+	return c.GetUserPasswordHashData, c.GetUserPasswordHashErr
+}
+
+func (c TestClient) CreateRefreshToken(ctx context.Context, t *RefreshToken) error {
+	return c.CreateRefreshTokenErr
+}
+
+func (c TestClient) GetRefreshTokenByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	return c.GetRefreshTokenByHashData, c.GetRefreshTokenByHashErr
+}
+
+func (c TestClient) MarkRefreshTokenUsed(ctx context.Context, id string) (bool, error) {
+	return c.MarkRefreshTokenUsedData, c.MarkRefreshTokenUsedErr
+}
+
+func (c TestClient) RevokeRefreshToken(ctx context.Context, id string) error {
+	return c.RevokeRefreshTokenErr
+}
+
+func (c TestClient) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	return c.RevokeRefreshTokenFamilyErr
+}
+
+func (c TestClient) RevokeUserRefreshTokens(ctx context.Context, userId string) error {
+	return c.RevokeUserRefreshTokensErr
+}
+
+func (c TestClient) CreateApiKey(ctx context.Context, k *ApiKey) error {
+	return c.CreateApiKeyErr
+}
+
+func (c TestClient) GetApiKeyByPrefix(ctx context.Context, prefix string) (*ApiKey, error) {
+	return c.GetApiKeyByPrefixData, c.GetApiKeyByPrefixErr
+}
+
+func (c TestClient) ListApiKeys(ctx context.Context) ([]*ApiKey, error) {
+	return c.ListApiKeysData, c.ListApiKeysErr
+}
+
+func (c TestClient) RevokeApiKey(ctx context.Context, id string) error {
+	return c.RevokeApiKeyErr
+}
+
+func (c TestClient) TouchApiKey(ctx context.Context, id string, usedAt time.Time) error {
+	return c.TouchApiKeyErr
+}
+
+func (c TestClient) GetUserRoles(ctx context.Context, userId string) ([]string, error) {
+	return c.GetUserRolesData, c.GetUserRolesErr
+}
+
+func (c TestClient) GetRolePermissions(ctx context.Context, roles []string) ([]*Permission, error) {
+	return c.GetRolePermissionsData, c.GetRolePermissionsErr
+}
+
+func (c TestClient) CreateAuthzDecisions(ctx context.Context, ds []*AuthzDecision) error {
+	return c.CreateAuthzDecisionsErr
+}
+
+func (c TestClient) MarkUserEmailVerified(ctx context.Context, id, email string) error {
+	return c.MarkUserEmailVerifiedErr
+}
+
+func (c TestClient) CreateEmailVerificationToken(ctx context.Context, t *EmailVerificationToken) error {
+	return c.CreateEmailVerificationTokenErr
+}
+
+func (c TestClient) ConsumeEmailVerificationToken(ctx context.Context, id string) (*EmailVerificationToken, error) {
+	return c.ConsumeEmailVerificationTokenData, c.ConsumeEmailVerificationTokenErr
+}
+
+func (c TestClient) CreatePasswordResetToken(ctx context.Context, t *PasswordResetToken) error {
+	return c.CreatePasswordResetTokenErr
+}
+
+func (c TestClient) ConsumePasswordResetToken(ctx context.Context, hash string) (*PasswordResetToken, error) {
+	return c.ConsumePasswordResetTokenData, c.ConsumePasswordResetTokenErr
+}
+
+func (c TestClient) InvalidatePasswordResetTokens(ctx context.Context, userId string) error {
+	return c.InvalidatePasswordResetTokensErr
+}
+
+func (c TestClient) UpsertUserMfa(ctx context.Context, userId string, ciphertext []byte) error {
+	return c.UpsertUserMfaErr
+}
+
+func (c TestClient) GetUserMfa(ctx context.Context, userId string) (*UserMfa, error) {
+	return c.GetUserMfaData, c.GetUserMfaErr
+}
+
+func (c TestClient) EnableUserMfa(ctx context.Context, userId string, codeHashes []string) error {
+	return c.EnableUserMfaErr
+}
+
+func (c TestClient) DeleteUserMfa(ctx context.Context, userId string) error {
+	return c.DeleteUserMfaErr
+}
+
+func (c TestClient) AdvanceMfaStep(ctx context.Context, userId string, step int64) (bool, error) {
+	return c.AdvanceMfaStepData, c.AdvanceMfaStepErr
+}
+
+func (c TestClient) ReplaceRecoveryCodes(ctx context.Context, userId string, codeHashes []string) error {
+	return c.ReplaceRecoveryCodesErr
+}
+
+func (c TestClient) UseRecoveryCode(ctx context.Context, userId, codeHash string) error {
+	return c.UseRecoveryCodeErr
+}
+
+func (c TestClient) CreateSession(ctx context.Context, s *Session) error {
+	return c.CreateSessionErr
+}
+
+func (c TestClient) GetSessionByHash(ctx context.Context, hash string) (*Session, error) {
+	return c.GetSessionByHashData, c.GetSessionByHashErr
+}
+
+func (c TestClient) TouchSession(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error {
+	return c.TouchSessionErr
+}
+
+func (c TestClient) ListUserSessions(ctx context.Context, userId string) ([]*Session, error) {
+	return c.ListUserSessionsData, c.ListUserSessionsErr
+}
+
+func (c TestClient) RevokeSession(ctx context.Context, userId, id string) error {
+	return c.RevokeSessionErr
+}
+
+func (c TestClient) RevokeUserSessions(ctx context.Context, userId string) error {
+	return c.RevokeUserSessionsErr
+}
+
+func (c TestClient) PingContext(ctx context.Context) error {
+	return c.PingContextErr
+}
+
+func (c TestClient) AppliedMigrations(ctx context.Context) ([]string, error) {
+	return c.AppliedMigrationsData, c.AppliedMigrationsErr
+}
+
+// UpdateRateLimitBucket passes a copy of UpdateRateLimitBucketData, or a new
+// bucket, to update.
+func (c TestClient) UpdateRateLimitBucket(ctx context.Context, key string, update func(b *RateLimitBucket)) error {
+	if c.UpdateRateLimitBucketErr != nil {
+		return c.UpdateRateLimitBucketErr
+	}
+	b := &RateLimitBucket{Key: key}
+	if c.UpdateRateLimitBucketData != nil {
+		*b = *c.UpdateRateLimitBucketData
+	}
+	update(b)
+	return nil
+}
+
+func (c TestClient) DeleteExpiredRateLimitBuckets(ctx context.Context, now time.Time) (int64, error) {
+	return c.DeleteExpiredRateLimitBucketsData, c.DeleteExpiredRateLimitBucketsErr
+}
+
+// UpdateSigningKeys passes UpdateSigningKeysData to update and discards the
+// result.
+func (c TestClient) UpdateSigningKeys(ctx context.Context, update func(keys []*SigningKey) ([]*SigningKey, error)) error {
+	if c.UpdateSigningKeysErr != nil {
+		return c.UpdateSigningKeysErr
+	}
+	_, err := update(c.UpdateSigningKeysData)
+	return err
+}
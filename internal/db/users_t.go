@@ -1,50 +1,71 @@
 package db
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"db_practice/internal/logging"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Table "public.users"
-// Column   |          Type          | Collation | Nullable | Default
-// ------------+------------------------+-----------+----------+---------
-// id         | character varying(10)  |           | not null |
-// first_name | character varying(50)  |           | not null |
-// last_name  | character varying(50)  |           | not null |
-// email      | character varying(100) |           | not null |
-// address    | character varying(255) |           |          |
-// city       | character varying(100) |           |          |
-// state      | character varying(100) |           |          |
-// zip        | character varying(20)  |           |          |
-// dob        | character varying(20)  |           |          |
+// Column            |           Type           | Collation | Nullable | Default
+// ------------------+--------------------------+-----------+----------+---------
+// id                | character varying(10)    |           | not null |
+// first_name        | character varying(50)    |           | not null |
+// last_name         | character varying(50)    |           | not null |
+// email             | character varying(100)   |           | not null |
+// address           | character varying(255)   |           |          |
+// city              | character varying(100)   |           |          |
+// state             | character varying(100)   |           |          |
+// zip               | character varying(20)    |           |          |
+// dob               | character varying(20)    |           |          |
+// password_hash     | character varying(255)   |           |          |
+// status            | character varying(30)    |           | not null | 'pending_verification'::character varying
+// email_verified_at | timestamp with time zone |           |          |
 // Indexes:
 //
 //	"users_pkey" PRIMARY KEY, btree (id)
 //	"users_email_key" UNIQUE CONSTRAINT, btree (email)
 
 type User struct {
-	Id          string `json:"id"`
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	Email       string `json:"email"`
-	Address     string `json:"address"`
-	City        string `json:"city"`
-	State       string `json:"state"`
-	ZipCode     string `json:"zip"`
-	DateOfBirth string `json:"dob"`
+	Id              string     `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Address         string     `json:"address"`
+	City            string     `json:"city"`
+	State           string     `json:"state"`
+	ZipCode         string     `json:"zip"`
+	DateOfBirth     string     `json:"dob"`
+	Status          string     `json:"status,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
 }
 
+const (
+	UserStatusPending = "pending_verification"
+	UserStatusActive  = "active"
+)
+
+const userColumns = `id, first_name, last_name, email, address, city, state, zip, dob, status, email_verified_at`
+
 var ErrEmailExists = errors.New("Email is already in use")
 var ErrIdExists = errors.New("Unique id required")
+var ErrNoPassword = errors.New("No password set for user")
+
+func (db *DB) CreateUser(ctx context.Context, firstName, lastName, email, address, city, state, zip, dob string) (_ *User, err error) {
+	defer db.observe("CreateUser", time.Now())
+	ctx, span := startSpan(ctx, "CreateUser", "")
+	defer func() { endSpan(span, err) }()
 
-func (db *DB) CreateUser(firstName, lastName, email, address, city, state, zip, dob string) (*User, error) {
-	existingEmail, err := db.GetUserByEmail(email)
+	existingEmail, err := db.GetUserByEmail(ctx, email)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
@@ -52,19 +73,19 @@ func (db *DB) CreateUser(firstName, lastName, email, address, city, state, zip,
 		return nil, ErrEmailExists
 	}
 
-	id, err := generateUserId(db)
+	id, err := generateUserId(ctx, db)
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := db.Conn.Begin()
+	tx, err := db.Conn.BeginTx(ctx, nil)
 	if err != nil {
-		log.Errorf("failed to begin transaction: %v", err)
+		logging.FromContext(ctx).Errorf("failed to begin transaction: %v", err)
 		return nil, err
 	}
 	defer func() {
 		if err := tx.Rollback(); err != sql.ErrTxDone && err != nil {
-			log.Errorf("failed to rollback transaction: %v", err)
+			logging.FromContext(ctx).Errorf("failed to rollback transaction: %v", err)
 		}
 	}()
 
@@ -80,28 +101,31 @@ func (db *DB) CreateUser(firstName, lastName, email, address, city, state, zip,
 		DateOfBirth: dob,
 	}
 
-	createdUser, err := db.CreateUserTx(tx, newUser)
+	createdUser, err := db.CreateUserTx(ctx, tx, newUser)
 	if err != nil {
 		return nil, err
 	}
 
 	if err := tx.Commit(); err != nil {
-		log.Errorf("failed to commit transaction: %v", err)
+		logging.FromContext(ctx).Errorf("failed to commit transaction: %v", err)
 		return nil, err
 	}
 	return createdUser, nil
 }
 
-func (db *DB) CreateUserTx(tx *sql.Tx, u *User) (*User, error) {
+func (db *DB) CreateUserTx(ctx context.Context, tx *sql.Tx, u *User) (_ *User, err error) {
+	defer db.observe("CreateUserTx", time.Now())
 
 	query := `
 			INSERT INTO Users (id, first_name, last_name, email, address, city, state, zip, dob)
 			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 			ON CONFLICT (email) DO NOTHING
-			RETURNING id, first_name, last_name, email, address, city, state, zip, dob;`
+			RETURNING id, first_name, last_name, email, address, city, state, zip, dob, status;`
+	ctx, span := startSpan(ctx, "CreateUserTx", query)
+	defer func() { endSpan(span, err) }()
 
-	var id, firstName, lastName, email, address, city, state, zip, dob string
-	err := tx.QueryRow(query, u.Id, u.FirstName, u.LastName, u.Email, u.Address, u.City, u.State, u.ZipCode, u.DateOfBirth).Scan(&id, &firstName, &lastName, &email, &address, &city, &state, &zip, &dob)
+	var id, firstName, lastName, email, address, city, state, zip, dob, status string
+	err = tx.QueryRowContext(ctx, query, u.Id, u.FirstName, u.LastName, u.Email, u.Address, u.City, u.State, u.ZipCode, u.DateOfBirth).Scan(&id, &firstName, &lastName, &email, &address, &city, &state, &zip, &dob, &status)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user already exists with email %s", email)
@@ -119,24 +143,27 @@ func (db *DB) CreateUserTx(tx *sql.Tx, u *User) (*User, error) {
 		State:       u.State,
 		ZipCode:     u.ZipCode,
 		DateOfBirth: u.DateOfBirth,
+		Status:      status,
 	}
 
-	fmt.Printf("User inserted successfully with ID: %s\n", id)
+	logging.FromContext(ctx).WithField("Id", id).Info("User inserted")
 	return newUser, nil
 }
 
-func (db *DB) GetUserByEmail(email string) (*User, error) {
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (_ *User, err error) {
+	defer db.observe("GetUserByEmail", time.Now())
 
 	query := `
-		SELECT id, first_name, last_name, email, address, city, state, zip, dob
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = $1
   `
+	ctx, span := startSpan(ctx, "GetUserByEmail", query)
+	defer func() { endSpan(span, err) }()
 
-	row := db.Conn.QueryRow(query, email)
+	row := db.Conn.QueryRowContext(ctx, query, email)
 
-	var user User
-	err := row.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Address, &user.City, &user.State, &user.ZipCode, &user.DateOfBirth)
+	user, err := scanUser(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, sql.ErrNoRows
@@ -145,34 +172,266 @@ func (db *DB) GetUserByEmail(email string) (*User, error) {
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-func (db *DB) GetUserById(id string) (*User, error) {
+func (db *DB) GetUserById(ctx context.Context, id string) (_ *User, err error) {
+	defer db.observe("GetUserById", time.Now())
 
 	query := `
-		SELECT id, first_name, last_name, email, address, city, state, zip, dob
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = $1
   `
+	ctx, span := startSpan(ctx, "GetUserById", query)
+	defer func() { endSpan(span, err) }()
 
-	row := db.Conn.QueryRow(query, id)
+	row := db.Conn.QueryRowContext(ctx, query, id)
 
-	var user User
-	err := row.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Address, &user.City, &user.State, &user.ZipCode, &user.DateOfBirth)
+	user, err := scanUser(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, sql.ErrNoRows
+		}
+
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUsersByIds returns the users with the given ids in one query, in the
+// order the ids were given. Ids with no user are left out.
+func (db *DB) GetUsersByIds(ctx context.Context, ids []string) (_ []*User, err error) {
+	defer db.observe("GetUsersByIds", time.Now())
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = ANY($1)
+		ORDER BY array_position($1::text[], id::text)
+  `
+	ctx, span := startSpan(ctx, "GetUsersByIds", query)
+	defer func() { endSpan(span, err) }()
+
+	return db.queryUsers(ctx, query, pq.Array(ids))
+}
+
+// GetUsersByEmails returns the users with the given emails in one query, in
+// the order the emails were given. Emails with no user are left out.
+func (db *DB) GetUsersByEmails(ctx context.Context, emails []string) (_ []*User, err error) {
+	defer db.observe("GetUsersByEmails", time.Now())
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE email = ANY($1)
+		ORDER BY array_position($1::text[], email::text)
+  `
+	ctx, span := startSpan(ctx, "GetUsersByEmails", query)
+	defer func() { endSpan(span, err) }()
+
+	return db.queryUsers(ctx, query, pq.Array(emails))
+}
+
+// ListUsers returns up to limit users in id order, starting after afterId,
+// so callers can page through every user with the last id they saw.
+func (db *DB) ListUsers(ctx context.Context, afterId string, limit int) (_ []*User, err error) {
+	defer db.observe("ListUsers", time.Now())
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2
+  `
+	ctx, span := startSpan(ctx, "ListUsers", query)
+	defer func() { endSpan(span, err) }()
+
+	return db.queryUsers(ctx, query, afterId, limit)
+}
+
+func (db *DB) UpdateUser(ctx context.Context, u *User) (_ *User, err error) {
+	defer db.observe("UpdateUser", time.Now())
+
+	// Changing the email address puts the account back into verification.
+	query := `
+		UPDATE users
+		SET first_name = $2, last_name = $3, email = $4, address = $5, city = $6, state = $7, zip = $8, dob = $9,
+			status = CASE WHEN email = $4 THEN status ELSE '` + UserStatusPending + `' END,
+			email_verified_at = CASE WHEN email = $4 THEN email_verified_at ELSE NULL END
+		WHERE id = $1
+		RETURNING ` + userColumns + `
+  `
+	ctx, span := startSpan(ctx, "UpdateUser", query)
+	defer func() { endSpan(span, err) }()
+
+	user, err := scanUser(db.Conn.QueryRowContext(ctx, query, u.Id, u.FirstName, u.LastName, u.Email, u.Address, u.City, u.State, u.ZipCode, u.DateOfBirth))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, sql.ErrNoRows
 		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrEmailExists
+		}
 
 		return nil, err
 	}
 
+	return user, nil
+}
+
+// MarkUserEmailVerified activates the account, provided the email on record
+// is still the one that was verified.
+func (db *DB) MarkUserEmailVerified(ctx context.Context, id, email string) (err error) {
+	defer db.observe("MarkUserEmailVerified", time.Now())
+
+	query := `
+		UPDATE users
+		SET status = $3, email_verified_at = NOW()
+		WHERE id = $1 AND email = $2
+  `
+	ctx, span := startSpan(ctx, "MarkUserEmailVerified", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, id, email, UserStatusActive)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *DB) DeleteUser(ctx context.Context, id string) (err error) {
+	defer db.observe("DeleteUser", time.Now())
+
+	query := `
+		DELETE FROM users
+		WHERE id = $1
+  `
+	ctx, span := startSpan(ctx, "DeleteUser", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *DB) SetUserPasswordHash(ctx context.Context, id, hash string) (err error) {
+	defer db.observe("SetUserPasswordHash", time.Now())
+
+	query := `
+		UPDATE users
+		SET password_hash = $1
+		WHERE id = $2
+  `
+	ctx, span := startSpan(ctx, "SetUserPasswordHash", query)
+	defer func() { endSpan(span, err) }()
+
+	res, err := db.Conn.ExecContext(ctx, query, hash, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (db *DB) GetUserPasswordHash(ctx context.Context, id string) (_ string, err error) {
+	defer db.observe("GetUserPasswordHash", time.Now())
+
+	query := `
+		SELECT password_hash
+		FROM users
+		WHERE id = $1
+  `
+	ctx, span := startSpan(ctx, "GetUserPasswordHash", query)
+	defer func() { endSpan(span, err) }()
+
+	var hash sql.NullString
+	err = db.Conn.QueryRowContext(ctx, query, id).Scan(&hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", sql.ErrNoRows
+		}
+
+		return "", err
+	}
+	if !hash.Valid || hash.String == "" {
+		return "", ErrNoPassword
+	}
+
+	return hash.String, nil
+}
+
+func (db *DB) queryUsers(ctx context.Context, query string, args ...interface{}) ([]*User, error) {
+	rows, err := db.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	var verifiedAt sql.NullTime
+	err := row.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &user.Address, &user.City, &user.State, &user.ZipCode, &user.DateOfBirth, &user.Status, &verifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if verifiedAt.Valid {
+		user.EmailVerifiedAt = &verifiedAt.Time
+	}
+
 	return &user, nil
 }
 
-func generateUserId(db *DB) (string, error) {
-	for {
+func generateUserId(ctx context.Context, db *DB) (_ string, err error) {
+	ctx, span := startSpan(ctx, "generateUserId", "")
+	defer func() { endSpan(span, err) }()
+
+	for attempt := 1; ; attempt++ {
+		span.SetAttributes(attribute.Int("db_practice.attempts", attempt))
+
 		input := make([]byte, 16)
 		if _, err := rand.Read(input); err != nil {
 			return "", err
@@ -181,7 +440,7 @@ func generateUserId(db *DB) (string, error) {
 		hash := sha256.Sum256(input)
 		id := hex.EncodeToString(hash[:])[:10]
 
-		existingId, err := db.GetUserById(id)
+		existingId, err := db.GetUserById(ctx, id)
 		if err != nil && err != sql.ErrNoRows {
 			return "", err
 		}
@@ -1,12 +1,17 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 var (
@@ -67,9 +72,9 @@ func TestCreateUser(t *testing.T) {
 			require.NoError(t, err, "Failed to begin transaction")
 			defer tx.Rollback()
 
-			_, err = db.CreateUser(testUserEli2.FirstName, testUserEli2.LastName, testUserEli2.Email, testUserEli2.Address, testUserEli2.City, testUserEli2.State, testUserEli2.ZipCode, testUserEli2.DateOfBirth)
+			_, err = db.CreateUser(context.Background(), testUserEli2.FirstName, testUserEli2.LastName, testUserEli2.Email, testUserEli2.Address, testUserEli2.City, testUserEli2.State, testUserEli2.ZipCode, testUserEli2.DateOfBirth)
 
-			user, err := db.CreateUser(tc.testUser.FirstName, tc.testUser.LastName, tc.testUser.Email, tc.testUser.Address, tc.testUser.City, tc.testUser.State, tc.testUser.ZipCode, tc.testUser.DateOfBirth)
+			user, err := db.CreateUser(context.Background(), tc.testUser.FirstName, tc.testUser.LastName, tc.testUser.Email, tc.testUser.Address, tc.testUser.City, tc.testUser.State, tc.testUser.ZipCode, tc.testUser.DateOfBirth)
 			if tc.expectedErr != nil {
 				assert.Equal(t, tc.expectedErr, err)
 			} else {
@@ -116,10 +121,10 @@ func TestGetUserByEmail(t *testing.T) {
 			require.NoError(t, err, "Failed to begin transaction")
 			defer tx.Rollback()
 
-			_, err = db.CreateUser(testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			_, err = db.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
 			require.NoError(t, err)
 
-			foundUser, err := db.GetUserByEmail(tc.email)
+			foundUser, err := db.GetUserByEmail(context.Background(), tc.email)
 			if tc.expectedErr != nil {
 				assert.Equal(t, tc.expectedErr, err)
 			} else {
@@ -166,10 +171,10 @@ func TestGetUserById(t *testing.T) {
 			require.NoError(t, err, "Failed to begin transaction")
 			defer tx.Rollback()
 
-			_, err = db.CreateUser(testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			_, err = db.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
 			require.NoError(t, err)
 
-			foundUser, err := db.GetUserById(tc.id)
+			foundUser, err := db.GetUserById(context.Background(), tc.id)
 			if tc.expectedErr != nil {
 				assert.Equal(t, tc.expectedErr, err)
 			} else {
@@ -183,3 +188,308 @@ func TestGetUserById(t *testing.T) {
 		})
 	}
 }
+
+func TestListUsers(t *testing.T) {
+	testCases := []struct {
+		description   string
+		afterFirst    bool
+		limit         int
+		expectedCount int
+	}{
+		{
+			description:   "Success: Every user listed",
+			limit:         10,
+			expectedCount: 2,
+		},
+		{
+			description:   "Success: Limit caps the page",
+			limit:         1,
+			expectedCount: 1,
+		},
+		{
+			description:   "Success: Listing resumes after the given id",
+			afterFirst:    true,
+			limit:         10,
+			expectedCount: 1,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Parallel()
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			for _, u := range []*User{testUserEli, testUserEli2} {
+				_, err = db.CreateUser(context.Background(), u.FirstName, u.LastName, u.Email, u.Address, u.City, u.State, u.ZipCode, u.DateOfBirth)
+				require.NoError(t, err)
+			}
+
+			afterId := ""
+			if tc.afterFirst {
+				first, err := db.ListUsers(context.Background(), "", 1)
+				require.NoError(t, err)
+				require.Len(t, first, 1)
+				afterId = first[0].Id
+			}
+
+			listed, err := db.ListUsers(context.Background(), afterId, tc.limit)
+			require.NoError(t, err)
+			assert.Len(t, listed, tc.expectedCount)
+			for i, u := range listed {
+				assert.Greater(t, u.Id, afterId)
+				if i > 0 {
+					assert.Greater(t, u.Id, listed[i-1].Id)
+				}
+			}
+		})
+	}
+}
+
+func TestGetUsersByIds(t *testing.T) {
+	testCases := []struct {
+		description    string
+		byEmail        bool
+		keys           func(created []*User) []string
+		expectedEmails []string
+	}{
+		{
+			description:    "Success: Ids found in request order",
+			keys:           func(created []*User) []string { return []string{created[1].Id, created[0].Id} },
+			expectedEmails: []string{testUserEli2.Email, testUserEli.Email},
+		},
+		{
+			description:    "Success: Missing ids left out",
+			keys:           func(created []*User) []string { return []string{"missing", created[0].Id} },
+			expectedEmails: []string{testUserEli.Email},
+		},
+		{
+			description: "Success: Emails found in request order",
+			byEmail:     true,
+			keys: func(created []*User) []string {
+				return []string{testUserEli2.Email, "missing@mail.com", testUserEli.Email}
+			},
+			expectedEmails: []string{testUserEli2.Email, testUserEli.Email},
+		},
+		{
+			description:    "Success: Nothing requested",
+			keys:           func(created []*User) []string { return nil },
+			expectedEmails: []string{},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			var created []*User
+			for _, u := range []*User{testUserEli, testUserEli2} {
+				c, err := db.CreateUser(context.Background(), u.FirstName, u.LastName, u.Email, u.Address, u.City, u.State, u.ZipCode, u.DateOfBirth)
+				require.NoError(t, err)
+				created = append(created, c)
+			}
+
+			var found []*User
+			if tc.byEmail {
+				found, err = db.GetUsersByEmails(context.Background(), tc.keys(created))
+			} else {
+				found, err = db.GetUsersByIds(context.Background(), tc.keys(created))
+			}
+			require.NoError(t, err)
+
+			emails := []string{}
+			for _, u := range found {
+				emails = append(emails, u.Email)
+			}
+			assert.Equal(t, tc.expectedEmails, emails)
+		})
+	}
+}
+
+func TestGetUserPasswordHash(t *testing.T) {
+	testCases := []struct {
+		description  string
+		setPassword  bool
+		expectedData string
+		expectedErr  error
+	}{
+		{
+			description:  "Success: Password hash found",
+			setPassword:  true,
+			expectedData: "$2a$10$hash",
+			expectedErr:  nil,
+		},
+		{
+			description: "Failure: No password set",
+			setPassword: false,
+			expectedErr: ErrNoPassword,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			user, err := db.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			require.NoError(t, err)
+
+			if tc.setPassword {
+				require.NoError(t, db.SetUserPasswordHash(context.Background(), user.Id, "$2a$10$hash"))
+			}
+
+			hash, err := db.GetUserPasswordHash(context.Background(), user.Id)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedData, hash)
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	testCases := []struct {
+		description string
+		email       string
+		missingUser bool
+		expectedErr error
+	}{
+		{
+			description: "Success: User updated",
+			email:       "updated@mail.com",
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Email already exists",
+			email:       testUserEli2.Email,
+			expectedErr: ErrEmailExists,
+		},
+		{
+			description: "Failure: No user found",
+			email:       "updated@mail.com",
+			missingUser: true,
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			user, err := db.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			require.NoError(t, err)
+			_, err = db.CreateUser(context.Background(), testUserEli2.FirstName, testUserEli2.LastName, testUserEli2.Email, testUserEli2.Address, testUserEli2.City, testUserEli2.State, testUserEli2.ZipCode, testUserEli2.DateOfBirth)
+			require.NoError(t, err)
+
+			update := *user
+			update.Email = tc.email
+			update.City = "Boulder"
+			if tc.missingUser {
+				update.Id = "missing"
+			}
+
+			updated, err := db.UpdateUser(context.Background(), &update)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.email, updated.Email)
+				assert.Equal(t, "Boulder", updated.City)
+			}
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	testCases := []struct {
+		description string
+		missingUser bool
+		expectedErr error
+	}{
+		{
+			description: "Success: User deleted",
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: No user found",
+			missingUser: true,
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			db, err := NewDB(connStr, true, t.Name())
+			// Use txdb for testing
+			require.NoError(t, err)
+			defer db.Close()
+
+			user, err := db.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			require.NoError(t, err)
+
+			id := user.Id
+			if tc.missingUser {
+				id = "missing"
+			}
+
+			err = db.DeleteUser(context.Background(), id)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestCreateUserSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	db, err := NewDB(connStr, true, t.Name())
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), "test")
+	_, err = db.CreateUser(ctx, testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+	require.NoError(t, err)
+	root.End()
+
+	// Children end before their parents.
+	names := []string{}
+	statements := map[string]string{}
+	for _, s := range recorder.Ended() {
+		if s.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			continue
+		}
+		names = append(names, s.Name())
+		for _, kv := range s.Attributes() {
+			if kv.Key == attribute.Key("db.statement") {
+				statements[s.Name()] = kv.Value.AsString()
+			}
+		}
+	}
+	assert.Equal(t, []string{"db.GetUserByEmail", "db.GetUserById", "db.generateUserId", "db.CreateUserTx", "db.CreateUser", "test"}, names)
+	assert.Equal(t, "SELECT "+userColumns+" FROM users WHERE email = $1", statements["db.GetUserByEmail"])
+	assert.Contains(t, statements["db.CreateUserTx"], "INSERT INTO Users")
+}
@@ -0,0 +1,292 @@
+// Package errcatalog is the catalog of error codes the API answers with.
+// Codes and their HTTP statuses are declared here; titles and message
+// templates live in messages/<language>.json, one file per language.
+package errcatalog
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Code is a stable, machine-readable error code. Codes are only ever added,
+// never renamed or reused; titles and messages are for people and may be
+// reworded.
+type Code string
+
+// The catalog, in the order GET /errors lists it:
+//
+//	not_found          404  The resource does not exist.
+//	bad_request        400  The request is malformed.
+//	invalid_json       400  The body is not valid JSON for the endpoint.
+//	invalid            400  Values are invalid; errors lists the fields.
+//	internal_error     500  The server failed; report the request_id.
+//	conflict_error     409  The request conflicts with the current state.
+//	unauthorized       401  Credentials are missing or invalid.
+//	forbidden          403  The credentials lack permission.
+//	too_many_requests  429  A rate limit was hit; see Retry-After.
+//	not_acceptable     406  The Accept header asks for an unknown version.
+//	payload_too_large  413  The body is over the size limit.
+//
+// These describe a single field of an invalid request, in its errors:
+//
+//	required           400  The field is missing or empty.
+//	invalid_type       400  The field's JSON type is wrong; params: type.
+//	too_short          400  The value is too short; params: min.
+//	too_long           400  The value is too long; params: max.
+//	invalid_format     400  The value isn't a valid format; params: format.
+//	unknown_field      400  The field isn't part of the request.
+const (
+	NotFound      Code = "not_found"
+	BadRequest    Code = "bad_request"
+	InvalidJSON   Code = "invalid_json"
+	Invalid       Code = "invalid"
+	Internal      Code = "internal_error"
+	Conflict      Code = "conflict_error"
+	Unauthorized  Code = "unauthorized"
+	Forbidden     Code = "forbidden"
+	RateLimited   Code = "too_many_requests"
+	NotAcceptable Code = "not_acceptable"
+	TooLarge      Code = "payload_too_large"
+
+	Required      Code = "required"
+	InvalidType   Code = "invalid_type"
+	TooShort      Code = "too_short"
+	TooLong       Code = "too_long"
+	InvalidFormat Code = "invalid_format"
+	UnknownField  Code = "unknown_field"
+)
+
+// statuses lists every code, in catalog order, with its HTTP status.
+var statuses = []struct {
+	code   Code
+	status int
+}{
+	{NotFound, 404},
+	{BadRequest, 400},
+	{InvalidJSON, 400},
+	{Invalid, 400},
+	{Internal, 500},
+	{Conflict, 409},
+	{Unauthorized, 401},
+	{Forbidden, 403},
+	{RateLimited, 429},
+	{NotAcceptable, 406},
+	{TooLarge, 413},
+	{Required, 400},
+	{InvalidType, 400},
+	{TooShort, 400},
+	{TooLong, 400},
+	{InvalidFormat, 400},
+	{UnknownField, 400},
+}
+
+// Fallback is the language used when none of the caller's are available.
+// Its message file is the reference the others are checked against.
+var Fallback = language.English
+
+//go:embed messages/*.json
+var messageFiles embed.FS
+
+// Entry is one error in one language. Message and FieldMessage are
+// templates whose {name} placeholders are listed in Params; FieldMessage,
+// when set, describes the error for a single field.
+type Entry struct {
+	Code         Code     `json:"code"`
+	Status       int      `json:"status"`
+	Title        string   `json:"title"`
+	Message      string   `json:"message"`
+	FieldMessage string   `json:"field_message,omitempty"`
+	Params       []string `json:"params,omitempty"`
+}
+
+type messages struct {
+	Title        string `json:"title"`
+	Message      string `json:"message"`
+	FieldMessage string `json:"field_message"`
+}
+
+type Catalog struct {
+	tags     []language.Tag
+	matcher  language.Matcher
+	messages map[language.Tag]map[Code]messages
+}
+
+// Default is the catalog built from the embedded message files.
+var Default = mustLoad()
+
+func mustLoad() *Catalog {
+	c, err := Load()
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Load reads and checks the embedded message files. Every file must cover
+// every code, and use the same placeholders as the Fallback file.
+func Load() (*Catalog, error) {
+	files, err := messageFiles.ReadDir("messages")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{
+		tags:     []language.Tag{Fallback},
+		messages: map[language.Tag]map[Code]messages{},
+	}
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".json")
+		tag, err := language.Parse(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+
+		raw, err := messageFiles.ReadFile(path.Join("messages", f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := map[Code]messages{}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+
+		c.messages[tag] = m
+		if tag != Fallback {
+			c.tags = append(c.tags, tag)
+		}
+	}
+
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	// The first tag is what the matcher falls back to.
+	c.matcher = language.NewMatcher(c.tags)
+	return c, nil
+}
+
+func (c *Catalog) check() error {
+	reference, ok := c.messages[Fallback]
+	if !ok {
+		return fmt.Errorf("no messages for %s", Fallback)
+	}
+
+	for _, tag := range c.tags {
+		m := c.messages[tag]
+		for _, s := range statuses {
+			msg, ok := m[s.code]
+			if !ok || msg.Title == "" || msg.Message == "" {
+				return fmt.Errorf("%s: %s needs a title and message", tag, s.code)
+			}
+			ref := reference[s.code]
+			if !sameParams(msg.Message, ref.Message) || !sameParams(msg.FieldMessage, ref.FieldMessage) {
+				return fmt.Errorf("%s: %s placeholders differ from %s", tag, s.code, Fallback)
+			}
+			if (msg.FieldMessage == "") != (ref.FieldMessage == "") {
+				return fmt.Errorf("%s: %s field_message differs from %s", tag, s.code, Fallback)
+			}
+		}
+		if len(m) != len(statuses) {
+			return fmt.Errorf("%s: messages for unknown codes", tag)
+		}
+	}
+	return nil
+}
+
+// Languages lists the languages the catalog is available in, Fallback first.
+func (c *Catalog) Languages() []language.Tag {
+	return append([]language.Tag{}, c.tags...)
+}
+
+// Match picks the best available language for an Accept-Language header.
+func (c *Catalog) Match(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return Fallback
+	}
+	_, i, _ := c.matcher.Match(tags...)
+	return c.tags[i]
+}
+
+// Entries lists the catalog in tag's language, with unresolved templates.
+func (c *Catalog) Entries(tag language.Tag) []Entry {
+	entries := make([]Entry, 0, len(statuses))
+	for _, s := range statuses {
+		entry, _ := c.Lookup(tag, s.code)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Lookup returns code's entry in tag's language, falling back to Fallback.
+func (c *Catalog) Lookup(tag language.Tag, code Code) (Entry, bool) {
+	for _, s := range statuses {
+		if s.code != code {
+			continue
+		}
+
+		m, ok := c.messages[tag]
+		if !ok {
+			m = c.messages[Fallback]
+		}
+		msg := m[code]
+		return Entry{
+			Code:         code,
+			Status:       s.status,
+			Title:        msg.Title,
+			Message:      msg.Message,
+			FieldMessage: msg.FieldMessage,
+			Params:       params(msg.Message + msg.FieldMessage),
+		}, true
+	}
+	return Entry{}, false
+}
+
+// Status is code's HTTP status, or 0 for a code not in the catalog.
+func Status(code Code) int {
+	for _, s := range statuses {
+		if s.code == code {
+			return s.status
+		}
+	}
+	return 0
+}
+
+// Render fills a template's {name} placeholders from params. Placeholders
+// without a value are left in place.
+func Render(template string, params map[string]string) string {
+	if len(params) == 0 {
+		return template
+	}
+	pairs := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+var placeholder = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// params lists the distinct placeholder names in a template, sorted.
+func params(template string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range placeholder.FindAllStringSubmatch(template, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sameParams(a, b string) bool {
+	return strings.Join(params(a), ",") == strings.Join(params(b), ",")
+}
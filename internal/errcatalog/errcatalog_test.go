@@ -0,0 +1,151 @@
+package errcatalog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func TestLoad(t *testing.T) {
+	c, err := Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, []language.Tag{language.English, language.Spanish, language.French}, c.Languages())
+	for _, tag := range c.Languages() {
+		entries := c.Entries(tag)
+		require.Len(t, entries, len(statuses), tag.String())
+		for _, e := range entries {
+			assert.NotZero(t, e.Status, e.Code)
+			assert.NotEmpty(t, e.Title, e.Code)
+			assert.NotEmpty(t, e.Message, e.Code)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	full := func() map[Code]messages {
+		m := map[Code]messages{}
+		for _, s := range statuses {
+			m[s.code] = messages{Title: "Title", Message: "Message"}
+		}
+		m[Invalid] = messages{Title: "Title", Message: "Message", FieldMessage: "{field} is invalid."}
+		return m
+	}
+
+	testCases := []struct {
+		description string
+		edit        func(es map[Code]messages)
+		expectedErr string
+	}{
+		{
+			description: "Success: Complete translation",
+			edit:        func(es map[Code]messages) {},
+		},
+		{
+			description: "Failure: Code missing",
+			edit:        func(es map[Code]messages) { delete(es, NotFound) },
+			expectedErr: "es: not_found needs a title and message",
+		},
+		{
+			description: "Failure: Placeholder renamed",
+			edit: func(es map[Code]messages) {
+				es[Invalid] = messages{Title: "Título", Message: "Mensaje", FieldMessage: "{campo} no es válido."}
+			},
+			expectedErr: "es: invalid placeholders differ from en",
+		},
+		{
+			description: "Failure: Field message missing",
+			edit: func(es map[Code]messages) {
+				es[Invalid] = messages{Title: "Título", Message: "Mensaje"}
+			},
+			expectedErr: "es: invalid placeholders differ from en",
+		},
+		{
+			description: "Failure: Unknown code",
+			edit:        func(es map[Code]messages) { es["teapot"] = messages{Title: "Tetera", Message: "Soy una tetera."} },
+			expectedErr: "es: messages for unknown codes",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			es := full()
+			tc.edit(es)
+			c := &Catalog{
+				tags:     []language.Tag{language.English, language.Spanish},
+				messages: map[language.Tag]map[Code]messages{language.English: full(), language.Spanish: es},
+			}
+
+			err := c.check()
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		description    string
+		acceptLanguage string
+		expected       language.Tag
+	}{
+		{
+			description: "Success: No header falls back to English",
+			expected:    language.English,
+		},
+		{
+			description:    "Success: Exact language",
+			acceptLanguage: "fr",
+			expected:       language.French,
+		},
+		{
+			description:    "Success: Regional variant",
+			acceptLanguage: "es-MX,es;q=0.9",
+			expected:       language.Spanish,
+		},
+		{
+			description:    "Success: First available preference",
+			acceptLanguage: "de-DE, fr;q=0.8, en;q=0.5",
+			expected:       language.French,
+		},
+		{
+			description:    "Success: Unavailable language falls back to English",
+			acceptLanguage: "ja",
+			expected:       language.English,
+		},
+		{
+			description:    "Success: Malformed header falls back to English",
+			acceptLanguage: "fr;q=nope;;",
+			expected:       language.English,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			assert.Equal(t, tc.expected, Default.Match(tc.acceptLanguage))
+		})
+	}
+}
+
+func TestLookupAndRender(t *testing.T) {
+	e, ok := Default.Lookup(language.Spanish, Invalid)
+	require.True(t, ok)
+	assert.Equal(t, 400, e.Status)
+	assert.Equal(t, []string{"field"}, e.Params)
+	assert.Equal(t, "Email no es válido.", Render(e.FieldMessage, map[string]string{"field": "Email"}))
+	// Placeholders without a value are left for the reader to notice.
+	assert.Equal(t, "{field} no es válido.", Render(e.FieldMessage, nil))
+
+	_, ok = Default.Lookup(language.English, "teapot")
+	assert.False(t, ok)
+	assert.Equal(t, 429, Status(RateLimited))
+	assert.Equal(t, 0, Status("teapot"))
+}
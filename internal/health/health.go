@@ -0,0 +1,192 @@
+package health
+
+import (
+	"context"
+	"db_practice/internal/db"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	// DefaultTimeout bounds a check that doesn't set its own.
+	DefaultTimeout = 2 * time.Second
+)
+
+type Client interface {
+	Ready(ctx context.Context) *Report
+	Drain()
+}
+
+// Check is one readiness dependency.
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+type Result struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type Report struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	Checks    []*Result `json:"checks,omitempty"`
+}
+
+// Checker runs the readiness checks. Results are cached for ttl so frequent
+// probes from several orchestrators don't each hit the database.
+type Checker struct {
+	checks []Check
+	ttl    time.Duration
+	now    func() time.Time
+
+	draining atomic.Bool
+
+	mu       sync.Mutex
+	cached   *Report
+	cachedAt time.Time
+}
+
+func NewChecker(ttl time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks: checks,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Drain marks the server as shutting down. Readiness fails from then on so
+// load balancers stop routing new requests before the listener closes.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs the checks, or returns the cached report if it is fresh. The
+// report is StatusOK only if every check passed.
+func (c *Checker) Ready(ctx context.Context) *Report {
+	if c.draining.Load() {
+		return &Report{
+			Status:    StatusFail,
+			CheckedAt: c.now(),
+			Checks:    []*Result{{Name: "shutdown", Status: StatusFail, Error: "server is shutting down"}},
+		}
+	}
+
+	// Holding the lock while checking means concurrent probes share one
+	// run instead of stampeding the dependencies.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached != nil && c.now().Sub(c.cachedAt) < c.ttl {
+		return c.cached
+	}
+
+	report := &Report{
+		Status:    StatusOK,
+		CheckedAt: c.now(),
+		Checks:    make([]*Result, len(c.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			report.Checks[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for _, r := range report.Checks {
+		if r.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	c.cached = report
+	c.cachedAt = report.CheckedAt
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) *Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := c.now()
+	// A check that ignores its context still can't hold up the probe.
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	r := &Result{
+		Name:       check.Name,
+		Status:     StatusOK,
+		DurationMs: c.now().Sub(start).Milliseconds(),
+	}
+	if err != nil {
+		r.Status = StatusFail
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// DatabaseCheck pings the database.
+func DatabaseCheck(client db.HealthClient, timeout time.Duration) Check {
+	return Check{
+		Name:    "database",
+		Timeout: timeout,
+		Run:     client.PingContext,
+	}
+}
+
+// MigrationsCheck fails if any of the expected migrations has not been
+// applied, so a binary never serves against a schema older than it needs.
+func MigrationsCheck(client db.HealthClient, expected []string, timeout time.Duration) Check {
+	return Check{
+		Name:    "migrations",
+		Timeout: timeout,
+		Run: func(ctx context.Context) error {
+			applied, err := client.AppliedMigrations(ctx)
+			if err != nil {
+				return err
+			}
+
+			have := map[string]bool{}
+			for _, v := range applied {
+				have[v] = true
+			}
+			missing := []string{}
+			for _, v := range expected {
+				if !have[v] {
+					missing = append(missing, v)
+				}
+			}
+			if len(missing) > 0 {
+				return fmt.Errorf("missing migrations: %s", strings.Join(missing, ", "))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,114 @@
+package health
+
+import (
+	"context"
+	"db_practice/internal/db"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestReady(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	testCases := []struct {
+		description    string
+		client         db.TestClient
+		extra          []Check
+		expectedStatus string
+		expectedErrors map[string]string
+	}{
+		{
+			description:    "Success: All checks pass",
+			client:         db.TestClient{AppliedMigrationsData: []string{"a", "b", "c"}},
+			expectedStatus: StatusOK,
+		},
+		{
+			description:    "Failure: Database unreachable",
+			client:         db.TestClient{PingContextErr: errors.New("connection refused"), AppliedMigrationsData: []string{"a", "b"}},
+			expectedStatus: StatusFail,
+			expectedErrors: map[string]string{"database": "connection refused"},
+		},
+		{
+			description:    "Failure: Migration missing",
+			client:         db.TestClient{AppliedMigrationsData: []string{"a"}},
+			expectedStatus: StatusFail,
+			expectedErrors: map[string]string{"migrations": "missing migrations: b"},
+		},
+		{
+			description: "Failure: Check ignoring its timeout",
+			client:      db.TestClient{AppliedMigrationsData: []string{"a", "b"}},
+			extra: []Check{{
+				Name:    "worker",
+				Timeout: 20 * time.Millisecond,
+				Run: func(ctx context.Context) error {
+					<-block
+					return nil
+				},
+			}},
+			expectedStatus: StatusFail,
+			expectedErrors: map[string]string{"worker": "timed out after 20ms"},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			checks := append([]Check{
+				DatabaseCheck(tc.client, time.Second),
+				MigrationsCheck(tc.client, []string{"a", "b"}, time.Second),
+			}, tc.extra...)
+			c := NewChecker(time.Second, checks...)
+
+			report := c.Ready(context.Background())
+			assert.Equal(t, tc.expectedStatus, report.Status)
+			require.Len(t, report.Checks, len(checks))
+			for _, r := range report.Checks {
+				if e, ok := tc.expectedErrors[r.Name]; ok {
+					assert.Equal(t, StatusFail, r.Status, r.Name)
+					assert.Equal(t, e, r.Error)
+				} else {
+					assert.Equal(t, StatusOK, r.Status, r.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestReadyCached(t *testing.T) {
+	now := testNow
+	runs := 0
+	c := NewChecker(5*time.Second, Check{Name: "counter", Run: func(ctx context.Context) error {
+		runs++
+		return nil
+	}})
+	c.now = func() time.Time { return now }
+
+	c.Ready(context.Background())
+	now = now.Add(4 * time.Second)
+	c.Ready(context.Background())
+	assert.Equal(t, 1, runs)
+
+	now = now.Add(time.Second)
+	c.Ready(context.Background())
+	assert.Equal(t, 2, runs)
+}
+
+func TestReadyDraining(t *testing.T) {
+	c := NewChecker(time.Minute, Check{Name: "ok", Run: func(ctx context.Context) error { return nil }})
+	assert.Equal(t, StatusOK, c.Ready(context.Background()).Status)
+
+	// A cached pass must not hide the shutdown.
+	c.Drain()
+	report := c.Ready(context.Background())
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, "shutdown", report.Checks[0].Name)
+}
@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Hook lets a component take part in startup and shutdown. Either function
+// may be nil.
+type Hook struct {
+	Name string
+	// Start runs before the server accepts connections. An error aborts
+	// startup.
+	Start func(ctx context.Context) error
+	// Stop runs after the server has drained, with whatever remains of the
+	// shutdown deadline.
+	Stop func(ctx context.Context) error
+}
+
+// App runs an HTTP server together with the components it depends on.
+// Hooks start in the order they were appended and stop in reverse, so a
+// component registered after the database can still use it while stopping.
+type App struct {
+	server          *http.Server
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	hooks           []Hook
+	onShutdown      []func()
+}
+
+// NewApp wraps server. On shutdown the OnShutdown callbacks run, then the
+// listener stays open for drainDelay so load balancers can see readiness
+// fail, then in-flight requests get shutdownTimeout to finish.
+func NewApp(server *http.Server, shutdownTimeout, drainDelay time.Duration) *App {
+	return &App{
+		server:          server,
+		shutdownTimeout: shutdownTimeout,
+		drainDelay:      drainDelay,
+	}
+}
+
+// Append registers a hook.
+func (a *App) Append(h Hook) {
+	a.hooks = append(a.hooks, h)
+}
+
+// OnShutdown registers fn to run as soon as shutdown begins, while the
+// listener is still open.
+func (a *App) OnShutdown(fn func()) {
+	a.onShutdown = append(a.onShutdown, fn)
+}
+
+// Run listens on the server's address and serves until ctx is cancelled,
+// typically by SIGINT or SIGTERM.
+func (a *App) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return err
+	}
+	return a.Serve(ctx, ln)
+}
+
+// Serve starts every hook, serves on ln until ctx is cancelled or the server
+// fails, then shuts down: new connections are refused, in-flight requests get
+// until the shutdown deadline to finish, and the hooks are stopped. All
+// shutdown errors are returned joined.
+func (a *App) Serve(ctx context.Context, ln net.Listener) error {
+	started, err := a.start(ctx)
+	if err != nil {
+		ln.Close()
+		stopCtx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+		defer cancel()
+		return errors.Join(err, a.stop(stopCtx, started))
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- a.server.Serve(ln)
+	}()
+	log.WithFields(log.Fields{"Addr": ln.Addr().String()}).Info("server started")
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		log.Info("shutting down")
+		for _, fn := range a.onShutdown {
+			fn()
+		}
+		if a.drainDelay > 0 {
+			time.Sleep(a.drainDelay)
+		}
+	case err := <-serveErr:
+		errs = append(errs, fmt.Errorf("serving: %w", err))
+	}
+
+	// The parent context is already done, so the deadline starts fresh.
+	stopCtx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	if err := a.server.Shutdown(stopCtx); err != nil {
+		errs = append(errs, fmt.Errorf("draining requests: %w", err))
+		// Whatever is still running is cut off so the hooks can stop.
+		a.server.Close()
+	}
+	errs = append(errs, a.stop(stopCtx, started))
+
+	return errors.Join(errs...)
+}
+
+// start runs Start hooks in order and returns how many succeeded.
+func (a *App) start(ctx context.Context) (int, error) {
+	for i, h := range a.hooks {
+		if h.Start == nil {
+			continue
+		}
+		if err := h.Start(ctx); err != nil {
+			return i, fmt.Errorf("starting %s: %w", h.Name, err)
+		}
+	}
+	return len(a.hooks), nil
+}
+
+// stop runs the Stop hooks of the first n hooks in reverse. Every hook is
+// stopped even if an earlier one fails.
+func (a *App) stop(ctx context.Context, n int) error {
+	var errs []error
+	for i := n - 1; i >= 0; i-- {
+		h := a.hooks[i]
+		if h.Stop == nil {
+			continue
+		}
+		if err := h.Stop(ctx); err != nil {
+			log.WithFields(log.Fields{"Hook": h.Name}).Errorf("failed to stop: %v", err)
+			errs = append(errs, fmt.Errorf("stopping %s: %w", h.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
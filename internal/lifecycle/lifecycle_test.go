@@ -0,0 +1,207 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listen(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return ln
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "finished")
+	})
+
+	var stopped []string
+	app := NewApp(&http.Server{Handler: handler}, 5*time.Second, 0)
+	app.Append(Hook{Name: "db", Stop: func(ctx context.Context) error {
+		stopped = append(stopped, "db")
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ln := listen(t)
+	addr := ln.Addr().String()
+	done := make(chan error, 1)
+	go func() { done <- app.Serve(ctx, ln) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	response := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			response <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		response <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	// Shutdown waits for the request: the server must not return, nor the
+	// hooks run, while it is still in flight.
+	select {
+	case <-done:
+		t.Fatal("server stopped before the in-flight request finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Empty(t, stopped)
+
+	// New connections are refused once draining has begun.
+	_, err := net.DialTimeout("tcp", addr, time.Second)
+	assert.Error(t, err)
+
+	close(release)
+	r := <-response
+	require.NoError(t, r.err)
+	assert.Equal(t, "finished", r.body)
+
+	require.NoError(t, <-done)
+	assert.Equal(t, []string{"db"}, stopped)
+}
+
+func TestShutdownNotifiesBeforeListenerCloses(t *testing.T) {
+	app := NewApp(&http.Server{Handler: http.NotFoundHandler()}, time.Second, 200*time.Millisecond)
+
+	notified := make(chan struct{})
+	app.OnShutdown(func() { close(notified) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ln := listen(t)
+	done := make(chan error, 1)
+	go func() { done <- app.Serve(ctx, ln) }()
+
+	cancel()
+	<-notified
+
+	// During the drain delay the server still takes requests.
+	resp, err := http.Get("http://" + ln.Addr().String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	require.NoError(t, <-done)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	stopped := false
+	app := NewApp(&http.Server{Handler: handler}, 50*time.Millisecond, 0)
+	app.Append(Hook{Name: "db", Stop: func(ctx context.Context) error {
+		stopped = true
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ln := listen(t)
+	done := make(chan error, 1)
+	go func() { done <- app.Serve(ctx, ln) }()
+
+	go http.Get("http://" + ln.Addr().String())
+	<-started
+	cancel()
+
+	err := <-done
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, stopped, "hooks must stop even when draining times out")
+}
+
+func TestHookOrder(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	testCases := []struct {
+		description string
+		failStart   string
+		failStop    string
+		expectedErr error
+		expected    []string
+	}{
+		{
+			description: "Success: Start in order, stop in reverse",
+			expected:    []string{"start db", "start workers", "stop workers", "stop db"},
+		},
+		{
+			description: "Failure: Start error stops what already started",
+			failStart:   "workers",
+			expectedErr: errBoom,
+			expected:    []string{"start db", "start workers", "stop db"},
+		},
+		{
+			description: "Failure: Stop error does not skip later hooks",
+			failStop:    "workers",
+			expectedErr: errBoom,
+			expected:    []string{"start db", "start workers", "stop workers", "stop db"},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			var calls []string
+			hook := func(name string) Hook {
+				return Hook{
+					Name: name,
+					Start: func(ctx context.Context) error {
+						calls = append(calls, "start "+name)
+						if name == tc.failStart {
+							return errBoom
+						}
+						return nil
+					},
+					Stop: func(ctx context.Context) error {
+						calls = append(calls, "stop "+name)
+						if name == tc.failStop {
+							return errBoom
+						}
+						return nil
+					},
+				}
+			}
+
+			app := NewApp(&http.Server{Handler: http.NotFoundHandler()}, time.Second, 0)
+			app.Append(hook("db"))
+			app.Append(Hook{Name: "no-op"})
+			app.Append(hook("workers"))
+
+			// Already cancelled: start, then shut straight down.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := app.Serve(ctx, listen(t))
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, calls)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"db_practice/internal/route"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RequestIDHeader carries the request id in both directions: a caller's
+// id is kept so one id follows a request across services.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds caller supplied ids, which end up in every log
+// line of the request.
+const maxRequestIDLength = 128
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// WithLogger returns a copy of ctx carrying entry.
+func WithLogger(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey, entry)
+}
+
+// RequestID returns the id Middleware gave the request, or "" outside one.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// FromContext returns the request-scoped logger, or the standard logger
+// outside a request. The entry carries ctx so hooks can read its span.
+func FromContext(ctx context.Context) *log.Entry {
+	entry, ok := ctx.Value(loggerKey).(*log.Entry)
+	if !ok {
+		entry = log.NewEntry(log.StandardLogger())
+	}
+	return entry.WithContext(ctx)
+}
+
+// NewContext gives ctx a request id, and a logger tagged with it. The id is
+// the caller's when usable, otherwise a new one, and is returned so it can
+// be echoed back.
+func NewContext(ctx context.Context, callerID string) (context.Context, string) {
+	id := callerID
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	ctx = context.WithValue(ctx, requestIDKey, id)
+	return WithLogger(ctx, log.WithField("request_id", id)), id
+}
+
+// Middleware gives every request an id, taken from X-Request-ID when the
+// caller sent a usable one, echoes it in the response and stores a logger
+// tagged with it in the context. Once the request completes it logs one
+// access line. Wrap it around the whole router, inside route.Track, so
+// unknown paths and methods are logged too.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		ctx, id := NewContext(r.Context(), r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, id)
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		entry := FromContext(ctx).WithFields(log.Fields{
+			"method":      r.Method,
+			"route":       route.Template(r),
+			"status":      rw.status,
+			"bytes":       rw.bytes,
+			"duration_ms": time.Since(start).Milliseconds(),
+			"user_agent":  r.UserAgent(),
+		})
+		if rw.status >= http.StatusInternalServerError {
+			entry.Error("Request completed")
+		} else {
+			entry.Info("Request completed")
+		}
+	})
+}
+
+// validRequestID accepts short ids of URL-safe characters, so a caller
+// can't inject arbitrary text into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Unreachable on supported platforms; an id is not worth failing
+		// the request over.
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// responseWriter remembers the status code and counts the body bytes
+// written through it.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush streamed responses.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
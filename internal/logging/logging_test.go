@@ -0,0 +1,204 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"db_practice/internal/route"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs sends the standard logger's JSON output to a buffer for the
+// rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFormatter(&log.JSONFormatter{})
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFormatter(&log.TextFormatter{})
+	})
+	return &buf
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	lines := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &fields))
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(route.Record)
+	router.HandleFunc("/users/{email}", func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).WithField("Email", mux.Vars(r)["email"]).Info("Handled")
+		w.Header().Set("X-Seen-Request-ID", RequestID(r.Context()))
+		if mux.Vars(r)["email"] == "broken@mail.com" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		io.WriteString(w, "hello")
+	}).Methods("GET")
+
+	testCases := []struct {
+		description    string
+		path           string
+		requestID      string
+		expectedID     string
+		expectedStatus float64
+		expectedBytes  float64
+		expectedLevel  string
+	}{
+		{
+			description:    "Success: Caller's request id kept",
+			path:           "/users/a@mail.com",
+			requestID:      "abc-123",
+			expectedID:     "abc-123",
+			expectedStatus: 200,
+			expectedBytes:  5,
+			expectedLevel:  "info",
+		},
+		{
+			description:    "Success: Request id generated",
+			path:           "/users/a@mail.com",
+			expectedStatus: 200,
+			expectedBytes:  5,
+			expectedLevel:  "info",
+		},
+		{
+			description:    "Success: Unsafe request id replaced",
+			path:           "/users/a@mail.com",
+			requestID:      "bad id\n{\"level\":\"fake\"}",
+			expectedStatus: 200,
+			expectedBytes:  5,
+			expectedLevel:  "info",
+		},
+		{
+			description:    "Failure: Server errors logged as errors",
+			path:           "/users/broken@mail.com",
+			requestID:      "abc-456",
+			expectedID:     "abc-456",
+			expectedStatus: 500,
+			expectedLevel:  "error",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			buf := captureLogs(t)
+			r := httptest.NewRequest("GET", tc.path, nil)
+			r.Header.Set("User-Agent", "test-agent")
+			if tc.requestID != "" {
+				r.Header.Set(RequestIDHeader, tc.requestID)
+			}
+			w := httptest.NewRecorder()
+			route.Track(Middleware(router)).ServeHTTP(w, r)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tc.expectedID != "" {
+				assert.Equal(t, tc.expectedID, id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+			assert.Equal(t, id, w.Header().Get("X-Seen-Request-ID"))
+
+			lines := decodeLines(t, buf)
+			require.Len(t, lines, 2)
+			handled, access := lines[0], lines[1]
+
+			// The handler's line and the access line share the id.
+			assert.Equal(t, "Handled", handled["msg"])
+			assert.Equal(t, id, handled["request_id"])
+
+			assert.Equal(t, "Request completed", access["msg"])
+			assert.Equal(t, tc.expectedLevel, access["level"])
+			assert.Equal(t, id, access["request_id"])
+			assert.Equal(t, "GET", access["method"])
+			assert.Equal(t, "/users/{email}", access["route"])
+			assert.Equal(t, tc.expectedStatus, access["status"])
+			assert.Equal(t, tc.expectedBytes, access["bytes"])
+			assert.Equal(t, "test-agent", access["user_agent"])
+			assert.Contains(t, access, "duration_ms")
+		})
+	}
+}
+
+func TestMiddlewareUnmatched(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(route.Record)
+	router.HandleFunc("/users/{email}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	handler := route.Track(Middleware(router))
+
+	testCases := []struct {
+		description    string
+		method         string
+		path           string
+		expectedStatus float64
+	}{
+		{
+			description:    "Success: Unknown path logged",
+			method:         "GET",
+			path:           "/pets/1",
+			expectedStatus: 404,
+		},
+		{
+			description:    "Success: Wrong method logged",
+			method:         "DELETE",
+			path:           "/users/a@mail.com",
+			expectedStatus: 405,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			buf := captureLogs(t)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+			id := w.Header().Get(RequestIDHeader)
+			assert.Len(t, id, 32)
+
+			lines := decodeLines(t, buf)
+			require.Len(t, lines, 1)
+			assert.Equal(t, "Request completed", lines[0]["msg"])
+			assert.Equal(t, id, lines[0]["request_id"])
+			assert.Equal(t, route.Unmatched, lines[0]["route"])
+			assert.Equal(t, tc.expectedStatus, lines[0]["status"])
+		})
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	buf := captureLogs(t)
+
+	// Outside a request: the standard logger, no request id.
+	FromContext(context.Background()).Info("Background")
+	ctx := WithLogger(context.Background(), log.WithField("request_id", "abc-123"))
+	FromContext(ctx).Info("In request")
+
+	lines := decodeLines(t, buf)
+	require.Len(t, lines, 2)
+	assert.NotContains(t, lines[0], "request_id")
+	assert.Equal(t, "abc-123", lines[1]["request_id"])
+	assert.Equal(t, "", RequestID(ctx))
+}
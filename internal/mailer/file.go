@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// FileMailer writes each message to an .eml file instead of sending it, for
+// local runs without a mail server.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (f *FileMailer) Send(msg *Message) error {
+	if msg.From == "" {
+		msg.From = f.from
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), recipient)
+	path := filepath.Join(f.dir, name)
+
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.WithFields(log.Fields{"To": msg.To, "Subject": msg.Subject, "Path": path}).Info("Mail written to file")
+	return nil
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers a message. Implementations fill in From when it is empty.
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// NewMessage renders the text and HTML versions of the named template, e.g.
+// "verify_email" renders templates/verify_email.txt and .html.
+func NewMessage(to, subject, name string, data interface{}) (*Message, error) {
+	var text, html bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return nil, err
+	}
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:      to,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// Bytes encodes the message as a multipart/alternative RFC 5322 message.
+func (m *Message) Bytes() ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"8bit"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	from, err := address(m.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := address(m.To)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + strings.NewReplacer("\r", "", "\n", "").Replace(m.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + w.Boundary(),
+	}
+	msg.WriteString(strings.Join(headers, "\r\n"))
+	msg.WriteString("\r\n\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// address validates an address header value and formats it anew, so no CR
+// or LF in it can start a header of its own.
+func address(value string) (string, error) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid address %q", value)
+	}
+	if addr.Name == "" {
+		return addr.Address, nil
+	}
+	return addr.String(), nil
+}
@@ -0,0 +1,127 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testData = map[string]string{
+	"FirstName": "Eli",
+	"Link":      "https://example.com/verify?token=abc&x=<y>",
+	"ExpiresIn": "24 hours",
+}
+
+func TestNewMessage(t *testing.T) {
+	msg, err := NewMessage("testemail@mail.com", "Verify your email", "verify_email", testData)
+	require.NoError(t, err)
+
+	assert.Equal(t, "testemail@mail.com", msg.To)
+	assert.Contains(t, msg.Text, "Hi Eli,")
+	assert.Contains(t, msg.Text, "https://example.com/verify?token=abc&x=<y>")
+	assert.Contains(t, msg.HTML, `href="https://example.com/verify?token=abc&amp;x=%3cy%3e"`)
+
+	_, err = NewMessage("testemail@mail.com", "Missing", "no_such_template", testData)
+	assert.Error(t, err)
+}
+
+func TestMessageBytes(t *testing.T) {
+	msg := &Message{
+		From:    "noreply@example.com",
+		To:      "testemail@mail.com",
+		Subject: "Hello\r\nBcc: someone@example.com",
+		Text:    "plain body",
+		HTML:    "<p>html body</p>",
+	}
+
+	b, err := msg.Bytes()
+	require.NoError(t, err)
+	raw := string(b)
+
+	assert.Contains(t, raw, "Subject: HelloBcc: someone@example.com\r\n", "header injection is stripped")
+	assert.Contains(t, raw, "Content-Type: multipart/alternative; boundary=")
+	assert.Contains(t, raw, "plain body")
+	assert.Contains(t, raw, "<p>html body</p>")
+}
+
+func TestMessageBytesAddresses(t *testing.T) {
+	testCases := []struct {
+		description  string
+		from         string
+		to           string
+		expectedFrom string
+		expectError  bool
+	}{
+		{
+			description:  "Success: Display name kept",
+			from:         "Practice <noreply@example.com>",
+			to:           "testemail@mail.com",
+			expectedFrom: "From: \"Practice\" <noreply@example.com>\r\n",
+		},
+		{
+			description: "Failure: Header injected through To",
+			from:        "noreply@example.com",
+			to:          "testemail@mail.com\r\nBcc: someone@example.com",
+			expectError: true,
+		},
+		{
+			description: "Failure: Header injected through From",
+			from:        "noreply@example.com\nBcc: someone@example.com",
+			to:          "testemail@mail.com",
+			expectError: true,
+		},
+		{
+			description: "Failure: No From",
+			to:          "testemail@mail.com",
+			expectError: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			b, err := (&Message{From: tc.from, To: tc.to, Text: "body"}).Bytes()
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, string(b), tc.expectedFrom)
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(dir, "noreply@example.com")
+	require.NoError(t, err)
+
+	require.NoError(t, m.Send(&Message{To: "testemail@mail.com", Subject: "Hi", Text: "body"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.True(t, strings.HasSuffix(files[0], "testemail_at_mail.com.eml"))
+
+	b, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "From: noreply@example.com")
+}
+
+func TestMemoryMailer(t *testing.T) {
+	m := NewMemoryMailer("noreply@example.com")
+	assert.Nil(t, m.Last())
+
+	require.NoError(t, m.Send(&Message{To: "a@mail.com"}))
+	require.NoError(t, m.Send(&Message{To: "b@mail.com"}))
+
+	assert.Len(t, m.Messages(), 2)
+	assert.Equal(t, "b@mail.com", m.Last().To)
+	assert.Equal(t, "noreply@example.com", m.Last().From)
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import "sync"
+
+// MemoryMailer keeps sent messages in memory for tests.
+type MemoryMailer struct {
+	mu       sync.Mutex
+	messages []*Message
+	from     string
+}
+
+func NewMemoryMailer(from string) *MemoryMailer {
+	return &MemoryMailer{
+		from: from,
+	}
+}
+
+func (m *MemoryMailer) Send(msg *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if msg.From == "" {
+		msg.From = m.from
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns every message sent so far, oldest first.
+func (m *MemoryMailer) Messages() []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]*Message, len(m.messages))
+	copy(out, m.messages)
+	return out
+}
+
+// Last returns the most recently sent message, or nil.
+func (m *MemoryMailer) Last() *Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.messages) == 0 {
+		return nil
+	}
+	return m.messages[len(m.messages)-1]
+}
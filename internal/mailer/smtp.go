@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+
+	"github.com/pkg/errors"
+)
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer sends through an SMTP relay, upgrading to TLS when the server
+// offers STARTTLS. Auth is skipped when username is empty.
+func NewSMTPMailer(host string, port int, username, password, from string) *SMTPMailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		auth: auth,
+		from: from,
+	}
+}
+
+func (s *SMTPMailer) Send(msg *Message) error {
+	if msg.From == "" {
+		msg.From = s.from
+	}
+
+	body, err := msg.Bytes()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := smtp.SendMail(s.addr, s.auth, msg.From, []string{msg.To}, body); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
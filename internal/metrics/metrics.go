@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"database/sql"
+	"db_practice/internal/route"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const namespace = "db_practice"
+
+// Metrics owns a registry and every collector the server reports. Each
+// instance has its own registry, so tests can build one, exercise the code
+// under test and read values back without sharing global state.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+	httpPanics   *prometheus.CounterVec
+	dbQuery      *prometheus.HistogramVec
+
+	usersCreated             prometheus.Counter
+	duplicateEmailRejections prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route template and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		httpPanics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_panics_total",
+			Help:      "Panics recovered from HTTP handlers by route template.",
+		}, []string{"route"}),
+		dbQuery: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Database query latency by query method.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"query"}),
+		usersCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "users_created_total",
+			Help:      "Users created.",
+		}),
+		duplicateEmailRejections: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "users_duplicate_email_rejections_total",
+			Help:      "User creates and updates rejected because the email was taken.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.httpPanics,
+		m.dbQuery,
+		m.usersCreated,
+		m.duplicateEmailRejections,
+	)
+	return m
+}
+
+// Registry exposes the underlying registry, e.g. for testutil.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// RegisterDBStats exports the sql.DBStats pool gauges for conn.
+func (m *Metrics) RegisterDBStats(name string, conn *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(conn, name))
+}
+
+// Middleware records a request count and latency for every request. Wrap it
+// around the whole router, inside route.Track: requests are labelled with
+// the route template, e.g. "/users/{email}", never the raw path, so the
+// number of series stays bounded, and with "unmatched" for unknown paths
+// and methods.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(sw, r)
+
+		tmpl := route.Template(r)
+		m.httpRequests.WithLabelValues(tmpl, r.Method, strconv.Itoa(sw.status)).Inc()
+		m.httpDuration.WithLabelValues(tmpl, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Value reads a metric back from the registry: the value of a counter or
+// gauge, or the sample count of a histogram, whose labels include labels.
+// It returns 0 when nothing matches.
+func (m *Metrics) Value(name string, labels map[string]string) float64 {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return 0
+	}
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			if !hasLabels(metric.GetLabel(), labels) {
+				continue
+			}
+			switch {
+			case metric.Counter != nil:
+				return metric.Counter.GetValue()
+			case metric.Gauge != nil:
+				return metric.Gauge.GetValue()
+			case metric.Histogram != nil:
+				return float64(metric.Histogram.GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+func hasLabels(pairs []*dto.LabelPair, want map[string]string) bool {
+	for k, v := range want {
+		found := false
+		for _, p := range pairs {
+			if p.GetName() == k && p.GetValue() == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// PanicRecovered implements handlers.PanicRecorder.
+func (m *Metrics) PanicRecovered(route string) {
+	m.httpPanics.WithLabelValues(route).Inc()
+}
+
+// ObserveQuery implements db.QueryObserver.
+func (m *Metrics) ObserveQuery(query string, d time.Duration) {
+	m.dbQuery.WithLabelValues(query).Observe(d.Seconds())
+}
+
+// UserCreated implements users.Recorder.
+func (m *Metrics) UserCreated() {
+	m.usersCreated.Inc()
+}
+
+// DuplicateEmailRejected implements users.Recorder.
+func (m *Metrics) DuplicateEmailRejected() {
+	m.duplicateEmailRejections.Inc()
+}
+
+// statusWriter remembers the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"database/sql"
+	"db_practice/internal/route"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	m := New()
+
+	router := mux.NewRouter()
+	router.Use(route.Record)
+	router.HandleFunc("/users/{email}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["email"] == "missing@mail.com" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}).Methods("GET")
+
+	testCases := []struct {
+		description string
+		path        string
+	}{
+		{description: "Success: Found", path: "/users/a@mail.com"},
+		{description: "Success: Found", path: "/users/b@mail.com"},
+		{description: "Failure: Not found", path: "/users/missing@mail.com"},
+		{description: "Failure: Unknown path", path: "/pets/1"},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			route.Track(m.Middleware(router)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tc.path, nil))
+		})
+	}
+
+	// Both emails share one series: labelled by template, not raw path.
+	assert.Equal(t, 2.0, m.Value("db_practice_http_requests_total", map[string]string{"route": "/users/{email}", "method": "GET", "code": "200"}))
+	assert.Equal(t, 1.0, m.Value("db_practice_http_requests_total", map[string]string{"route": "/users/{email}", "code": "404"}))
+	assert.Equal(t, 0.0, m.Value("db_practice_http_requests_total", map[string]string{"route": "/users/a@mail.com"}))
+	assert.Equal(t, 3.0, m.Value("db_practice_http_request_duration_seconds", map[string]string{"route": "/users/{email}"}))
+	// Unknown paths are counted under one label too.
+	assert.Equal(t, 1.0, m.Value("db_practice_http_requests_total", map[string]string{"route": route.Unmatched, "code": "404"}))
+	assert.Equal(t, 0.0, m.Value("db_practice_http_requests_total", map[string]string{"route": "/pets/1"}))
+}
+
+func TestBusinessEvents(t *testing.T) {
+	m := New()
+
+	m.UserCreated()
+	m.UserCreated()
+	m.DuplicateEmailRejected()
+	m.ObserveQuery("CreateUser", 3*time.Millisecond)
+	m.PanicRecovered("/users/{email}")
+
+	assert.Equal(t, 2.0, m.Value("db_practice_users_created_total", nil))
+	assert.Equal(t, 1.0, m.Value("db_practice_users_duplicate_email_rejections_total", nil))
+	assert.Equal(t, 1.0, m.Value("db_practice_db_query_duration_seconds", map[string]string{"query": "CreateUser"}))
+	assert.Equal(t, 0.0, m.Value("db_practice_db_query_duration_seconds", map[string]string{"query": "DeleteUser"}))
+	assert.Equal(t, 1.0, m.Value("db_practice_http_panics_total", map[string]string{"route": "/users/{email}"}))
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+
+	// Opening doesn't connect, which is all the pool gauges need.
+	conn, err := sql.Open("postgres", "postgres://localhost/unused?sslmode=disable")
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetMaxOpenConns(7)
+	m.RegisterDBStats("users", conn)
+
+	m.UserCreated()
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "db_practice_users_created_total 1")
+	assert.Contains(t, w.Body.String(), `go_sql_max_open_connections{db_name="users"} 7`)
+	assert.Contains(t, w.Body.String(), "go_goroutines")
+	assert.Equal(t, 7.0, m.Value("go_sql_max_open_connections", map[string]string{"db_name": "users"}))
+}
@@ -0,0 +1,52 @@
+package mfa
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+// KeySize is the length of the AES-256 key that encrypts secrets at rest.
+const KeySize = 32
+
+var errCiphertext = errors.New("ciphertext too short")
+
+// encrypt seals plaintext with AES-GCM, prefixing the random nonce. The user
+// id is bound as additional data so a ciphertext cannot be moved to another
+// account.
+func encrypt(key, plaintext []byte, userId string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, []byte(userId)), nil
+}
+
+func decrypt(key, ciphertext []byte, userId string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errCiphertext
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+
+	return gcm.Open(nil, nonce, sealed, []byte(userId))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
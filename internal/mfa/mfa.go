@@ -0,0 +1,325 @@
+package mfa
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"db_practice/internal/db"
+	"db_practice/internal/logging"
+	"db_practice/internal/ratelimit"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ChallengeTTL bounds the time between the password step of a login and
+	// the MFA step.
+	ChallengeTTL = 5 * time.Minute
+
+	RecoveryCodeCount = 10
+)
+
+// AttemptLimit bounds the codes tried for one user, right or wrong, so
+// guessing is locked out until the bucket refills.
+var AttemptLimit = ratelimit.Policy{Requests: 5, Per: 15 * time.Minute}
+
+var (
+	ErrNotEnabled       = errors.New("MFA is not enabled")
+	ErrAlreadyEnabled   = errors.New("MFA is already enabled")
+	ErrNotEnrolled      = errors.New("MFA enrollment not started")
+	ErrInvalidCode      = errors.New("Invalid MFA code")
+	ErrInvalidChallenge = errors.New("Invalid or expired MFA challenge")
+	ErrTooManyAttempts  = errors.New("Too many failed MFA attempts")
+)
+
+type Client interface {
+	Enroll(ctx context.Context, userId, account string) (*Enrollment, error)
+	Activate(ctx context.Context, userId, code string) ([]string, error)
+	Enabled(ctx context.Context, userId string) (bool, error)
+	Verify(ctx context.Context, userId, code string) error
+	Disable(ctx context.Context, userId string) error
+	RegenerateRecoveryCodes(ctx context.Context, userId string) ([]string, error)
+	Challenge(ctx context.Context, userId string) (string, error)
+	VerifyChallenge(ctx context.Context, challenge, code string) (string, error)
+}
+
+type MfaClient struct {
+	db     db.MfaClient
+	key    []byte
+	issuer string
+	limits ratelimit.Store
+	now    func() time.Time
+}
+
+// Enrollment is returned once, when the user starts enrolling, so they can
+// add the secret to an authenticator app.
+type Enrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+func NewMfaClient(data db.MfaClient, key []byte, issuer string, limits ratelimit.Store) *MfaClient {
+	return &MfaClient{
+		db:     data,
+		key:    key,
+		issuer: issuer,
+		limits: limits,
+		now:    time.Now,
+	}
+}
+
+// Enroll generates a new secret for the user. MFA is not required until the
+// user proves they can produce codes with Activate.
+func (m *MfaClient) Enroll(ctx context.Context, userId, account string) (*Enrollment, error) {
+	fields := log.Fields{"Id": userId}
+
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ciphertext, err := encrypt(m.key, secret, userId)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := m.db.UpsertUserMfa(ctx, userId, ciphertext); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ErrAlreadyEnabled
+		}
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to store MFA secret: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(fields).Info("MFA enrollment started")
+	return &Enrollment{
+		Secret:     EncodeSecret(secret),
+		OtpauthURI: OtpauthURI(m.issuer, account, secret),
+	}, nil
+}
+
+// Activate confirms enrollment with a code from the new secret, turns MFA on
+// and returns the user's recovery codes.
+func (m *MfaClient) Activate(ctx context.Context, userId, code string) ([]string, error) {
+	fields := log.Fields{"Id": userId}
+
+	stored, err := m.db.GetUserMfa(ctx, userId)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ErrNotEnrolled
+		}
+		return nil, errors.WithStack(err)
+	}
+	if stored.EnabledAt != nil {
+		return nil, ErrAlreadyEnabled
+	}
+
+	if err := m.checkTOTP(ctx, stored, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := m.db.EnableUserMfa(ctx, userId, hashes); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, ErrAlreadyEnabled
+		}
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to enable MFA: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(fields).Info("MFA enabled")
+	return codes, nil
+}
+
+func (m *MfaClient) Enabled(ctx context.Context, userId string) (bool, error) {
+	stored, err := m.db.GetUserMfa(ctx, userId)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	return stored.EnabledAt != nil, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code.
+// Each code works once, and each attempt spends from AttemptLimit.
+func (m *MfaClient) Verify(ctx context.Context, userId, code string) error {
+	fields := log.Fields{"Id": userId}
+
+	limit, err := m.limits.Take(ctx, "mfa|user:"+userId, AttemptLimit, m.now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !limit.Allowed {
+		logging.FromContext(ctx).WithFields(fields).Warn("MFA locked out after repeated attempts")
+		return ErrTooManyAttempts
+	}
+
+	stored, err := m.db.GetUserMfa(ctx, userId)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return ErrNotEnabled
+		}
+		return errors.WithStack(err)
+	}
+	if stored.EnabledAt == nil {
+		return ErrNotEnabled
+	}
+
+	if len(strings.TrimSpace(code)) == Digits {
+		return m.checkTOTP(ctx, stored, code)
+	}
+	return m.useRecoveryCode(ctx, userId, code)
+}
+
+func (m *MfaClient) Disable(ctx context.Context, userId string) error {
+	if err := m.db.DeleteUserMfa(ctx, userId); err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"Id": userId}).Errorf("Failed to disable MFA: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(log.Fields{"Id": userId}).Info("MFA disabled")
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all of the user's recovery codes.
+func (m *MfaClient) RegenerateRecoveryCodes(ctx context.Context, userId string) ([]string, error) {
+	enabled, err := m.Enabled(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrNotEnabled
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := m.db.ReplaceRecoveryCodes(ctx, userId, hashes); err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"Id": userId}).Errorf("Failed to store recovery codes: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(log.Fields{"Id": userId}).Info("MFA recovery codes regenerated")
+	return codes, nil
+}
+
+// Challenge returns a short-lived token proving the user passed the password
+// step of login, to be presented with their code to VerifyChallenge.
+func (m *MfaClient) Challenge(ctx context.Context, userId string) (string, error) {
+	payload := userId + "." + strconv.FormatInt(m.now().Add(ChallengeTTL).Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(m.mac(payload)), nil
+}
+
+// VerifyChallenge checks the challenge and the code and returns the user id.
+func (m *MfaClient) VerifyChallenge(ctx context.Context, challenge, code string) (string, error) {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidChallenge
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, m.mac(parts[0]+"."+parts[1])) {
+		return "", ErrInvalidChallenge
+	}
+
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || !m.now().Before(time.Unix(exp, 0)) {
+		return "", ErrInvalidChallenge
+	}
+
+	if err := m.Verify(ctx, parts[0], code); err != nil {
+		return "", err
+	}
+	return parts[0], nil
+}
+
+func (m *MfaClient) checkTOTP(ctx context.Context, stored *db.UserMfa, code string) error {
+	fields := log.Fields{"Id": stored.UserId}
+
+	secret, err := decrypt(m.key, stored.SecretCiphertext, stored.UserId)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to decrypt MFA secret: %v", err)
+		return errors.WithStack(err)
+	}
+
+	step, ok := Validate(secret, code, m.now())
+	if !ok {
+		return ErrInvalidCode
+	}
+
+	// Refuse a code whose step was already used, even within its window.
+	advanced, err := m.db.AdvanceMfaStep(ctx, stored.UserId, step)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !advanced {
+		logging.FromContext(ctx).WithFields(fields).Warn("Replayed MFA code rejected")
+		return ErrInvalidCode
+	}
+
+	return nil
+}
+
+func (m *MfaClient) useRecoveryCode(ctx context.Context, userId, code string) error {
+	err := m.db.UseRecoveryCode(ctx, userId, hashCode(normalizeRecoveryCode(code)))
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return ErrInvalidCode
+		}
+		return errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(log.Fields{"Id": userId}).Info("MFA recovery code used")
+	return nil
+}
+
+func (m *MfaClient) mac(payload string) []byte {
+	h := hmac.New(sha256.New, m.key)
+	h.Write([]byte("mfa-challenge:" + payload))
+	return h.Sum(nil)
+}
+
+// newRecoveryCodes returns codes formatted for display and the hashes to
+// store.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(b32.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+		hashes[i] = hashCode(raw)
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,248 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/db"
+	"db_practice/internal/ratelimit"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey    = []byte("0123456789abcdef0123456789abcdef")
+	testSecret = []byte("12345678901234567890")
+	testNow    = time.Unix(1700000000, 0)
+)
+
+func newTestMfaClient(data db.MfaClient) *MfaClient {
+	m := NewMfaClient(data, testKey, "db_practice", ratelimit.NewMemoryStore())
+	m.now = func() time.Time { return testNow }
+	return m
+}
+
+func testUserMfa(t *testing.T, enabled bool) *db.UserMfa {
+	ciphertext, err := encrypt(testKey, testSecret, "12infioed")
+	require.NoError(t, err)
+
+	m := &db.UserMfa{UserId: "12infioed", SecretCiphertext: ciphertext}
+	if enabled {
+		m.EnabledAt = &testNow
+	}
+	return m
+}
+
+func TestEnroll(t *testing.T) {
+	testCases := []struct {
+		description string
+		db          *db.TestClient
+		expectedErr error
+	}{
+		{
+			description: "Success: Secret issued",
+			db:          &db.TestClient{},
+		},
+		{
+			description: "Failure: Already enabled",
+			db: &db.TestClient{
+				UpsertUserMfaErr: sql.ErrNoRows,
+			},
+			expectedErr: ErrAlreadyEnabled,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			e, err := newTestMfaClient(tc.db).Enroll(context.Background(), "12infioed", "testemail@mail.com")
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, e.Secret, 32)
+			assert.Contains(t, e.OtpauthURI, "secret="+e.Secret)
+		})
+	}
+}
+
+func TestActivate(t *testing.T) {
+	code := Code(testSecret, Step(testNow), Digits)
+
+	testCases := []struct {
+		description string
+		db          *db.TestClient
+		code        string
+		expectedErr error
+	}{
+		{
+			description: "Success: MFA enabled",
+			db: &db.TestClient{
+				GetUserMfaData:     testUserMfa(t, false),
+				AdvanceMfaStepData: true,
+			},
+			code: code,
+		},
+		{
+			description: "Failure: Wrong code",
+			db: &db.TestClient{
+				GetUserMfaData: testUserMfa(t, false),
+			},
+			code:        "000000",
+			expectedErr: ErrInvalidCode,
+		},
+		{
+			description: "Failure: Not enrolled",
+			db: &db.TestClient{
+				GetUserMfaErr: sql.ErrNoRows,
+			},
+			code:        code,
+			expectedErr: ErrNotEnrolled,
+		},
+		{
+			description: "Failure: Already enabled",
+			db: &db.TestClient{
+				GetUserMfaData: testUserMfa(t, true),
+			},
+			code:        code,
+			expectedErr: ErrAlreadyEnabled,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			codes, err := newTestMfaClient(tc.db).Activate(context.Background(), "12infioed", tc.code)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, codes, RecoveryCodeCount)
+			assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	code := Code(testSecret, Step(testNow), Digits)
+
+	testCases := []struct {
+		description string
+		db          *db.TestClient
+		code        string
+		expectedErr error
+	}{
+		{
+			description: "Success: TOTP code",
+			db: &db.TestClient{
+				GetUserMfaData:     testUserMfa(t, true),
+				AdvanceMfaStepData: true,
+			},
+			code: code,
+		},
+		{
+			description: "Success: Recovery code",
+			db: &db.TestClient{
+				GetUserMfaData: testUserMfa(t, true),
+			},
+			code: "ABCDE-FGHIJ",
+		},
+		{
+			description: "Failure: Replayed TOTP code",
+			db: &db.TestClient{
+				GetUserMfaData:     testUserMfa(t, true),
+				AdvanceMfaStepData: false,
+			},
+			code:        code,
+			expectedErr: ErrInvalidCode,
+		},
+		{
+			description: "Failure: Used recovery code",
+			db: &db.TestClient{
+				GetUserMfaData:     testUserMfa(t, true),
+				UseRecoveryCodeErr: sql.ErrNoRows,
+			},
+			code:        "abcde-fghij",
+			expectedErr: ErrInvalidCode,
+		},
+		{
+			description: "Failure: Not enabled",
+			db: &db.TestClient{
+				GetUserMfaData: testUserMfa(t, false),
+			},
+			code:        code,
+			expectedErr: ErrNotEnabled,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			err := newTestMfaClient(tc.db).Verify(context.Background(), "12infioed", tc.code)
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+func TestVerifyLockout(t *testing.T) {
+	m := newTestMfaClient(&db.TestClient{
+		GetUserMfaData:     testUserMfa(t, true),
+		AdvanceMfaStepData: true,
+	})
+	now := testNow
+	m.now = func() time.Time { return now }
+
+	for i := 0; i < AttemptLimit.Requests; i++ {
+		assert.Equal(t, ErrInvalidCode, m.Verify(context.Background(), "12infioed", "000000"))
+	}
+
+	code := Code(testSecret, Step(testNow), Digits)
+	assert.Equal(t, ErrTooManyAttempts, m.Verify(context.Background(), "12infioed", code))
+
+	// The lockout ends once the bucket refills.
+	now = now.Add(AttemptLimit.Per)
+	assert.NoError(t, m.Verify(context.Background(), "12infioed", Code(testSecret, Step(now), Digits)))
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	data := &db.TestClient{
+		GetUserMfaData:     testUserMfa(t, true),
+		AdvanceMfaStepData: true,
+	}
+	m := newTestMfaClient(data)
+	code := Code(testSecret, Step(testNow), Digits)
+
+	challenge, err := m.Challenge(context.Background(), "12infioed")
+	require.NoError(t, err)
+
+	userId, err := m.VerifyChallenge(context.Background(), challenge, code)
+	require.NoError(t, err)
+	assert.Equal(t, "12infioed", userId)
+
+	_, err = m.VerifyChallenge(context.Background(), challenge+"x", code)
+	assert.Equal(t, ErrInvalidChallenge, err)
+
+	expired := newTestMfaClient(data)
+	expired.now = func() time.Time { return testNow.Add(ChallengeTTL) }
+	_, err = expired.VerifyChallenge(context.Background(), challenge, code)
+	assert.Equal(t, ErrInvalidChallenge, err)
+}
+
+func TestSecretEncryption(t *testing.T) {
+	ciphertext, err := encrypt(testKey, testSecret, "12infioed")
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), string(testSecret))
+
+	plaintext, err := decrypt(testKey, ciphertext, "12infioed")
+	require.NoError(t, err)
+	assert.Equal(t, testSecret, plaintext)
+
+	// Bound to the owning user.
+	_, err = decrypt(testKey, ciphertext, "otheruser")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package mfa
+
+import "context"
+
+type TestClient struct {
+	EnrollData *Enrollment
+	EnrollErr  error
+
+	ActivateData []string
+	ActivateErr  error
+
+	EnabledData bool
+	EnabledErr  error
+
+	VerifyErr  error
+	DisableErr error
+
+	RegenerateRecoveryCodesData []string
+	RegenerateRecoveryCodesErr  error
+
+	ChallengeData string
+	ChallengeErr  error
+
+	VerifyChallengeData string
+	VerifyChallengeErr  error
+}
+
+func (c TestClient) Enroll(ctx context.Context, userId, account string) (*Enrollment, error) {
+	return c.EnrollData, c.EnrollErr
+}
+
+func (c TestClient) Activate(ctx context.Context, userId, code string) ([]string, error) {
+	return c.ActivateData, c.ActivateErr
+}
+
+func (c TestClient) Enabled(ctx context.Context, userId string) (bool, error) {
+	return c.EnabledData, c.EnabledErr
+}
+
+func (c TestClient) Verify(ctx context.Context, userId, code string) error {
+	return c.VerifyErr
+}
+
+func (c TestClient) Disable(ctx context.Context, userId string) error {
+	return c.DisableErr
+}
+
+func (c TestClient) RegenerateRecoveryCodes(ctx context.Context, userId string) ([]string, error) {
+	return c.RegenerateRecoveryCodesData, c.RegenerateRecoveryCodesErr
+}
+
+func (c TestClient) Challenge(ctx context.Context, userId string) (string, error) {
+	return c.ChallengeData, c.ChallengeErr
+}
+
+func (c TestClient) VerifyChallenge(ctx context.Context, challenge, code string) (string, error) {
+	return c.VerifyChallengeData, c.VerifyChallengeErr
+}
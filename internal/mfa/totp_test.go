@@ -0,0 +1,78 @@
+package mfa
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 appendix B, SHA1.
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	testCases := []struct {
+		description string
+		unix        int64
+		expected    string
+	}{
+		{description: "1970-01-01 00:00:59", unix: 59, expected: "94287082"},
+		{description: "2005-03-18 01:58:29", unix: 1111111109, expected: "07081804"},
+		{description: "2005-03-18 01:58:31", unix: 1111111111, expected: "14050471"},
+		{description: "2009-02-13 23:31:30", unix: 1234567890, expected: "89005924"},
+		{description: "2033-05-18 03:33:20", unix: 2000000000, expected: "69279037"},
+		{description: "2603-10-11 11:33:20", unix: 20000000000, expected: "65353130"},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			assert.Equal(t, tc.expected, Code(secret, Step(time.Unix(tc.unix, 0)), 8))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111109, 0)
+	code := Code(secret, Step(now), Digits)
+
+	testCases := []struct {
+		description string
+		at          time.Time
+		code        string
+		expectOK    bool
+	}{
+		{description: "Success: Current step", at: now, code: code, expectOK: true},
+		{description: "Success: Previous step within skew", at: now.Add(Period), code: code, expectOK: true},
+		{description: "Failure: Outside skew", at: now.Add(2 * Period), code: code},
+		{description: "Failure: Wrong code", at: now, code: "000000"},
+		{description: "Failure: Wrong length", at: now, code: "1234"},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			step, ok := Validate(secret, tc.code, tc.at)
+			assert.Equal(t, tc.expectOK, ok)
+			if tc.expectOK {
+				assert.Equal(t, Step(now), step)
+			}
+		})
+	}
+}
+
+func TestOtpauthURI(t *testing.T) {
+	uri := OtpauthURI("db_practice", "testemail@mail.com", []byte("12345678901234567890"))
+
+	u, err := url.Parse(uri)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/db_practice:testemail@mail.com", u.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", u.Query().Get("secret"))
+	assert.Equal(t, "db_practice", u.Query().Get("issuer"))
+}
@@ -0,0 +1,311 @@
+// Package openapi builds an OpenAPI 3.1 document from the routes registered
+// on a mux router and the Go types their handlers read and write, so the
+// document describes the API that is actually served.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const Version = "3.1.0"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// PathItem holds a path's operations by lower-case method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Spec is what the router can't tell: the document's info, how callers
+// authenticate, and what each route does.
+type Spec struct {
+	Info            Info
+	SecuritySchemes map[string]*SecurityScheme
+	Endpoints       []Endpoint
+}
+
+// Endpoint documents the route registered for Method and Path, Path being
+// the mux path template.
+type Endpoint struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	// Security names the schemes the route accepts, any one being enough.
+	// Routes without any are public.
+	Security []string
+	Query    []Query
+	// Request is a value of the JSON body's type, nil if there is none.
+	Request   interface{}
+	Responses []Body
+	// Deprecated routes are kept for compatibility; Description should say
+	// what replaces them.
+	Deprecated bool
+}
+
+// Query is a query string parameter.
+type Query struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Body is one response. Content holds a value of the body's type per media
+// type; responses without a body leave it empty.
+type Body struct {
+	Status      int
+	Description string
+	// Headers describes the response headers by name.
+	Headers map[string]string
+	Content map[string]interface{}
+}
+
+// Build documents every route registered on router. Routes without an
+// Endpoint are left out of the document and, along with Endpoints matching
+// no route, reported in the error.
+func Build(router *mux.Router, spec Spec) (*Document, error) {
+	endpoints := map[string]*Endpoint{}
+	for i := range spec.Endpoints {
+		e := &spec.Endpoints[i]
+		endpoints[e.Method+" "+e.Path] = e
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    spec.Info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			SecuritySchemes: spec.SecuritySchemes,
+		},
+	}
+	s := newSchemas()
+	var problems []string
+	used := map[*Endpoint]bool{}
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			// Subrouters, whose routes are walked on their own.
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Routes matching any method are documented by whichever
+			// methods their Endpoints list.
+			methods = nil
+			for _, e := range spec.Endpoints {
+				if e.Path == path {
+					methods = append(methods, e.Method)
+				}
+			}
+			if len(methods) == 0 {
+				problems = append(problems, "undocumented route * "+path)
+			}
+		}
+
+		for _, method := range methods {
+			e, ok := endpoints[method+" "+path]
+			if !ok {
+				problems = append(problems, "undocumented route "+method+" "+path)
+				continue
+			}
+			used[e] = true
+
+			item, ok := doc.Paths[openAPIPath(path)]
+			if !ok {
+				item = PathItem{}
+				doc.Paths[openAPIPath(path)] = item
+			}
+			item[strings.ToLower(method)] = operation(s, e, route.GetName())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range spec.Endpoints {
+		e := &spec.Endpoints[i]
+		if !used[e] {
+			problems = append(problems, "endpoint "+e.Method+" "+e.Path+" matches no route")
+		}
+	}
+	doc.Components.Schemas = s.components
+
+	if len(problems) > 0 {
+		return doc, fmt.Errorf("openapi: %s", strings.Join(problems, "; "))
+	}
+	return doc, nil
+}
+
+func operation(s *schemas, e *Endpoint, name string) *Operation {
+	op := &Operation{
+		OperationID: operationID(e, name),
+		Summary:     e.Summary,
+		Description: e.Description,
+		Tags:        e.Tags,
+		Responses:   map[string]*Response{},
+		Deprecated:  e.Deprecated,
+	}
+
+	for _, p := range pathParams(e.Path) {
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:     p,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: Types{"string"}},
+		})
+	}
+	for _, q := range e.Query {
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:        q.Name,
+			In:          "query",
+			Description: q.Description,
+			Required:    q.Required,
+			Schema:      &Schema{Type: Types{"string"}},
+		})
+	}
+
+	if e.Request != nil {
+		// Request fields the API doesn't know are mistakes, not extensions.
+		schema := s.of(e.Request)
+		s.closed(schema)
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]*MediaType{"application/json": {Schema: schema}},
+		}
+	}
+
+	for _, b := range e.Responses {
+		resp := &Response{Description: b.Description}
+		if resp.Description == "" {
+			resp.Description = http.StatusText(b.Status)
+		}
+		for name, description := range b.Headers {
+			if resp.Headers == nil {
+				resp.Headers = map[string]*Header{}
+			}
+			resp.Headers[name] = &Header{Description: description, Schema: &Schema{Type: Types{"string"}}}
+		}
+		// Sorted, so component names don't depend on map order.
+		mediaTypes := make([]string, 0, len(b.Content))
+		for mediaType := range b.Content {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+		sort.Strings(mediaTypes)
+		for _, mediaType := range mediaTypes {
+			if resp.Content == nil {
+				resp.Content = map[string]*MediaType{}
+			}
+			resp.Content[mediaType] = &MediaType{Schema: s.of(b.Content[mediaType])}
+		}
+		op.Responses[strconv.Itoa(b.Status)] = resp
+	}
+
+	for _, scheme := range e.Security {
+		op.Security = append(op.Security, map[string][]string{scheme: {}})
+	}
+	return op
+}
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// openAPIPath drops the patterns from a mux path template's variables.
+func openAPIPath(template string) string {
+	return pathParam.ReplaceAllString(template, "{$1}")
+}
+
+func pathParams(template string) []string {
+	var names []string
+	for _, m := range pathParam.FindAllStringSubmatch(template, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// operationID is the route's name when it has one, otherwise made from the
+// method and path, e.g. "get_auth_sessions_id".
+func operationID(e *Endpoint, name string) string {
+	if name != "" {
+		return name
+	}
+	id := strings.ToLower(e.Method)
+	for _, part := range strings.FieldsFunc(openAPIPath(e.Path), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		id += "_" + part
+	}
+	return id
+}
@@ -0,0 +1,172 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type address struct {
+	City string `json:"city"`
+}
+
+type Owner struct {
+	Name string `json:"name"`
+}
+
+type Pet struct {
+	*address
+	Id       string          `json:"id"`
+	Tags     []string        `json:"tags,omitempty"`
+	Owner    *Owner          `json:"owner"`
+	Parent   *Pet            `json:"parent,omitempty"`
+	BornAt   *time.Time      `json:"born_at"`
+	Weight   float64         `json:"weight"`
+	Labels   map[string]int  `json:"labels,omitempty"`
+	Extra    json.RawMessage `json:"extra,omitempty"`
+	Ignored  string          `json:"-"`
+	internal string
+	Untagged bool
+	Inline   struct{ A int64 } `json:"inline"`
+}
+
+func TestSchemas(t *testing.T) {
+	s := newSchemas()
+	ref := s.of(Pet{})
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/Pet"}, ref)
+
+	pet := s.components["Pet"]
+	require.NotNil(t, pet)
+	assert.Equal(t, []string{"city", "id", "owner", "born_at", "weight", "Untagged", "inline"}, pet.Required)
+	assert.Equal(t, &Schema{Type: Types{"string"}}, pet.Properties["city"])
+	assert.Equal(t, &Schema{Type: Types{"array"}, Items: &Schema{Type: Types{"string"}}}, pet.Properties["tags"])
+	assert.Equal(t, &Schema{AnyOf: []*Schema{{Ref: "#/components/schemas/Owner"}, {Type: Types{"null"}}}}, pet.Properties["owner"])
+	assert.Equal(t, &Schema{Ref: "#/components/schemas/Pet"}, pet.Properties["parent"])
+	assert.Equal(t, &Schema{Type: Types{"string", "null"}, Format: "date-time"}, pet.Properties["born_at"])
+	assert.Equal(t, &Schema{Type: Types{"number"}, Format: "double"}, pet.Properties["weight"])
+	assert.Equal(t, &Schema{Type: Types{"object"}, AdditionalProperties: &Schema{Type: Types{"integer"}}}, pet.Properties["labels"])
+	assert.Equal(t, &Schema{}, pet.Properties["extra"])
+	assert.Equal(t, &Schema{Type: Types{"boolean"}}, pet.Properties["Untagged"])
+	assert.Equal(t, &Schema{
+		Type:       Types{"object"},
+		Properties: map[string]*Schema{"A": {Type: Types{"integer"}, Format: "int64"}},
+		Required:   []string{"A"},
+	}, pet.Properties["inline"])
+	assert.NotContains(t, pet.Properties, "Ignored")
+	assert.NotContains(t, pet.Properties, "internal")
+	assert.Contains(t, s.components, "Owner")
+
+	anyOf := s.of(AnyOf(Owner{}, ""))
+	assert.Equal(t, &Schema{AnyOf: []*Schema{{Ref: "#/components/schemas/Owner"}, {Type: Types{"string"}}}}, anyOf)
+
+	b, err := json.Marshal(pet.Properties["born_at"])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":["string","null"],"format":"date-time"}`, string(b))
+}
+
+func TestBuild(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	spec := func(endpoints ...Endpoint) Spec {
+		return Spec{Info: Info{Title: "Pets", Version: "1"}, Endpoints: endpoints}
+	}
+	getPet := Endpoint{
+		Method:  "GET",
+		Path:    "/pets/{id:[0-9]+}",
+		Summary: "Get a pet",
+		Tags:    []string{"pets"},
+		Query:   []Query{{Name: "verbose"}},
+		Responses: []Body{
+			{Status: 200, Content: map[string]interface{}{"application/json": Pet{}}},
+			{Status: 404},
+		},
+		Security: []string{"bearer"},
+	}
+	createPet := Endpoint{
+		Method:  "POST",
+		Path:    "/pets",
+		Request: Pet{},
+		Responses: []Body{{
+			Status:      201,
+			Description: "Created",
+			Headers:     map[string]string{"Location": "The pet's URL"},
+			Content:     map[string]interface{}{"application/json": Pet{}},
+		}},
+		Deprecated: true,
+	}
+	root := Endpoint{Method: "GET", Path: "/", Responses: []Body{{Status: 200}}}
+
+	testCases := []struct {
+		description string
+		spec        Spec
+		expectedErr string
+	}{
+		{
+			description: "Success: Every route documented",
+			spec:        spec(getPet, createPet, root),
+		},
+		{
+			description: "Failure: Route missing from the spec",
+			spec:        spec(getPet, root),
+			expectedErr: "openapi: undocumented route POST /pets",
+		},
+		{
+			description: "Failure: Route without methods missing from the spec",
+			spec:        spec(getPet, createPet),
+			expectedErr: "openapi: undocumented route * /",
+		},
+		{
+			description: "Failure: Endpoint without a route",
+			spec:        spec(getPet, createPet, root, Endpoint{Method: "DELETE", Path: "/pets/{id}"}),
+			expectedErr: "openapi: endpoint DELETE /pets/{id} matches no route",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/", ok)
+			api := router.NewRoute().Subrouter()
+			api.HandleFunc("/pets/{id:[0-9]+}", ok).Methods("GET").Name("pets.get")
+			api.HandleFunc("/pets", ok).Methods("POST")
+
+			doc, err := Build(router, tc.spec)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, Version, doc.OpenAPI)
+			assert.Len(t, doc.Paths, 3)
+			get := doc.Paths["/pets/{id}"]["get"]
+			require.NotNil(t, get)
+			assert.Equal(t, "pets.get", get.OperationID)
+			assert.Equal(t, []*Parameter{
+				{Name: "id", In: "path", Required: true, Schema: &Schema{Type: Types{"string"}}},
+				{Name: "verbose", In: "query", Schema: &Schema{Type: Types{"string"}}},
+			}, get.Parameters)
+			assert.Equal(t, "Not Found", get.Responses["404"].Description)
+			assert.Equal(t, []map[string][]string{{"bearer": {}}}, get.Security)
+
+			post := doc.Paths["/pets"]["post"]
+			require.NotNil(t, post)
+			assert.Equal(t, "post_pets", post.OperationID)
+			assert.Equal(t, &Schema{Ref: "#/components/schemas/Pet"}, post.RequestBody.Content["application/json"].Schema)
+			assert.Equal(t, map[string]*Header{"Location": {Description: "The pet's URL", Schema: &Schema{Type: Types{"string"}}}},
+				post.Responses["201"].Headers)
+			assert.True(t, post.Deprecated)
+			assert.False(t, get.Deprecated)
+			assert.Contains(t, doc.Components.Schemas, "Pet")
+			assert.Contains(t, doc.Components.Schemas, "Owner")
+
+			assert.NotNil(t, doc.Paths["/"]["get"])
+		})
+	}
+}
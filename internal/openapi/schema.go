@@ -0,0 +1,280 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Types is a schema's type, or types. OpenAPI 3.1 writes a nullable value
+// as a list including "null"; a single type is written as a string.
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Schema is the subset of JSON Schema that Go types map to.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 Types              `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+
+	// never is the false schema, which no value matches.
+	never bool
+}
+
+// False is the schema no value matches. As AdditionalProperties it rejects
+// unknown fields.
+func False() *Schema {
+	return &Schema{never: true}
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	if s.never {
+		return []byte("false"), nil
+	}
+	type schema Schema
+	return json.Marshal((*schema)(s))
+}
+
+// anyOf is a body that is one of several types.
+type anyOf []interface{}
+
+// AnyOf describes a body that is a value of any one of the given types.
+func AnyOf(values ...interface{}) interface{} {
+	return anyOf(values)
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemas converts Go types to schemas, collecting named structs as
+// components so each is described once and referenced everywhere else.
+type schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{
+		components: map[string]*Schema{},
+		names:      map[reflect.Type]string{},
+	}
+}
+
+// of describes the JSON encoding of v's type.
+func (s *schemas) of(v interface{}) *Schema {
+	if values, ok := v.(anyOf); ok {
+		schema := &Schema{}
+		for _, value := range values {
+			schema.AnyOf = append(schema.AnyOf, s.of(value))
+		}
+		return schema
+	}
+	return s.typeOf(reflect.TypeOf(v))
+}
+
+func (s *schemas) typeOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	case rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.typeOf(t.Elem())
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Int32, reflect.Uint32:
+		return &Schema{Type: Types{"integer"}, Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}, Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: Types{"number"}, Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: Types{"number"}, Format: "double"}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}, Format: "byte"}
+		}
+		return &Schema{Type: Types{"array"}, Items: s.typeOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: Types{"object"}, AdditionalProperties: s.typeOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + s.component(t)}
+	default:
+		return &Schema{}
+	}
+}
+
+// component registers a named struct, returning its component name. Names
+// are the Go type name, prefixed with the package name if two packages
+// declare the same one.
+func (s *schemas) component(t reflect.Type) string {
+	if name, ok := s.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := s.components[name]; taken {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = string(unicode.ToUpper(rune(pkg[0]))) + pkg[1:] + name
+	}
+	// Registered before the fields are, so recursive types terminate.
+	s.names[t] = name
+	s.components[name] = &Schema{}
+	*s.components[name] = *s.object(t)
+	return name
+}
+
+// object describes a struct the way encoding/json encodes it: exported
+// fields under their json names, with embedded structs' fields promoted.
+// Fields without omitempty are always present, so they are required.
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: Types{"object"}, Properties: map[string]*Schema{}}
+	s.fields(t, schema)
+	return schema
+}
+
+func (s *schemas) fields(t reflect.Type, schema *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				s.fields(embedded, schema)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		field := s.typeOf(f.Type)
+		constrain(field, f.Tag.Get("openapi"))
+		omitempty := strings.Contains(","+opts+",", ",omitempty,")
+		if f.Type.Kind() == reflect.Ptr && !omitempty {
+			field = nullable(field)
+		}
+		schema.Properties[name] = field
+		if !omitempty {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// constrain applies a field's openapi tag, a comma separated list of
+// minLength=n, maxLength=n and format=name, e.g.
+//
+//	Email string `json:"email" openapi:"maxLength=100,format=email"`
+func constrain(schema *Schema, tag string) {
+	if tag == "" {
+		return
+	}
+	for _, opt := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "minLength", "maxLength":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				panic(fmt.Sprintf("openapi: %s=%q is not a number", key, value))
+			}
+			if key == "minLength" {
+				schema.MinLength = &n
+			} else {
+				schema.MaxLength = &n
+			}
+		case "format":
+			schema.Format = value
+		default:
+			panic(fmt.Sprintf("openapi: unknown tag option %q", key))
+		}
+	}
+}
+
+// closed rejects unknown fields in schema's objects, and in those of the
+// objects they hold.
+func (s *schemas) closed(schema *Schema) {
+	seen := map[*Schema]bool{}
+	var walk func(*Schema)
+	walk = func(schema *Schema) {
+		if schema == nil || seen[schema] {
+			return
+		}
+		seen[schema] = true
+		if schema.Ref != "" {
+			walk(s.components[refName(schema.Ref)])
+			return
+		}
+		if schema.Properties != nil && schema.AdditionalProperties == nil {
+			schema.AdditionalProperties = False()
+		}
+		for _, p := range schema.Properties {
+			walk(p)
+		}
+		walk(schema.Items)
+		for _, o := range schema.AnyOf {
+			walk(o)
+		}
+	}
+	walk(schema)
+}
+
+func refName(ref string) string {
+	return strings.TrimPrefix(ref, "#/components/schemas/")
+}
+
+// nullable allows null as well as the values schema describes.
+func nullable(schema *Schema) *Schema {
+	if schema.Ref != "" {
+		return &Schema{AnyOf: []*Schema{schema, {Type: Types{"null"}}}}
+	}
+	if len(schema.Type) == 0 {
+		return schema
+	}
+	schema.Type = append(schema.Type, "null")
+	return schema
+}
@@ -0,0 +1,399 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Violation codes. Those found in requests name errcatalog codes, so they
+// can be reported to clients as field errors. ViolationUndocumented is only
+// found in responses.
+const (
+	ViolationRequired     = "required"
+	ViolationType         = "invalid_type"
+	ViolationTooShort     = "too_short"
+	ViolationTooLong      = "too_long"
+	ViolationFormat       = "invalid_format"
+	ViolationUnknownField = "unknown_field"
+	ViolationNoMatch      = "invalid"
+	ViolationUndocumented = "undocumented"
+)
+
+// Violation is one way a value breaks its schema. Field is the path to the
+// value, e.g. "scopes[1]", and empty for the body itself. Params fill the
+// placeholders of the code's message.
+type Violation struct {
+	Field  string
+	Code   string
+	Params map[string]string
+}
+
+func (v Violation) String() string {
+	var params []string
+	for k, p := range v.Params {
+		params = append(params, k+"="+p)
+	}
+	sort.Strings(params)
+	return strings.TrimSpace(fmt.Sprintf("%s: %s %s", v.Field, v.Code, strings.Join(params, " ")))
+}
+
+// ErrInvalidJSON is returned for request bodies that can't be parsed.
+var ErrInvalidJSON = errors.New("openapi: request body is not valid JSON")
+
+// Validator checks requests and responses against a Document. The
+// document's schemas are compiled once, when the Validator is made.
+type Validator struct {
+	operations map[string]*compiledOperation
+}
+
+type compiledOperation struct {
+	query     []*Parameter
+	request   *compiled
+	responses map[string]map[string]*compiled
+}
+
+// compiled is a schema with its references resolved.
+type compiled struct {
+	never      bool
+	types      []string
+	format     string
+	minLength  *int
+	maxLength  *int
+	properties map[string]*compiled
+	required   []string
+	additional *compiled
+	items      *compiled
+	anyOf      []*compiled
+}
+
+func NewValidator(doc *Document) (*Validator, error) {
+	c := &compiler{
+		components: doc.Components.Schemas,
+		resolved:   map[string]*compiled{},
+	}
+	v := &Validator{operations: map[string]*compiledOperation{}}
+
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			co := &compiledOperation{responses: map[string]map[string]*compiled{}}
+			for _, p := range op.Parameters {
+				if p.In == "query" {
+					co.query = append(co.query, p)
+				}
+			}
+			if op.RequestBody != nil {
+				if m, ok := op.RequestBody.Content["application/json"]; ok {
+					schema, err := c.compile(m.Schema)
+					if err != nil {
+						return nil, fmt.Errorf("%s %s: %w", method, path, err)
+					}
+					co.request = schema
+				}
+			}
+			for status, resp := range op.Responses {
+				co.responses[status] = map[string]*compiled{}
+				for mediaType, m := range resp.Content {
+					schema, err := c.compile(m.Schema)
+					if err != nil {
+						return nil, fmt.Errorf("%s %s %s: %w", method, path, status, err)
+					}
+					co.responses[status][mediaType] = schema
+				}
+			}
+			v.operations[strings.ToUpper(method)+" "+path] = co
+		}
+	}
+	return v, nil
+}
+
+type compiler struct {
+	components map[string]*Schema
+	resolved   map[string]*compiled
+}
+
+func (c *compiler) compile(s *Schema) (*compiled, error) {
+	if s == nil {
+		return &compiled{}, nil
+	}
+	if s.Ref != "" {
+		name := refName(s.Ref)
+		if done, ok := c.resolved[name]; ok {
+			return done, nil
+		}
+		target, ok := c.components[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema %s", s.Ref)
+		}
+		// Resolved before compiling, so recursive schemas terminate.
+		out := &compiled{}
+		c.resolved[name] = out
+		done, err := c.compile(target)
+		if err != nil {
+			return nil, err
+		}
+		*out = *done
+		return out, nil
+	}
+
+	out := &compiled{
+		never:     s.never,
+		types:     s.Type,
+		format:    s.Format,
+		minLength: s.MinLength,
+		maxLength: s.MaxLength,
+		required:  s.Required,
+	}
+	var err error
+	if s.Properties != nil {
+		out.properties = map[string]*compiled{}
+		for name, p := range s.Properties {
+			if out.properties[name], err = c.compile(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.AdditionalProperties != nil {
+		if out.additional, err = c.compile(s.AdditionalProperties); err != nil {
+			return nil, err
+		}
+	}
+	if s.Items != nil {
+		if out.items, err = c.compile(s.Items); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range s.AnyOf {
+		co, err := c.compile(o)
+		if err != nil {
+			return nil, err
+		}
+		out.anyOf = append(out.anyOf, co)
+	}
+	return out, nil
+}
+
+// Request checks the query and JSON body of a request to the route
+// registered for method and the mux path template. Routes not in the
+// document aren't checked. Bodies that aren't JSON give ErrInvalidJSON.
+func (v *Validator) Request(method, template string, query url.Values, body []byte) ([]Violation, error) {
+	op, ok := v.operations[method+" "+openAPIPath(template)]
+	if !ok {
+		return nil, nil
+	}
+
+	var violations []Violation
+	for _, p := range op.query {
+		if p.Required && !query.Has(p.Name) {
+			violations = append(violations, Violation{Field: p.Name, Code: ViolationRequired})
+		}
+	}
+	if op.request == nil {
+		return violations, nil
+	}
+
+	value, err := decode(body)
+	if err != nil {
+		return nil, ErrInvalidJSON
+	}
+	return append(violations, op.request.check("", value)...), nil
+}
+
+// Response checks a response written by the route registered for method
+// and the mux path template. Statuses and media types the document doesn't
+// list are violations too.
+func (v *Validator) Response(method, template string, status int, contentType string, body []byte) []Violation {
+	op, ok := v.operations[method+" "+openAPIPath(template)]
+	if !ok {
+		return nil
+	}
+
+	content, ok := op.responses[strconv.Itoa(status)]
+	if !ok {
+		return []Violation{{Code: ViolationUndocumented, Params: map[string]string{"status": strconv.Itoa(status)}}}
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	schema, ok := content[mediaType]
+	if !ok {
+		return []Violation{{Code: ViolationUndocumented, Params: map[string]string{"status": strconv.Itoa(status), "content_type": mediaType}}}
+	}
+	if !strings.HasSuffix(mediaType, "json") {
+		return nil
+	}
+
+	value, err := decode(body)
+	if err != nil {
+		return []Violation{{Code: ViolationType, Params: map[string]string{"type": "json"}}}
+	}
+	return schema.check("", value)
+}
+
+// decode parses a single JSON value, keeping numbers as json.Number so
+// integers can be told apart.
+func decode(body []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	var value interface{}
+	if err := d.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after JSON value")
+	}
+	return value, nil
+}
+
+func (c *compiled) check(field string, value interface{}) []Violation {
+	if c.never {
+		return []Violation{{Field: field, Code: ViolationUnknownField}}
+	}
+
+	if len(c.anyOf) > 0 {
+		for _, o := range c.anyOf {
+			if len(o.check(field, value)) == 0 {
+				return nil
+			}
+		}
+		return []Violation{{Field: field, Code: ViolationNoMatch}}
+	}
+
+	if len(c.types) > 0 {
+		t := jsonType(value)
+		if !c.allows(t) {
+			return []Violation{{Field: field, Code: ViolationType, Params: map[string]string{"type": strings.Join(c.types, " or ")}}}
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return c.checkString(field, value)
+	case []interface{}:
+		var violations []Violation
+		if c.items != nil {
+			for i, item := range value {
+				violations = append(violations, c.items.check(fmt.Sprintf("%s[%d]", field, i), item)...)
+			}
+		}
+		return violations
+	case map[string]interface{}:
+		return c.checkObject(field, value)
+	}
+	return nil
+}
+
+func (c *compiled) allows(t string) bool {
+	for _, allowed := range c.types {
+		if allowed == t || allowed == "number" && t == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *compiled) checkString(field, value string) []Violation {
+	var violations []Violation
+	length := utf8.RuneCountInString(value)
+	if c.minLength != nil && length < *c.minLength {
+		code := ViolationTooShort
+		if length == 0 {
+			code = ViolationRequired
+		}
+		violations = append(violations, Violation{Field: field, Code: code, Params: map[string]string{"min": strconv.Itoa(*c.minLength)}})
+	}
+	if c.maxLength != nil && length > *c.maxLength {
+		violations = append(violations, Violation{Field: field, Code: ViolationTooLong, Params: map[string]string{"max": strconv.Itoa(*c.maxLength)}})
+	}
+	if length > 0 && !validFormat(c.format, value) {
+		violations = append(violations, Violation{Field: field, Code: ViolationFormat, Params: map[string]string{"format": c.format}})
+	}
+	return violations
+}
+
+// checkObject reports missing fields and then each field's violations, in
+// field name order.
+func (c *compiled) checkObject(field string, value map[string]interface{}) []Violation {
+	var violations []Violation
+	for _, name := range c.required {
+		if _, ok := value[name]; !ok {
+			violations = append(violations, Violation{Field: join(field, name), Code: ViolationRequired})
+		}
+	}
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema, ok := c.properties[name]
+		if !ok {
+			schema = c.additional
+		}
+		if schema != nil {
+			violations = append(violations, schema.check(join(field, name), value[name])...)
+		}
+	}
+	return violations
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
+
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// validFormat checks the formats the API's types use. Others, like the
+// numeric formats, carry no extra constraint on a string.
+func validFormat(format, value string) bool {
+	switch format {
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "byte":
+		_, err := base64.StdEncoding.DecodeString(value)
+		return err == nil
+	default:
+		return true
+	}
+}
@@ -0,0 +1,211 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Signup struct {
+	Name    string   `json:"name" openapi:"minLength=1,maxLength=5"`
+	Email   string   `json:"email" openapi:"format=email"`
+	Age     int      `json:"age,omitempty"`
+	Owner   *Owner   `json:"owner,omitempty"`
+	Nick    *string  `json:"nick,omitempty" openapi:"maxLength=3"`
+	Aliases []string `json:"aliases,omitempty" openapi:"maxLength=3"`
+}
+
+func testValidator(t *testing.T) *Validator {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router := mux.NewRouter()
+	router.HandleFunc("/signups", ok).Methods("POST")
+	router.HandleFunc("/signups/{id:[0-9]+}", ok).Methods("GET")
+
+	doc, err := Build(router, Spec{Info: Info{Title: "Signups", Version: "1"}, Endpoints: []Endpoint{
+		{
+			Method:    "POST",
+			Path:      "/signups",
+			Request:   Signup{},
+			Responses: []Body{{Status: 201, Content: map[string]interface{}{"application/json": Signup{}}}},
+		},
+		{
+			Method:    "GET",
+			Path:      "/signups/{id:[0-9]+}",
+			Query:     []Query{{Name: "fields", Required: true}},
+			Responses: []Body{{Status: 200, Content: map[string]interface{}{"application/json": Signup{}}}},
+		},
+	}})
+	require.NoError(t, err)
+	v, err := NewValidator(doc)
+	require.NoError(t, err)
+	return v
+}
+
+func TestSchemaConstraints(t *testing.T) {
+	s := newSchemas()
+	s.of(Signup{})
+	signup := s.components["Signup"]
+	require.NotNil(t, signup)
+
+	one, five, three := 1, 5, 3
+	assert.Equal(t, &Schema{Type: Types{"string"}, MinLength: &one, MaxLength: &five}, signup.Properties["name"])
+	assert.Equal(t, &Schema{Type: Types{"string"}, Format: "email"}, signup.Properties["email"])
+	assert.Equal(t, &Schema{Type: Types{"string"}, MaxLength: &three}, signup.Properties["nick"])
+	assert.Equal(t, &Schema{Type: Types{"array"}, Items: &Schema{Type: Types{"string"}}, MaxLength: &three}, signup.Properties["aliases"])
+
+	s.closed(&Schema{Ref: "#/components/schemas/Signup"})
+	b, err := json.Marshal(signup)
+	require.NoError(t, err)
+	var closed map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &closed))
+	assert.Equal(t, false, closed["additionalProperties"])
+	assert.True(t, s.components["Owner"].AdditionalProperties.never)
+
+	assert.Panics(t, func() { constrain(&Schema{}, "maxLength=many") })
+	assert.Panics(t, func() { constrain(&Schema{}, "pattern=.*") })
+}
+
+func TestValidatorRequest(t *testing.T) {
+	v := testValidator(t)
+
+	testCases := []struct {
+		description string
+		method      string
+		template    string
+		query       url.Values
+		body        string
+		expected    []Violation
+		expectedErr error
+	}{
+		{
+			description: "Success: Valid body",
+			method:      "POST",
+			template:    "/signups",
+			body:        `{"name":"Ann","email":"ann@example.com","age":30,"owner":{"name":"Bo"}}`,
+		},
+		{
+			description: "Success: Undocumented route isn't checked",
+			method:      "DELETE",
+			template:    "/signups",
+			body:        `not json`,
+		},
+		{
+			description: "Success: Path pattern stripped from the template",
+			method:      "GET",
+			template:    "/signups/{id:[0-9]+}",
+			query:       url.Values{"fields": {"name"}},
+		},
+		{
+			description: "Failure: Every violation reported",
+			method:      "POST",
+			template:    "/signups",
+			body:        `{"name":"Annabel","email":"ann","age":1.5,"owner":{"name":"Bo","pet":true},"nick":"Bobby","aliases":[7],"role":"admin"}`,
+			expected: []Violation{
+				{Field: "age", Code: ViolationType, Params: map[string]string{"type": "integer"}},
+				{Field: "aliases[0]", Code: ViolationType, Params: map[string]string{"type": "string"}},
+				{Field: "email", Code: ViolationFormat, Params: map[string]string{"format": "email"}},
+				{Field: "name", Code: ViolationTooLong, Params: map[string]string{"max": "5"}},
+				{Field: "nick", Code: ViolationTooLong, Params: map[string]string{"max": "3"}},
+				{Field: "owner.pet", Code: ViolationUnknownField},
+				{Field: "role", Code: ViolationUnknownField},
+			},
+		},
+		{
+			description: "Failure: Missing and empty required fields",
+			method:      "POST",
+			template:    "/signups",
+			body:        `{"name":""}`,
+			expected: []Violation{
+				{Field: "email", Code: ViolationRequired},
+				{Field: "name", Code: ViolationRequired, Params: map[string]string{"min": "1"}},
+			},
+		},
+		{
+			description: "Failure: Body isn't an object",
+			method:      "POST",
+			template:    "/signups",
+			body:        `[]`,
+			expected:    []Violation{{Code: ViolationType, Params: map[string]string{"type": "object"}}},
+		},
+		{
+			description: "Failure: Required query parameter missing",
+			method:      "GET",
+			template:    "/signups/{id}",
+			expected:    []Violation{{Field: "fields", Code: ViolationRequired}},
+		},
+		{
+			description: "Failure: Invalid JSON",
+			method:      "POST",
+			template:    "/signups",
+			body:        `{"name":"Ann"} {}`,
+			expectedErr: ErrInvalidJSON,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			violations, err := v.Request(tc.method, tc.template, tc.query, []byte(tc.body))
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, violations)
+		})
+	}
+}
+
+func TestValidatorResponse(t *testing.T) {
+	v := testValidator(t)
+
+	testCases := []struct {
+		description string
+		status      int
+		contentType string
+		body        string
+		expected    []Violation
+	}{
+		{
+			description: "Success: Documented response",
+			status:      201,
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name":"Ann","email":"ann@example.com"}`,
+		},
+		{
+			description: "Failure: Undocumented status",
+			status:      500,
+			contentType: "application/json",
+			body:        `{}`,
+			expected:    []Violation{{Code: ViolationUndocumented, Params: map[string]string{"status": "500"}}},
+		},
+		{
+			description: "Failure: Undocumented media type",
+			status:      201,
+			contentType: "text/plain",
+			body:        `Ann`,
+			expected:    []Violation{{Code: ViolationUndocumented, Params: map[string]string{"status": "201", "content_type": "text/plain"}}},
+		},
+		{
+			description: "Failure: Body drifted from the schema",
+			status:      201,
+			contentType: "application/json",
+			body:        `{"name":"Ann"}`,
+			expected:    []Violation{{Field: "email", Code: ViolationRequired}},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			violations := v.Response("POST", "/signups", tc.status, tc.contentType, []byte(tc.body))
+			assert.Equal(t, tc.expected, violations)
+		})
+	}
+}
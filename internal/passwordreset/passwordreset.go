@@ -0,0 +1,227 @@
+package passwordreset
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"db_practice/internal/auth"
+	"db_practice/internal/db"
+	"db_practice/internal/logging"
+	"db_practice/internal/mailer"
+	"db_practice/internal/ratelimit"
+	"db_practice/internal/sessions"
+	"db_practice/internal/users"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const TokenTTL = time.Hour
+
+// EmailLimit bounds the reset emails one address receives, whichever
+// clients ask for them. Requests per client are limited by the
+// auth.password_reset route policy.
+var EmailLimit = ratelimit.Policy{Requests: 3, Per: time.Hour}
+
+var (
+	ErrInvalidToken = errors.New("Invalid or expired password reset token")
+	ErrRateLimited  = errors.New("Too many password reset requests")
+)
+
+type Client interface {
+	RequestReset(ctx context.Context, email, ip string) error
+	ConfirmReset(ctx context.Context, token, password string) error
+}
+
+type PasswordResetClient struct {
+	db          db.PasswordResetClient
+	usersClient users.Client
+	authClient  auth.Client
+	sessions    sessions.Client
+	mailer      mailer.Mailer
+	baseURL     string
+	limits      ratelimit.Store
+	now         func() time.Time
+	// pending counts reset emails still being sent.
+	pending sync.WaitGroup
+}
+
+func NewPasswordResetClient(data db.PasswordResetClient, u users.Client, a auth.Client, s sessions.Client, m mailer.Mailer, limits ratelimit.Store, baseURL string) *PasswordResetClient {
+	return &PasswordResetClient{
+		db:          data,
+		usersClient: u,
+		authClient:  a,
+		sessions:    s,
+		mailer:      m,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		limits:      limits,
+		now:         time.Now,
+	}
+}
+
+// RequestReset mails a single-use reset link to the account with the given
+// email. Unknown emails succeed silently so callers cannot probe for
+// accounts; only rate limiting is reported. The token is stored and the
+// email sent after it returns, so a known email is answered as quickly as an
+// unknown one; failures are only logged.
+func (p *PasswordResetClient) RequestReset(ctx context.Context, email, ip string) error {
+	email = strings.ToLower(email)
+	fields := log.Fields{"IP": ip}
+
+	now := p.now()
+	limit, err := p.limits.Take(ctx, "password_reset|email:"+email, EmailLimit, now)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !limit.Allowed {
+		logging.FromContext(ctx).WithFields(fields).Warn("Password reset rate limited")
+		return ErrRateLimited
+	}
+
+	user, err := p.usersClient.GetUserByEmail(ctx, email)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Info("Password reset requested for unknown email")
+		return nil
+	}
+
+	// Detached from the request, which ends first, but keeping its logger
+	// and trace.
+	p.pending.Add(1)
+	go func() {
+		defer p.pending.Done()
+		p.send(context.WithoutCancel(ctx), user, ip, now)
+	}()
+	return nil
+}
+
+// send stores a reset token for user and mails them the link.
+func (p *PasswordResetClient) send(ctx context.Context, user *users.User, ip string, now time.Time) {
+	fields := log.Fields{"Id": user.Id, "IP": ip}
+
+	id, err := randomHex(16)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("%+v", errors.WithStack(err))
+		return
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("%+v", errors.WithStack(err))
+		return
+	}
+
+	err = p.db.CreatePasswordResetToken(ctx, &db.PasswordResetToken{
+		Id:        id,
+		UserId:    user.Id,
+		TokenHash: hashToken(token),
+		RequestIP: ip,
+		ExpiresAt: now.Add(TokenTTL),
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to store password reset token: %+v", err)
+		return
+	}
+
+	link := p.baseURL + "/reset-password?token=" + url.QueryEscape(token)
+	msg, err := mailer.NewMessage(user.Email, "Reset your password", "password_reset", map[string]string{
+		"FirstName": user.FirstName,
+		"Link":      link,
+		"ExpiresIn": "1 hour",
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("%+v", errors.WithStack(err))
+		return
+	}
+
+	if err := p.mailer.Send(msg); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to send password reset email: %+v", err)
+		return
+	}
+
+	logging.FromContext(ctx).WithFields(fields).Info("Password reset email sent")
+}
+
+// Wait blocks until every reset email already requested has been sent, or
+// ctx is done.
+func (p *PasswordResetClient) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ConfirmReset consumes the token, sets the new password and signs the user
+// out everywhere, ending both refresh token families and cookie sessions. Other outstanding reset tokens for the user are
+// invalidated.
+func (p *PasswordResetClient) ConfirmReset(ctx context.Context, token, password string) error {
+	stored, err := p.db.ConsumePasswordResetToken(ctx, hashToken(token))
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return ErrInvalidToken
+		}
+		return errors.WithStack(err)
+	}
+	if !p.now().Before(stored.ExpiresAt) {
+		return ErrInvalidToken
+	}
+
+	fields := log.Fields{"Id": stored.UserId}
+
+	if err := p.usersClient.SetPassword(ctx, stored.UserId, password); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to set password: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	if err := p.db.InvalidatePasswordResetTokens(ctx, stored.UserId); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to invalidate password reset tokens: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	if err := p.authClient.RevokeAll(ctx, stored.UserId); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to revoke refresh tokens: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	if err := p.sessions.RevokeAll(ctx, stored.UserId); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to revoke sessions: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(fields).Info("Password reset completed")
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,210 @@
+package passwordreset
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/auth"
+	"db_practice/internal/db"
+	"db_practice/internal/mailer"
+	"db_practice/internal/ratelimit"
+	"db_practice/internal/sessions"
+	"db_practice/internal/users"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testUserEli = &users.User{
+	Id:        "12infioed",
+	FirstName: "Eli",
+	Email:     "testemail@mail.com",
+}
+
+func TestRequestReset(t *testing.T) {
+	testCases := []struct {
+		description string
+		db          *db.TestClient
+		userClient  *users.TestClient
+		emails      []string
+		ips         []string
+		expectedErr error
+		expectMail  bool
+	}{
+		{
+			description: "Success: Reset email sent",
+			userClient: &users.TestClient{
+				GetUserByEmailData: testUserEli,
+			},
+			emails:     []string{"TestEmail@mail.com"},
+			ips:        []string{"10.0.0.1"},
+			expectMail: true,
+		},
+		{
+			description: "Success: Unknown email answers the same",
+			userClient: &users.TestClient{
+				GetUserByEmailErr: sql.ErrNoRows,
+			},
+			emails: []string{"nobody@mail.com"},
+			ips:    []string{"10.0.0.1"},
+		},
+		{
+			description: "Success: Failing to store the token answers the same",
+			db:          &db.TestClient{CreatePasswordResetTokenErr: sql.ErrConnDone},
+			userClient: &users.TestClient{
+				GetUserByEmailData: testUserEli,
+			},
+			emails: []string{"testemail@mail.com"},
+			ips:    []string{"10.0.0.1"},
+		},
+		{
+			description: "Failure: Too many requests for one email",
+			userClient: &users.TestClient{
+				GetUserByEmailData: testUserEli,
+			},
+			emails:      []string{"testemail@mail.com", "testemail@mail.com", "testemail@mail.com", "testemail@mail.com"},
+			ips:         []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+			expectedErr: ErrRateLimited,
+			expectMail:  true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			data := tc.db
+			if data == nil {
+				data = &db.TestClient{}
+			}
+			m := mailer.NewMemoryMailer("noreply@example.com")
+			p := NewPasswordResetClient(data, tc.userClient, &auth.TestClient{}, &sessions.TestClient{}, m, ratelimit.NewMemoryStore(), "https://app.example.com/")
+
+			var err error
+			for j := range tc.emails {
+				err = p.RequestReset(context.Background(), tc.emails[j], tc.ips[j])
+			}
+			assert.Equal(t, tc.expectedErr, err)
+			require.NoError(t, p.Wait(context.Background()))
+
+			if !tc.expectMail {
+				assert.Nil(t, m.Last())
+				return
+			}
+			msg := m.Last()
+			require.NotNil(t, msg)
+			assert.Equal(t, testUserEli.Email, msg.To)
+			assert.Contains(t, msg.Text, "https://app.example.com/reset-password?token=")
+		})
+	}
+}
+
+// blockingMailer holds every send until release is closed.
+type blockingMailer struct {
+	release chan struct{}
+	sent    chan *mailer.Message
+}
+
+func (m *blockingMailer) Send(msg *mailer.Message) error {
+	<-m.release
+	m.sent <- msg
+	return nil
+}
+
+func TestRequestResetDetached(t *testing.T) {
+	m := &blockingMailer{release: make(chan struct{}), sent: make(chan *mailer.Message, 1)}
+	p := NewPasswordResetClient(&db.TestClient{}, &users.TestClient{GetUserByEmailData: testUserEli}, &auth.TestClient{}, &sessions.TestClient{}, m, ratelimit.NewMemoryStore(), "https://app.example.com")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	// Returns while the email is still going out, as it does for an
+	// unknown email.
+	require.NoError(t, p.RequestReset(ctx, testUserEli.Email, "10.0.0.1"))
+	// The request ending does not stop the send.
+	cancel()
+
+	waitCtx, stop := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer stop()
+	assert.Equal(t, context.DeadlineExceeded, p.Wait(waitCtx), "the email is still pending")
+
+	close(m.release)
+	require.NoError(t, p.Wait(context.Background()))
+	assert.Equal(t, testUserEli.Email, (<-m.sent).To)
+}
+
+func TestConfirmReset(t *testing.T) {
+	valid := &db.PasswordResetToken{Id: "token-1", UserId: "12infioed", ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &db.PasswordResetToken{Id: "token-1", UserId: "12infioed", ExpiresAt: time.Now().Add(-time.Minute)}
+
+	testCases := []struct {
+		description    string
+		db             *db.TestClient
+		userClient     *users.TestClient
+		authClient     *auth.TestClient
+		sessionsClient *sessions.TestClient
+		expectedErr    error
+	}{
+		{
+			description: "Success: Password reset and sessions revoked",
+			db: &db.TestClient{
+				ConsumePasswordResetTokenData: valid,
+			},
+			userClient:     &users.TestClient{},
+			authClient:     &auth.TestClient{},
+			sessionsClient: &sessions.TestClient{},
+			expectedErr:    nil,
+		},
+		{
+			description: "Failure: Unknown or used token",
+			db: &db.TestClient{
+				ConsumePasswordResetTokenErr: sql.ErrNoRows,
+			},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Expired token",
+			db: &db.TestClient{
+				ConsumePasswordResetTokenData: expired,
+			},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Sessions not revoked",
+			db: &db.TestClient{
+				ConsumePasswordResetTokenData: valid,
+			},
+			userClient: &users.TestClient{},
+			authClient: &auth.TestClient{
+				RevokeAllErr: errors.New("connection refused"),
+			},
+			expectedErr: errors.New("connection refused"),
+		},
+		{
+			description: "Failure: Cookie sessions not revoked",
+			db: &db.TestClient{
+				ConsumePasswordResetTokenData: valid,
+			},
+			userClient: &users.TestClient{},
+			authClient: &auth.TestClient{},
+			sessionsClient: &sessions.TestClient{
+				RevokeAllErr: errors.New("connection refused"),
+			},
+			expectedErr: errors.New("connection refused"),
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			p := NewPasswordResetClient(tc.db, tc.userClient, tc.authClient, tc.sessionsClient, nil, nil, "")
+			err := p.ConfirmReset(context.Background(), "token", "newpassword123")
+			if tc.expectedErr != nil {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedErr.Error(), err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
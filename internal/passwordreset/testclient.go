@@ -0,0 +1,16 @@
+package passwordreset
+
+import "context"
+
+type TestClient struct {
+	RequestResetErr error
+	ConfirmResetErr error
+}
+
+func (c TestClient) RequestReset(ctx context.Context, email, ip string) error {
+	return c.RequestResetErr
+}
+
+func (c TestClient) ConfirmReset(ctx context.Context, token, password string) error {
+	return c.ConfirmResetErr
+}
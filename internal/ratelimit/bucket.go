@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"db_practice/internal/db"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Policy is a token bucket holding up to Burst tokens, refilled at Requests
+// per Per. Each request spends one token. Burst defaults to Requests.
+type Policy struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Enabled reports whether the policy limits anything.
+func (p Policy) Enabled() bool {
+	return p.Requests > 0 && p.Per > 0
+}
+
+func (p Policy) capacity() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Requests)
+}
+
+// interval is the time it takes to refill one token.
+func (p Policy) interval() time.Duration {
+	return p.Per / time.Duration(p.Requests)
+}
+
+// Result describes a bucket after a request tried to take a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until a token is available. It is zero when
+	// the request was allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// take refills a bucket holding tokens since updated, a zero time meaning a
+// new bucket, and spends a token if there is one.
+func (p Policy) take(tokens float64, updated, now time.Time) (float64, *Result) {
+	capacity := p.capacity()
+	interval := p.interval()
+
+	if updated.IsZero() {
+		tokens = capacity
+	} else if elapsed := now.Sub(updated); elapsed > 0 {
+		tokens = math.Min(capacity, tokens+float64(elapsed)/float64(interval))
+	}
+
+	r := &Result{Limit: int(capacity)}
+	if tokens >= 1 {
+		tokens--
+		r.Allowed = true
+	} else {
+		r.RetryAfter = time.Duration((1 - tokens) * float64(interval))
+	}
+	r.Remaining = int(math.Floor(tokens))
+	r.Reset = time.Duration((capacity - tokens) * float64(interval))
+	return tokens, r
+}
+
+// Store keeps the buckets. Take must be atomic per key.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy, now time.Time) (*Result, error)
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// MemoryStore keeps buckets in process. Each instance enforces its own
+// limits, so behind a load balancer clients get the limit once per instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	takes   int
+}
+
+// memoryPruneEvery is how many takes pass between sweeps for full buckets.
+const memoryPruneEvery = 1024
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*memoryBucket{},
+	}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, p Policy, now time.Time) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.takes++
+	if m.takes%memoryPruneEvery == 0 {
+		for k, b := range m.buckets {
+			if now.After(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{}
+		m.buckets[key] = b
+	}
+
+	tokens, r := p.take(b.tokens, b.updated, now)
+	b.tokens = tokens
+	b.updated = now
+	b.full = now.Add(r.Reset)
+	return r, nil
+}
+
+// PostgresStore keeps buckets in the database, so every instance shares
+// one limit per key.
+type PostgresStore struct {
+	db db.RateLimitClient
+}
+
+func NewPostgresStore(data db.RateLimitClient) *PostgresStore {
+	return &PostgresStore{
+		db: data,
+	}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, p Policy, now time.Time) (*Result, error) {
+	var r *Result
+	err := s.db.UpdateRateLimitBucket(ctx, key, func(b *db.RateLimitBucket) {
+		b.Tokens, r = p.take(b.Tokens, b.UpdatedAt, now)
+		b.UpdatedAt = now
+		b.ExpiresAt = now.Add(r.Reset)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return r, nil
+}
+
+// StartPruning deletes full buckets every interval until stop is called.
+func (s *PostgresStore) StartPruning(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				if _, err := s.db.DeleteExpiredRateLimitBuckets(context.Background(), now); err != nil {
+					log.Errorf("failed to prune rate limit buckets: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"db_practice/internal/db"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestMemoryStoreTake(t *testing.T) {
+	// 6 requests a minute, one token every 10s, in bursts of 3.
+	policy := Policy{Requests: 6, Per: time.Minute, Burst: 3}
+
+	testCases := []struct {
+		description string
+		at          []time.Duration
+		expected    Result
+	}{
+		{
+			description: "Success: New bucket starts full",
+			at:          []time.Duration{0},
+			expected:    Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 10 * time.Second},
+		},
+		{
+			description: "Success: Burst used up",
+			at:          []time.Duration{0, 0, 0},
+			expected:    Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 30 * time.Second},
+		},
+		{
+			description: "Failure: Limited once the burst is spent",
+			at:          []time.Duration{0, 0, 0, 4 * time.Second},
+			expected:    Result{Limit: 3, Remaining: 0, RetryAfter: 6 * time.Second, Reset: 26 * time.Second},
+		},
+		{
+			description: "Success: Tokens refill over time",
+			at:          []time.Duration{0, 0, 0, 10 * time.Second},
+			expected:    Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 30 * time.Second},
+		},
+		{
+			description: "Success: Refill capped at the burst",
+			at:          []time.Duration{0, time.Hour},
+			expected:    Result{Allowed: true, Limit: 3, Remaining: 2, Reset: 10 * time.Second},
+		},
+		{
+			description: "Success: Clock going backwards refills nothing",
+			at:          []time.Duration{0, 0, 0, -time.Minute},
+			expected:    Result{Limit: 3, Remaining: 0, RetryAfter: 10 * time.Second, Reset: 30 * time.Second},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			m := NewMemoryStore()
+			var r *Result
+			var err error
+			for _, at := range tc.at {
+				r, err = m.Take(context.Background(), "users.get|ip:127.0.0.1", policy, start.Add(at))
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.expected, *r)
+
+			// Other keys have buckets of their own.
+			r, err = m.Take(context.Background(), "users.get|ip:10.0.0.1", policy, start)
+			require.NoError(t, err)
+			assert.True(t, r.Allowed)
+		})
+	}
+}
+
+func TestMemoryStorePrune(t *testing.T) {
+	m := NewMemoryStore()
+	policy := Policy{Requests: 1, Per: time.Second}
+
+	for i := 0; i < memoryPruneEvery-1; i++ {
+		_, err := m.Take(context.Background(), fmt.Sprintf("ip:%d", i), policy, start)
+		require.NoError(t, err)
+	}
+	assert.Len(t, m.buckets, memoryPruneEvery-1)
+
+	// Every earlier bucket is full again a minute later.
+	_, err := m.Take(context.Background(), "ip:last", policy, start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, m.buckets, 1)
+}
+
+func TestPostgresStoreTake(t *testing.T) {
+	policy := Policy{Requests: 10, Per: 10 * time.Second}
+
+	testCases := []struct {
+		description string
+		data        *db.RateLimitBucket
+		err         error
+		expected    *Result
+		expectedErr error
+	}{
+		{
+			description: "Success: New bucket",
+			expected:    &Result{Allowed: true, Limit: 10, Remaining: 9, Reset: time.Second},
+		},
+		{
+			description: "Success: Stored bucket refilled",
+			data:        &db.RateLimitBucket{Tokens: 0.5, UpdatedAt: start.Add(-time.Second)},
+			expected:    &Result{Allowed: true, Limit: 10, Remaining: 0, Reset: 9500 * time.Millisecond},
+		},
+		{
+			description: "Failure: Stored bucket empty",
+			data:        &db.RateLimitBucket{Tokens: 0.25, UpdatedAt: start},
+			expected:    &Result{Limit: 10, Remaining: 0, RetryAfter: 750 * time.Millisecond, Reset: 9750 * time.Millisecond},
+		},
+		{
+			description: "Failure: Database error",
+			err:         errors.New("connection refused"),
+			expectedErr: errors.New("connection refused"),
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			s := NewPostgresStore(db.TestClient{
+				UpdateRateLimitBucketData: tc.data,
+				UpdateRateLimitBucketErr:  tc.err,
+			})
+			r, err := s.Take(context.Background(), "users.get|user:abc", policy, start)
+			if tc.expectedErr != nil {
+				assert.EqualError(t, err, tc.expectedErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, r)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package rbac
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PolicyCase is one row of a policy test table. Tables are plain text with
+// four whitespace separated columns; blank lines and lines starting with #
+// are ignored:
+//
+//	# roles        action        resource  expect
+//	user           users:read    own       allow
+//	support,user   users:read    other     allow
+//	user           users:delete  own       deny
+//
+// Roles are comma separated, resource is "own" or "other" relative to the
+// subject, and expect is "allow" or "deny".
+type PolicyCase struct {
+	Line   int
+	Roles  []string
+	Action Action
+	Own    bool
+	Allow  bool
+}
+
+func ParsePolicyTable(r io.Reader) ([]PolicyCase, error) {
+	var cases []PolicyCase
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		cols := strings.Fields(text)
+		if len(cols) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 columns, got %d", line, len(cols))
+		}
+
+		c := PolicyCase{
+			Line:   line,
+			Roles:  strings.Split(cols[0], ","),
+			Action: Action(cols[1]),
+		}
+
+		switch cols[2] {
+		case "own":
+			c.Own = true
+		case "other":
+		default:
+			return nil, fmt.Errorf("line %d: resource must be own or other, got %q", line, cols[2])
+		}
+
+		switch cols[3] {
+		case "allow":
+			c.Allow = true
+		case "deny":
+		default:
+			return nil, fmt.Errorf("line %d: expect must be allow or deny, got %q", line, cols[3])
+		}
+
+		cases = append(cases, c)
+	}
+
+	return cases, scanner.Err()
+}
+
+// PermissionsFor filters a permission set down to the given roles.
+func PermissionsFor(perms []Permission, roles []string) []Permission {
+	held := map[string]bool{}
+	for _, r := range roles {
+		held[r] = true
+	}
+
+	var out []Permission
+	for _, p := range perms {
+		if held[p.Role] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
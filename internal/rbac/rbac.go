@@ -0,0 +1,198 @@
+package rbac
+
+import (
+	"context"
+	"db_practice/internal/db"
+	"db_practice/internal/logging"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type Action string
+
+const (
+	ActionReadUser   Action = "users:read"
+	ActionUpdateUser Action = "users:update"
+	ActionDeleteUser Action = "users:delete"
+)
+
+// Permission scopes. An "own" permission only applies to resources the
+// subject owns.
+const (
+	ScopeOwn = "own"
+	ScopeAny = "any"
+)
+
+// DefaultRole is held implicitly by every authenticated user.
+const DefaultRole = "user"
+
+// DefaultPermissions mirrors the seed data in migrations/create_rbac_tables.sql.
+var DefaultPermissions = []Permission{
+	{Role: "user", Action: ActionReadUser, Scope: ScopeOwn},
+	{Role: "user", Action: ActionUpdateUser, Scope: ScopeOwn},
+	{Role: "support", Action: ActionReadUser, Scope: ScopeAny},
+	{Role: "admin", Action: ActionReadUser, Scope: ScopeAny},
+	{Role: "admin", Action: ActionUpdateUser, Scope: ScopeAny},
+	{Role: "admin", Action: ActionDeleteUser, Scope: ScopeAny},
+}
+
+type Client interface {
+	Can(ctx context.Context, subject string, action Action, resource Resource) (bool, error)
+	CanAll(ctx context.Context, subject string, action Action, resources []Resource) ([]bool, error)
+	CanAny(ctx context.Context, subject string, action Action) (bool, error)
+}
+
+type RbacClient struct {
+	db db.RbacClient
+}
+
+type Permission struct {
+	Role   string
+	Action Action
+	Scope  string
+}
+
+type Resource struct {
+	Type    string
+	Id      string
+	OwnerId string
+}
+
+type Decision struct {
+	Subject  string
+	Action   Action
+	Resource Resource
+	Allowed  bool
+	Reason   string
+}
+
+func NewRbacClient(data db.RbacClient) *RbacClient {
+	return &RbacClient{
+		db: data,
+	}
+}
+
+// UserResource is a user record, which its own user owns.
+func UserResource(id string) Resource {
+	return Resource{Type: "users", Id: id, OwnerId: id}
+}
+
+func (r Resource) String() string {
+	return r.Type + "/" + r.Id
+}
+
+// Can reports whether the subject user may perform the action on the
+// resource. Every decision is logged and recorded in authz_decisions. Errors
+// loading roles deny the request.
+func (c *RbacClient) Can(ctx context.Context, subject string, action Action, resource Resource) (bool, error) {
+	allowed, err := c.CanAll(ctx, subject, action, []Resource{resource})
+	if err != nil {
+		return false, err
+	}
+	return allowed[0], nil
+}
+
+// CanAll decides the action on each resource as Can does, loading the
+// subject's permissions once and recording the decisions together.
+func (c *RbacClient) CanAll(ctx context.Context, subject string, action Action, resources []Resource) ([]bool, error) {
+	perms, err := c.permissions(ctx, subject, action)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]Decision, len(resources))
+	allowed := make([]bool, len(resources))
+	for i, resource := range resources {
+		decisions[i] = Evaluate(subject, perms, action, resource)
+		allowed[i] = decisions[i].Allowed
+	}
+	c.audit(ctx, decisions)
+
+	return allowed, nil
+}
+
+// CanAny reports whether the subject may perform the action on every
+// resource, not only its own. It grants access to nothing by itself, so
+// callers use it to choose what to check with Can, and it isn't audited.
+func (c *RbacClient) CanAny(ctx context.Context, subject string, action Action) (bool, error) {
+	perms, err := c.permissions(ctx, subject, action)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range perms {
+		if p.Action == action && p.Scope == ScopeAny {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// permissions loads what the subject's roles, and the default role, grant.
+func (c *RbacClient) permissions(ctx context.Context, subject string, action Action) ([]Permission, error) {
+	fields := log.Fields{"Subject": subject, "Action": action}
+
+	roles, err := c.db.GetUserRoles(ctx, subject)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to load roles: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+	roles = append(roles, DefaultRole)
+
+	stored, err := c.db.GetRolePermissions(ctx, roles)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to load permissions: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+
+	perms := make([]Permission, len(stored))
+	for i, p := range stored {
+		perms[i] = Permission{Role: p.Role, Action: Action(p.Action), Scope: p.Scope}
+	}
+	return perms, nil
+}
+
+func (c *RbacClient) audit(ctx context.Context, decisions []Decision) {
+	records := make([]*db.AuthzDecision, len(decisions))
+	for i, d := range decisions {
+		fields := log.Fields{"Subject": d.Subject, "Action": d.Action, "Resource": d.Resource.String(), "Allowed": d.Allowed, "Reason": d.Reason}
+		logging.FromContext(ctx).WithFields(fields).Info("Authorization decision")
+
+		records[i] = &db.AuthzDecision{
+			Subject:  d.Subject,
+			Action:   string(d.Action),
+			Resource: d.Resource.String(),
+			Allowed:  d.Allowed,
+			Reason:   d.Reason,
+		}
+	}
+
+	if err := c.db.CreateAuthzDecisions(ctx, records); err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"Decisions": len(records)}).Errorf("Failed to record authorization decisions: %+v", err)
+	}
+}
+
+// Evaluate decides an action against an already-resolved permission set.
+func Evaluate(subject string, perms []Permission, action Action, resource Resource) Decision {
+	d := Decision{Subject: subject, Action: action, Resource: resource}
+
+	for _, p := range perms {
+		if p.Action != action {
+			continue
+		}
+		switch {
+		case p.Scope == ScopeAny:
+			d.Allowed = true
+			d.Reason = "granted by role " + p.Role
+			return d
+		case p.Scope == ScopeOwn && resource.OwnerId != "" && resource.OwnerId == subject:
+			d.Allowed = true
+			d.Reason = "granted by role " + p.Role + " on own resource"
+			return d
+		}
+	}
+
+	d.Reason = "no matching permission"
+	return d
+}
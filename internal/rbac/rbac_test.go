@@ -0,0 +1,251 @@
+package rbac
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/db"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSubject = "12infioed"
+
+func TestDefaultPolicyTable(t *testing.T) {
+	f, err := os.Open("testdata/default_policy.table")
+	require.NoError(t, err)
+	defer f.Close()
+
+	cases, err := ParsePolicyTable(f)
+	require.NoError(t, err)
+	require.NotEmpty(t, cases)
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("line %d", tc.Line), func(t *testing.T) {
+			owner := "someone"
+			if tc.Own {
+				owner = testSubject
+			}
+
+			perms := PermissionsFor(DefaultPermissions, tc.Roles)
+			d := Evaluate(testSubject, perms, tc.Action, UserResource(owner))
+			assert.Equal(t, tc.Allow, d.Allowed, "%v %s: %s", tc.Roles, tc.Action, d.Reason)
+		})
+	}
+}
+
+func TestParsePolicyTable(t *testing.T) {
+	testCases := []struct {
+		description string
+		table       string
+		expectedErr string
+	}{
+		{
+			description: "Success: Comments and blank lines skipped",
+			table:       "# comment\n\nuser users:read own allow\n",
+		},
+		{
+			description: "Failure: Wrong column count",
+			table:       "user users:read own\n",
+			expectedErr: "line 1: expected 4 columns, got 3",
+		},
+		{
+			description: "Failure: Unknown resource",
+			table:       "user users:read mine allow\n",
+			expectedErr: `line 1: resource must be own or other, got "mine"`,
+		},
+		{
+			description: "Failure: Unknown expectation",
+			table:       "user users:read own maybe\n",
+			expectedErr: `line 1: expect must be allow or deny, got "maybe"`,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			cases, err := ParsePolicyTable(strings.NewReader(tc.table))
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+			} else {
+				require.NoError(t, err)
+				assert.Len(t, cases, 1)
+			}
+		})
+	}
+}
+
+func TestCan(t *testing.T) {
+	testCases := []struct {
+		description  string
+		db           *db.TestClient
+		action       Action
+		owner        string
+		expectedData bool
+		expectedErr  bool
+	}{
+		{
+			description: "Success: Own record readable",
+			db: &db.TestClient{
+				GetRolePermissionsData: []*db.Permission{{Role: "user", Action: "users:read", Scope: "own"}},
+			},
+			action:       ActionReadUser,
+			owner:        testSubject,
+			expectedData: true,
+		},
+		{
+			description: "Failure: Other record not readable",
+			db: &db.TestClient{
+				GetRolePermissionsData: []*db.Permission{{Role: "user", Action: "users:read", Scope: "own"}},
+			},
+			action:       ActionReadUser,
+			owner:        "someone",
+			expectedData: false,
+		},
+		{
+			description: "Success: Audit failure does not change decision",
+			db: &db.TestClient{
+				GetRolePermissionsData:  []*db.Permission{{Role: "admin", Action: "users:delete", Scope: "any"}},
+				CreateAuthzDecisionsErr: sql.ErrConnDone,
+			},
+			action:       ActionDeleteUser,
+			owner:        "someone",
+			expectedData: true,
+		},
+		{
+			description: "Failure: Role lookup fails closed",
+			db: &db.TestClient{
+				GetUserRolesErr: sql.ErrConnDone,
+			},
+			action:       ActionReadUser,
+			owner:        testSubject,
+			expectedData: false,
+			expectedErr:  true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			c := NewRbacClient(tc.db)
+			allowed, err := c.Can(context.Background(), testSubject, tc.action, UserResource(tc.owner))
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedData, allowed)
+		})
+	}
+}
+
+func TestCanAll(t *testing.T) {
+	testCases := []struct {
+		description  string
+		db           *db.TestClient
+		owners       []string
+		expectedData []bool
+		expectedErr  bool
+	}{
+		{
+			description: "Success: Each resource decided",
+			db: &db.TestClient{
+				GetRolePermissionsData: []*db.Permission{{Role: "user", Action: "users:read", Scope: "own"}},
+			},
+			owners:       []string{testSubject, "someone"},
+			expectedData: []bool{true, false},
+		},
+		{
+			description: "Failure: Role lookup fails closed",
+			db: &db.TestClient{
+				GetUserRolesErr: sql.ErrConnDone,
+			},
+			owners:      []string{testSubject, "someone"},
+			expectedErr: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			resources := make([]Resource, len(tc.owners))
+			for i, owner := range tc.owners {
+				resources[i] = UserResource(owner)
+			}
+
+			c := NewRbacClient(tc.db)
+			allowed, err := c.CanAll(context.Background(), testSubject, ActionReadUser, resources)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedData, allowed)
+		})
+	}
+}
+
+// auditingDB records the decisions CreateAuthzDecisions is given.
+type auditingDB struct {
+	db.TestClient
+	recorded []*db.AuthzDecision
+}
+
+func (d *auditingDB) CreateAuthzDecisions(ctx context.Context, ds []*db.AuthzDecision) error {
+	d.recorded = append(d.recorded, ds...)
+	return nil
+}
+
+func TestCanAny(t *testing.T) {
+	testCases := []struct {
+		description  string
+		db           db.TestClient
+		expectedData bool
+		expectedErr  bool
+	}{
+		{
+			description: "Success: Permission on any user",
+			db: db.TestClient{
+				GetRolePermissionsData: []*db.Permission{
+					{Role: "user", Action: "users:read", Scope: "own"},
+					{Role: "support", Action: "users:read", Scope: "any"},
+				},
+			},
+			expectedData: true,
+		},
+		{
+			description: "Failure: Permission on own user only",
+			db: db.TestClient{
+				GetRolePermissionsData: []*db.Permission{{Role: "user", Action: "users:read", Scope: "own"}},
+			},
+			expectedData: false,
+		},
+		{
+			description: "Failure: Role lookup fails closed",
+			db: db.TestClient{
+				GetUserRolesErr: sql.ErrConnDone,
+			},
+			expectedErr: true,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			data := &auditingDB{TestClient: tc.db}
+			c := NewRbacClient(data)
+			allowed, err := c.CanAny(context.Background(), testSubject, ActionReadUser)
+			if tc.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedData, allowed)
+			assert.Empty(t, data.recorded)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package rbac
+
+import "context"
+
+type TestClient struct {
+	CanData bool
+	CanErr  error
+	// OwnOnly denies resources the subject doesn't own, as the default user
+	// role does, and answers CanData for the rest.
+	OwnOnly bool
+}
+
+func (c TestClient) Can(ctx context.Context, subject string, action Action, resource Resource) (bool, error) {
+	if c.OwnOnly && resource.OwnerId != subject {
+		return false, c.CanErr
+	}
+	return c.CanData, c.CanErr
+}
+
+func (c TestClient) CanAll(ctx context.Context, subject string, action Action, resources []Resource) ([]bool, error) {
+	if c.CanErr != nil {
+		return nil, c.CanErr
+	}
+	allowed := make([]bool, len(resources))
+	for i, resource := range resources {
+		allowed[i], _ = c.Can(ctx, subject, action, resource)
+	}
+	return allowed, nil
+}
+
+// CanAny answers CanData, or false with OwnOnly.
+func (c TestClient) CanAny(ctx context.Context, subject string, action Action) (bool, error) {
+	if c.OwnOnly {
+		return false, c.CanErr
+	}
+	return c.CanData, c.CanErr
+}
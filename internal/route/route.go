@@ -0,0 +1,67 @@
+// Package route tells middleware wrapped around the router which route
+// served a request. mux only knows inside the router, and only once a route
+// matched, so router middleware that must also see 404s and 405s goes
+// around the router and reads the route from here instead.
+package route
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Unmatched labels requests no route served, e.g. unknown paths and wrong
+// methods.
+const Unmatched = "unmatched"
+
+type contextKey struct{}
+
+// holder is filled in by Record inside the router and read by Template
+// outside it, once the request has been served.
+type holder struct {
+	template string
+}
+
+// Track lets Template find the route of requests served by next. Install it
+// outside every middleware calling Template.
+func Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(contextKey{}).(*holder); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, &holder{})))
+	})
+}
+
+// Record is router middleware noting the matched route for Track.
+func Record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := r.Context().Value(contextKey{}).(*holder); ok {
+			h.template = current(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Template is the path template of the route serving r, e.g.
+// "/v1/users/{id}", never the raw path, or Unmatched.
+func Template(r *http.Request) string {
+	if tmpl := current(r); tmpl != "" {
+		return tmpl
+	}
+	if h, ok := r.Context().Value(contextKey{}).(*holder); ok && h.template != "" {
+		return h.template
+	}
+	return Unmatched
+}
+
+func current(r *http.Request) string {
+	if c := mux.CurrentRoute(r); c != nil {
+		if tmpl, err := c.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return ""
+}
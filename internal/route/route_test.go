@@ -0,0 +1,57 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Record)
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+
+	testCases := []struct {
+		description string
+		method      string
+		path        string
+		expected    string
+	}{
+		{
+			description: "Success: Matched route's template",
+			method:      "GET",
+			path:        "/users/1",
+			expected:    "/users/{id}",
+		},
+		{
+			description: "Success: Unknown path",
+			method:      "GET",
+			path:        "/pets/1",
+			expected:    Unmatched,
+		},
+		{
+			description: "Success: Wrong method",
+			method:      "DELETE",
+			path:        "/users/1",
+			expected:    Unmatched,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			var template string
+			handler := Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				router.ServeHTTP(w, r)
+				template = Template(r)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tc.method, tc.path, nil))
+
+			assert.Equal(t, tc.expected, template)
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package sessions
+
+import "context"
+
+type contextKey int
+
+const sessionKey contextKey = iota
+
+// WithSession returns a copy of ctx carrying the cookie session the request
+// authenticated with.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey, s)
+}
+
+// SessionFromContext returns the request's cookie session, if any.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey).(*Session)
+	return s, ok && s != nil
+}
@@ -0,0 +1,105 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/db"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process session store for tests and single-instance
+// local runs. Sessions are lost on restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]db.Session
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: map[string]db.Session{},
+	}
+}
+
+func (m *MemoryStore) CreateSession(ctx context.Context, s *db.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.LastSeenAt = s.CreatedAt
+	m.sessions[s.Id] = *s
+	return nil
+}
+
+func (m *MemoryStore) GetSessionByHash(ctx context.Context, hash string) (*db.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.sessions {
+		if s.TokenHash == hash {
+			return &s, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *MemoryStore) TouchSession(ctx context.Context, id string, lastSeenAt, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || s.RevokedAt != nil {
+		return nil
+	}
+	s.LastSeenAt = lastSeenAt
+	s.ExpiresAt = expiresAt
+	m.sessions[id] = s
+	return nil
+}
+
+func (m *MemoryStore) ListUserSessions(ctx context.Context, userId string) ([]*db.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	sessions := []*db.Session{}
+	for _, s := range m.sessions {
+		if s.UserId == userId && s.RevokedAt == nil && s.ExpiresAt.After(now) {
+			s := s
+			sessions = append(sessions, &s)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (m *MemoryStore) RevokeSession(ctx context.Context, userId, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok || s.UserId != userId || s.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	s.RevokedAt = &now
+	m.sessions[id] = s
+	return nil
+}
+
+func (m *MemoryStore) RevokeUserSessions(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, s := range m.sessions {
+		if s.UserId == userId && s.RevokedAt == nil {
+			s.RevokedAt = &now
+			m.sessions[id] = s
+		}
+	}
+	return nil
+}
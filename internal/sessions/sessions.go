@@ -0,0 +1,217 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"db_practice/internal/db"
+	"db_practice/internal/logging"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// IdleTimeout is how long a session survives without use. Each use
+	// slides the expiry forward, up to MaxLifetime after sign-in.
+	IdleTimeout = 7 * 24 * time.Hour
+	MaxLifetime = 30 * 24 * time.Hour
+
+	// TouchInterval throttles last-seen writes for busy sessions.
+	TouchInterval = time.Minute
+)
+
+var ErrInvalidSession = errors.New("Invalid or expired session")
+
+type Client interface {
+	Create(ctx context.Context, userId, userAgent, ip string) (*Session, string, error)
+	Authenticate(ctx context.Context, token string) (*Session, bool, error)
+	List(ctx context.Context, userId string) ([]*Session, error)
+	Revoke(ctx context.Context, userId, id string) error
+	RevokeToken(ctx context.Context, token string) error
+	RevokeAll(ctx context.Context, userId string) error
+}
+
+type SessionsClient struct {
+	store db.SessionsClient
+	now   func() time.Time
+}
+
+type Session struct {
+	Id         string    `json:"id"`
+	UserId     string    `json:"user_id"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	IP         string    `json:"ip,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// NewSessionsClient takes the session store: *db.DB for Postgres, or a
+// MemoryStore.
+func NewSessionsClient(store db.SessionsClient) *SessionsClient {
+	return &SessionsClient{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Create starts a session and returns it with the token for the cookie. Only
+// a hash of the token is stored.
+func (s *SessionsClient) Create(ctx context.Context, userId, userAgent, ip string) (*Session, string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	now := s.now()
+	stored := &db.Session{
+		Id:         id,
+		UserId:     userId,
+		TokenHash:  hashToken(token),
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(IdleTimeout),
+	}
+	if err := s.store.CreateSession(ctx, stored); err != nil {
+		logging.FromContext(ctx).WithFields(log.Fields{"Id": userId}).Errorf("Failed to create session: %+v", err)
+		return nil, "", errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(log.Fields{"Id": userId, "Session Id": id}).Info("Session created")
+	return dbToSession(stored), token, nil
+}
+
+// Authenticate looks up a live session by token and slides its expiry. The
+// bool reports whether the expiry moved, so the caller can refresh the
+// cookie.
+func (s *SessionsClient) Authenticate(ctx context.Context, token string) (*Session, bool, error) {
+	stored, err := s.store.GetSessionByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, false, ErrInvalidSession
+		}
+		return nil, false, errors.WithStack(err)
+	}
+
+	now := s.now()
+	if stored.RevokedAt != nil || !now.Before(stored.ExpiresAt) {
+		return nil, false, ErrInvalidSession
+	}
+
+	if now.Sub(stored.LastSeenAt) < TouchInterval {
+		return dbToSession(stored), false, nil
+	}
+
+	expiresAt := now.Add(IdleTimeout)
+	if limit := stored.CreatedAt.Add(MaxLifetime); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+
+	if err := s.store.TouchSession(ctx, stored.Id, now, expiresAt); err != nil {
+		// The session is still valid; only its expiry did not slide.
+		logging.FromContext(ctx).WithFields(log.Fields{"Session Id": stored.Id}).Errorf("Failed to touch session: %+v", err)
+		return dbToSession(stored), false, nil
+	}
+	stored.LastSeenAt = now
+	stored.ExpiresAt = expiresAt
+
+	return dbToSession(stored), true, nil
+}
+
+func (s *SessionsClient) List(ctx context.Context, userId string) ([]*Session, error) {
+	stored, err := s.store.ListUserSessions(ctx, userId)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sessions := make([]*Session, len(stored))
+	for i, st := range stored {
+		sessions[i] = dbToSession(st)
+	}
+	return sessions, nil
+}
+
+// Revoke ends one of the user's own sessions. It returns sql.ErrNoRows when
+// the user has no live session with that id.
+func (s *SessionsClient) Revoke(ctx context.Context, userId, id string) error {
+	if err := s.store.RevokeSession(ctx, userId, id); err != nil {
+		return errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(log.Fields{"Id": userId, "Session Id": id}).Info("Session revoked")
+	return nil
+}
+
+// RevokeToken ends the session the token belongs to, for sign-out.
+func (s *SessionsClient) RevokeToken(ctx context.Context, token string) error {
+	stored, err := s.store.GetSessionByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return ErrInvalidSession
+		}
+		return errors.WithStack(err)
+	}
+
+	err = s.store.RevokeSession(ctx, stored.UserId, stored.Id)
+	if err != nil && errors.Cause(err) != sql.ErrNoRows {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *SessionsClient) RevokeAll(ctx context.Context, userId string) error {
+	if err := s.store.RevokeUserSessions(ctx, userId); err != nil {
+		return errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(log.Fields{"Id": userId}).Info("All sessions revoked")
+	return nil
+}
+
+func dbToSession(s *db.Session) *Session {
+	return &Session{
+		Id:         s.Id,
+		UserId:     s.UserId,
+		UserAgent:  s.UserAgent,
+		IP:         s.IP,
+		CreatedAt:  s.CreatedAt,
+		LastSeenAt: s.LastSeenAt,
+		ExpiresAt:  s.ExpiresAt,
+	}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSessionsClient(now *time.Time) *SessionsClient {
+	s := NewSessionsClient(NewMemoryStore())
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestAuthenticate(t *testing.T) {
+	start := time.Now()
+
+	testCases := []struct {
+		description    string
+		after          time.Duration
+		revoke         bool
+		expectExtended bool
+		expectedErr    error
+	}{
+		{
+			description: "Success: Recent session not touched",
+			after:       time.Second,
+		},
+		{
+			description:    "Success: Expiry slides forward",
+			after:          time.Hour,
+			expectExtended: true,
+		},
+		{
+			description: "Failure: Idle too long",
+			after:       IdleTimeout,
+			expectedErr: ErrInvalidSession,
+		},
+		{
+			description: "Failure: Revoked",
+			after:       time.Second,
+			revoke:      true,
+			expectedErr: ErrInvalidSession,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			now := start
+			s := newTestSessionsClient(&now)
+
+			created, token, err := s.Create(context.Background(), "12infioed", "Mozilla/5.0", "10.0.0.1")
+			require.NoError(t, err)
+			if tc.revoke {
+				require.NoError(t, s.RevokeToken(context.Background(), token))
+			}
+
+			now = start.Add(tc.after)
+			session, extended, err := s.Authenticate(context.Background(), token)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, created.Id, session.Id)
+			assert.Equal(t, tc.expectExtended, extended)
+			if tc.expectExtended {
+				assert.Equal(t, now.Add(IdleTimeout), session.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestAuthenticateMaxLifetime(t *testing.T) {
+	now := time.Now()
+	start := now
+	s := newTestSessionsClient(&now)
+
+	_, token, err := s.Create(context.Background(), "12infioed", "", "")
+	require.NoError(t, err)
+
+	// Keep the session busy until its hard limit.
+	for now.Sub(start) < MaxLifetime-IdleTimeout {
+		now = now.Add(24 * time.Hour)
+		_, _, err := s.Authenticate(context.Background(), token)
+		require.NoError(t, err)
+	}
+
+	now = now.Add(24 * time.Hour)
+	session, _, err := s.Authenticate(context.Background(), token)
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(MaxLifetime), session.ExpiresAt)
+
+	now = start.Add(MaxLifetime)
+	_, _, err = s.Authenticate(context.Background(), token)
+	assert.Equal(t, ErrInvalidSession, err)
+}
+
+func TestRevoke(t *testing.T) {
+	now := time.Now()
+	s := newTestSessionsClient(&now)
+
+	first, _, err := s.Create(context.Background(), "12infioed", "Firefox", "")
+	require.NoError(t, err)
+	_, _, err = s.Create(context.Background(), "12infioed", "Safari", "")
+	require.NoError(t, err)
+
+	list, err := s.List(context.Background(), "12infioed")
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	// Users can only revoke their own sessions.
+	err = s.Revoke(context.Background(), "otheruser", first.Id)
+	assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
+
+	require.NoError(t, s.Revoke(context.Background(), "12infioed", first.Id))
+	list, err = s.List(context.Background(), "12infioed")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "Safari", list[0].UserAgent)
+
+	require.NoError(t, s.RevokeAll(context.Background(), "12infioed"))
+	list, err = s.List(context.Background(), "12infioed")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
@@ -0,0 +1,44 @@
+package sessions
+
+import "context"
+
+type TestClient struct {
+	CreateData  *Session
+	CreateToken string
+	CreateErr   error
+
+	AuthenticateData     *Session
+	AuthenticateExtended bool
+	AuthenticateErr      error
+
+	ListData []*Session
+	ListErr  error
+
+	RevokeErr      error
+	RevokeTokenErr error
+	RevokeAllErr   error
+}
+
+func (c TestClient) Create(ctx context.Context, userId, userAgent, ip string) (*Session, string, error) {
+	return c.CreateData, c.CreateToken, c.CreateErr
+}
+
+func (c TestClient) Authenticate(ctx context.Context, token string) (*Session, bool, error) {
+	return c.AuthenticateData, c.AuthenticateExtended, c.AuthenticateErr
+}
+
+func (c TestClient) List(ctx context.Context, userId string) ([]*Session, error) {
+	return c.ListData, c.ListErr
+}
+
+func (c TestClient) Revoke(ctx context.Context, userId, id string) error {
+	return c.RevokeErr
+}
+
+func (c TestClient) RevokeToken(ctx context.Context, token string) error {
+	return c.RevokeTokenErr
+}
+
+func (c TestClient) RevokeAll(ctx context.Context, userId string) error {
+	return c.RevokeAllErr
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SanitizeSQL prepares a statement for a span: whitespace runs collapse to
+// one space and string and numeric literals become "?", so no value that
+// was inlined into the text is exported. Placeholders such as $1 are kept.
+func SanitizeSQL(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	space := false
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			space = b.Len() > 0
+			continue
+		case c == '\'':
+			// '' inside a literal is an escaped quote.
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			writeSpace(&b, &space)
+			b.WriteRune('?')
+			continue
+		case unicode.IsDigit(c) && !inWord(runes, i):
+			for i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.') {
+				i++
+			}
+			writeSpace(&b, &space)
+			b.WriteRune('?')
+			continue
+		}
+		writeSpace(&b, &space)
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func writeSpace(b *strings.Builder, space *bool) {
+	if *space {
+		b.WriteByte(' ')
+		*space = false
+	}
+}
+
+// inWord reports whether the digit at i continues an identifier or a
+// placeholder, e.g. the 2 in "v2" or "$2".
+func inWord(runes []rune, i int) bool {
+	if i == 0 {
+		return false
+	}
+	p := runes[i-1]
+	return p == '$' || p == '_' || unicode.IsLetter(p) || unicode.IsDigit(p)
+}
+
+// Operation is the statement's leading keyword, e.g. "SELECT".
+func Operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,167 @@
+package tracing
+
+import (
+	"context"
+	"db_practice/internal/route"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+var Exporters = []string{ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP}
+
+type Options struct {
+	ServiceName string
+	Exporter    string
+	// File is where the file exporter appends spans, one JSON object each.
+	File string
+	// OTLPEndpoint is the collector's OTLP/HTTP base URL, e.g.
+	// "http://localhost:4318". Spans are posted to <endpoint>/v1/traces.
+	OTLPEndpoint string
+	// SampleRatio is the fraction of new traces recorded. Requests that
+	// arrive with a sampled traceparent are always recorded.
+	SampleRatio float64
+}
+
+// Provider is the installed tracer provider. Shutdown flushes any buffered
+// spans, so it must run after the server has stopped taking requests.
+type Provider struct {
+	*sdktrace.TracerProvider
+	closer io.Closer
+}
+
+func (p *Provider) Shutdown(ctx context.Context) error {
+	err := p.TracerProvider.Shutdown(ctx)
+	if p.closer != nil {
+		err = errors.Join(err, p.closer.Close())
+	}
+	return err
+}
+
+// Setup installs a global tracer provider and the W3C trace context and
+// baggage propagators. With ExporterNone spans are still created, so trace
+// ids reach the logs and propagate downstream, but none are exported.
+func Setup(ctx context.Context, opts Options) (*Provider, error) {
+	p := &Provider{}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch opts.Exporter {
+	case ExporterNone, "":
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		f, ferr := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if ferr != nil {
+			return nil, ferr
+		}
+		p.closer = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opts.OTLPEndpoint))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(opts.ServiceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tpOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	}
+	if exporter != nil {
+		tpOpts = append(tpOpts, sdktrace.WithBatcher(exporter))
+	}
+	p.TracerProvider = sdktrace.NewTracerProvider(tpOpts...)
+
+	otel.SetTracerProvider(p.TracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return p, nil
+}
+
+// Middleware starts a server span for every request served by next,
+// continuing any trace started by the caller's traceparent. Wrap it around
+// the whole router, inside route.Track, so unknown paths and methods are
+// traced too. Spans are named after the route template once it is known.
+func Middleware(service string, next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		span := trace.SpanFromContext(r.Context())
+		tmpl := route.Template(r)
+		span.SetName(tmpl)
+		if tmpl != route.Unmatched {
+			span.SetAttributes(semconv.HTTPRoute(tmpl))
+		}
+	})
+	return otelhttp.NewHandler(named, service)
+}
+
+// LogHook adds the trace and span ids to entries logged with a span's
+// context, e.g. log.WithContext(ctx).Error(...), so logs and traces can be
+// joined.
+type LogHook struct{}
+
+func (LogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (LogHook) Fire(e *log.Entry) error {
+	if e.Context == nil {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(e.Context)
+	if !sc.IsValid() {
+		return nil
+	}
+	e.Data["trace_id"] = sc.TraceID().String()
+	e.Data["span_id"] = sc.SpanID().String()
+	return nil
+}
+
+// Transport injects the traceparent of the request's context into outgoing
+// requests. Wrap the transport of any client calling another service:
+//
+//	client := &http.Client{Transport: tracing.Transport(http.DefaultTransport)}
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+	return t.base.RoundTrip(r)
+}
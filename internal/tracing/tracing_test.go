@@ -0,0 +1,300 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"db_practice/internal/route"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestSanitizeSQL(t *testing.T) {
+	testCases := []struct {
+		description string
+		query       string
+		expected    string
+	}{
+		{
+			description: "Success: Whitespace collapsed, placeholders kept",
+			query:       "\n\t\tSELECT id, email\n\t\tFROM users\n\t\tWHERE email = $1\n  ",
+			expected:    "SELECT id, email FROM users WHERE email = $1",
+		},
+		{
+			description: "Success: String literals removed",
+			query:       "UPDATE users SET status = CASE WHEN email = $4 THEN status ELSE 'pending_verification' END",
+			expected:    "UPDATE users SET status = CASE WHEN email = $4 THEN status ELSE ? END",
+		},
+		{
+			description: "Success: Escaped quotes stay inside the literal",
+			query:       "SELECT 1 FROM users WHERE last_name = 'O''Brien' LIMIT 10",
+			expected:    "SELECT ? FROM users WHERE last_name = ? LIMIT ?",
+		},
+		{
+			description: "Success: Digits in identifiers and placeholders kept",
+			query:       "SELECT v2.id FROM t_1 v2 WHERE x = $12 AND y > 0.5",
+			expected:    "SELECT v2.id FROM t_1 v2 WHERE x = $12 AND y > ?",
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			assert.Equal(t, tc.expected, SanitizeSQL(tc.query))
+		})
+	}
+
+	assert.Equal(t, "INSERT", Operation("\n insert INTO users"))
+	assert.Equal(t, "", Operation(" "))
+}
+
+func TestSetup(t *testing.T) {
+	// A stand-in collector receiving OTLP over HTTP.
+	received := make(chan string, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		select {
+		case received <- r.URL.Path + " " + string(body):
+		default:
+		}
+	}))
+	defer collector.Close()
+
+	testCases := []struct {
+		description string
+		options     Options
+		expectedErr string
+		check       func(t *testing.T, opts Options)
+	}{
+		{
+			description: "Success: No exporter",
+			options:     Options{Exporter: ExporterNone},
+		},
+		{
+			description: "Success: File exporter",
+			options:     Options{Exporter: ExporterFile, File: filepath.Join(t.TempDir(), "traces.jsonl")},
+			check: func(t *testing.T, opts Options) {
+				contents, err := os.ReadFile(opts.File)
+				require.NoError(t, err)
+				var span struct{ Name string }
+				require.NoError(t, json.NewDecoder(bytes.NewReader(contents)).Decode(&span))
+				assert.Equal(t, "test-span", span.Name)
+			},
+		},
+		{
+			description: "Success: OTLP exporter",
+			options:     Options{Exporter: ExporterOTLP, OTLPEndpoint: collector.URL},
+			check: func(t *testing.T, opts Options) {
+				got := <-received
+				assert.Contains(t, got, "/v1/traces ")
+				assert.Contains(t, got, "test-span")
+			},
+		},
+		{
+			description: "Failure: Unknown exporter",
+			options:     Options{Exporter: "jaeger"},
+			expectedErr: `unknown trace exporter "jaeger"`,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			tc.options.ServiceName = "db_practice_test"
+			tc.options.SampleRatio = 1
+			p, err := Setup(context.Background(), tc.options)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+			assert.True(t, span.SpanContext().IsSampled())
+			span.End()
+
+			// Shutdown flushes the batch to the exporter.
+			require.NoError(t, p.Shutdown(context.Background()))
+			if tc.check != nil {
+				tc.check(t, tc.options)
+			}
+		})
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	p, err := Setup(context.Background(), Options{ServiceName: "db_practice_test", SampleRatio: 0})
+	require.NoError(t, err)
+	defer p.Shutdown(context.Background())
+
+	// Downstream service: records the traceparent it was sent.
+	var outgoing string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outgoing = r.Header.Get("traceparent")
+	}))
+	defer downstream.Close()
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+
+	var routeSpan trace.SpanContext
+	router := mux.NewRouter()
+	router.Use(route.Record)
+	router.HandleFunc("/users/{email}", func(w http.ResponseWriter, r *http.Request) {
+		routeSpan = trace.SpanContextFromContext(r.Context())
+
+		req, err := http.NewRequestWithContext(r.Context(), "GET", downstream.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	})
+
+	r := httptest.NewRequest("GET", "/users/a@mail.com", nil)
+	r.Header.Set("traceparent", testTraceparent)
+	route.Track(Middleware("db_practice_test", router)).ServeHTTP(httptest.NewRecorder(), r)
+
+	// The caller sampled the trace, so it is recorded despite the ratio,
+	// and continued rather than restarted.
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", routeSpan.TraceID().String())
+	assert.True(t, routeSpan.IsSampled())
+	assert.Equal(t, fmt.Sprintf("00-%s-%s-01", routeSpan.TraceID(), routeSpan.SpanID()), outgoing)
+}
+
+func TestMiddleware(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer tp.Shutdown(context.Background())
+
+	router := mux.NewRouter()
+	router.Use(route.Record)
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	handler := route.Track(Middleware("db_practice_test", router))
+
+	testCases := []struct {
+		description   string
+		method        string
+		path          string
+		expectedName  string
+		expectedRoute bool
+	}{
+		{
+			description:   "Success: Named after the route",
+			method:        "GET",
+			path:          "/users/1",
+			expectedName:  "/users/{id}",
+			expectedRoute: true,
+		},
+		{
+			description:  "Success: Unknown path traced",
+			method:       "GET",
+			path:         "/pets/1",
+			expectedName: route.Unmatched,
+		},
+		{
+			description:  "Success: Wrong method traced",
+			method:       "DELETE",
+			path:         "/users/1",
+			expectedName: route.Unmatched,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			r.Header.Set("traceparent", testTraceparent)
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			ended := spans.Ended()
+			require.NotEmpty(t, ended)
+			span := ended[len(ended)-1]
+			assert.Equal(t, tc.expectedName, span.Name())
+			assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+			// Continued from the caller's traceparent.
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+			assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+
+			var httpRoute bool
+			for _, a := range span.Attributes() {
+				if a.Key == semconv.HTTPRouteKey {
+					httpRoute = true
+					assert.Equal(t, tc.expectedName, a.Value.AsString())
+				}
+			}
+			assert.Equal(t, tc.expectedRoute, httpRoute)
+		})
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	p, err := Setup(context.Background(), Options{ServiceName: "db_practice_test", SampleRatio: 1})
+	require.NoError(t, err)
+	defer p.Shutdown(context.Background())
+
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&log.JSONFormatter{})
+	logger.AddHook(LogHook{})
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	defer span.End()
+
+	testCases := []struct {
+		description string
+		entry       *log.Entry
+		expected    map[string]interface{}
+	}{
+		{
+			description: "Success: Span context logged",
+			entry:       logger.WithContext(ctx),
+			expected: map[string]interface{}{
+				"trace_id": span.SpanContext().TraceID().String(),
+				"span_id":  span.SpanContext().SpanID().String(),
+			},
+		},
+		{
+			description: "Success: No context, no ids",
+			entry:       log.NewEntry(logger),
+			expected:    map[string]interface{}{},
+		},
+		{
+			description: "Success: Context without a span, no ids",
+			entry:       logger.WithContext(context.Background()),
+			expected:    map[string]interface{}{},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			buf.Reset()
+			tc.entry.Info("hello")
+
+			var fields map[string]interface{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &fields))
+			for _, k := range []string{"trace_id", "span_id"} {
+				assert.Equal(t, tc.expected[k], fields[k], k)
+			}
+		})
+	}
+}
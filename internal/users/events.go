@@ -0,0 +1,82 @@
+package users
+
+import (
+	"context"
+	"db_practice/internal/logging"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+)
+
+// Event describes a change to a user. A deleted event's User only has an Id.
+type Event struct {
+	Type EventType `json:"type"`
+	User *User     `json:"user"`
+	At   time.Time `json:"at"`
+}
+
+// Publisher is told about every change to a user.
+type Publisher interface {
+	Publish(ctx context.Context, e Event)
+}
+
+type nopPublisher struct{}
+
+func (nopPublisher) Publish(ctx context.Context, e Event) {}
+
+// Broker fans events out to subscribers in this process. Publishing never
+// blocks: a subscriber whose buffer is full misses the event.
+type Broker struct {
+	buffer int
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// NewBroker buffers up to buffer events for each subscriber.
+func NewBroker(buffer int) *Broker {
+	return &Broker{
+		buffer:      buffer,
+		subscribers: map[chan Event]struct{}{},
+	}
+}
+
+func (b *Broker) Publish(ctx context.Context, e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+			logging.FromContext(ctx).WithField("Type", e.Type).Warn("Dropped user event for slow subscriber")
+		}
+	}
+}
+
+// Subscribe returns a channel of the events published from now on. It is
+// closed once ctx is done.
+func (b *Broker) Subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, b.buffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+		close(ch)
+	}()
+
+	return ch
+}
@@ -0,0 +1,98 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/db"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishEvents(t *testing.T) {
+	testCases := []struct {
+		description    string
+		db             *db.TestClient
+		change         func(c *UsersClient)
+		expectedEvents []EventType
+	}{
+		{
+			description: "Success: Create published",
+			db:          &db.TestClient{CreateUserData: testUserEli},
+			change: func(c *UsersClient) {
+				c.CreateUser(context.Background(), "Eli", "Fuchsman", testUserEli.Email, "", "", "", "", "")
+			},
+			expectedEvents: []EventType{EventCreated},
+		},
+		{
+			description: "Success: Update published",
+			db:          &db.TestClient{UpdateUserData: testUserEli},
+			change: func(c *UsersClient) {
+				c.UpdateUser(context.Background(), testUserEli.Id, "Eli", "Fuchsman", testUserEli.Email, "", "", "", "", "")
+			},
+			expectedEvents: []EventType{EventUpdated},
+		},
+		{
+			description:    "Success: Delete published",
+			db:             &db.TestClient{},
+			change:         func(c *UsersClient) { c.DeleteUser(context.Background(), testUserEli.Id) },
+			expectedEvents: []EventType{EventDeleted},
+		},
+		{
+			description: "Failure: Failed change not published",
+			db:          &db.TestClient{UpdateUserErr: sql.ErrNoRows},
+			change: func(c *UsersClient) {
+				c.UpdateUser(context.Background(), testUserEli.Id, "Eli", "Fuchsman", testUserEli.Email, "", "", "", "", "")
+			},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			broker := NewBroker(10)
+			events := broker.Subscribe(ctx)
+
+			c := NewUsersClient(tc.db)
+			c.SetPublisher(broker)
+			tc.change(c)
+
+			var types []EventType
+			for len(events) > 0 {
+				e := <-events
+				assert.Equal(t, testUserEli.Id, e.User.Id)
+				types = append(types, e.Type)
+			}
+			assert.Equal(t, tc.expectedEvents, types)
+		})
+	}
+}
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	events := broker.Subscribe(ctx)
+
+	broker.Publish(context.Background(), Event{Type: EventCreated, User: &User{Id: "1"}})
+	// The buffer is full, so the second event is dropped rather than blocking.
+	broker.Publish(context.Background(), Event{Type: EventUpdated, User: &User{Id: "1"}})
+
+	e := <-events
+	assert.Equal(t, EventCreated, e.Type)
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription not closed")
+	}
+
+	// Publishing after every subscriber has gone is a no-op.
+	broker.Publish(context.Background(), Event{Type: EventDeleted, User: &User{Id: "1"}})
+}
@@ -1,5 +1,7 @@
 package users
 
+import "context"
+
 type TestClient struct {
 	CreateUserData *User
 	CreateUserErr  error
@@ -9,16 +11,63 @@ type TestClient struct {
 
 	GetUserByIdData *User
 	GetUserByIdErr  error
+
+	GetUsersByIdsData []*User
+	GetUsersByIdsErr  error
+
+	GetUsersByEmailsData []*User
+	GetUsersByEmailsErr  error
+
+	ListUsersData []*User
+	ListUsersErr  error
+
+	UpdateUserData *User
+	UpdateUserErr  error
+
+	DeleteUserErr error
+
+	SetPasswordErr error
+
+	AuthenticateData *User
+	AuthenticateErr  error
 }
 
-func (c TestClient) CreateUser(firstName, lastName, email, address, city, state, zip, dob string) (*User, error) {
+func (c TestClient) CreateUser(ctx context.Context, firstName, lastName, email, address, city, state, zip, dob string) (*User, error) {
 	return c.CreateUserData, c.CreateUserErr
 }
 
-func (c TestClient) GetUserByEmail(email string) (*User, error) {
+func (c TestClient) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	return c.GetUserByEmailData, c.GetUserByEmailErr
 }
 
-func (c TestClient) GetUserById(id string) (*User, error) {
+func (c TestClient) GetUserById(ctx context.Context, id string) (*User, error) {
 	return c.GetUserByIdData, c.GetUserByIdErr
 }
+
+func (c TestClient) GetUsersByIds(ctx context.Context, ids []string) ([]*User, error) {
+	return c.GetUsersByIdsData, c.GetUsersByIdsErr
+}
+
+func (c TestClient) GetUsersByEmails(ctx context.Context, emails []string) ([]*User, error) {
+	return c.GetUsersByEmailsData, c.GetUsersByEmailsErr
+}
+
+func (c TestClient) ListUsers(ctx context.Context, afterId string, limit int) ([]*User, error) {
+	return c.ListUsersData, c.ListUsersErr
+}
+
+func (c TestClient) UpdateUser(ctx context.Context, id, firstName, lastName, email, address, city, state, zip, dob string) (*User, error) {
+	return c.UpdateUserData, c.UpdateUserErr
+}
+
+func (c TestClient) DeleteUser(ctx context.Context, id string) error {
+	return c.DeleteUserErr
+}
+
+func (c TestClient) SetPassword(ctx context.Context, id, password string) error {
+	return c.SetPasswordErr
+}
+
+func (c TestClient) Authenticate(ctx context.Context, email, password string) (*User, error) {
+	return c.AuthenticateData, c.AuthenticateErr
+}
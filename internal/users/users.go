@@ -1,108 +1,337 @@
 package users
 
 import (
+	"context"
 	"db_practice/internal/db"
+	"db_practice/internal/logging"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Client interface {
-	GetUserByEmail(email string) (*User, error)
-	GetUserById(id string) (*User, error)
-	CreateUser(firstName, lastName, email, address, city, state, zip, dob string) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserById(ctx context.Context, id string) (*User, error)
+	GetUsersByIds(ctx context.Context, ids []string) ([]*User, error)
+	GetUsersByEmails(ctx context.Context, emails []string) ([]*User, error)
+	ListUsers(ctx context.Context, afterId string, limit int) ([]*User, error)
+	CreateUser(ctx context.Context, firstName, lastName, email, address, city, state, zip, dob string) (*User, error)
+	UpdateUser(ctx context.Context, id, firstName, lastName, email, address, city, state, zip, dob string) (*User, error)
+	DeleteUser(ctx context.Context, id string) error
+	SetPassword(ctx context.Context, id, password string) error
+	Authenticate(ctx context.Context, email, password string) (*User, error)
 }
 
+var (
+	ErrInvalidCredentials = errors.New("Invalid email or password")
+	ErrEmailNotVerified   = errors.New("Email address has not been verified")
+)
+
+// ErrEmailExists is returned when a create or update would duplicate an email.
+var ErrEmailExists = db.ErrEmailExists
+
+// dummyHash is compared against when no user or password exists so a failed
+// login takes the same time whether or not the email is registered.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+var tracer = otel.Tracer("db_practice/internal/users")
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Recorder is told about business events so they can be counted.
+type Recorder interface {
+	UserCreated()
+	DuplicateEmailRejected()
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) UserCreated()            {}
+func (nopRecorder) DuplicateEmailRejected() {}
+
 type UsersClient struct {
-	db db.Client
+	db        db.Client
+	recorder  Recorder
+	publisher Publisher
 }
 
 type User struct {
-	Id          string `json:"id"`
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	Email       string `json:"email"`
-	Address     string `json:"address"`
-	City        string `json:"city"`
-	State       string `json:"state"`
-	ZipCode     string `json:"zip"`
-	DateOfBirth string `json:"dob"`
+	Id              string     `json:"id"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Email           string     `json:"email"`
+	Address         string     `json:"address"`
+	City            string     `json:"city"`
+	State           string     `json:"state"`
+	ZipCode         string     `json:"zip"`
+	DateOfBirth     string     `json:"dob"`
+	Status          string     `json:"status,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+}
+
+const (
+	StatusPending = db.UserStatusPending
+	StatusActive  = db.UserStatusActive
+)
+
+// fromDB converts a user read from the database.
+func fromDB(user *db.User) *User {
+	return &User{
+		Id:              user.Id,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		Address:         user.Address,
+		City:            user.City,
+		State:           user.State,
+		ZipCode:         user.ZipCode,
+		DateOfBirth:     user.DateOfBirth,
+		Status:          user.Status,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	}
 }
 
 func NewUsersClient(data db.Client) *UsersClient {
 	return &UsersClient{
-		db: data,
+		db:        data,
+		recorder:  nopRecorder{},
+		publisher: nopPublisher{},
 	}
 }
 
-func (u *UsersClient) GetUserByEmail(email string) (*User, error) {
-	fields := log.Fields{"Email": email}
+// SetRecorder reports business events to r.
+func (u *UsersClient) SetRecorder(r Recorder) {
+	u.recorder = r
+}
+
+// SetPublisher sends an Event to p after every successful create, update and
+// delete.
+func (u *UsersClient) SetPublisher(p Publisher) {
+	u.publisher = p
+}
+
+func (u *UsersClient) GetUserByEmail(ctx context.Context, email string) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "users.GetUserByEmail")
+	defer func() { endSpan(span, err) }()
+
+	user, err := u.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		logging.FromContext(ctx).Errorf("Failed to get user by email: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+
+	return fromDB(user), nil
+}
+
+func (u *UsersClient) GetUserById(ctx context.Context, id string) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "users.GetUserById")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"Id": id}
+
+	user, err := u.db.GetUserById(ctx, id)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("User not found with id: %s", id)
+		return nil, errors.WithStack(err)
+	}
 
-	user, err := u.db.GetUserByEmail(email)
+	return fromDB(user), nil
+}
+
+// GetUsersByIds looks up every id in one query. Users come back in the order
+// their ids were given; ids with no user are left out.
+func (u *UsersClient) GetUsersByIds(ctx context.Context, ids []string) (_ []*User, err error) {
+	ctx, span := tracer.Start(ctx, "users.GetUsersByIds")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"Count": len(ids)}
+
+	found, err := u.db.GetUsersByIds(ctx, ids)
 	if err != nil {
-		log.WithFields(fields).Errorf("User not found with email: %s", email)
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to look up users: %+v", err)
 		return nil, errors.WithStack(err)
 	}
 
-	foundUser := &User{
-		Id:          user.Id,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		Email:       user.Email,
-		Address:     user.Address,
-		City:        user.City,
-		State:       user.State,
-		ZipCode:     user.ZipCode,
-		DateOfBirth: user.DateOfBirth,
+	users := make([]*User, len(found))
+	for i, user := range found {
+		users[i] = fromDB(user)
 	}
 
-	return foundUser, nil
+	return users, nil
 }
 
-func (u *UsersClient) GetUserById(id string) (*User, error) {
-	fields := log.Fields{"Id": id}
+// GetUsersByEmails looks up every email in one query. Users come back in the order
+// their emails were given; emails with no user are left out.
+func (u *UsersClient) GetUsersByEmails(ctx context.Context, emails []string) (_ []*User, err error) {
+	ctx, span := tracer.Start(ctx, "users.GetUsersByEmails")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"Count": len(emails)}
 
-	user, err := u.db.GetUserById(id)
+	found, err := u.db.GetUsersByEmails(ctx, emails)
 	if err != nil {
-		log.WithFields(fields).Errorf("User not found with id: %s", id)
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to look up users: %+v", err)
 		return nil, errors.WithStack(err)
 	}
 
-	foundUser := &User{
-		Id:          user.Id,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		Email:       user.Email,
-		Address:     user.Address,
-		City:        user.City,
-		State:       user.State,
-		ZipCode:     user.ZipCode,
-		DateOfBirth: user.DateOfBirth,
+	users := make([]*User, len(found))
+	for i, user := range found {
+		users[i] = fromDB(user)
 	}
 
-	return foundUser, nil
+	return users, nil
 }
 
-func (u *UsersClient) CreateUser(firstName, lastName, email, address, city, state, zip, dob string) (*User, error) {
-	fields := log.Fields{"First Name": firstName, "Last Name": lastName, "Email": email, "Address": address, "City": city, "State": state, "Zip Code": zip, "Date of Birth": dob}
+// ListUsers returns up to limit users in id order, starting after afterId.
+func (u *UsersClient) ListUsers(ctx context.Context, afterId string, limit int) (_ []*User, err error) {
+	ctx, span := tracer.Start(ctx, "users.ListUsers")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"After Id": afterId, "Limit": limit}
 
-	user, err := u.db.CreateUser(firstName, lastName, email, address, city, state, zip, dob)
+	found, err := u.db.ListUsers(ctx, afterId, limit)
 	if err != nil {
-		log.WithFields(fields).Errorf("Failed to create user: %+v", err)
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to list users: %+v", err)
 		return nil, errors.WithStack(err)
 	}
 
-	newUser := &User{
-		Id:          user.Id,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		Email:       user.Email,
-		Address:     user.Address,
-		City:        user.City,
-		State:       user.State,
-		ZipCode:     user.ZipCode,
-		DateOfBirth: user.DateOfBirth,
+	listed := make([]*User, len(found))
+	for i, user := range found {
+		listed[i] = fromDB(user)
 	}
 
+	return listed, nil
+}
+
+func (u *UsersClient) CreateUser(ctx context.Context, firstName, lastName, email, address, city, state, zip, dob string) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "users.CreateUser")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"First Name": firstName, "Last Name": lastName, "Email": email, "Address": address, "City": city, "State": state, "Zip Code": zip, "Date of Birth": dob}
+
+	user, err := u.db.CreateUser(ctx, firstName, lastName, email, address, city, state, zip, dob)
+	if err != nil {
+		if errors.Cause(err) == ErrEmailExists {
+			u.recorder.DuplicateEmailRejected()
+		}
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to create user: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+	u.recorder.UserCreated()
+
+	newUser := fromDB(user)
+	u.publisher.Publish(ctx, Event{Type: EventCreated, User: newUser, At: time.Now()})
+
 	return newUser, nil
 }
+
+func (u *UsersClient) UpdateUser(ctx context.Context, id, firstName, lastName, email, address, city, state, zip, dob string) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "users.UpdateUser")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"Id": id, "First Name": firstName, "Last Name": lastName, "Email": email, "Address": address, "City": city, "State": state, "Zip Code": zip, "Date of Birth": dob}
+
+	user, err := u.db.UpdateUser(ctx, &db.User{
+		Id:          id,
+		FirstName:   firstName,
+		LastName:    lastName,
+		Email:       email,
+		Address:     address,
+		City:        city,
+		State:       state,
+		ZipCode:     zip,
+		DateOfBirth: dob,
+	})
+	if err != nil {
+		if errors.Cause(err) == ErrEmailExists {
+			u.recorder.DuplicateEmailRejected()
+		}
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to update user: %+v", err)
+		return nil, errors.WithStack(err)
+	}
+
+	updatedUser := fromDB(user)
+	u.publisher.Publish(ctx, Event{Type: EventUpdated, User: updatedUser, At: time.Now()})
+
+	return updatedUser, nil
+}
+
+func (u *UsersClient) DeleteUser(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "users.DeleteUser")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"Id": id}
+
+	if err := u.db.DeleteUser(ctx, id); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to delete user: %+v", err)
+		return errors.WithStack(err)
+	}
+	u.publisher.Publish(ctx, Event{Type: EventDeleted, User: &User{Id: id}, At: time.Now()})
+
+	return nil
+}
+
+func (u *UsersClient) SetPassword(ctx context.Context, id, password string) (err error) {
+	ctx, span := tracer.Start(ctx, "users.SetPassword")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"Id": id}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to hash password: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	if err := u.db.SetUserPasswordHash(ctx, id, string(hash)); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to set password: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (u *UsersClient) Authenticate(ctx context.Context, email, password string) (_ *User, err error) {
+	ctx, span := tracer.Start(ctx, "users.Authenticate")
+	defer func() { endSpan(span, err) }()
+
+	fields := log.Fields{"Email": email}
+
+	user, err := u.GetUserByEmail(ctx, email)
+	if err != nil {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	hash, err := u.db.GetUserPasswordHash(ctx, user.Id)
+	if err != nil {
+		if errors.Cause(err) != db.ErrNoPassword {
+			logging.FromContext(ctx).WithFields(fields).Errorf("Failed to load password: %+v", err)
+			return nil, errors.WithStack(err)
+		}
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Warn("Invalid password")
+		return nil, ErrInvalidCredentials
+	}
+
+	if user.Status == StatusPending {
+		return nil, ErrEmailNotVerified
+	}
+
+	return user, nil
+}
@@ -1,18 +1,25 @@
 package users
 
 import (
+	"context"
 	"database/sql"
+	"db_practice/config"
 	"db_practice/internal/db"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"runtime"
 	"testing"
 
 	"github.com/joho/godotenv"
-	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
@@ -51,24 +58,15 @@ func init() {
 
 	dir := filepath.Dir(filename)
 	projectRoot := filepath.Join(dir, "..", "..")
-	configPath := filepath.Join(projectRoot, "config", "test.yml")
-	if err := godotenv.Load(filepath.Join(projectRoot, ".env")); err != nil {
+	if err := godotenv.Load(filepath.Join(projectRoot, ".env")); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		panic("Error loading .env file: " + err.Error())
 	}
 
-	viper.SetConfigFile(configPath)
-	if err := viper.ReadInConfig(); err != nil {
-		panic("Error reading testing configuration file: " + err.Error())
-	}
-	viper.SetDefault("environment.test.database.user", os.Getenv("TEST_USER"))
-	viper.SetDefault("environment.test.database.password", os.Getenv("TEST_PASSWORD"))
-	viper.SetDefault("environment.test.database.name", os.Getenv("TEST_DB"))
-	viper.SetDefault("environment.test.database.connection_string", os.Getenv("TEST_CONN_STR"))
-
-	connStr = viper.GetString("environment.test.database.connection_string")
-	if connStr == "" {
-		panic("Connection string not found in configuration")
+	cfg, err := config.Load([]string{"-env", "test", "-config-dir", filepath.Join(projectRoot, "config")})
+	if err != nil {
+		panic("Error loading testing configuration: " + err.Error())
 	}
+	connStr = cfg.Database.ConnectionString
 }
 
 func TestCreateUser(t *testing.T) {
@@ -110,7 +108,7 @@ func TestCreateUser(t *testing.T) {
 			t.Log(tc.description)
 
 			c := NewUsersClient(tc.db)
-			user, err := c.CreateUser(testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			user, err := c.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
 			if tc.expectedErr != nil {
 				assert.Equal(t, tc.expectedErr.Error(), err.Error())
 			} else {
@@ -125,6 +123,92 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+type testRecorder struct {
+	created    int
+	duplicates int
+}
+
+func (r *testRecorder) UserCreated()            { r.created++ }
+func (r *testRecorder) DuplicateEmailRejected() { r.duplicates++ }
+
+func TestCreateUserRecordsEvents(t *testing.T) {
+	testCases := []struct {
+		description        string
+		db                 *db.TestClient
+		expectedCreated    int
+		expectedDuplicates int
+	}{
+		{
+			description:     "Success: User created counted",
+			db:              &db.TestClient{CreateUserData: testUserEli},
+			expectedCreated: 1,
+		},
+		{
+			description:        "Failure: Duplicate email counted",
+			db:                 &db.TestClient{CreateUserErr: db.ErrEmailExists},
+			expectedDuplicates: 1,
+		},
+		{
+			description: "Failure: Other errors not counted",
+			db:          &db.TestClient{CreateUserErr: sql.ErrConnDone},
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := &testRecorder{}
+			c := NewUsersClient(tc.db)
+			c.SetRecorder(r)
+			c.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+
+			assert.Equal(t, tc.expectedCreated, r.created)
+			assert.Equal(t, tc.expectedDuplicates, r.duplicates)
+		})
+	}
+}
+
+func TestCreateUserSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	testCases := []struct {
+		description    string
+		db             *db.TestClient
+		expectedStatus codes.Code
+	}{
+		{
+			description:    "Success: Span recorded",
+			db:             &db.TestClient{CreateUserData: testUserEli},
+			expectedStatus: codes.Unset,
+		},
+		{
+			description:    "Failure: Error recorded on the span",
+			db:             &db.TestClient{CreateUserErr: db.ErrEmailExists},
+			expectedStatus: codes.Error,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			ctx, parent := otel.Tracer("test").Start(context.Background(), "POST /users/create")
+			c := NewUsersClient(tc.db)
+			c.CreateUser(ctx, testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			parent.End()
+
+			spans := recorder.Ended()
+			require.GreaterOrEqual(t, len(spans), 2)
+			span := spans[len(spans)-2]
+			assert.Equal(t, "users.CreateUser", span.Name())
+			assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+			assert.Equal(t, tc.expectedStatus, span.Status().Code)
+		})
+	}
+}
+
 func TestGetUserById(t *testing.T) {
 	testCases := []struct {
 		description    string
@@ -172,10 +256,10 @@ func TestGetUserById(t *testing.T) {
 
 			c := NewUsersClient(tc.db)
 
-			_, err := c.CreateUser(testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			_, err := c.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
 			require.NoError(t, err)
 
-			foundUser, err := c.GetUserById(tc.id)
+			foundUser, err := c.GetUserById(context.Background(), tc.id)
 			if tc.expectedErr != nil {
 				assert.Equal(t, tc.expectedErr.Error(), err.Error())
 			} else {
@@ -234,10 +318,10 @@ func TestGetUserByEmail(t *testing.T) {
 
 			c := NewUsersClient(tc.db)
 
-			_, err := c.CreateUser(testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			_, err := c.CreateUser(context.Background(), testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
 			require.NoError(t, err)
 
-			foundUser, err := c.GetUserByEmail(tc.email)
+			foundUser, err := c.GetUserByEmail(context.Background(), tc.email)
 			if tc.expectedErr != nil {
 				assert.Equal(t, tc.expectedErr.Error(), err.Error())
 			} else {
@@ -248,3 +332,275 @@ func TestGetUserByEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestListUsers(t *testing.T) {
+	testCases := []struct {
+		description    string
+		db             *db.TestClient
+		expectedOutput []*User
+		expectedErr    error
+	}{
+		{
+			description: "Success: Users listed",
+			db: &db.TestClient{
+				ListUsersData: []*db.User{testUserEli, testUserEli2},
+			},
+			expectedOutput: []*User{
+				{
+					Id:          "12infioed",
+					FirstName:   "Eli",
+					LastName:    "Fuchsman",
+					Email:       "testEmail@mail.com",
+					Address:     "1123 Street St.",
+					City:        "Denver",
+					State:       "CO",
+					ZipCode:     "80108",
+					DateOfBirth: "12/14/1993",
+				},
+				{
+					Id:          "12infioEd",
+					FirstName:   "Eli",
+					LastName:    "Fuchsman",
+					Email:       "testEmail2@mail.com",
+					Address:     "1123 Street St.",
+					City:        "Denver",
+					State:       "CO",
+					ZipCode:     "80108",
+					DateOfBirth: "12/14/1993",
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "Success: No users left",
+			db: &db.TestClient{
+				ListUsersData: []*db.User{},
+			},
+			expectedOutput: []*User{},
+			expectedErr:    nil,
+		},
+		{
+			description: "Failure: Query failed",
+			db: &db.TestClient{
+				ListUsersErr: sql.ErrConnDone,
+			},
+			expectedOutput: nil,
+			expectedErr:    sql.ErrConnDone,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Parallel()
+			t.Log(tc.description)
+
+			c := NewUsersClient(tc.db)
+
+			listed, err := c.ListUsers(context.Background(), "", 10)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr.Error(), err.Error())
+			} else {
+				assert.NoError(t, err, tc.description)
+				assert.Equal(t, tc.expectedOutput, listed)
+			}
+		})
+	}
+}
+
+func TestGetUsersByIds(t *testing.T) {
+	testCases := []struct {
+		description    string
+		byEmail        bool
+		db             *db.TestClient
+		expectedOutput []string
+		expectedErr    error
+	}{
+		{
+			description:    "Success: Users found by id",
+			db:             &db.TestClient{GetUsersByIdsData: []*db.User{testUserEli2, testUserEli}},
+			expectedOutput: []string{testUserEli2.Id, testUserEli.Id},
+		},
+		{
+			description:    "Success: Users found by email",
+			byEmail:        true,
+			db:             &db.TestClient{GetUsersByEmailsData: []*db.User{testUserEli}},
+			expectedOutput: []string{testUserEli.Id},
+		},
+		{
+			description:    "Success: None found",
+			db:             &db.TestClient{GetUsersByIdsData: []*db.User{}},
+			expectedOutput: []string{},
+		},
+		{
+			description: "Failure: Query failed",
+			byEmail:     true,
+			db:          &db.TestClient{GetUsersByEmailsErr: sql.ErrConnDone},
+			expectedErr: sql.ErrConnDone,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			c := NewUsersClient(tc.db)
+
+			var found []*User
+			var err error
+			if tc.byEmail {
+				found, err = c.GetUsersByEmails(context.Background(), []string{testUserEli.Email})
+			} else {
+				found, err = c.GetUsersByIds(context.Background(), []string{testUserEli2.Id, testUserEli.Id})
+			}
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr.Error(), err.Error())
+				return
+			}
+			require.NoError(t, err)
+			ids := []string{}
+			for _, u := range found {
+				ids = append(ids, u.Id)
+			}
+			assert.Equal(t, tc.expectedOutput, ids)
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description    string
+		password       string
+		db             *db.TestClient
+		expectedOutput *User
+		expectedErr    error
+	}{
+		{
+			description: "Success: Credentials match",
+			password:    "correct-password",
+			db: &db.TestClient{
+				GetUserByEmailData:      testUserEli,
+				GetUserPasswordHashData: string(hash),
+			},
+			expectedOutput: &User{
+				Id:          "12infioed",
+				FirstName:   "Eli",
+				LastName:    "Fuchsman",
+				Email:       "testEmail@mail.com",
+				Address:     "1123 Street St.",
+				City:        "Denver",
+				State:       "CO",
+				ZipCode:     "80108",
+				DateOfBirth: "12/14/1993",
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Wrong password",
+			password:    "wrong-password",
+			db: &db.TestClient{
+				GetUserByEmailData:      testUserEli,
+				GetUserPasswordHashData: string(hash),
+			},
+			expectedErr: ErrInvalidCredentials,
+		},
+		{
+			description: "Failure: No password set",
+			password:    "correct-password",
+			db: &db.TestClient{
+				GetUserByEmailData:     testUserEli,
+				GetUserPasswordHashErr: db.ErrNoPassword,
+			},
+			expectedErr: ErrInvalidCredentials,
+		},
+		{
+			description: "Failure: No user found",
+			password:    "correct-password",
+			db: &db.TestClient{
+				GetUserByEmailErr: sql.ErrNoRows,
+			},
+			expectedErr: ErrInvalidCredentials,
+		},
+		{
+			description: "Failure: Email not verified",
+			password:    "correct-password",
+			db: &db.TestClient{
+				GetUserByEmailData:      &db.User{Id: testUserEli.Id, Email: testUserEli.Email, Status: db.UserStatusPending},
+				GetUserPasswordHashData: string(hash),
+			},
+			expectedErr: ErrEmailNotVerified,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			c := NewUsersClient(tc.db)
+
+			user, err := c.Authenticate(context.Background(), testUserEli.Email, tc.password)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+				assert.Nil(t, user)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedOutput, user)
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	testCases := []struct {
+		description    string
+		db             *db.TestClient
+		expectedOutput *User
+		expectedErr    error
+	}{
+		{
+			description: "Success: User updated",
+			db: &db.TestClient{
+				UpdateUserData: testUserEli,
+			},
+			expectedOutput: &User{
+				Id:          "12infioed",
+				FirstName:   "Eli",
+				LastName:    "Fuchsman",
+				Email:       "testEmail@mail.com",
+				Address:     "1123 Street St.",
+				City:        "Denver",
+				State:       "CO",
+				ZipCode:     "80108",
+				DateOfBirth: "12/14/1993",
+			},
+			expectedErr: nil,
+		},
+		{
+			description: "Failure: Email already exists",
+			db: &db.TestClient{
+				UpdateUserErr: db.ErrEmailExists,
+			},
+			expectedErr: db.ErrEmailExists,
+		},
+		{
+			description: "Failure: No user found",
+			db: &db.TestClient{
+				UpdateUserErr: sql.ErrNoRows,
+			},
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			c := NewUsersClient(tc.db)
+			user, err := c.UpdateUser(context.Background(), testUserEli.Id, testUserEli.FirstName, testUserEli.LastName, testUserEli.Email, testUserEli.Address, testUserEli.City, testUserEli.State, testUserEli.ZipCode, testUserEli.DateOfBirth)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr.Error(), err.Error())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedOutput, user)
+			}
+		})
+	}
+}
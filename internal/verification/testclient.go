@@ -0,0 +1,18 @@
+package verification
+
+import "context"
+
+type TestClient struct {
+	SendVerificationErr error
+
+	VerifyData string
+	VerifyErr  error
+}
+
+func (c TestClient) SendVerification(ctx context.Context, userId string) error {
+	return c.SendVerificationErr
+}
+
+func (c TestClient) Verify(ctx context.Context, token string) (string, error) {
+	return c.VerifyData, c.VerifyErr
+}
@@ -0,0 +1,173 @@
+package verification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"db_practice/internal/db"
+	"db_practice/internal/logging"
+	"db_practice/internal/mailer"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const TokenTTL = 24 * time.Hour
+
+var (
+	ErrInvalidToken    = errors.New("Invalid or expired verification token")
+	ErrAlreadyVerified = errors.New("Email address is already verified")
+)
+
+type Client interface {
+	SendVerification(ctx context.Context, userId string) error
+	Verify(ctx context.Context, token string) (string, error)
+}
+
+type VerificationClient struct {
+	db        db.VerificationClient
+	mailer    mailer.Mailer
+	secret    []byte
+	verifyURL string
+	now       func() time.Time
+}
+
+// NewVerificationClient mails links to verifyURL, the absolute URL of the
+// verify route, with the token added to its query.
+func NewVerificationClient(data db.VerificationClient, m mailer.Mailer, secret []byte, verifyURL string) *VerificationClient {
+	return &VerificationClient{
+		db:        data,
+		mailer:    m,
+		secret:    secret,
+		verifyURL: verifyURL,
+		now:       time.Now,
+	}
+}
+
+// SendVerification issues a new token for the user's current email address
+// and mails the verification link.
+func (v *VerificationClient) SendVerification(ctx context.Context, userId string) error {
+	fields := log.Fields{"Id": userId}
+
+	user, err := v.db.GetUserById(ctx, userId)
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("User not found with id: %s", userId)
+		return errors.WithStack(err)
+	}
+	if user.Status == db.UserStatusActive {
+		return ErrAlreadyVerified
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	expiresAt := v.now().Add(TokenTTL)
+
+	err = v.db.CreateEmailVerificationToken(ctx, &db.EmailVerificationToken{
+		Id:        id,
+		UserId:    user.Id,
+		Email:     user.Email,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to store verification token: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	link := v.verifyURL + "?token=" + url.QueryEscape(v.sign(id, expiresAt))
+	msg, err := mailer.NewMessage(user.Email, "Verify your email address", "verify_email", map[string]string{
+		"FirstName": user.FirstName,
+		"Link":      link,
+		"ExpiresIn": "24 hours",
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := v.mailer.Send(msg); err != nil {
+		logging.FromContext(ctx).WithFields(fields).Errorf("Failed to send verification email: %+v", err)
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Verify consumes the token and activates the account it was issued for,
+// returning the user id.
+func (v *VerificationClient) Verify(ctx context.Context, token string) (string, error) {
+	id, expiresAt, ok := v.parse(token)
+	if !ok || !v.now().Before(expiresAt) {
+		return "", ErrInvalidToken
+	}
+
+	stored, err := v.db.ConsumeEmailVerificationToken(ctx, id)
+	if err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return "", ErrInvalidToken
+		}
+		return "", errors.WithStack(err)
+	}
+
+	fields := log.Fields{"Id": stored.UserId}
+
+	if err := v.db.MarkUserEmailVerified(ctx, stored.UserId, stored.Email); err != nil {
+		// The account's email changed after this token was sent.
+		if errors.Cause(err) == sql.ErrNoRows {
+			logging.FromContext(ctx).WithFields(fields).Warn("Verification token no longer matches user email")
+			return "", ErrInvalidToken
+		}
+		return "", errors.WithStack(err)
+	}
+
+	logging.FromContext(ctx).WithFields(fields).Info("Email address verified")
+	return stored.UserId, nil
+}
+
+// sign produces <id>.<expiry>.<mac>, so a forged or altered token is rejected
+// before touching the database.
+func (v *VerificationClient) sign(id string, expiresAt time.Time) string {
+	payload := id + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(v.mac(payload))
+}
+
+func (v *VerificationClient) parse(token string) (string, time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}, false
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, v.mac(parts[0]+"."+parts[1])) {
+		return "", time.Time{}, false
+	}
+
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	return parts[0], time.Unix(exp, 0), true
+}
+
+func (v *VerificationClient) mac(payload string) []byte {
+	h := hmac.New(sha256.New, v.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,168 @@
+package verification
+
+import (
+	"context"
+	"database/sql"
+	"db_practice/internal/db"
+	"db_practice/internal/mailer"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPendingUser = &db.User{
+	Id:        "12infioed",
+	FirstName: "Eli",
+	Email:     "testemail@mail.com",
+	Status:    db.UserStatusPending,
+}
+
+func TestSendVerification(t *testing.T) {
+	testCases := []struct {
+		description string
+		db          *db.TestClient
+		expectedErr error
+		expectMail  bool
+	}{
+		{
+			description: "Success: Verification mailed",
+			db: &db.TestClient{
+				GetUserByIdData: testPendingUser,
+			},
+			expectMail: true,
+		},
+		{
+			description: "Failure: Already verified",
+			db: &db.TestClient{
+				GetUserByIdData: &db.User{Id: "12infioed", Status: db.UserStatusActive},
+			},
+			expectedErr: ErrAlreadyVerified,
+		},
+		{
+			description: "Failure: No user found",
+			db: &db.TestClient{
+				GetUserByIdErr: sql.ErrNoRows,
+			},
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			m := mailer.NewMemoryMailer("noreply@example.com")
+			v := NewVerificationClient(tc.db, m, []byte("secret"), "https://api.example.com/v1/verify")
+
+			err := v.SendVerification(context.Background(), "12infioed")
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr.Error(), err.Error())
+			} else {
+				require.NoError(t, err)
+			}
+
+			if !tc.expectMail {
+				assert.Nil(t, m.Last())
+				return
+			}
+			msg := m.Last()
+			require.NotNil(t, msg)
+			assert.Equal(t, "testemail@mail.com", msg.To)
+			assert.Contains(t, msg.Text, "https://api.example.com/v1/verify?token=")
+			assert.NotEmpty(t, msg.HTML)
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	v := NewVerificationClient(&db.TestClient{}, nil, []byte("secret"), "")
+	valid := v.sign("token-1", time.Now().Add(time.Hour))
+	expired := v.sign("token-1", time.Now().Add(-time.Hour))
+	forged := NewVerificationClient(nil, nil, []byte("other"), "").sign("token-1", time.Now().Add(time.Hour))
+	consumed := &db.EmailVerificationToken{Id: "token-1", UserId: "12infioed", Email: "testemail@mail.com"}
+
+	testCases := []struct {
+		description  string
+		token        string
+		db           *db.TestClient
+		expectedData string
+		expectedErr  error
+	}{
+		{
+			description: "Success: Email verified",
+			token:       valid,
+			db: &db.TestClient{
+				ConsumeEmailVerificationTokenData: consumed,
+			},
+			expectedData: "12infioed",
+		},
+		{
+			description: "Failure: Expired token",
+			token:       expired,
+			db:          &db.TestClient{},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Forged signature",
+			token:       forged,
+			db:          &db.TestClient{},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Malformed token",
+			token:       "garbage",
+			db:          &db.TestClient{},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Token already used",
+			token:       valid,
+			db: &db.TestClient{
+				ConsumeEmailVerificationTokenErr: sql.ErrNoRows,
+			},
+			expectedErr: ErrInvalidToken,
+		},
+		{
+			description: "Failure: Email changed since sending",
+			token:       valid,
+			db: &db.TestClient{
+				ConsumeEmailVerificationTokenData: consumed,
+				MarkUserEmailVerifiedErr:          sql.ErrNoRows,
+			},
+			expectedErr: ErrInvalidToken,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			c := NewVerificationClient(tc.db, nil, []byte("secret"), "")
+			userId, err := c.Verify(context.Background(), tc.token)
+			if tc.expectedErr != nil {
+				assert.Equal(t, tc.expectedErr, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedData, userId)
+			}
+		})
+	}
+}
+
+func TestLinkRoundTrip(t *testing.T) {
+	m := mailer.NewMemoryMailer("")
+	v := NewVerificationClient(&db.TestClient{GetUserByIdData: testPendingUser}, m, []byte("secret"), "https://api.example.com/v1/verify")
+	require.NoError(t, v.SendVerification(context.Background(), "12infioed"))
+
+	text := m.Last().Text
+	start := strings.Index(text, "https://")
+	link, err := url.Parse(strings.Fields(text[start:])[0])
+	require.NoError(t, err)
+
+	id, _, ok := v.parse(link.Query().Get("token"))
+	assert.True(t, ok)
+	assert.Len(t, id, 32)
+}
@@ -1,13 +1,42 @@
 package main
 
 import (
-	cors "db_practice/config"
+	"context"
+	"db_practice/config"
+	"db_practice/graphqlapi"
+	"db_practice/grpcapi"
 	"db_practice/handlers"
+	"db_practice/internal/apikeys"
+	"db_practice/internal/auth"
+	"db_practice/internal/crash"
 	"db_practice/internal/db"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/health"
+	"db_practice/internal/lifecycle"
+	"db_practice/internal/logging"
+	"db_practice/internal/mailer"
+	"db_practice/internal/metrics"
+	"db_practice/internal/mfa"
+	"db_practice/internal/openapi"
+	"db_practice/internal/passwordreset"
+	"db_practice/internal/ratelimit"
+	"db_practice/internal/rbac"
+	"db_practice/internal/route"
+	"db_practice/internal/sessions"
+	"db_practice/internal/tracing"
 	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	"db_practice/migrations"
+	usersv1 "db_practice/proto/users/v1"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -15,48 +44,375 @@ import (
 )
 
 func main() {
-	fmt.Println("Starting the application")
+	// A .env file is optional; containers set the environment directly.
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	// "config print [flags]" shows the effective configuration, secrets
+	// redacted, and exits.
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		cfg, err := config.Load(os.Args[3:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// "migrate [flags]" applies the migrations the database lacks and exits.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	log.SetFormatter(&log.JSONFormatter{})
 	log.SetOutput(os.Stdout)
 	log.SetLevel(log.InfoLevel)
+	log.Info("Starting the application")
 
-	err := godotenv.Load(".env")
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		log.Fatalf("%v", err)
 	}
 
-	connStr := os.Getenv("DEV_CONN_STR")
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.Port),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	// Components that own connections or goroutines register a hook; they
+	// are stopped in reverse order once in-flight requests have drained.
+	app := lifecycle.NewApp(server, cfg.Server.ShutdownTimeout, cfg.Server.DrainDelay)
 
-	if connStr == "" {
-		panic("Connection string not found in configuration")
+	tracer, err := tracing.Setup(context.Background(), tracing.Options{
+		ServiceName:  cfg.Tracing.ServiceName,
+		Exporter:     cfg.Tracing.Exporter,
+		File:         cfg.Tracing.File,
+		OTLPEndpoint: cfg.Tracing.OTLPEndpoint,
+		SampleRatio:  cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Fatalf("FAILURE CONFIGURING TRACING: %v", err)
 	}
+	// Appended first so it stops last, flushing the spans of the final
+	// requests and of the other hooks' shutdown.
+	app.Append(lifecycle.Hook{
+		Name: "tracing",
+		Stop: tracer.Shutdown,
+	})
+	log.AddHook(tracing.LogHook{})
+
+	appMetrics := metrics.New()
 
-	udb, err := db.NewDB(connStr, false, "")
+	udb, err := db.NewDB(cfg.Database.ConnectionString, false, "")
 	if err != nil {
 		log.Fatalf("FAILURE OPENING DATABASE CONNECTION: %v", err)
 	}
-	defer udb.Close()
+	udb.Observer = appMetrics
+	appMetrics.RegisterDBStats("db_practice", udb.Conn)
+	app.Append(lifecycle.Hook{
+		Name: "database",
+		Stop: func(ctx context.Context) error {
+			udb.Close()
+			return nil
+		},
+	})
 
 	uClient := users.NewUsersClient(udb)
+	uClient.SetRecorder(appMetrics)
+	// GraphQL subscriptions hear about changes made by this instance.
+	broker := users.NewBroker(16)
+	uClient.SetPublisher(broker)
+
+	issuer := cfg.Auth.Issuer
+
+	// Retired keys stay published for one access token lifetime, plus the
+	// time other instances may take to notice a rotation, so tokens signed
+	// just before it keep validating. The keys are shared through the
+	// database: only the first instance to start generates them, and a
+	// restart keeps the ones clients' tokens were signed with.
+	keys := auth.NewKeyRing(udb, cfg.Auth.SigningKeyCipher(), auth.AccessTokenTTL+auth.KeySyncInterval)
+	if err := keys.RotateIfDue(context.Background(), cfg.Auth.KeyRotationInterval); err != nil {
+		log.Fatalf("FAILURE LOADING SIGNING KEYS: %v", err)
+	}
+	var stopRotation func()
+	app.Append(lifecycle.Hook{
+		Name: "signing key rotation",
+		Start: func(ctx context.Context) error {
+			stopRotation = keys.StartRotation(cfg.Auth.KeyRotationInterval)
+			return nil
+		},
+		Stop: func(ctx context.Context) error {
+			stopRotation()
+			return nil
+		},
+	})
+
+	aClient := auth.NewAuthClient(udb, keys, issuer)
+
+	rClient := rbac.NewRbacClient(udb)
+
+	// Shared by the rate limit middleware and the MFA and password reset
+	// limits.
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "postgres" {
+		pgLimits := ratelimit.NewPostgresStore(udb)
+		limitStore = pgLimits
+		var stopPruning func()
+		app.Append(lifecycle.Hook{
+			Name: "rate limit pruning",
+			Start: func(ctx context.Context) error {
+				stopPruning = pgLimits.StartPruning(cfg.RateLimit.PruneInterval)
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				stopPruning()
+				return nil
+			},
+		})
+	}
+
+	mClient := mfa.NewMfaClient(udb, cfg.Auth.MfaKey(), issuer, limitStore)
+
+	kClient := apikeys.NewApiKeysClient(udb, cfg.Auth.AdminAPIKey)
+
+	m, err := newMailer(cfg.Mailer)
+	if err != nil {
+		log.Fatalf("FAILURE CONFIGURING MAILER: %v", err)
+	}
+
+	reporter, err := newCrashReporter(cfg.Crash)
+	if err != nil {
+		log.Fatalf("FAILURE CONFIGURING CRASH REPORTER: %v", err)
+	}
+
+	baseURL := cfg.Server.PublicBaseURL
+
+	var sessionStore db.SessionsClient = udb
+	if cfg.Sessions.Store == "memory" {
+		sessionStore = sessions.NewMemoryStore()
+	}
+	sClient := sessions.NewSessionsClient(sessionStore)
+
+	verifyURL := strings.TrimRight(baseURL, "/") + handlers.VersionPath(latestVersion(), "/verify")
+	vClient := verification.NewVerificationClient(udb, m, []byte(cfg.Auth.EmailTokenSecret), verifyURL)
+	pClient := passwordreset.NewPasswordResetClient(udb, uClient, aClient, sClient, m, limitStore, baseURL)
+	// Reset emails are sent after the request that asked for them ends;
+	// those still going out get the rest of the shutdown deadline.
+	app.Append(lifecycle.Hook{Name: "password reset emails", Stop: pClient.Wait})
+
+	hClient := health.NewChecker(cfg.Health.CacheTTL,
+		health.DatabaseCheck(udb, cfg.Health.CheckTimeout),
+		health.MigrationsCheck(udb, migrations.Versions(), cfg.Health.CheckTimeout),
+		health.Check{
+			Name:    "signing_keys",
+			Timeout: cfg.Health.CheckTimeout,
+			Run: func(ctx context.Context) error {
+				// The active key was generated one rotation before it
+				// started signing, so it is at most two intervals old
+				// unless rotation has stalled.
+				active := keys.Active()
+				if active == nil {
+					return fmt.Errorf("no active signing key")
+				}
+				if age := time.Since(active.CreatedAt); age > 3*cfg.Auth.KeyRotationInterval {
+					return fmt.Errorf("active signing key is %s old", age.Round(time.Second))
+				}
+				return nil
+			},
+		},
+	)
+	app.OnShutdown(hClient.Drain)
+
+	routeLimits := map[string]handlers.RouteLimit{}
+	for _, p := range cfg.RateLimit.Routes {
+		routeLimits[p.Route] = routeLimit(p)
+	}
+	limiter := handlers.NewRateLimitHandler(limitStore, cfg.RateLimit.TrustForwardedFor).
+		Limit(routeLimit(cfg.RateLimit.Default), routeLimits)
 
 	// Setup the HTTP server and router
 	router := mux.NewRouter()
+	// Tells the middleware wrapped around the router which route matched.
+	router.Use(route.Record)
 
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "Welcome to the practice API")
+	gSchema, err := graphqlapi.NewSchema(uClient, rClient, vClient, broker, graphqlapi.Limits{
+		MaxDepth:      cfg.GraphQL.MaxDepth,
+		MaxComplexity: cfg.GraphQL.MaxComplexity,
+		Introspection: cfg.GraphQL.Introspection,
 	})
+	if err != nil {
+		log.Fatalf("FAILURE BUILDING GRAPHQL SCHEMA: %v", err)
+	}
+	gqlHandler := handlers.NewGraphQLHandler(gSchema)
+	// Open subscriptions would otherwise hold up the drain.
+	app.OnShutdown(gqlHandler.Shutdown)
 
-	uHandler := handlers.NewUsersHandler(uClient)
-	router.HandleFunc("/users/create", uHandler.CreateUser).Methods("POST")
-	router.HandleFunc("/users/{email}", uHandler.GetUserByEmail).Methods("GET")
+	oHandler := handlers.NewOpenAPIHandler(cfg.OpenAPI.ValidateRequests, cfg.OpenAPI.ValidateResponses, cfg.OpenAPI.MaxBodyBytes)
+	api := registerRoutes(router, routeHandlers{
+		health:        handlers.NewHealthHandler(hClient),
+		metrics:       appMetrics.Handler(),
+		apiKeys:       handlers.NewApiKeysHandler(kClient),
+		auth:          handlers.NewAuthHandler(uClient, aClient, mClient),
+		passwordReset: handlers.NewPasswordResetHandler(pClient),
+		// Session cookies are Secure unless explicitly disabled for local
+		// development over plain HTTP.
+		sessions: handlers.NewSessionsHandler(uClient, mClient, sClient, cfg.Sessions.CookieSecure),
+		errors:   handlers.NewErrorCatalogHandler(errcatalog.Default),
+		openAPI:  oHandler,
+		users:    handlers.NewUsersHandler(uClient, rClient, vClient),
+		mfa:      handlers.NewMfaHandler(uClient, mClient),
+		graphql:  gqlHandler,
+		limiter:  limiter,
+	})
+
+	// Undocumented routes are left out of the document rather than keeping
+	// the API down; TestOpenAPISpec stops them being merged.
+	doc, err := openapi.Build(router, handlers.OpenAPISpec(cfg.Sessions.CookieSecure))
+	if err != nil {
+		log.Warnf("%v", err)
+	}
+	if err := oHandler.Load(doc); err != nil {
+		log.Fatalf("FAILURE LOADING OPENAPI DOCUMENT: %v", err)
+	}
+	// GraphQL arguments are checked against the matching REST requests.
+	gSchema.SetValidator(oHandler.Validator())
 
-	handler := cors.SetCORS(router)
+	// The gRPC API shares the HTTP API's clients, credentials and request
+	// schemas. Appended last, so it stops first.
+	gHealth := grpcapi.NewHealthServer(hClient, cfg.Health.CacheTTL, usersv1.UserService_ServiceDesc.ServiceName)
+	gServer := grpcapi.NewServer(
+		grpcapi.NewUsersServer(uClient, rClient, vClient, oHandler.Validator()),
+		gHealth,
+		grpcapi.NewAuthenticator(aClient, kClient, grpcapi.AuthPolicy{
+			Scopes: map[string]apikeys.Scope{
+				usersv1.UserService_CreateUser_FullMethodName:     apikeys.ScopeUsersWrite,
+				usersv1.UserService_GetUser_FullMethodName:        apikeys.ScopeUsersRead,
+				usersv1.UserService_GetUserByEmail_FullMethodName: apikeys.ScopeUsersRead,
+				// Listing reads every account, which no REST route does.
+				usersv1.UserService_ListUsers_FullMethodName:  apikeys.ScopeUsersAdmin,
+				usersv1.UserService_UpdateUser_FullMethodName: apikeys.ScopeUsersWrite,
+			},
+			// Signing up needs no account, like POST /v1/users, and is rate
+			// limited like it.
+			Public: []string{
+				usersv1.UserService_CreateUser_FullMethodName,
+				"/grpc.health.v1.Health/",
+				"/grpc.reflection.v1.ServerReflection/",
+				"/grpc.reflection.v1alpha.ServerReflection/",
+			},
+		}),
+		grpcapi.Options{
+			Reflection: cfg.GRPC.Reflection,
+			Reporter:   reporter,
+			// Calls spend from the same buckets as the routes they mirror.
+			RateLimiter: grpcapi.NewRateLimiter(limitStore, routeLimit(cfg.RateLimit.Default), routeLimits),
+		},
+	)
+	app.Append(grpcapi.Hook(gServer, gHealth, fmt.Sprintf(":%d", cfg.GRPC.Port)))
 
-	port := 8000
-	fmt.Printf("Server is running on :%d\n", port)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), handler); err != nil {
-		log.Fatalf("Error starting server: %v", err)
+	// Only allowlisted origins may make credentialed cross-origin requests.
+	handler := config.NewCORSHandler(&cfg.CORS, api)
+	// Inside logging and metrics, which then see the 500 it answers with
+	// and the request id.
+	recovery := handlers.NewRecoveryHandler(reporter, appMetrics)
+	handler = recovery.Recover(handler)
+	// The rest go around the whole router rather than on it, since the
+	// router only runs its middleware for matched routes: unknown paths and
+	// methods are counted, logged and traced too. Inside tracing, so the
+	// access log line carries the trace id.
+	handler = appMetrics.Middleware(handler)
+	handler = logging.Middleware(handler)
+	// The server span continues any trace started by the caller's
+	// traceparent.
+	handler = tracing.Middleware(cfg.Tracing.ServiceName, handler)
+	// Outermost as well, so a panic in any of the wrappers above is still
+	// answered with a 500 rather than reaching net/http, which drops the
+	// connection.
+	server.Handler = recovery.Recover(route.Track(handler))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	log.WithFields(log.Fields{"port": cfg.Server.Port, "grpc_port": cfg.GRPC.Port}).Info("Server is running")
+	if err := app.Run(ctx); err != nil {
+		log.Fatalf("Error running server: %v", err)
+	}
+
+	log.Info("Application stopped cleanly")
+}
+
+// migrate applies the embedded migrations the configured database hasn't
+// recorded, all or none of them, printing each one applied.
+func migrate(args []string) error {
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
 	}
 
-	fmt.Println("Application started successfully")
+	udb, err := db.NewDB(cfg.Database.ConnectionString, false, "")
+	if err != nil {
+		return err
+	}
+	defer udb.Close()
+
+	applied, err := udb.ApplyMigrations(context.Background(), migrations.Versions(), migrations.SQL)
+	if err != nil {
+		return fmt.Errorf("applying migrations: %w", err)
+	}
+	for _, v := range applied {
+		fmt.Println("Applied", v)
+	}
+	if len(applied) == 0 {
+		fmt.Println("No migrations to apply")
+	}
+	return nil
+}
+
+// newMailer builds the configured mail transport.
+func newMailer(c config.MailerConfig) (mailer.Mailer, error) {
+	switch c.Transport {
+	case "smtp":
+		return mailer.NewSMTPMailer(c.SMTP.Host, c.SMTP.Port, c.SMTP.Username, c.SMTP.Password, c.From), nil
+	case "file":
+		return mailer.NewFileMailer(c.Dir, c.From)
+	case "memory":
+		return mailer.NewMemoryMailer(c.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer transport %q", c.Transport)
+	}
+}
+
+// newCrashReporter builds the configured crash reporter.
+func newCrashReporter(c config.CrashConfig) (crash.Reporter, error) {
+	switch c.Reporter {
+	case "file":
+		return crash.NewFileReporter(c.Dir)
+	case "none":
+		return crash.NopReporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown crash reporter %q", c.Reporter)
+	}
+}
+
+// routeLimit converts a configured policy for the rate limit middleware.
+func routeLimit(p config.RateLimitPolicy) handlers.RouteLimit {
+	return handlers.RouteLimit{
+		Key: handlers.RateLimitKey(p.Key),
+		Policy: ratelimit.Policy{
+			Requests: p.Requests,
+			Per:      p.Per,
+			Burst:    p.Burst,
+		},
+	}
 }
@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN status VARCHAR(30) NOT NULL DEFAULT 'pending_verification';
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+-- Accounts that predate email verification are grandfathered in.
+UPDATE users SET status = 'active';
+
+CREATE TABLE email_verification_tokens (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(10) NOT NULL,
+    email VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX email_verification_tokens_user_id_idx ON email_verification_tokens (user_id);
@@ -0,0 +1,11 @@
+CREATE TABLE password_reset_tokens (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(10) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    request_ip VARCHAR(45),
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX password_reset_tokens_user_id_idx ON password_reset_tokens (user_id);
@@ -0,0 +1,12 @@
+-- Token buckets shared by every instance when rate_limit.store is postgres.
+-- Rows are pruned once their bucket would have refilled. Databases set up by
+-- hand may have the table without its schema_migrations row, so it is
+-- created only if missing.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_expires_at_idx ON rate_limit_buckets (expires_at);
@@ -0,0 +1,44 @@
+CREATE TABLE roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description VARCHAR(255)
+);
+
+CREATE TABLE role_permissions (
+    role VARCHAR(50) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    action VARCHAR(50) NOT NULL,
+    scope VARCHAR(10) NOT NULL CHECK (scope IN ('own', 'any')),
+    PRIMARY KEY (role, action, scope)
+);
+
+CREATE TABLE user_roles (
+    user_id VARCHAR(10) NOT NULL,
+    role VARCHAR(50) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE authz_decisions (
+    id BIGSERIAL PRIMARY KEY,
+    subject VARCHAR(50) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    resource VARCHAR(100) NOT NULL,
+    allowed BOOLEAN NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    decided_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX authz_decisions_subject_idx ON authz_decisions (subject, decided_at);
+
+-- Every user implicitly holds the "user" role; support and admin are granted
+-- through user_roles.
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Any authenticated user'),
+    ('support', 'Support staff'),
+    ('admin', 'Administrators');
+
+INSERT INTO role_permissions (role, action, scope) VALUES
+    ('user', 'users:read', 'own'),
+    ('user', 'users:update', 'own'),
+    ('support', 'users:read', 'any'),
+    ('admin', 'users:read', 'any'),
+    ('admin', 'users:update', 'any'),
+    ('admin', 'users:delete', 'any');
@@ -0,0 +1,13 @@
+CREATE TABLE refresh_tokens (
+    id VARCHAR(32) PRIMARY KEY,
+    family_id VARCHAR(32) NOT NULL,
+    user_id VARCHAR(10) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
@@ -0,0 +1,22 @@
+-- Records which migrations have been applied. "migrate" inserts each file
+-- name (without .sql) here as it applies it; migrations never record
+-- themselves, as they may run before this table exists. /readyz reports any
+-- migration shipped with the binary that is missing.
+CREATE TABLE schema_migrations (
+    version VARCHAR(255) PRIMARY KEY,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Every migration that existed before this table was added.
+INSERT INTO schema_migrations (version) VALUES
+    ('add_email_verification'),
+    ('add_password_hash_to_users'),
+    ('create_api_keys_table'),
+    ('create_mfa_tables'),
+    ('create_password_reset_tokens_table'),
+    ('create_rbac_tables'),
+    ('create_refresh_tokens_table'),
+    ('create_schema_migrations_table'),
+    ('create_sessions_table'),
+    ('create_users_table')
+ON CONFLICT (version) DO NOTHING;
@@ -0,0 +1,13 @@
+CREATE TABLE sessions (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id VARCHAR(10) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    user_agent VARCHAR(255),
+    ip VARCHAR(45),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,13 @@
+-- Access token signing keys shared by every instance. A key is published in
+-- the JWKS from created_at, signs from activated_at and keeps verifying until
+-- its retention after retired_at has passed. Private keys are encrypted with
+-- auth.signing_key_encryption_key, bound to their kid. Created only if
+-- missing, like rate_limit_buckets, for databases set up by hand.
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id VARCHAR(16) PRIMARY KEY,
+    private_key_ciphertext BYTEA NOT NULL,
+    public_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    activated_at TIMESTAMPTZ,
+    retired_at TIMESTAMPTZ
+);
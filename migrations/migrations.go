@@ -0,0 +1,37 @@
+// Package migrations embeds the SQL migrations so the server knows which
+// schema versions it expects, and so "migrate" can apply them.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
+
+// order lists every migration, by file name without .sql, in the order they
+// apply. A new migration is appended here; the tests fail for a file that
+// isn't listed.
+var order = []string{
+	"create_users_table",
+	"add_password_hash_to_users",
+	"create_refresh_tokens_table",
+	"create_api_keys_table",
+	"create_rbac_tables",
+	"add_email_verification",
+	"create_password_reset_tokens_table",
+	"create_mfa_tables",
+	"create_sessions_table",
+	"create_schema_migrations_table",
+	"create_rate_limit_buckets_table",
+	"create_signing_keys_table",
+}
+
+// Versions lists every migration in the order they apply.
+func Versions() []string {
+	return append([]string(nil), order...)
+}
+
+// SQL returns the statements of the migration.
+func SQL(version string) (string, error) {
+	b, err := FS.ReadFile(version + ".sql")
+	return string(b), err
+}
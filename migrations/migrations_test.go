@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersions(t *testing.T) {
+	files, err := fs.Glob(FS, "*.sql")
+	require.NoError(t, err)
+
+	embedded := make([]string, len(files))
+	for i, f := range files {
+		embedded[i] = strings.TrimSuffix(f, ".sql")
+	}
+
+	// Every file is applied, once, and every listed version has a file.
+	assert.ElementsMatch(t, embedded, Versions())
+}
+
+func TestSQL(t *testing.T) {
+	for _, v := range Versions() {
+		query, err := SQL(v)
+		require.NoError(t, err, v)
+		assert.NotEmpty(t, strings.TrimSpace(query), v)
+	}
+
+	_, err := SQL("missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"db_practice/handlers"
+	"db_practice/internal/apikeys"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// routeHandlers serve the API's routes.
+type routeHandlers struct {
+	health        *handlers.HealthHandler
+	metrics       http.Handler
+	apiKeys       *handlers.ApiKeysHandler
+	auth          *handlers.AuthHandler
+	passwordReset *handlers.PasswordResetHandler
+	sessions      *handlers.SessionsHandler
+	errors        *handlers.ErrorCatalogHandler
+	openAPI       *handlers.OpenAPIHandler
+	users         *handlers.UsersHandler
+	mfa           *handlers.MfaHandler
+	graphql       *handlers.GraphQLHandler
+	limiter       mux.MiddlewareFunc
+}
+
+// apiVersion is a version of the API and the routes it serves.
+type apiVersion struct {
+	handlers.APIVersion
+	register func(router *mux.Router, h routeHandlers)
+}
+
+// apiVersions are registered under their /{Name} prefix. Unversioned paths
+// are served as aliases of aliasVersion, the shape they had before versions.
+var apiVersions = []apiVersion{
+	{APIVersion: handlers.APIVersion{Name: "v1"}, register: registerV1},
+}
+
+const aliasVersion = "v1"
+
+// latestVersion is the newest API version, which links sent by email point
+// into.
+func latestVersion() string {
+	return apiVersions[len(apiVersions)-1].Name
+}
+
+// registerRoutes registers every route the API serves, and returns the
+// handler serving them under both their versioned and unversioned paths.
+// Each route needs an Endpoint in handlers.OpenAPISpec too; TestOpenAPISpec
+// fails until it has one.
+func registerRoutes(router *mux.Router, h routeHandlers) *handlers.VersionRouter {
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Welcome to the practice API")
+	})
+
+	router.HandleFunc("/healthz", h.health.Liveness).Methods("GET")
+	router.HandleFunc("/readyz", h.health.Readiness).Methods("GET")
+	router.Handle("/metrics", h.metrics).Methods("GET")
+
+	// Route names are shared between versions, so a route keeps its scope
+	// and rate limit policy in the next version.
+	router.Use(h.apiKeys.EnforceScopes(map[string]handlers.RouteScope{
+		"users.create":        {Scope: apikeys.ScopeUsersWrite},
+		"users.create_legacy": {Scope: apikeys.ScopeUsersWrite},
+		"users.get":           {Scope: apikeys.ScopeUsersRead},
+		"users.search":        {Scope: apikeys.ScopeUsersRead},
+		"users.batch_get":     {Scope: apikeys.ScopeUsersRead},
+		"users.update":        {Scope: apikeys.ScopeUsersWrite},
+		"users.delete":        {Scope: apikeys.ScopeUsersAdmin},
+		"users.verify":        {Scope: apikeys.ScopeUsersWrite},
+		// Fields needing more than read check the key themselves.
+		"graphql":        {Scope: apikeys.ScopeUsersRead},
+		"apikeys.create": {Scope: apikeys.ScopeUsersAdmin, KeyRequired: true},
+		"apikeys.list":   {Scope: apikeys.ScopeUsersAdmin, KeyRequired: true},
+		"apikeys.revoke": {Scope: apikeys.ScopeUsersAdmin, KeyRequired: true},
+	}))
+
+	// Health checks, metrics and / above stay unlimited. Routes below are
+	// limited per client, or per user once authenticated, and then checked
+	// against the OpenAPI document.
+	public := router.NewRoute().Subrouter()
+	public.Use(h.limiter, h.openAPI.Validate)
+
+	// Unversioned: key discovery, problem types and the document itself
+	// don't change shape between versions.
+	public.HandleFunc("/.well-known/jwks.json", h.auth.JWKS).Methods("GET")
+	public.HandleFunc("/errors", h.errors.ListErrors).Methods("GET")
+	public.HandleFunc("/errors/{code}", h.errors.GetError).Methods("GET")
+	public.HandleFunc("/openapi.json", h.openAPI.Spec).Methods("GET")
+	public.HandleFunc("/docs", h.openAPI.Docs).Methods("GET")
+
+	// Unversioned too: the schema evolves by adding fields rather than by
+	// versions. Anonymous callers can only sign up with createUser.
+	graphql := router.NewRoute().Subrouter()
+	graphql.Use(h.sessions.LoadSession, h.auth.OptionalAuth, h.limiter, h.openAPI.Validate)
+	graphql.HandleFunc("/graphql", h.graphql.Serve).Methods("POST").Name("graphql")
+
+	versions := make([]handlers.APIVersion, len(apiVersions))
+	for i, v := range apiVersions {
+		versioned := router.PathPrefix(handlers.VersionPath(v.Name, "")).Subrouter()
+		versioned.Use(v.Middleware)
+		v.register(versioned, h)
+		versions[i] = v.APIVersion
+	}
+	return handlers.NewVersionRouter(router, versions, aliasVersion)
+}
+
+// registerV1 registers the routes of v1 on its /v1 subrouter.
+func registerV1(router *mux.Router, h routeHandlers) {
+	public := router.NewRoute().Subrouter()
+	public.Use(h.limiter, h.openAPI.Validate)
+
+	public.HandleFunc("/admin/api-keys", h.apiKeys.CreateApiKey).Methods("POST").Name("apikeys.create")
+	public.HandleFunc("/admin/api-keys", h.apiKeys.ListApiKeys).Methods("GET").Name("apikeys.list")
+	public.HandleFunc("/admin/api-keys/{id}", h.apiKeys.RevokeApiKey).Methods("DELETE").Name("apikeys.revoke")
+
+	public.HandleFunc("/auth/login", h.auth.Login).Methods("POST")
+	public.HandleFunc("/auth/login/mfa", h.auth.LoginMfa).Methods("POST")
+	public.HandleFunc("/auth/refresh", h.auth.Refresh).Methods("POST")
+	public.HandleFunc("/auth/logout", h.auth.Logout).Methods("POST")
+
+	public.HandleFunc("/auth/password-reset", h.passwordReset.RequestReset).Methods("POST").Name("auth.password_reset")
+	public.HandleFunc("/auth/password-reset/confirm", h.passwordReset.ConfirmReset).Methods("POST")
+
+	public.HandleFunc("/auth/sessions", h.sessions.Login).Methods("POST")
+	public.HandleFunc("/auth/sessions/mfa", h.sessions.LoginMfa).Methods("POST")
+	public.HandleFunc("/auth/sessions/current", h.sessions.Logout).Methods("DELETE")
+
+	public.HandleFunc("/users", h.users.CreateUser).Methods("POST").Name("users.create")
+	// The verb route POST /users replaced.
+	public.Handle("/users/create", handlers.Deprecated(handlers.LegacyUserRoutesDeprecated, "/users", h.users.CreateUser)).
+		Methods("POST").Name("users.create_legacy")
+	public.HandleFunc("/verify", h.users.VerifyEmail).Methods("GET")
+
+	protected := router.NewRoute().Subrouter()
+	// The limiter runs after RequireAuth so it can count per user.
+	protected.Use(h.sessions.LoadSession, h.auth.RequireAuth, h.limiter, h.openAPI.Validate)
+	protected.HandleFunc("/users/search", h.users.SearchUsers).Methods("POST").Name("users.search")
+	protected.HandleFunc("/users/batch-get", h.users.BatchGetUsers).Methods("POST").Name("users.batch_get")
+	// Also serves the deprecated GET /users/{email}; see GetUser.
+	protected.HandleFunc("/users/{id}", h.users.GetUser).Methods("GET").Name("users.get")
+	protected.HandleFunc("/users/{id}", h.users.UpdateUser).Methods("PUT").Name("users.update")
+	protected.HandleFunc("/users/{id}", h.users.DeleteUser).Methods("DELETE").Name("users.delete")
+	protected.HandleFunc("/users/{id}/verify/resend", h.users.ResendVerification).Methods("POST").Name("users.verify")
+
+	protected.HandleFunc("/auth/mfa/enroll", h.mfa.Enroll).Methods("POST")
+	protected.HandleFunc("/auth/mfa/activate", h.mfa.Activate).Methods("POST")
+	protected.HandleFunc("/auth/mfa/disable", h.mfa.Disable).Methods("POST")
+	protected.HandleFunc("/auth/mfa/recovery-codes", h.mfa.RegenerateRecoveryCodes).Methods("POST")
+
+	protected.HandleFunc("/auth/sessions", h.sessions.ListSessions).Methods("GET")
+	protected.HandleFunc("/auth/sessions/{id}", h.sessions.RevokeSession).Methods("DELETE")
+}
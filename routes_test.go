@@ -0,0 +1,277 @@
+package main
+
+import (
+	"db_practice/graphqlapi"
+	"db_practice/handlers"
+	"db_practice/internal/errcatalog"
+	"db_practice/internal/openapi"
+	"db_practice/internal/rbac"
+	"db_practice/internal/users"
+	"db_practice/internal/verification"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRouter() (*mux.Router, *handlers.VersionRouter, *handlers.OpenAPIHandler) {
+	oHandler := handlers.NewOpenAPIHandler(true, true, 1<<20)
+	usersClient := &users.TestClient{CreateUserData: &users.User{Id: "u1"}}
+	schema, err := graphqlapi.NewSchema(usersClient, rbac.TestClient{}, &verification.TestClient{}, users.NewBroker(1),
+		graphqlapi.Limits{MaxDepth: 10, MaxComplexity: 1000})
+	if err != nil {
+		panic(err)
+	}
+	router := mux.NewRouter()
+	api := registerRoutes(router, routeHandlers{
+		health:        handlers.NewHealthHandler(nil),
+		metrics:       http.NotFoundHandler(),
+		apiKeys:       handlers.NewApiKeysHandler(nil),
+		auth:          handlers.NewAuthHandler(nil, nil, nil),
+		passwordReset: handlers.NewPasswordResetHandler(nil),
+		sessions:      handlers.NewSessionsHandler(nil, nil, nil, true),
+		errors:        handlers.NewErrorCatalogHandler(errcatalog.Default),
+		openAPI:       oHandler,
+		users:         handlers.NewUsersHandler(usersClient, nil, &verification.TestClient{}),
+		mfa:           handlers.NewMfaHandler(nil, nil),
+		graphql:       handlers.NewGraphQLHandler(schema),
+		limiter:       func(next http.Handler) http.Handler { return next },
+	})
+	return router, api, oHandler
+}
+
+// TestOpenAPISpec fails when a registered route has no Endpoint in
+// handlers.OpenAPISpec, or an Endpoint no longer matches a route.
+func TestOpenAPISpec(t *testing.T) {
+	router, _, _ := testRouter()
+
+	doc, err := openapi.Build(router, handlers.OpenAPISpec(true))
+	require.NoError(t, err)
+
+	for _, name := range []string{"CreateUserRequest", "User", "Error", "FieldError", "Problem"} {
+		assert.Contains(t, doc.Components.Schemas, name)
+	}
+	assert.NotContains(t, doc.Paths, "/users")
+	create := doc.Paths["/v1/users"]["post"]
+	require.NotNil(t, create)
+	assert.Equal(t, "users.create", create.OperationID)
+	assert.Equal(t, "#/components/schemas/CreateUserRequest", create.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/User", create.Responses["201"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/Problem", create.Responses["409"].Content[handlers.ProblemContentType].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/Error", create.Responses["409"].Content["application/json"].Schema.Ref)
+	assert.Contains(t, create.Responses["201"].Headers, "Location")
+	assert.True(t, doc.Paths["/v1/users/create"]["post"].Deprecated)
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	router, api, oHandler := testRouter()
+	doc, err := openapi.Build(router, handlers.OpenAPISpec(true))
+	require.NoError(t, err)
+	require.NoError(t, oHandler.Load(doc))
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var served map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &served))
+	assert.Equal(t, openapi.Version, served["openapi"])
+
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), `fetch("openapi.json")`)
+}
+
+func TestVersionedRoutes(t *testing.T) {
+	router, api, oHandler := testRouter()
+	doc, err := openapi.Build(router, handlers.OpenAPISpec(true))
+	require.NoError(t, err)
+	require.NoError(t, oHandler.Load(doc))
+
+	testCases := []struct {
+		description     string
+		method          string
+		path            string
+		accept          string
+		expectedCode    int
+		expectedWarning string
+	}{
+		{
+			description:  "Success: Versioned path",
+			method:       "POST",
+			path:         "/v1/users/create",
+			expectedCode: 400,
+		},
+		{
+			description:     "Success: Unversioned path served as v1 with a warning",
+			method:          "POST",
+			path:            "/users/create",
+			expectedCode:    400,
+			expectedWarning: `299 - "Unversioned paths are deprecated, use /v1/users/create"`,
+		},
+		{
+			description:  "Success: Unversioned path with the version asked for",
+			method:       "POST",
+			path:         "/users/create",
+			accept:       handlers.VersionMediaType("v1"),
+			expectedCode: 400,
+		},
+		{
+			description:  "Success: Unversioned route left alone",
+			method:       "GET",
+			path:         "/errors/invalid",
+			expectedCode: 200,
+		},
+		{
+			description:  "Failure: Unknown version asked for",
+			method:       "POST",
+			path:         "/users/create",
+			accept:       handlers.VersionMediaType("v9"),
+			expectedCode: 406,
+		},
+		{
+			description:  "Failure: Unversioned route isn't served under a version",
+			method:       "GET",
+			path:         "/v1/errors/invalid",
+			expectedCode: 404,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader("{}"))
+			if tc.accept != "" {
+				r.Header.Set("Accept", tc.accept)
+			}
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, r)
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Equal(t, tc.expectedWarning, w.Header().Get("Warning"))
+		})
+	}
+}
+
+func TestVerifyLinkRouted(t *testing.T) {
+	router, _, _ := testRouter()
+
+	// Verification emails link here.
+	var match mux.RouteMatch
+	r := httptest.NewRequest("GET", handlers.VersionPath(latestVersion(), "/verify")+"?token=x", nil)
+	assert.True(t, router.Match(r, &match))
+}
+
+func TestUserRoutes(t *testing.T) {
+	router, api, oHandler := testRouter()
+	doc, err := openapi.Build(router, handlers.OpenAPISpec(true))
+	require.NoError(t, err)
+	require.NoError(t, oHandler.Load(doc))
+	body := `{"first_name":"Ann","last_name":"Lee","email":"ann@example.com","address":"1 Main St",` +
+		`"city":"Springfield","state":"IL","zip":"62701","dob":"1990-01-01"}`
+
+	testCases := []struct {
+		description         string
+		path                string
+		expectedLocation    string
+		expectedDeprecation string
+		expectedLink        string
+	}{
+		{
+			description:      "Success: Created with its location",
+			path:             "/v1/users",
+			expectedLocation: "/v1/users/u1",
+		},
+		{
+			description:      "Success: Created through the unversioned alias",
+			path:             "/users",
+			expectedLocation: "/v1/users/u1",
+		},
+		{
+			description:         "Success: Legacy route still creates",
+			path:                "/v1/users/create",
+			expectedLocation:    "/v1/users/u1",
+			expectedDeprecation: handlers.DeprecationDate(handlers.LegacyUserRoutesDeprecated),
+			expectedLink:        `</v1/users>; rel="successor-version"`,
+		},
+		{
+			description:         "Success: Unversioned legacy route still creates",
+			path:                "/users/create",
+			expectedLocation:    "/v1/users/u1",
+			expectedDeprecation: handlers.DeprecationDate(handlers.LegacyUserRoutesDeprecated),
+			expectedLink:        `</v1/users>; rel="successor-version"`,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, httptest.NewRequest("POST", tc.path, strings.NewReader(body)))
+
+			assert.Equal(t, 201, w.Code)
+			assert.Equal(t, tc.expectedLocation, w.Header().Get("Location"))
+			assert.Equal(t, tc.expectedDeprecation, w.Header().Get("Deprecation"))
+			assert.Equal(t, tc.expectedLink, w.Header().Get("Link"))
+		})
+	}
+}
+
+func TestGraphQLRoute(t *testing.T) {
+	router, api, oHandler := testRouter()
+	doc, err := openapi.Build(router, handlers.OpenAPISpec(true))
+	require.NoError(t, err)
+	require.NoError(t, oHandler.Load(doc))
+
+	testCases := []struct {
+		description  string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			description: "Success: Anonymous callers can sign up",
+			body: `{"query":"mutation { createUser(input: {firstName: \"Ann\", lastName: \"Lee\", email: \"ann@example.com\", ` +
+				`address: \"1 Main St\", city: \"Springfield\", state: \"IL\", zip: \"62701\", dob: \"1990-01-01\"}) { id } }"}`,
+			expectedCode: 200,
+			expectedBody: `"data":{"createUser":{"id":"u1"}}`,
+		},
+		{
+			description:  "Failure: Other fields need a user",
+			body:         `{"query":"{ user(id: \"u1\") { id } }"}`,
+			expectedCode: 200,
+			expectedBody: `"code":"unauthorized"`,
+		},
+		{
+			description:  "Failure: Subscriptions need an event stream",
+			body:         `{"query":"subscription { userEvents { type } }"}`,
+			expectedCode: 200,
+			expectedBody: `"code":"bad_request"`,
+		},
+		{
+			description:  "Failure: Missing query",
+			body:         `{}`,
+			expectedCode: 400,
+		},
+	}
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			t.Log(tc.description)
+
+			w := httptest.NewRecorder()
+			api.ServeHTTP(w, httptest.NewRequest("POST", "/graphql", strings.NewReader(tc.body)))
+
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Empty(t, w.Header().Get("Warning"))
+			assert.Contains(t, w.Body.String(), tc.expectedBody)
+		})
+	}
+}